@@ -3,20 +3,27 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// Time zone database for stats tz, also in minimal images without /usr/share/zoneinfo.
+	_ "time/tzdata"
 
 	"github.com/viacheslaev/url-shortener/internal/config"
 	"github.com/viacheslaev/url-shortener/internal/feature/account"
 	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
 	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/feature/conversion"
 	"github.com/viacheslaev/url-shortener/internal/feature/link"
+	"github.com/viacheslaev/url-shortener/internal/feature/webhook"
+	"github.com/viacheslaev/url-shortener/internal/geoip"
 	"github.com/viacheslaev/url-shortener/internal/server"
 	"github.com/viacheslaev/url-shortener/internal/server/middleware"
+	"github.com/viacheslaev/url-shortener/internal/storage/cache"
 	"github.com/viacheslaev/url-shortener/internal/storage/postgres"
 )
 
@@ -35,37 +42,171 @@ func main() {
 	linkRepo := postgres.NewLinkRepository(db)
 	accountRepo := postgres.NewAccountRepository(db)
 	analyticsRepo := postgres.NewAnalyticsRepository(db)
+	webhookRepo := postgres.NewWebhookRepository(db)
+	apiKeyRepo := postgres.NewAPIKeyRepository(db)
+	conversionRepo := postgres.NewConversionRepository(db)
+
+	// FAILOVER + CACHE (redirect hot path)
+	linkFailover := cache.NewFailoverLinkRepository(linkRepo, cache.FailoverConfig{
+		FailureThreshold: cfg.LinkBreakerFailureThreshold,
+		OpenTimeout:      time.Duration(cfg.LinkBreakerOpenSeconds) * time.Second,
+		StaleSize:        cfg.LinkStaleCacheSize,
+		SnapshotPath:     cfg.LinkSnapshotPath,
+		SnapshotInterval: time.Duration(cfg.LinkSnapshotIntervalSeconds) * time.Second,
+	})
+	linkFailover.Start()
+	expvar.Publish("link_failover", expvar.Func(func() any { return linkFailover.Stats() }))
+
+	var linkStore link.LinkRepository = linkFailover
+	linkInvalidators := []postgres.LinkInvalidator{linkFailover}
+	if cfg.LinkCacheSize > 0 {
+		linkCache := cache.NewLinkCache(linkFailover, cache.LinkCacheConfig{
+			Size:        cfg.LinkCacheSize,
+			TTL:         time.Duration(cfg.LinkCacheTTLSeconds) * time.Second,
+			NegativeTTL: time.Duration(cfg.LinkCacheNegativeTTLSeconds) * time.Second,
+		})
+		expvar.Publish("link_cache", expvar.Func(func() any { return linkCache.Stats() }))
+		linkStore = linkCache
+		linkInvalidators = append(linkInvalidators, linkCache)
+	}
+
+	// Evicts cached and last known destinations changed by other instances
+	linkChangeListener := postgres.NewLinkChangeListener(cfg.DSN, linkInvalidators...)
+	linkChangeListener.Start()
+
+	// CLICK SPOOL (optional durable click queue)
+	var clickSpool *analytics.ClickSpool
+	if cfg.ClickSpoolDir != "" {
+		clickSpool, err = analytics.OpenClickSpool(analytics.ClickSpoolConfig{
+			Dir:          cfg.ClickSpoolDir,
+			SegmentSize:  int64(cfg.ClickSpoolSegmentMB) << 20,
+			MaxSize:      int64(cfg.ClickSpoolMaxMB) << 20,
+			SyncInterval: time.Duration(cfg.ClickSpoolSyncMillis) * time.Millisecond,
+		})
+		if err != nil {
+			log.Fatalf("failed to open click spool: %v", err)
+		}
+	}
+
+	// GEOIP (optional click locations, a nil locator resolves nothing)
+	var geoLocator *geoip.Locator
+	if cfg.GeoIPDBPath != "" {
+		geoLocator = geoip.NewLocator(cfg.GeoIPDBPath, time.Duration(cfg.GeoIPReloadIntervalSeconds)*time.Second)
+		geoLocator.Start()
+	}
+
+	// VISITORS + IP PRIVACY (pseudonymized click IPs, a nil pseudonymizer stores them as they are)
+	var ipPseudonymizer *analytics.IPPseudonymizer
+	if ipMode := analytics.IPMode(cfg.ClickIPMode); ipMode != analytics.IPModeRaw {
+		ipPseudonymizer = analytics.NewIPPseudonymizer(ipMode, analyticsRepo)
+	}
+	visitorIdentifier := analytics.NewVisitorIdentifier(analytics.VisitorStrategy(cfg.VisitorIDStrategy), ipPseudonymizer)
 
 	// SERVICE
-	analyticsService := analytics.NewAnalyticsService(analyticsRepo, linkRepo)
-	linkService := link.NewLinkService(analyticsService, linkRepo, cfg)
+	// Webhooks are queued for link and click events in the background.
+	webhookService := webhook.NewWebhookService(webhookRepo, cfg.BaseURL)
+	webhookService.Start()
+	analyticsService := analytics.NewAnalyticsService(analyticsRepo, linkRepo, clickSpool, geoLocator, visitorIdentifier, webhookService)
+	expvar.Publish("click_queue", expvar.Func(func() any { return analyticsService.QueueStats() }))
+	linkService := link.NewLinkService(analyticsService, linkStore, cfg, webhookService)
 	accountService := account.NewAccountService(accountRepo)
+	conversionService := conversion.NewConversionService(conversionRepo)
 
-	// AUTH (register/login + JWT)
+	// AUTH (register/login + JWT, API keys)
 	tokenIssuer := auth.NewTokenIssuer(cfg)
 	authService := auth.NewAuthService(accountRepo, tokenIssuer)
-	authMiddleware := middleware.NewAuthMiddleware(accountRepo, cfg)
+	apiKeyService := auth.NewAPIKeyService(apiKeyRepo)
+	authMiddleware := middleware.NewAuthMiddleware(accountRepo, apiKeyService, cfg)
 
 	// JOB
-	expiredLinksCleanupWorker := link.NewExpiredLinksCleanupWorker(linkRepo, time.Duration(cfg.ExpiredLinksCleanupIntervalHours)*time.Hour)
+	expiredLinksCleanupWorker := link.NewExpiredLinksCleanupWorker(
+		linkRepo,
+		time.Duration(cfg.ExpiredLinksCleanupIntervalHours)*time.Hour,
+		link.LinkRetentionPolicy{
+			Retention: time.Duration(cfg.LinkArchiveRetentionDays) * 24 * time.Hour,
+			BatchSize: cfg.LinkCleanupBatchSize,
+			ExportDir: cfg.LinkArchiveExportDir,
+		},
+		webhookService,
+	)
 	expiredLinksCleanupWorker.Start()
-	clickEventWorker := analytics.NewClickEventWorker(analyticsService)
+	linkHealthWorker := link.NewLinkHealthWorker(
+		linkRepo,
+		time.Duration(cfg.LinkHealthCheckIntervalMinutes)*time.Minute,
+		time.Duration(cfg.LinkHealthCheckTimeoutSeconds)*time.Second,
+		cfg.LinkHealthCheckConcurrency,
+		cfg.LinkHealthCheckBatchSize,
+		cfg.LinkHealthAllowPrivateTargets,
+		webhookService,
+	)
+	linkHealthWorker.Start()
+	clickEventWorker := analytics.NewClickEventWorker(analyticsService, analytics.ClickWorkerConfig{
+		Consumers:     cfg.ClickWorkerConsumers,
+		BatchSize:     cfg.ClickBatchSize,
+		FlushInterval: time.Duration(cfg.ClickFlushIntervalMillis) * time.Millisecond,
+	})
 	clickEventWorker.Start()
+	clickRollupWorker := analytics.NewRollupWorker(
+		analyticsRepo,
+		time.Duration(cfg.ClickRollupIntervalSeconds)*time.Second,
+		time.Duration(cfg.ClickRollupDelaySeconds)*time.Second,
+	)
+	clickRollupWorker.Start()
+	clickPartitionWorker := analytics.NewClickPartitionWorker(
+		analyticsRepo,
+		time.Duration(cfg.ClickPartitionIntervalMinutes)*time.Minute,
+		analytics.ClickRetentionPolicy{
+			MonthsAhead:     cfg.ClickPartitionMonthsAhead,
+			RetentionMonths: cfg.ClickRetentionMonths,
+			Detach:          cfg.ClickRetentionAction == "detach",
+		},
+	)
+	clickPartitionWorker.Start()
+	clickPrivacyWorker := analytics.NewPrivacyWorker(
+		analyticsRepo,
+		time.Duration(cfg.ClickPrivacyIntervalMinutes)*time.Minute,
+		analytics.PersonalDataPolicy{
+			Retention: time.Duration(cfg.ClickPersonalDataRetentionDays) * 24 * time.Hour,
+			Delete:    cfg.ClickPersonalDataAction == "delete",
+			BatchSize: cfg.LinkCleanupBatchSize,
+		},
+	)
+	clickPrivacyWorker.Start()
+	webhookDeliveryWorker := webhook.NewDeliveryWorker(
+		webhookRepo,
+		time.Duration(cfg.WebhookDeliveryIntervalSeconds)*time.Second,
+		webhook.DeliveryPolicy{
+			BatchSize:           cfg.WebhookDeliveryBatchSize,
+			Concurrency:         cfg.WebhookDeliveryConcurrency,
+			Timeout:             time.Duration(cfg.WebhookTimeoutSeconds) * time.Second,
+			MaxAttempts:         cfg.WebhookMaxAttempts,
+			RetryBackoff:        time.Duration(cfg.WebhookRetryBackoffSeconds) * time.Second,
+			Retention:           time.Duration(cfg.WebhookDeliveryRetentionDays) * 24 * time.Hour,
+			AllowPrivateTargets: cfg.WebhookAllowPrivateTargets,
+		},
+	)
+	webhookDeliveryWorker.Start()
 
 	// HANDLER
 	linkHandler := link.NewLinkHandler(cfg, linkService)
 	accRegisterHandler := account.NewAccountRegisterHandler(accountService)
 	authHandler := auth.NewAuthHandler(authService)
 	analyticsHandler := analytics.NewAnalyticsHandler(analyticsService)
+	webhookHandler := webhook.NewWebhookHandler(webhookService)
+	apiKeyHandler := auth.NewAPIKeyHandler(apiKeyService)
+	conversionHandler := conversion.NewConversionHandler(conversionService)
 
 	// ROUTER
-	router := middleware.Logging(server.NewRouter(linkHandler, accRegisterHandler, authHandler, analyticsHandler, authMiddleware))
+	router := middleware.Logging(server.NewRouter(linkHandler, accRegisterHandler, authHandler, analyticsHandler, webhookHandler,
+		apiKeyHandler, conversionHandler, authMiddleware))
 
 	// SERVER
 	srv := &http.Server{
 		Addr:    cfg.HTTPAddr,
 		Handler: router,
 	}
+	// Live click streams never end on their own, so they are closed when shutdown begins.
+	srv.RegisterOnShutdown(analyticsService.CloseClickStreams)
 
 	// Start server
 	go func() {
@@ -75,6 +216,21 @@ func main() {
 		}
 	}()
 
+	// Runtime counters are served on a separate internal listener only.
+	var debugSrv *http.Server
+	if cfg.DebugHTTPAddr != "" {
+		debugSrv = &http.Server{
+			Addr:    cfg.DebugHTTPAddr,
+			Handler: server.NewDebugRouter(),
+		}
+		go func() {
+			log.Printf("starting debug server on %s\n", cfg.DebugHTTPAddr)
+			if err := debugSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("debug http server failed: %v", err)
+			}
+		}()
+	}
+
 	// SHUTDOWN CONTEXT
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -89,9 +245,31 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server shutdown error: %v", err)
 	}
+	if debugSrv != nil {
+		if err := debugSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("debug server shutdown error: %v", err)
+		}
+	}
 
 	clickEventWorker.Stop()
+	if clickSpool != nil {
+		if err := clickSpool.Close(); err != nil {
+			log.Printf("click spool close error: %v", err)
+		}
+	}
+	if geoLocator != nil {
+		geoLocator.Stop()
+	}
+	clickRollupWorker.Stop()
+	clickPartitionWorker.Stop()
+	clickPrivacyWorker.Stop()
 	expiredLinksCleanupWorker.Stop()
+	linkHealthWorker.Stop()
+	// After the workers that notify it, so the events they queued are written.
+	webhookService.Stop()
+	webhookDeliveryWorker.Stop()
+	linkChangeListener.Stop()
+	linkFailover.Stop()
 
 	log.Println("server stopped")
 }
@@ -13,13 +13,65 @@ import (
 type Config struct {
 	ServiceName                      string
 	HTTPAddr                         string
+	DebugHTTPAddr                    string
 	BaseURL                          string
 	LogLevel                         string
 	DSN                              string
 	LinkTTLHours                     int
 	ExpiredLinksCleanupIntervalHours int
+	LinkArchiveRetentionDays         int
+	LinkCleanupBatchSize             int
+	LinkArchiveExportDir             string
 	JWTSecret                        string
 	JWTAccessTokenTTL                int
+	LinkHealthCheckIntervalMinutes   int
+	LinkHealthCheckConcurrency       int
+	LinkHealthCheckTimeoutSeconds    int
+	LinkHealthCheckBatchSize         int
+	LinkHealthAllowPrivateTargets    bool
+	LinkCacheSize                    int
+	LinkCacheTTLSeconds              int
+	LinkCacheNegativeTTLSeconds      int
+	LinkBreakerFailureThreshold      int
+	LinkBreakerOpenSeconds           int
+	LinkStaleCacheSize               int
+	LinkSnapshotPath                 string
+	LinkSnapshotIntervalSeconds      int
+	ExpiredLinkAction                string
+	ExpiredLinkFallbackURL           string
+	NotFoundAction                   string
+	NotFoundFallbackURL              string
+	ClickSpoolDir                    string
+	ClickSpoolSegmentMB              int
+	ClickSpoolMaxMB                  int
+	ClickSpoolSyncMillis             int
+	ClickWorkerConsumers             int
+	ClickBatchSize                   int
+	ClickFlushIntervalMillis         int
+	GeoIPDBPath                      string
+	GeoIPReloadIntervalSeconds       int
+	ClickRollupIntervalSeconds       int
+	ClickRollupDelaySeconds          int
+	ClickPartitionIntervalMinutes    int
+	ClickPartitionMonthsAhead        int
+	ClickRetentionMonths             int
+	ClickRetentionAction             string
+	ClickIPMode                      string
+	ClickPrivacyIntervalMinutes      int
+	ClickPersonalDataRetentionDays   int
+	ClickPersonalDataAction          string
+	VisitorIDStrategy                string
+	WebhookDeliveryIntervalSeconds   int
+	WebhookDeliveryBatchSize         int
+	WebhookDeliveryConcurrency       int
+	WebhookTimeoutSeconds            int
+	WebhookMaxAttempts               int
+	WebhookRetryBackoffSeconds       int
+	WebhookDeliveryRetentionDays     int
+	WebhookAllowPrivateTargets       bool
+	ClickIDMode                      string
+	ClickIDParam                     string
+	ClickIDCookieDomain              string
 }
 
 func Load() *Config {
@@ -30,13 +82,65 @@ func Load() *Config {
 	cfg := &Config{
 		ServiceName:                      getEnv("SERVICE_NAME"),
 		HTTPAddr:                         getEnv("HTTP_ADDR"),
+		DebugHTTPAddr:                    getEnvDefault("DEBUG_HTTP_ADDR", "127.0.0.1:6060"),
 		BaseURL:                          getEnv("BASE_URL"),
 		LogLevel:                         getEnv("LOG_LEVEL"),
 		DSN:                              getEnv("DSN"),
 		LinkTTLHours:                     getEnvInt("LINK_TTL_HOURS"),
 		ExpiredLinksCleanupIntervalHours: getEnvInt("EXPIRED_LINKS_CLEANUP_INTERVAL_HOURS"),
+		LinkArchiveRetentionDays:         getEnvIntDefault("LINK_ARCHIVE_RETENTION_DAYS", 30),
+		LinkCleanupBatchSize:             getEnvIntDefault("LINK_CLEANUP_BATCH_SIZE", 1000),
+		LinkArchiveExportDir:             getEnvDefault("LINK_ARCHIVE_EXPORT_DIR", ""),
 		JWTSecret:                        getEnv("JWT_SECRET"),
 		JWTAccessTokenTTL:                getEnvInt("JWT_ACCESS_TOKEN_TTL_HOURS"),
+		LinkHealthCheckIntervalMinutes:   getEnvIntDefault("LINK_HEALTH_CHECK_INTERVAL_MINUTES", 60),
+		LinkHealthCheckConcurrency:       getEnvIntDefault("LINK_HEALTH_CHECK_CONCURRENCY", 8),
+		LinkHealthCheckTimeoutSeconds:    getEnvIntDefault("LINK_HEALTH_CHECK_TIMEOUT_SECONDS", 10),
+		LinkHealthCheckBatchSize:         getEnvIntDefault("LINK_HEALTH_CHECK_BATCH_SIZE", 200),
+		LinkHealthAllowPrivateTargets:    getEnvBoolDefault("LINK_HEALTH_CHECK_ALLOW_PRIVATE_TARGETS", false),
+		LinkCacheSize:                    getEnvIntDefault("LINK_CACHE_SIZE", 10000),
+		LinkCacheTTLSeconds:              getEnvIntDefault("LINK_CACHE_TTL_SECONDS", 60),
+		LinkCacheNegativeTTLSeconds:      getEnvIntDefault("LINK_CACHE_NEGATIVE_TTL_SECONDS", 10),
+		LinkBreakerFailureThreshold:      getEnvIntDefault("LINK_BREAKER_FAILURE_THRESHOLD", 5),
+		LinkBreakerOpenSeconds:           getEnvIntDefault("LINK_BREAKER_OPEN_SECONDS", 30),
+		LinkStaleCacheSize:               getEnvIntDefault("LINK_STALE_CACHE_SIZE", 100000),
+		LinkSnapshotPath:                 getEnvDefault("LINK_SNAPSHOT_PATH", ""),
+		LinkSnapshotIntervalSeconds:      getEnvIntDefault("LINK_SNAPSHOT_INTERVAL_SECONDS", 300),
+		ExpiredLinkAction:                getEnvDefault("EXPIRED_LINK_ACTION", "json"),
+		ExpiredLinkFallbackURL:           getEnvDefault("EXPIRED_LINK_FALLBACK_URL", ""),
+		NotFoundAction:                   getEnvDefault("NOT_FOUND_ACTION", "json"),
+		NotFoundFallbackURL:              getEnvDefault("NOT_FOUND_FALLBACK_URL", ""),
+		ClickSpoolDir:                    getEnvDefault("CLICK_SPOOL_DIR", ""),
+		ClickSpoolSegmentMB:              getEnvIntDefault("CLICK_SPOOL_SEGMENT_MB", 16),
+		ClickSpoolMaxMB:                  getEnvIntDefault("CLICK_SPOOL_MAX_MB", 1024),
+		ClickSpoolSyncMillis:             getEnvIntDefault("CLICK_SPOOL_SYNC_MILLIS", 1000),
+		ClickWorkerConsumers:             getEnvIntDefault("CLICK_WORKER_CONSUMERS", 2),
+		ClickBatchSize:                   getEnvIntDefault("CLICK_BATCH_SIZE", 500),
+		ClickFlushIntervalMillis:         getEnvIntDefault("CLICK_FLUSH_INTERVAL_MILLIS", 1000),
+		GeoIPDBPath:                      getEnvDefault("GEOIP_DB_PATH", ""),
+		GeoIPReloadIntervalSeconds:       getEnvIntDefault("GEOIP_RELOAD_INTERVAL_SECONDS", 60),
+		ClickRollupIntervalSeconds:       getEnvIntDefault("CLICK_ROLLUP_INTERVAL_SECONDS", 60),
+		ClickRollupDelaySeconds:          getEnvIntDefault("CLICK_ROLLUP_DELAY_SECONDS", 300),
+		ClickPartitionIntervalMinutes:    getEnvIntDefault("CLICK_PARTITION_INTERVAL_MINUTES", 60),
+		ClickPartitionMonthsAhead:        getEnvIntDefault("CLICK_PARTITION_MONTHS_AHEAD", 3),
+		ClickRetentionMonths:             getEnvIntDefault("CLICK_RETENTION_MONTHS", 0),
+		ClickRetentionAction:             getEnvDefault("CLICK_RETENTION_ACTION", "drop"),
+		ClickIPMode:                      getEnvDefault("CLICK_IP_MODE", "raw"),
+		ClickPrivacyIntervalMinutes:      getEnvIntDefault("CLICK_PRIVACY_INTERVAL_MINUTES", 60),
+		ClickPersonalDataRetentionDays:   getEnvIntDefault("CLICK_PERSONAL_DATA_RETENTION_DAYS", 0),
+		ClickPersonalDataAction:          getEnvDefault("CLICK_PERSONAL_DATA_ACTION", "anonymize"),
+		VisitorIDStrategy:                getEnvDefault("VISITOR_ID_STRATEGY", "ip"),
+		WebhookDeliveryIntervalSeconds:   getEnvIntDefault("WEBHOOK_DELIVERY_INTERVAL_SECONDS", 5),
+		WebhookDeliveryBatchSize:         getEnvIntDefault("WEBHOOK_DELIVERY_BATCH_SIZE", 100),
+		WebhookDeliveryConcurrency:       getEnvIntDefault("WEBHOOK_DELIVERY_CONCURRENCY", 8),
+		WebhookTimeoutSeconds:            getEnvIntDefault("WEBHOOK_TIMEOUT_SECONDS", 10),
+		WebhookMaxAttempts:               getEnvIntDefault("WEBHOOK_MAX_ATTEMPTS", 10),
+		WebhookRetryBackoffSeconds:       getEnvIntDefault("WEBHOOK_RETRY_BACKOFF_SECONDS", 30),
+		WebhookDeliveryRetentionDays:     getEnvIntDefault("WEBHOOK_DELIVERY_RETENTION_DAYS", 14),
+		WebhookAllowPrivateTargets:       getEnvBoolDefault("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+		ClickIDMode:                      getEnvDefault("CLICK_ID_MODE", "off"),
+		ClickIDParam:                     getEnvDefault("CLICK_ID_PARAM", "click_id"),
+		ClickIDCookieDomain:              getEnvDefault("CLICK_ID_COOKIE_DOMAIN", ""),
 	}
 
 	validate(cfg)
@@ -97,6 +201,163 @@ func validate(cfg *Config) {
 	if cfg.ExpiredLinksCleanupIntervalHours <= 0 {
 		log.Fatalf("EXPIRED_LINKS_CLEANUP_INTERVAL_HOURS must be > 0 (got %d)", cfg.LinkTTLHours)
 	}
+	if cfg.LinkArchiveRetentionDays < 0 {
+		log.Fatalf("LINK_ARCHIVE_RETENTION_DAYS must be >= 0 (got %d)", cfg.LinkArchiveRetentionDays)
+	}
+	if cfg.LinkCleanupBatchSize <= 0 {
+		log.Fatalf("LINK_CLEANUP_BATCH_SIZE must be > 0 (got %d)", cfg.LinkCleanupBatchSize)
+	}
+
+	// LINK HEALTH
+	if cfg.LinkHealthCheckIntervalMinutes <= 0 {
+		log.Fatalf("LINK_HEALTH_CHECK_INTERVAL_MINUTES must be > 0 (got %d)", cfg.LinkHealthCheckIntervalMinutes)
+	}
+	if cfg.LinkHealthCheckConcurrency <= 0 {
+		log.Fatalf("LINK_HEALTH_CHECK_CONCURRENCY must be > 0 (got %d)", cfg.LinkHealthCheckConcurrency)
+	}
+	if cfg.LinkHealthCheckTimeoutSeconds <= 0 {
+		log.Fatalf("LINK_HEALTH_CHECK_TIMEOUT_SECONDS must be > 0 (got %d)", cfg.LinkHealthCheckTimeoutSeconds)
+	}
+	if cfg.LinkHealthCheckBatchSize <= 0 {
+		log.Fatalf("LINK_HEALTH_CHECK_BATCH_SIZE must be > 0 (got %d)", cfg.LinkHealthCheckBatchSize)
+	}
+
+	// LINK CACHE (LINK_CACHE_SIZE=0 disables the cache)
+	if cfg.LinkCacheSize < 0 {
+		log.Fatalf("LINK_CACHE_SIZE must be >= 0 (got %d)", cfg.LinkCacheSize)
+	}
+	if cfg.LinkCacheTTLSeconds <= 0 {
+		log.Fatalf("LINK_CACHE_TTL_SECONDS must be > 0 (got %d)", cfg.LinkCacheTTLSeconds)
+	}
+	if cfg.LinkCacheNegativeTTLSeconds < 0 {
+		log.Fatalf("LINK_CACHE_NEGATIVE_TTL_SECONDS must be >= 0 (got %d)", cfg.LinkCacheNegativeTTLSeconds)
+	}
+
+	// LINK FAILOVER (stale redirects while the database is unavailable)
+	if cfg.LinkBreakerFailureThreshold <= 0 {
+		log.Fatalf("LINK_BREAKER_FAILURE_THRESHOLD must be > 0 (got %d)", cfg.LinkBreakerFailureThreshold)
+	}
+	if cfg.LinkBreakerOpenSeconds <= 0 {
+		log.Fatalf("LINK_BREAKER_OPEN_SECONDS must be > 0 (got %d)", cfg.LinkBreakerOpenSeconds)
+	}
+	if cfg.LinkStaleCacheSize <= 0 {
+		log.Fatalf("LINK_STALE_CACHE_SIZE must be > 0 (got %d)", cfg.LinkStaleCacheSize)
+	}
+	if cfg.LinkSnapshotIntervalSeconds <= 0 {
+		log.Fatalf("LINK_SNAPSHOT_INTERVAL_SECONDS must be > 0 (got %d)", cfg.LinkSnapshotIntervalSeconds)
+	}
+
+	// CLICK WORKER
+	if cfg.ClickWorkerConsumers <= 0 {
+		log.Fatalf("CLICK_WORKER_CONSUMERS must be > 0 (got %d)", cfg.ClickWorkerConsumers)
+	}
+	if cfg.ClickBatchSize <= 0 {
+		log.Fatalf("CLICK_BATCH_SIZE must be > 0 (got %d)", cfg.ClickBatchSize)
+	}
+	if cfg.ClickFlushIntervalMillis <= 0 {
+		log.Fatalf("CLICK_FLUSH_INTERVAL_MILLIS must be > 0 (got %d)", cfg.ClickFlushIntervalMillis)
+	}
+
+	// CLICK SPOOL (only validated when enabled)
+	if cfg.ClickSpoolDir != "" {
+		if cfg.ClickSpoolSegmentMB <= 0 {
+			log.Fatalf("CLICK_SPOOL_SEGMENT_MB must be > 0 (got %d)", cfg.ClickSpoolSegmentMB)
+		}
+		if cfg.ClickSpoolMaxMB < cfg.ClickSpoolSegmentMB {
+			log.Fatalf("CLICK_SPOOL_MAX_MB must be >= CLICK_SPOOL_SEGMENT_MB (got %d)", cfg.ClickSpoolMaxMB)
+		}
+		if cfg.ClickSpoolSyncMillis <= 0 {
+			log.Fatalf("CLICK_SPOOL_SYNC_MILLIS must be > 0 (got %d)", cfg.ClickSpoolSyncMillis)
+		}
+	}
+
+	// GEOIP (only validated when enabled)
+	if cfg.GeoIPDBPath != "" && cfg.GeoIPReloadIntervalSeconds <= 0 {
+		log.Fatalf("GEOIP_RELOAD_INTERVAL_SECONDS must be > 0 (got %d)", cfg.GeoIPReloadIntervalSeconds)
+	}
+
+	// CLICK ROLLUPS
+	if cfg.ClickRollupIntervalSeconds <= 0 {
+		log.Fatalf("CLICK_ROLLUP_INTERVAL_SECONDS must be > 0 (got %d)", cfg.ClickRollupIntervalSeconds)
+	}
+	if cfg.ClickRollupDelaySeconds < 0 {
+		log.Fatalf("CLICK_ROLLUP_DELAY_SECONDS must be >= 0 (got %d)", cfg.ClickRollupDelaySeconds)
+	}
+
+	// CLICK PARTITIONS
+	if cfg.ClickPartitionIntervalMinutes <= 0 {
+		log.Fatalf("CLICK_PARTITION_INTERVAL_MINUTES must be > 0 (got %d)", cfg.ClickPartitionIntervalMinutes)
+	}
+	if cfg.ClickPartitionMonthsAhead < 1 {
+		log.Fatalf("CLICK_PARTITION_MONTHS_AHEAD must be >= 1 (got %d)", cfg.ClickPartitionMonthsAhead)
+	}
+	if cfg.ClickRetentionMonths < 0 {
+		log.Fatalf("CLICK_RETENTION_MONTHS must be >= 0 (got %d)", cfg.ClickRetentionMonths)
+	}
+	cfg.ClickRetentionAction = strings.ToLower(strings.TrimSpace(cfg.ClickRetentionAction))
+	if cfg.ClickRetentionAction != "drop" && cfg.ClickRetentionAction != "detach" {
+		log.Fatalf("CLICK_RETENTION_ACTION must be one of: drop, detach (got %q)", cfg.ClickRetentionAction)
+	}
+
+	// CLICK PRIVACY (CLICK_PERSONAL_DATA_RETENTION_DAYS=0 keeps personal data forever)
+	cfg.ClickIPMode = strings.ToLower(strings.TrimSpace(cfg.ClickIPMode))
+	if cfg.ClickIPMode != "raw" && cfg.ClickIPMode != "truncate" && cfg.ClickIPMode != "hash" {
+		log.Fatalf("CLICK_IP_MODE must be one of: raw, truncate, hash (got %q)", cfg.ClickIPMode)
+	}
+	if cfg.ClickPrivacyIntervalMinutes <= 0 {
+		log.Fatalf("CLICK_PRIVACY_INTERVAL_MINUTES must be > 0 (got %d)", cfg.ClickPrivacyIntervalMinutes)
+	}
+	if cfg.ClickPersonalDataRetentionDays < 0 {
+		log.Fatalf("CLICK_PERSONAL_DATA_RETENTION_DAYS must be >= 0 (got %d)", cfg.ClickPersonalDataRetentionDays)
+	}
+	cfg.ClickPersonalDataAction = strings.ToLower(strings.TrimSpace(cfg.ClickPersonalDataAction))
+	if cfg.ClickPersonalDataAction != "anonymize" && cfg.ClickPersonalDataAction != "delete" {
+		log.Fatalf("CLICK_PERSONAL_DATA_ACTION must be one of: anonymize, delete (got %q)", cfg.ClickPersonalDataAction)
+	}
+
+	// VISITORS
+	cfg.VisitorIDStrategy = strings.ToLower(strings.TrimSpace(cfg.VisitorIDStrategy))
+	if cfg.VisitorIDStrategy != "cookie" && cfg.VisitorIDStrategy != "ip_ua" && cfg.VisitorIDStrategy != "ip" {
+		log.Fatalf("VISITOR_ID_STRATEGY must be one of: cookie, ip_ua, ip (got %q)", cfg.VisitorIDStrategy)
+	}
+
+	// WEBHOOKS (WEBHOOK_DELIVERY_RETENTION_DAYS=0 keeps the delivery log forever)
+	if cfg.WebhookDeliveryIntervalSeconds <= 0 {
+		log.Fatalf("WEBHOOK_DELIVERY_INTERVAL_SECONDS must be > 0 (got %d)", cfg.WebhookDeliveryIntervalSeconds)
+	}
+	if cfg.WebhookDeliveryBatchSize <= 0 {
+		log.Fatalf("WEBHOOK_DELIVERY_BATCH_SIZE must be > 0 (got %d)", cfg.WebhookDeliveryBatchSize)
+	}
+	if cfg.WebhookDeliveryConcurrency <= 0 {
+		log.Fatalf("WEBHOOK_DELIVERY_CONCURRENCY must be > 0 (got %d)", cfg.WebhookDeliveryConcurrency)
+	}
+	if cfg.WebhookTimeoutSeconds <= 0 {
+		log.Fatalf("WEBHOOK_TIMEOUT_SECONDS must be > 0 (got %d)", cfg.WebhookTimeoutSeconds)
+	}
+	if cfg.WebhookMaxAttempts <= 0 {
+		log.Fatalf("WEBHOOK_MAX_ATTEMPTS must be > 0 (got %d)", cfg.WebhookMaxAttempts)
+	}
+	if cfg.WebhookRetryBackoffSeconds <= 0 {
+		log.Fatalf("WEBHOOK_RETRY_BACKOFF_SECONDS must be > 0 (got %d)", cfg.WebhookRetryBackoffSeconds)
+	}
+	if cfg.WebhookDeliveryRetentionDays < 0 {
+		log.Fatalf("WEBHOOK_DELIVERY_RETENTION_DAYS must be >= 0 (got %d)", cfg.WebhookDeliveryRetentionDays)
+	}
+
+	// CLICK IDS (handed to destinations for conversion attribution)
+	cfg.ClickIDMode = strings.ToLower(strings.TrimSpace(cfg.ClickIDMode))
+	if cfg.ClickIDMode != "off" && cfg.ClickIDMode != "query" && cfg.ClickIDMode != "cookie" {
+		log.Fatalf("CLICK_ID_MODE must be one of: off, query, cookie (got %q)", cfg.ClickIDMode)
+	}
+	cfg.ClickIDParam = strings.TrimSpace(cfg.ClickIDParam)
+	if cfg.ClickIDParam == "" || strings.ContainsAny(cfg.ClickIDParam, " \t;,=&?#") {
+		log.Fatalf("CLICK_ID_PARAM must be a non-empty name without spaces or ;,=&?# (got %q)", cfg.ClickIDParam)
+	}
+	cfg.ClickIDCookieDomain = strings.TrimSpace(cfg.ClickIDCookieDomain)
+
+	// EXPIRED / NOT FOUND behavior
+	cfg.ExpiredLinkAction = validateUnavailableAction("EXPIRED_LINK", cfg.ExpiredLinkAction, cfg.ExpiredLinkFallbackURL)
+	cfg.NotFoundAction = validateUnavailableAction("NOT_FOUND", cfg.NotFoundAction, cfg.NotFoundFallbackURL)
 
 	// JWT
 	if strings.TrimSpace(cfg.JWTSecret) == "" {
@@ -115,6 +376,22 @@ func validate(cfg *Config) {
 	}
 }
 
+// validateUnavailableAction validates <prefix>_ACTION and <prefix>_FALLBACK_URL pair and returns normalized action.
+func validateUnavailableAction(prefix string, action string, fallbackURL string) string {
+	action = strings.ToLower(strings.TrimSpace(action))
+	switch action {
+	case "json", "html":
+	case "redirect":
+		u, err := url.Parse(fallbackURL)
+		if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+			log.Fatalf("%s_FALLBACK_URL must be a valid http/https URL when %s_ACTION=redirect (got %q)", prefix, prefix, fallbackURL)
+		}
+	default:
+		log.Fatalf("%s_ACTION must be one of: json, html, redirect (got %q)", prefix, action)
+	}
+	return action
+}
+
 func getEnvInt(key string) int {
 	v := getEnv(key)
 	i, err := strconv.Atoi(v)
@@ -123,3 +400,38 @@ func getEnvInt(key string) int {
 	}
 	return i
 }
+
+// getEnvDefault returns the env value or def when the variable is not set.
+func getEnvDefault(key string, def string) string {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return def
+	}
+	return v
+}
+
+// getEnvIntDefault returns the env value as int or def when the variable is not set.
+func getEnvIntDefault(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("env %s must be an integer (got %q)", key, v)
+	}
+	return i
+}
+
+// getEnvBoolDefault returns the env value as bool or def when the variable is not set.
+func getEnvBoolDefault(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		log.Fatalf("env %s must be a boolean (got %q)", key, v)
+	}
+	return b
+}
@@ -1,25 +1,345 @@
 package analytics
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
 
 type dayCount struct {
 	Date  string `json:"date"`
 	Count int64  `json:"count"`
 }
 
+type bucketCount struct {
+	Start string `json:"start"`
+	Count int64  `json:"count"`
+}
+
+type referrerDomainCount struct {
+	Domain string `json:"domain"`
+	Count  int64  `json:"count"`
+}
+
+type referrerCount struct {
+	Referrer string `json:"referrer"`
+	Count    int64  `json:"count"`
+}
+
+type valueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type revenueResponse struct {
+	Currency string      `json:"currency"`
+	Amount   json.Number `json:"amount"`
+}
+
+type conversionsResponse struct {
+	Count           int64             `json:"count"`
+	ConvertedClicks int64             `json:"converted_clicks"`
+	Rate            *float64          `json:"rate"`
+	Revenue         []revenueResponse `json:"revenue"`
+}
+
 type StatsResponse struct {
-	TotalClicks  int64      `json:"total_clicks"`
-	UniqueClicks int64      `json:"unique_clicks"`
-	ByDay        []dayCount `json:"by_day"`
+	TotalClicks  int64 `json:"total_clicks"`
+	UniqueClicks int64 `json:"unique_clicks"`
+	// FirstTimeVisitors and ReturningVisitors split the unique visitors by whether they clicked before From.
+	FirstTimeVisitors int64         `json:"first_time_visitors"`
+	ReturningVisitors int64         `json:"returning_visitors"`
+	From              string        `json:"from"`
+	To                string        `json:"to"`
+	Granularity       Granularity   `json:"granularity"`
+	Timezone          string        `json:"timezone"`
+	Series            []bucketCount `json:"series"`
+	// ByDay predates Series and is only filled for day granularity.
+	ByDay              []dayCount            `json:"by_day"`
+	TopReferrerDomains []referrerDomainCount `json:"top_referrer_domains"`
+	TopReferrers       []referrerCount       `json:"top_referrers"`
+	ByBrowser          []valueCount          `json:"by_browser"`
+	ByOS               []valueCount          `json:"by_os"`
+	ByDevice           []valueCount          `json:"by_device"`
+	ByCountry          []valueCount          `json:"by_country"`
+	Conversions        conversionsResponse   `json:"conversions"`
+	Comparison         *comparisonResponse   `json:"comparison,omitempty"`
 }
 
 type Stats struct {
+	TotalClicks int64
+	// UniqueClicks is the number of unique visitors (see VisitorStrategy).
+	UniqueClicks int64
+	// FirstTimeVisitors clicked the scope for the first time in [From, To); the other unique visitors are returning.
+	FirstTimeVisitors int64
+	ReturningVisitors int64
+	From              time.Time
+	To                time.Time
+	// Series has a bucket for every period of [From, To), including empty ones.
+	Series []Bucket
+	// TopReferrerDomains counts clicks per normalized referer host; DirectReferrer stands for no referer.
+	TopReferrerDomains []ValueCount
+	// TopReferrers counts clicks per full referer URL, direct traffic excluded.
+	TopReferrers []ValueCount
+	// ByBrowser, ByOS and ByDevice count clicks per User-Agent family; UnknownValue stands for clicks stored before parsing.
+	ByBrowser []ValueCount
+	ByOS      []ValueCount
+	ByDevice  []ValueCount
+	// ByCountry counts clicks per ISO country code; UnknownValue stands for unlocated clicks.
+	ByCountry []ValueCount
+	// Conversions are attributed to the clicks of the scope and counted by the time they were recorded.
+	Conversions ConversionStats
+	// Comparison is set when the previous period was requested.
+	Comparison *Comparison
+}
+
+// ConversionStats are the conversions of a scope in [From, To).
+type ConversionStats struct {
+	Count int64
+	// ConvertedClicks is the number of distinct clicks with a conversion.
+	ConvertedClicks int64
+	// Rate is the percentage of converted clicks among the clicks of the period, nil without clicks.
+	Rate *float64
+	// Revenue sums the conversion values per currency, ordered by currency.
+	Revenue []Revenue
+}
+
+// Revenue is the sum of conversion values in a currency, as a decimal number.
+type Revenue struct {
+	Currency string
+	Amount   string
+}
+
+// Overview is the account-wide Stats with the busiest links and the change since the previous period.
+type Overview struct {
+	Stats
+	TopLinks []LinkCount
+	Trend    Trend
+}
+
+// LinkCount is the number of clicks of a link.
+type LinkCount struct {
+	ShortCode    string
+	LongURL      string
 	TotalClicks  int64
 	UniqueClicks int64
-	ByDay        []DayCount
 }
 
-type DayCount struct {
-	Date  time.Time
+// Totals are the click counts of a period.
+type Totals struct {
+	TotalClicks  int64
+	UniqueClicks int64
+}
+
+// Trend compares the requested period with the one of equal length right before it.
+type Trend struct {
+	PreviousFrom time.Time
+	PreviousTo   time.Time
+	TotalClicks  Change
+	UniqueClicks Change
+}
+
+// Comparison is a Trend with the previous period's series aligned to the current one.
+type Comparison struct {
+	Trend
+	Series []ShiftedBucket
+}
+
+// ShiftedBucket is a bucket of the previous period moved onto the bucket at the same position
+// of the current series, so both can be drawn on one chart.
+type ShiftedBucket struct {
+	Start         time.Time // start of the current bucket
+	PreviousStart time.Time
+	Count         int64
+}
+
+// Change is a metric in the current and the previous period.
+type Change struct {
+	Current  int64
+	Previous int64
+	Delta    int64
+	// Percent is the relative change, nil when the previous period has nothing to compare with.
+	Percent *float64
+}
+
+// ValueCount is the number of clicks with a given value of a dimension.
+type ValueCount struct {
+	Value string
+	Count int64
+}
+
+// Bucket is the number of clicks in the period starting at Start.
+type Bucket struct {
+	Start time.Time
 	Count int64
 }
+
+type topLink struct {
+	ShortCode    string `json:"short_code"`
+	LongURL      string `json:"long_url"`
+	TotalClicks  int64  `json:"total_clicks"`
+	UniqueClicks int64  `json:"unique_clicks"`
+}
+
+type changeResponse struct {
+	Current  int64    `json:"current"`
+	Previous int64    `json:"previous"`
+	Delta    int64    `json:"delta"`
+	Percent  *float64 `json:"percent"`
+}
+
+type trendsResponse struct {
+	PreviousFrom string         `json:"previous_from"`
+	PreviousTo   string         `json:"previous_to"`
+	TotalClicks  changeResponse `json:"total_clicks"`
+	UniqueClicks changeResponse `json:"unique_clicks"`
+}
+
+type shiftedBucketCount struct {
+	Start         string `json:"start"`
+	PreviousStart string `json:"previous_start"`
+	Count         int64  `json:"count"`
+}
+
+type comparisonResponse struct {
+	trendsResponse
+	Series []shiftedBucketCount `json:"series"`
+}
+
+type OverviewResponse struct {
+	StatsResponse
+	TopLinks []topLink      `json:"top_links"`
+	Trends   trendsResponse `json:"trends"`
+}
+
+func createStatsResponse(stats Stats, timeRange TimeRange) StatsResponse {
+	resp := StatsResponse{
+		TotalClicks:       stats.TotalClicks,
+		UniqueClicks:      stats.UniqueClicks,
+		FirstTimeVisitors: stats.FirstTimeVisitors,
+		ReturningVisitors: stats.ReturningVisitors,
+		From:              stats.From.Format(time.RFC3339),
+		To:                stats.To.Format(time.RFC3339),
+		Granularity:       timeRange.Granularity,
+		Timezone:          timeRange.Location.String(),
+		Series:            make([]bucketCount, 0, len(stats.Series)),
+		ByDay:             make([]dayCount, 0),
+	}
+	for _, b := range stats.Series {
+		resp.Series = append(resp.Series, bucketCount{Start: b.Start.Format(time.RFC3339), Count: b.Count})
+		if timeRange.Granularity == GranularityDay {
+			resp.ByDay = append(resp.ByDay, dayCount{Date: b.Start.Format("2006-01-02"), Count: b.Count})
+		}
+	}
+	resp.TopReferrerDomains = make([]referrerDomainCount, 0, len(stats.TopReferrerDomains))
+	for _, d := range stats.TopReferrerDomains {
+		resp.TopReferrerDomains = append(resp.TopReferrerDomains, referrerDomainCount{Domain: d.Value, Count: d.Count})
+	}
+	resp.TopReferrers = make([]referrerCount, 0, len(stats.TopReferrers))
+	for _, ref := range stats.TopReferrers {
+		resp.TopReferrers = append(resp.TopReferrers, referrerCount{Referrer: ref.Value, Count: ref.Count})
+	}
+	resp.ByBrowser = createValueCounts(stats.ByBrowser)
+	resp.ByOS = createValueCounts(stats.ByOS)
+	resp.ByDevice = createValueCounts(stats.ByDevice)
+	resp.ByCountry = createValueCounts(stats.ByCountry)
+	resp.Conversions = createConversionsResponse(stats.Conversions)
+	if stats.Comparison != nil {
+		resp.Comparison = createComparisonResponse(*stats.Comparison)
+	}
+	return resp
+}
+
+func createTrendsResponse(trend Trend) trendsResponse {
+	return trendsResponse{
+		PreviousFrom: trend.PreviousFrom.Format(time.RFC3339),
+		PreviousTo:   trend.PreviousTo.Format(time.RFC3339),
+		TotalClicks:  changeResponse(trend.TotalClicks),
+		UniqueClicks: changeResponse(trend.UniqueClicks),
+	}
+}
+
+func createComparisonResponse(comparison Comparison) *comparisonResponse {
+	resp := &comparisonResponse{
+		trendsResponse: createTrendsResponse(comparison.Trend),
+		Series:         make([]shiftedBucketCount, 0, len(comparison.Series)),
+	}
+	for _, b := range comparison.Series {
+		resp.Series = append(resp.Series, shiftedBucketCount{
+			Start:         b.Start.Format(time.RFC3339),
+			PreviousStart: b.PreviousStart.Format(time.RFC3339),
+			Count:         b.Count,
+		})
+	}
+	return resp
+}
+
+func createConversionsResponse(conversions ConversionStats) conversionsResponse {
+	resp := conversionsResponse{
+		Count:           conversions.Count,
+		ConvertedClicks: conversions.ConvertedClicks,
+		Rate:            conversions.Rate,
+		Revenue:         make([]revenueResponse, 0, len(conversions.Revenue)),
+	}
+	for _, r := range conversions.Revenue {
+		resp.Revenue = append(resp.Revenue, revenueResponse{Currency: r.Currency, Amount: json.Number(r.Amount)})
+	}
+	return resp
+}
+
+func createValueCounts(values []ValueCount) []valueCount {
+	resp := make([]valueCount, 0, len(values))
+	for _, v := range values {
+		resp = append(resp, valueCount{Value: v.Value, Count: v.Count})
+	}
+	return resp
+}
+
+func createOverviewResponse(overview Overview, timeRange TimeRange) OverviewResponse {
+	resp := OverviewResponse{
+		StatsResponse: createStatsResponse(overview.Stats, timeRange),
+		TopLinks:      make([]topLink, 0, len(overview.TopLinks)),
+		Trends:        createTrendsResponse(overview.Trend),
+	}
+	for _, l := range overview.TopLinks {
+		resp.TopLinks = append(resp.TopLinks, topLink(l))
+	}
+	return resp
+}
+
+// liveClickResponse is the data of a "click" event of the live click stream. It carries no personal data.
+type liveClickResponse struct {
+	ShortCode      string           `json:"short_code"`
+	OccurredAt     string           `json:"occurred_at"`
+	TrafficType    link.TrafficType `json:"traffic_type"`
+	ReferrerDomain string           `json:"referrer_domain"`
+	Country        string           `json:"country"`
+	City           string           `json:"city"`
+	Browser        string           `json:"browser"`
+	OS             string           `json:"os"`
+	Device         string           `json:"device"`
+}
+
+// droppedClicksResponse is the data of a "dropped" event: clicks skipped because the client fell behind.
+type droppedClicksResponse struct {
+	Dropped int64 `json:"dropped"`
+}
+
+func createLiveClickResponse(shortCode string, c Click) liveClickResponse {
+	trafficType := c.TrafficType
+	if trafficType == "" {
+		trafficType = link.TrafficHuman
+	}
+	return liveClickResponse{
+		ShortCode:      shortCode,
+		OccurredAt:     c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		TrafficType:    trafficType,
+		ReferrerDomain: c.RefererDomain,
+		Country:        c.Country,
+		City:           c.City,
+		Browser:        c.Browser,
+		OS:             c.OS,
+		Device:         c.Device,
+	}
+}
@@ -4,4 +4,9 @@ import "errors"
 
 var (
 	ErrAnalyticsNotFound = errors.New("analytics not found")
+	ErrInvalidStatsRange = errors.New("invalid stats range")
+	ErrClickStreamClosed = errors.New("click stream closed")
+	// ErrClicksRejected is returned by SaveClicks when the database refuses the clicks themselves
+	// (invalid data, constraint violations): storing the same clicks again can't succeed.
+	ErrClicksRejected = errors.New("clicks rejected by storage")
 )
@@ -0,0 +1,150 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// maxExportRange bounds the time range of a clicks export; longer periods are exported in several requests.
+const maxExportRange = 93 * 24 * time.Hour
+
+// ExportFormat is the file format of a clicks export.
+type ExportFormat string
+
+const (
+	ExportCSV    ExportFormat = "csv"
+	ExportNDJSON ExportFormat = "ndjson"
+)
+
+func parseExportFormat(param string) (ExportFormat, error) {
+	switch f := ExportFormat(param); f {
+	case "":
+		return ExportCSV, nil
+	case ExportCSV, ExportNDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid format %q", param)
+	}
+}
+
+// ContentType returns the media type of the format.
+func (f ExportFormat) ContentType() string {
+	if f == ExportNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+var exportColumns = []string{
+	"short_code", "clicked_at", "ip", "user_agent", "referer", "referer_domain",
+	"browser", "os", "device", "country", "region", "city", "traffic_type",
+}
+
+// clickWriter encodes exported clicks in one of the export formats.
+type clickWriter interface {
+	write(c ExportedClick) error
+	// flush writes buffered rows and reports the first error of the export.
+	flush() error
+}
+
+func newClickWriter(format ExportFormat, w io.Writer) (clickWriter, error) {
+	if format == ExportNDJSON {
+		return &ndjsonClickWriter{enc: json.NewEncoder(w)}, nil
+	}
+
+	cw := &csvClickWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+type csvClickWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvClickWriter) write(c ExportedClick) error {
+	return cw.w.Write([]string{
+		c.ShortCode, c.CreatedAt.UTC().Format(time.RFC3339Nano), c.IPAddress, c.UserAgent, c.Referer, c.RefererDomain,
+		c.Browser, c.OS, c.Device, c.Country, c.Region, c.City, string(c.TrafficType),
+	})
+}
+
+func (cw *csvClickWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonClickWriter struct {
+	enc *json.Encoder
+}
+
+type exportedClickJSON struct {
+	ShortCode     string    `json:"short_code"`
+	ClickedAt     time.Time `json:"clicked_at"`
+	IP            string    `json:"ip"`
+	UserAgent     string    `json:"user_agent"`
+	Referer       string    `json:"referer"`
+	RefererDomain string    `json:"referer_domain"`
+	Browser       string    `json:"browser"`
+	OS            string    `json:"os"`
+	Device        string    `json:"device"`
+	Country       string    `json:"country"`
+	Region        string    `json:"region"`
+	City          string    `json:"city"`
+	TrafficType   string    `json:"traffic_type"`
+}
+
+func (nw *ndjsonClickWriter) write(c ExportedClick) error {
+	return nw.enc.Encode(exportedClickJSON{
+		ShortCode:     c.ShortCode,
+		ClickedAt:     c.CreatedAt.UTC(),
+		IP:            c.IPAddress,
+		UserAgent:     c.UserAgent,
+		Referer:       c.Referer,
+		RefererDomain: c.RefererDomain,
+		Browser:       c.Browser,
+		OS:            c.OS,
+		Device:        c.Device,
+		Country:       c.Country,
+		Region:        c.Region,
+		City:          c.City,
+		TrafficType:   string(c.TrafficType),
+	})
+}
+
+// flush is a no-op: the encoder writes every row through.
+func (nw *ndjsonClickWriter) flush() error { return nil }
+
+// ipHasher pseudonymizes exported IPs with HMAC-SHA256 under a random key of a single export.
+// Equal IPs get equal hashes within the file, so unique visitors can still be counted, but the
+// key is never stored: hashes can't be reversed by enumerating addresses or joined across exports.
+type ipHasher struct {
+	mac hash.Hash
+}
+
+func newIPHasher() (*ipHasher, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &ipHasher{mac: hmac.New(sha256.New, key)}, nil
+}
+
+// hash returns the first 16 bytes of the HMAC in hex, empty for a missing IP.
+func (h *ipHasher) hash(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	h.mac.Reset()
+	h.mac.Write([]byte(ip))
+	return hex.EncodeToString(h.mac.Sum(nil)[:16])
+}
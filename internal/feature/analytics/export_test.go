@@ -0,0 +1,162 @@
+package analytics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+func TestAnalyticsService_ExportLinkClicks_HashesIPs(t *testing.T) {
+	clicks := []ExportedClick{
+		{ShortCode: "abc", CreatedAt: time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC), IPAddress: "203.0.113.7", UserAgent: "curl/8.0", TrafficType: link.TrafficHuman},
+		{ShortCode: "abc", CreatedAt: time.Date(2026, 1, 10, 9, 5, 0, 0, time.UTC), IPAddress: "203.0.113.7", Country: "DE", TrafficType: link.TrafficHuman},
+		{ShortCode: "abc", CreatedAt: time.Date(2026, 1, 10, 9, 6, 0, 0, time.UTC), IPAddress: "198.51.100.1", TrafficType: link.TrafficBot},
+	}
+	from := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	analyticsRepo := &mockAnalyticsRepo{
+		streamClicksFunc: func(ctx context.Context, query ExportQuery, fn func(ExportedClick) error) error {
+			want := ExportQuery{Scope: ClickScope{LinkID: 7}, From: from, To: to, IncludeBots: true}
+			if query != want {
+				t.Fatalf("query = %+v, want %+v", query, want)
+			}
+			for _, c := range clicks {
+				if err := fn(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	linksRepo := &mockLinksRepo{getLinkIdFunc: func(ctx context.Context, code string, acc string) (int64, error) {
+		return 7, nil
+	}}
+	service := NewAnalyticsService(analyticsRepo, linksRepo, nil, nil, nil, nil)
+
+	var buf bytes.Buffer
+	opts := ExportOptions{From: from, To: to, Format: ExportCSV, IncludeBots: true}
+	if err := service.ExportLinkClicks(context.Background(), "acc", "abc", opts, &buf); err != nil {
+		t.Fatalf("ExportLinkClicks error: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("records = %d, want header and 3 rows", len(records))
+	}
+	if records[0][2] != "ip" || records[1][1] != "2026-01-10T09:00:00Z" || records[2][9] != "DE" || records[3][12] != "bot" {
+		t.Fatalf("unexpected rows: %q", records)
+	}
+
+	first, second, other := records[1][2], records[2][2], records[3][2]
+	if first == "203.0.113.7" || len(first) != 32 {
+		t.Fatalf("ip = %q, want a hash", first)
+	}
+	if first != second || first == other {
+		t.Fatalf("hashes = %q, %q, %q: equal IPs must share a hash, different IPs must not", first, second, other)
+	}
+}
+
+func TestAnalyticsService_ExportAccountClicks_RejectsLongRange(t *testing.T) {
+	service := NewAnalyticsService(&mockAnalyticsRepo{}, &mockLinksRepo{}, nil, nil, nil, nil)
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	opts := ExportOptions{From: from, To: from.AddDate(1, 0, 0), Format: ExportCSV}
+	err := service.ExportAccountClicks(context.Background(), "acc", opts, &buf)
+
+	if !errors.Is(err, ErrInvalidStatsRange) {
+		t.Fatalf("expected ErrInvalidStatsRange, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing written, got %q", buf.String())
+	}
+}
+
+func TestAnalyticsHandler_ExportLinkClicks_Gzip(t *testing.T) {
+	analyticsRepo := &mockAnalyticsRepo{
+		streamClicksFunc: func(ctx context.Context, query ExportQuery, fn func(ExportedClick) error) error {
+			return fn(ExportedClick{ShortCode: "abc", CreatedAt: time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC), IPAddress: "203.0.113.7", TrafficType: link.TrafficHuman})
+		},
+	}
+	linksRepo := &mockLinksRepo{getLinkIdFunc: func(ctx context.Context, code string, acc string) (int64, error) {
+		if code != "abc" {
+			return 0, link.ErrNotFound
+		}
+		return 7, nil
+	}}
+	handler := NewAnalyticsHandler(NewAnalyticsService(analyticsRepo, linksRepo, nil, nil, nil, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/links/{code}/clicks/export", handler.ExportLinkClicks)
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br;q=0.5")
+		req = req.WithContext(auth.WithAccountPublicID(req.Context(), "acc"))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/links/abc/clicks/export?from=2026-01-10&to=2026-01-10&format=ndjson&ip=raw")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="clicks-abc.ndjson"` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("read gzip body: %v", err)
+	}
+	if !bytes.Contains(body, []byte(`"ip":"203.0.113.7"`)) || bytes.Count(body, []byte("\n")) != 1 {
+		t.Fatalf("body = %s, want one NDJSON row with the raw IP", body)
+	}
+
+	rec = get("/api/v1/links/missing/clicks/export?from=2026-01-10")
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("unknown link: status = %d, headers %v", rec.Code, rec.Header())
+	}
+
+	rec = get("/api/v1/links/abc/clicks/export?from=2026-01-10&format=xlsx")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad format: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"deflate, GZIP":     true,
+		"gzip;q=0.8, br":    true,
+		"gzip;q=0, deflate": false,
+		"identity":          false,
+		"x-gzip":            false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
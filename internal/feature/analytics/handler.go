@@ -1,13 +1,20 @@
 package analytics
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
 	"github.com/viacheslaev/url-shortener/internal/server/httpx"
 )
 
@@ -21,7 +28,8 @@ func NewAnalyticsHandler(service *AnalyticsService) *AnalyticsHandler {
 }
 
 // GetStats returns aggregated analytics for a short link.
-// Route: GET /api/v1/links/{code}/stats?days=30
+// Route: GET /api/v1/links/{code}/stats?days=30&include_bots=false&domains_limit=10&referrers_limit=10
+// or GET /api/v1/links/{code}/stats?from=2026-01-01&to=2026-01-31&granularity=day&tz=Europe/Berlin&compare=previous
 // Access: owner only (by JWT subject == accounts.public_id).
 func (handler *AnalyticsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	accPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
@@ -36,18 +44,21 @@ func (handler *AnalyticsHandler) GetStats(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	days, err := parseDays(r.URL.Query().Get("days"))
+	opts, err := parseStatsOptions(r.URL.Query())
 	if err != nil {
-		httpx.WriteErr(w, http.StatusBadRequest, "invalid days parameter")
+		httpx.WriteErr(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	stats, err := handler.analyticsService.GetLinkAnalytics(r.Context(), accPublicId, shortCode, days)
+	stats, err := handler.analyticsService.GetLinkAnalytics(r.Context(), accPublicId, shortCode, opts)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrAnalyticsNotFound):
 			httpx.WriteErr(w, http.StatusNotFound, "analytics not found")
 			return
+		case errors.Is(err, ErrInvalidStatsRange):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+			return
 		default:
 			log.Printf("GetStats failed: %v", err)
 			httpx.WriteErr(w, http.StatusInternalServerError, "failed to get analytics")
@@ -55,16 +66,375 @@ func (handler *AnalyticsHandler) GetStats(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	resp := StatsResponse{
-		TotalClicks:  stats.TotalClicks,
-		UniqueClicks: stats.UniqueClicks,
-		ByDay:        make([]dayCount, 0, len(stats.ByDay)),
+	httpx.WriteResponse(w, http.StatusOK, createStatsResponse(stats, opts.TimeRange))
+}
+
+// GetOverview returns analytics aggregated over all links of the account.
+// Route: GET /api/v1/analytics/overview?days=30&links_limit=10 (plus the range, bots and limits parameters of GetStats)
+// Access: authenticated account.
+func (handler *AnalyticsHandler) GetOverview(w http.ResponseWriter, r *http.Request) {
+	accPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	statsOpts, err := parseStatsOptions(query)
+	if err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	linksLimit, err := parseLimit(query.Get("links_limit"))
+	if err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid links_limit parameter")
+		return
+	}
+
+	overview, err := handler.analyticsService.GetAccountOverview(r.Context(), accPublicId, OverviewOptions{
+		StatsOptions: statsOpts,
+		LinksLimit:   linksLimit,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidStatsRange):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("GetOverview failed: %v", err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to get analytics overview")
+		}
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createOverviewResponse(overview, statsOpts.TimeRange))
+}
+
+// ExportLinkClicks downloads the raw clicks of a short link.
+// Route: GET /api/v1/links/{code}/clicks/export?from=2026-01-01&to=2026-01-31&tz=Europe/Berlin&format=csv&ip=hashed
+// Access: owner only (by JWT subject == accounts.public_id).
+func (handler *AnalyticsHandler) ExportLinkClicks(w http.ResponseWriter, r *http.Request) {
+	accPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	shortCode := r.PathValue("code")
+	if shortCode == "" {
+		httpx.WriteErr(w, http.StatusBadRequest, "missing shortCode")
+		return
+	}
+
+	handler.exportClicks(w, r, "clicks-"+shortCode, func(out io.Writer, opts ExportOptions) error {
+		return handler.analyticsService.ExportLinkClicks(r.Context(), accPublicId, shortCode, opts, out)
+	})
+}
+
+// ExportAccountClicks downloads the raw clicks of all links of the account.
+// Route: GET /api/v1/analytics/clicks/export (same parameters as ExportLinkClicks)
+// Access: authenticated account.
+func (handler *AnalyticsHandler) ExportAccountClicks(w http.ResponseWriter, r *http.Request) {
+	accPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	handler.exportClicks(w, r, "clicks", func(out io.Writer, opts ExportOptions) error {
+		return handler.analyticsService.ExportAccountClicks(r.Context(), accPublicId, opts, out)
+	})
+}
+
+// streamHeartbeatInterval is how often an idle click stream sends a comment, which keeps proxies
+// from timing it out and detects clients that went away.
+const streamHeartbeatInterval = 15 * time.Second
+
+// StreamLinkClicks pushes the clicks of a short link as Server-Sent Events as soon as they are stored.
+// Route: GET /api/v1/links/{code}/clicks/stream?include_bots=false
+// Access: owner only (by JWT subject == accounts.public_id).
+// Events are "click", and "dropped" with the number of clicks skipped because the client fell behind.
+func (handler *AnalyticsHandler) StreamLinkClicks(w http.ResponseWriter, r *http.Request) {
+	accPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	shortCode := r.PathValue("code")
+	if shortCode == "" {
+		httpx.WriteErr(w, http.StatusBadRequest, "missing shortCode")
+		return
+	}
+
+	includeBots, err := parseIncludeBots(r.URL.Query().Get("include_bots"))
+	if err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid include_bots parameter")
+		return
+	}
+
+	sub, err := handler.analyticsService.subscribeLinkClicks(r.Context(), accPublicId, shortCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAnalyticsNotFound):
+			httpx.WriteErr(w, http.StatusNotFound, "analytics not found")
+		case errors.Is(err, ErrClickStreamClosed):
+			httpx.WriteErr(w, http.StatusServiceUnavailable, "server is shutting down")
+		default:
+			log.Printf("StreamLinkClicks failed: %v", err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to stream clicks")
+		}
+		return
+	}
+	defer handler.analyticsService.unsubscribeClicks(sub)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disables response buffering of nginx
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("StreamLinkClicks cannot flush: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case c, ok := <-sub.clicks:
+			if !ok {
+				return
+			}
+			if !includeBots && c.TrafficType != "" && c.TrafficType != link.TrafficHuman {
+				continue
+			}
+			err = writeEvent(w, "click", createLiveClickResponse(shortCode, c))
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": ping\n\n")
+		}
+
+		if dropped := sub.dropped.Swap(0); err == nil && dropped > 0 {
+			err = writeEvent(w, "dropped", droppedClicksResponse{Dropped: dropped})
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event with v as JSON data.
+func writeEvent(w io.Writer, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// exportClicks parses the export parameters and streams the export written by run as a download,
+// gzip-compressed when the client accepts it.
+func (handler *AnalyticsHandler) exportClicks(w http.ResponseWriter, r *http.Request, name string, run func(io.Writer, ExportOptions) error) {
+	opts, err := parseExportOptions(r.URL.Query())
+	if err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out := &exportResponse{
+		w:           w,
+		filename:    name + "." + string(opts.Format),
+		contentType: opts.Format.ContentType(),
+		gzip:        acceptsGzip(r.Header.Get("Accept-Encoding")),
+	}
+	if err := run(out, opts); err != nil {
+		if out.started {
+			// The status is already sent: abort the connection so the client sees a truncated
+			// download instead of a complete-looking file.
+			log.Printf("ExportClicks failed mid-stream: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+
+		switch {
+		case errors.Is(err, ErrAnalyticsNotFound):
+			httpx.WriteErr(w, http.StatusNotFound, "analytics not found")
+		case errors.Is(err, ErrInvalidStatsRange):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("ExportClicks failed: %v", err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to export clicks")
+		}
+		return
+	}
+
+	if err := out.close(); err != nil {
+		log.Printf("ExportClicks failed to finish response: %v", err)
+	}
+}
+
+// exportResponse sends the download headers on the first write, so that errors found before
+// any row is written can still be answered with a JSON error.
+type exportResponse struct {
+	w           http.ResponseWriter
+	filename    string
+	contentType string
+	gzip        bool
+
+	started bool
+	gz      *gzip.Writer
+}
+
+func (out *exportResponse) Write(p []byte) (int, error) {
+	if !out.started {
+		out.start()
+	}
+	if out.gz != nil {
+		return out.gz.Write(p)
+	}
+	return out.w.Write(p)
+}
+
+func (out *exportResponse) start() {
+	out.started = true
+
+	h := out.w.Header()
+	h.Set("Content-Type", out.contentType)
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", out.filename))
+	h.Add("Vary", "Accept-Encoding")
+	if out.gzip {
+		h.Set("Content-Encoding", "gzip")
+		out.gz = gzip.NewWriter(out.w)
+	}
+	out.w.WriteHeader(http.StatusOK)
+}
+
+// close sends the headers of an empty export and ends the gzip stream.
+func (out *exportResponse) close() error {
+	if !out.started {
+		out.start()
+	}
+	if out.gz != nil {
+		return out.gz.Close()
+	}
+	return nil
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// parseExportOptions parses the query parameters of the export endpoints.
+// Errors are meant for the client.
+func parseExportOptions(query url.Values) (ExportOptions, error) {
+	var opts ExportOptions
+
+	loc, err := parseTimezone(query.Get("tz"))
+	if err != nil {
+		return ExportOptions{}, fmt.Errorf("invalid tz parameter")
+	}
+	if query.Get("from") == "" {
+		return ExportOptions{}, fmt.Errorf("from parameter is required")
+	}
+	if opts.From, err = parseRangeBound(query.Get("from"), loc, false); err != nil {
+		return ExportOptions{}, fmt.Errorf("invalid from parameter")
+	}
+	if opts.To, err = parseRangeBound(query.Get("to"), loc, true); err != nil {
+		return ExportOptions{}, fmt.Errorf("invalid to parameter")
+	}
+
+	if opts.Format, err = parseExportFormat(query.Get("format")); err != nil {
+		return ExportOptions{}, fmt.Errorf("invalid format parameter")
+	}
+
+	switch query.Get("ip") {
+	case "", "hashed":
+	case "raw":
+		opts.RawIPs = true
+	default:
+		return ExportOptions{}, fmt.Errorf("invalid ip parameter")
+	}
+
+	if opts.IncludeBots, err = parseIncludeBots(query.Get("include_bots")); err != nil {
+		return ExportOptions{}, fmt.Errorf("invalid include_bots parameter")
+	}
+
+	return opts, nil
+}
+
+// parseStatsOptions parses the query parameters shared by the stats endpoints.
+// Errors are meant for the client.
+func parseStatsOptions(query url.Values) (StatsOptions, error) {
+	var opts StatsOptions
+	var err error
+
+	if opts.Location, err = parseTimezone(query.Get("tz")); err != nil {
+		return StatsOptions{}, fmt.Errorf("invalid tz parameter")
+	}
+	if opts.Granularity, err = parseGranularity(query.Get("granularity")); err != nil {
+		return StatsOptions{}, fmt.Errorf("invalid granularity parameter")
+	}
+
+	switch {
+	case query.Get("from") == "" && query.Get("to") != "":
+		return StatsOptions{}, fmt.Errorf("to parameter requires from")
+	case query.Get("from") == "":
+		if opts.Days, err = parseDays(query.Get("days")); err != nil {
+			return StatsOptions{}, fmt.Errorf("invalid days parameter")
+		}
+	case query.Get("days") != "":
+		return StatsOptions{}, fmt.Errorf("days parameter can't be combined with from")
+	default:
+		if opts.From, err = parseRangeBound(query.Get("from"), opts.Location, false); err != nil {
+			return StatsOptions{}, fmt.Errorf("invalid from parameter")
+		}
+		if opts.To, err = parseRangeBound(query.Get("to"), opts.Location, true); err != nil {
+			return StatsOptions{}, fmt.Errorf("invalid to parameter")
+		}
+	}
+
+	switch query.Get("compare") {
+	case "":
+	case "previous":
+		opts.ComparePrevious = true
+	default:
+		return StatsOptions{}, fmt.Errorf("invalid compare parameter")
+	}
+
+	if opts.IncludeBots, err = parseIncludeBots(query.Get("include_bots")); err != nil {
+		return StatsOptions{}, fmt.Errorf("invalid include_bots parameter")
+	}
+	if opts.ReferrerDomainsLimit, err = parseLimit(query.Get("domains_limit")); err != nil {
+		return StatsOptions{}, fmt.Errorf("invalid domains_limit parameter")
 	}
-	for _, d := range stats.ByDay {
-		resp.ByDay = append(resp.ByDay, dayCount{Date: d.Date.UTC().Format("2006-01-02"), Count: d.Count})
+	if opts.ReferrersLimit, err = parseLimit(query.Get("referrers_limit")); err != nil {
+		return StatsOptions{}, fmt.Errorf("invalid referrers_limit parameter")
 	}
 
-	httpx.WriteResponse(w, http.StatusOK, resp)
+	return opts, nil
 }
 
 func parseDays(daysParam string) (int, error) {
@@ -79,3 +449,62 @@ func parseDays(daysParam string) (int, error) {
 
 	return parsed, nil
 }
+
+// parseTimezone parses an optional IANA time zone name, UTC when omitted.
+func parseTimezone(param string) (*time.Location, error) {
+	switch param {
+	case "":
+		return time.UTC, nil
+	case "Local":
+		// The server's zone means nothing to API clients.
+		return nil, fmt.Errorf("invalid tz parameter")
+	}
+	return time.LoadLocation(param)
+}
+
+// parseRangeBound parses from/to as an RFC 3339 timestamp or a date in loc. Dates as the
+// upper bound are inclusive: the range ends at the following midnight.
+func parseRangeBound(param string, loc *time.Location, upper bool) (time.Time, error) {
+	if param == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, param); err == nil {
+		return t, nil
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", param, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid range bound")
+	}
+	if upper {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// parseIncludeBots parses the optional include_bots flag; bots are excluded by default.
+func parseIncludeBots(param string) (bool, error) {
+	if param == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(param)
+}
+
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+// parseLimit parses an optional top list size: 0..100, 10 when omitted. 0 omits the list.
+func parseLimit(param string) (int, error) {
+	if param == "" {
+		return defaultTopLimit, nil
+	}
+
+	parsed, err := strconv.Atoi(param)
+	if err != nil || parsed < 0 || parsed > maxTopLimit {
+		return 0, fmt.Errorf("invalid limit parameter")
+	}
+
+	return parsed, nil
+}
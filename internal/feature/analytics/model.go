@@ -1,11 +1,156 @@
 package analytics
 
-import "time"
+import (
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
 
 type Click struct {
-	LinkID    int64
+	LinkID int64
+	// IPAddress is the client IP, truncated or empty depending on the IPMode.
 	IPAddress string
+	// IPHash is the keyed hash of the full IP that unique clicks count, empty with IPModeRaw.
+	IPHash string
+	// VisitorID tells the clicks of one visitor apart from others' (see VisitorStrategy).
+	VisitorID string
+	// ClickID is the ID conversions of the click are attributed to, empty unless click IDs are enabled.
+	ClickID string
+	// EventID identifies the tracked click event; a click stored with an EventID is never stored twice.
+	EventID   string
 	UserAgent string
 	Referer   string
-	CreatedAt time.Time
+	// RefererDomain is the normalized referer host, empty for direct traffic.
+	RefererDomain string
+	// Browser, OS and Device are families parsed from UserAgent (see useragent.Parse).
+	Browser string
+	OS      string
+	Device  string
+	// Country (ISO code), Region and City are resolved from IPAddress when a GeoIP database is configured.
+	Country     string
+	Region      string
+	City        string
+	TrafficType link.TrafficType
+	CreatedAt   time.Time
+}
+
+// TimeRange is the caller-requested window of stats.
+type TimeRange struct {
+	// Days selects the last Days calendar days in Location, unless From is set.
+	Days int
+	// From and To select an explicit [From, To) range; a zero To means now.
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+	// Location is the viewer's time zone: buckets start at its midnights and hours.
+	Location *time.Location
+}
+
+// StatsOptions are the caller-controlled parameters of link stats.
+type StatsOptions struct {
+	TimeRange
+	IncludeBots bool
+	// ComparePrevious adds the totals and series of the preceding period of equal length.
+	ComparePrevious bool
+	// ReferrerDomainsLimit and ReferrersLimit bound the top lists; 0 omits the list.
+	ReferrerDomainsLimit int
+	ReferrersLimit       int
+}
+
+// OverviewOptions are the caller-controlled parameters of the account overview.
+type OverviewOptions struct {
+	StatsOptions
+	// LinksLimit bounds the top links list; 0 omits the list.
+	LinksLimit int
+}
+
+// ClickScope selects whose clicks are aggregated: one link, or every link of an account.
+type ClickScope struct {
+	LinkID          int64
+	AccountPublicID string
+}
+
+// StatsQuery selects the clicks stats are computed over.
+type StatsQuery struct {
+	Scope ClickScope
+	// From and To bound created_at to [From, To).
+	From time.Time
+	To   time.Time
+	// Series is bucketed by Granularity in Location's wall clock.
+	Granularity Granularity
+	Location    *time.Location
+	// IncludeBots adds bot and prefetch clicks, which are excluded by default.
+	IncludeBots          bool
+	ReferrerDomainsLimit int
+	ReferrersLimit       int
+}
+
+// TotalsQuery selects the clicks of a scope in [From, To), e.g. of the previous period.
+type TotalsQuery struct {
+	Scope       ClickScope
+	From        time.Time
+	To          time.Time
+	IncludeBots bool
+}
+
+// SeriesQuery selects the clicks of a scope in [From, To), bucketed like StatsQuery.
+type SeriesQuery struct {
+	Scope       ClickScope
+	From        time.Time
+	To          time.Time
+	Granularity Granularity
+	Location    *time.Location
+	IncludeBots bool
+}
+
+// TopLinksQuery selects an account's links with the most clicks in [From, To).
+type TopLinksQuery struct {
+	AccountPublicID string
+	From            time.Time
+	To              time.Time
+	IncludeBots     bool
+	Limit           int
+}
+
+// ExportOptions are the caller-controlled parameters of a raw clicks export.
+type ExportOptions struct {
+	// From and To select the clicks of [From, To); a zero To means now.
+	From        time.Time
+	To          time.Time
+	Format      ExportFormat
+	IncludeBots bool
+	// RawIPs exports IP addresses as stored instead of pseudonymized (see ipHasher).
+	RawIPs bool
+}
+
+// ExportQuery selects the clicks of a scope in [From, To) for export.
+type ExportQuery struct {
+	Scope       ClickScope
+	From        time.Time
+	To          time.Time
+	IncludeBots bool
+}
+
+// ExportedClick is a single click row of an export.
+type ExportedClick struct {
+	ShortCode     string
+	CreatedAt     time.Time
+	IPAddress     string
+	UserAgent     string
+	Referer       string
+	RefererDomain string
+	Browser       string
+	OS            string
+	Device        string
+	Country       string
+	Region        string
+	City          string
+	TrafficType   link.TrafficType
+}
+
+// StaleRollupHour is an hour of a link that received clicks after it was rolled up,
+// e.g. clicks replayed from the spool after a restart.
+type StaleRollupHour struct {
+	LinkID int64
+	Hour   time.Time
 }
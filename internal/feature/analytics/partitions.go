@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ClickRetentionPolicy controls the monthly partitions of raw clicks.
+type ClickRetentionPolicy struct {
+	// MonthsAhead is the number of future months that always have a partition.
+	MonthsAhead int
+	// RetentionMonths is the number of whole months kept before the current one. Zero keeps clicks forever.
+	// Rollups outlive the raw clicks, so totals of older periods stay available.
+	RetentionMonths int
+	// Detach detaches expired partitions instead of dropping them, e.g. to archive their tables.
+	Detach bool
+}
+
+// ClickPartitionWorker creates partitions of upcoming months ahead of time and removes
+// partitions older than the retention, which is a metadata change instead of a mass DELETE.
+type ClickPartitionWorker struct {
+	repo     ClickPartitionRepository
+	interval time.Duration
+	policy   ClickRetentionPolicy
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewClickPartitionWorker creates a new partition worker.
+func NewClickPartitionWorker(repo ClickPartitionRepository, interval time.Duration, policy ClickRetentionPolicy) *ClickPartitionWorker {
+	return &ClickPartitionWorker{
+		repo:     repo,
+		interval: interval,
+		policy:   policy,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (w *ClickPartitionWorker) Start() {
+	go w.run()
+}
+
+// Stop gracefully stops the worker and blocks until the maintenance loop exits.
+func (w *ClickPartitionWorker) Stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// run maintains partitions right away, so upcoming months are covered after a long downtime, then periodically.
+func (w *ClickPartitionWorker) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	log.Printf("[partitions] click partition worker started interval=%s ahead=%d retention_months=%d detach=%t",
+		w.interval, w.policy.MonthsAhead, w.policy.RetentionMonths, w.policy.Detach)
+
+	w.maintain(time.Now())
+	for {
+		select {
+		case <-ticker.C:
+			w.maintain(time.Now())
+		case <-w.done:
+			log.Printf("[partitions] click partition worker stopped")
+			return
+		}
+	}
+}
+
+// maintain performs a single pass.
+func (w *ClickPartitionWorker) maintain(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	partitions, err := w.repo.GetClickPartitions(ctx)
+	if err != nil {
+		log.Printf("[partitions] failed to list partitions: %v", err)
+		return
+	}
+	existing := make(map[time.Time]bool, len(partitions))
+	for _, month := range partitions {
+		existing[month] = true
+	}
+
+	current := monthStart(now)
+	for i := range w.policy.MonthsAhead + 1 {
+		month := current.AddDate(0, i, 0)
+		if existing[month] {
+			continue
+		}
+		if err := w.repo.CreateClickPartition(ctx, month); err != nil {
+			log.Printf("[partitions] failed to create partition %s: %v", month.Format("2006-01"), err)
+			return
+		}
+		log.Printf("[partitions] created partition %s", month.Format("2006-01"))
+	}
+
+	if w.policy.RetentionMonths <= 0 {
+		return
+	}
+	cutoff := current.AddDate(0, -w.policy.RetentionMonths, 0)
+	for _, month := range partitions {
+		if !month.Before(cutoff) {
+			continue
+		}
+		if err := w.repo.RemoveClickPartition(ctx, month, w.policy.Detach); err != nil {
+			log.Printf("[partitions] failed to remove partition %s: %v", month.Format("2006-01"), err)
+			return
+		}
+		log.Printf("[partitions] removed partition %s detach=%t", month.Format("2006-01"), w.policy.Detach)
+	}
+
+	deleted, err := w.repo.DeleteUnpartitionedClicks(ctx, cutoff)
+	if err != nil {
+		log.Printf("[partitions] failed to delete expired unpartitioned clicks: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("[partitions] deleted expired unpartitioned clicks=%d", deleted)
+	}
+}
+
+// monthStart returns the first instant of t's month in UTC.
+func monthStart(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type mockPartitionRepo struct {
+	partitions []time.Time
+
+	created   []time.Time
+	removed   []time.Time
+	detached  bool
+	deletedTo time.Time
+}
+
+func (m *mockPartitionRepo) GetClickPartitions(ctx context.Context) ([]time.Time, error) {
+	return m.partitions, nil
+}
+
+func (m *mockPartitionRepo) CreateClickPartition(ctx context.Context, month time.Time) error {
+	m.created = append(m.created, month)
+	return nil
+}
+
+func (m *mockPartitionRepo) RemoveClickPartition(ctx context.Context, month time.Time, detach bool) error {
+	m.removed = append(m.removed, month)
+	m.detached = detach
+	return nil
+}
+
+func (m *mockPartitionRepo) DeleteUnpartitionedClicks(ctx context.Context, before time.Time) (int64, error) {
+	m.deletedTo = before
+	return 0, nil
+}
+
+func month(y int, m time.Month) time.Time {
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestClickPartitionWorker_CreatesAheadAndRemovesExpired(t *testing.T) {
+	repo := &mockPartitionRepo{partitions: []time.Time{
+		month(2025, 11), month(2025, 12), month(2026, 1), month(2026, 2), month(2026, 3),
+	}}
+	worker := NewClickPartitionWorker(repo, time.Hour, ClickRetentionPolicy{MonthsAhead: 2, RetentionMonths: 2, Detach: true})
+
+	worker.maintain(time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC))
+
+	if len(repo.created) != 2 || !repo.created[0].Equal(month(2026, 4)) || !repo.created[1].Equal(month(2026, 5)) {
+		t.Fatalf("created = %v, want April and May", repo.created)
+	}
+	// Two whole months before March are kept: January and February.
+	if len(repo.removed) != 2 || !repo.removed[0].Equal(month(2025, 11)) || !repo.removed[1].Equal(month(2025, 12)) || !repo.detached {
+		t.Fatalf("removed = %v (detach %t), want November and December detached", repo.removed, repo.detached)
+	}
+	if !repo.deletedTo.Equal(month(2026, 1)) {
+		t.Fatalf("unpartitioned clicks deleted before %s, want January", repo.deletedTo)
+	}
+}
+
+func TestClickPartitionWorker_KeepsClicksWithoutRetention(t *testing.T) {
+	repo := &mockPartitionRepo{partitions: []time.Time{month(2020, 1), month(2026, 3)}}
+	worker := NewClickPartitionWorker(repo, time.Hour, ClickRetentionPolicy{MonthsAhead: 1})
+
+	worker.maintain(time.Date(2026, 3, 31, 23, 0, 0, 0, time.FixedZone("UTC-5", -5*3600))) // April 1st in UTC
+
+	if len(repo.created) != 2 || !repo.created[0].Equal(month(2026, 4)) || !repo.created[1].Equal(month(2026, 5)) {
+		t.Fatalf("created = %v, want April and May", repo.created)
+	}
+	if len(repo.removed) != 0 || !repo.deletedTo.IsZero() {
+		t.Fatalf("removed = %v, deleted before %s: nothing expires without retention", repo.removed, repo.deletedTo)
+	}
+}
@@ -0,0 +1,285 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// IPMode selects how click IPs are stored.
+type IPMode string
+
+const (
+	// IPModeRaw stores IPs as they are.
+	IPModeRaw IPMode = "raw"
+	// IPModeTruncate stores the /24 network of IPv4 and the /48 network of IPv6 addresses.
+	IPModeTruncate IPMode = "truncate"
+	// IPModeHash stores no IP at all, only its hash.
+	IPModeHash IPMode = "hash"
+)
+
+// ipSaltSize is the size of the random daily salts.
+const ipSaltSize = 32
+
+// IPPseudonymizer rewrites click IPs before they are stored. Unless the mode is raw, every click also
+// gets a hash of its full IP keyed with the random salt of its UTC day, which unique clicks count instead
+// of the IP. Salts are shared by all replicas through the repository and deleted soon after their day
+// (see PrivacyWorker), so hashes of different days can't be linked with each other nor with IPs.
+// A visitor coming back on another day therefore counts as another unique visitor.
+type IPPseudonymizer struct {
+	mode  IPMode
+	salts PrivacyRepository
+
+	mu   sync.Mutex
+	day  time.Time
+	salt []byte
+}
+
+// NewIPPseudonymizer creates a pseudonymizer. A nil pseudonymizer stores IPs as they are.
+func NewIPPseudonymizer(mode IPMode, salts PrivacyRepository) *IPPseudonymizer {
+	return &IPPseudonymizer{mode: mode, salts: salts}
+}
+
+// pseudonymize sets the hash of a click and truncates or removes its IP. The GeoIP lookup must be done before.
+func (p *IPPseudonymizer) pseudonymize(ctx context.Context, c *Click) error {
+	if p == nil || p.mode == IPModeRaw || c.IPAddress == "" {
+		return nil
+	}
+
+	hash, err := p.hash(ctx, c.IPAddress, c.CreatedAt)
+	if err != nil {
+		return err
+	}
+	c.IPHash = hash
+
+	switch p.mode {
+	case IPModeTruncate:
+		c.IPAddress = truncateIP(c.IPAddress)
+	case IPModeHash:
+		c.IPAddress = ""
+	}
+	return nil
+}
+
+// hash returns the keyed hash of a value under the salt of t's day. Without pseudonymization
+// the key is empty, as the IPs the value is derived from are stored anyway.
+func (p *IPPseudonymizer) hash(ctx context.Context, value string, t time.Time) (string, error) {
+	if p == nil || p.mode == IPModeRaw {
+		return hashIP(nil, value), nil
+	}
+	salt, err := p.saltOf(ctx, t)
+	if err != nil {
+		return "", fmt.Errorf("get ip salt: %w", err)
+	}
+	return hashIP(salt, value), nil
+}
+
+// saltOf returns the salt of t's UTC day. The salt of the latest day is cached; clicks of earlier
+// days, e.g. replayed from the spool, look theirs up every time.
+func (p *IPPseudonymizer) saltOf(ctx context.Context, t time.Time) ([]byte, error) {
+	y, m, d := t.UTC().Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.salt != nil && p.day.Equal(day) {
+		return p.salt, nil
+	}
+
+	candidate := make([]byte, ipSaltSize)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, err
+	}
+	salt, err := p.salts.GetOrCreateIPSalt(ctx, day, candidate)
+	if err != nil {
+		return nil, err
+	}
+	if p.salt == nil || day.After(p.day) {
+		p.day, p.salt = day, salt
+	}
+	return salt, nil
+}
+
+// hashIP returns the HMAC-SHA256 of an IP under salt, truncated to 16 bytes and hex-encoded.
+func hashIP(salt []byte, ip string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// truncateIP zeroes the host part of an IP: the last octet of IPv4 and the last 80 bits of IPv6 addresses.
+// It returns an empty string for invalid IPs.
+func truncateIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+// PersonalDataPolicy controls how long clicks keep their personal data.
+type PersonalDataPolicy struct {
+	// Retention is the age after which clicks lose their IP, user agent, referer and visitor ID, and after which
+	// visitors not seen since are forgotten, i.e. count as first-time visitors again. Zero keeps them forever.
+	// Derived data (referer domain, browser, OS, device, location, IP hash) is kept, and so are unique counts
+	// of rolled up hours, whose sketches were computed while the clicks still had their visitor IDs.
+	Retention time.Duration
+	// Delete deletes expired clicks altogether instead of clearing their personal fields.
+	Delete bool
+	// BatchSize bounds every UPDATE/DELETE statement.
+	BatchSize int
+}
+
+// PrivacyWorker deletes the IP salts of past days and, with a retention, strips or deletes
+// the personal data of old clicks.
+type PrivacyWorker struct {
+	repo     PrivacyRepository
+	interval time.Duration
+	policy   PersonalDataPolicy
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewPrivacyWorker creates a new privacy worker.
+func NewPrivacyWorker(repo PrivacyRepository, interval time.Duration, policy PersonalDataPolicy) *PrivacyWorker {
+	return &PrivacyWorker{
+		repo:     repo,
+		interval: interval,
+		policy:   policy,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (w *PrivacyWorker) Start() {
+	go w.run()
+}
+
+// Stop gracefully stops the worker and blocks until the loop exits.
+func (w *PrivacyWorker) Stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// run is the internal background loop.
+func (w *PrivacyWorker) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	log.Printf("[privacy] privacy worker started interval=%s retention=%s delete=%t batch=%d",
+		w.interval, w.policy.Retention, w.policy.Delete, w.policy.BatchSize)
+
+	for {
+		select {
+		case <-ticker.C:
+			w.enforce(time.Now())
+		case <-w.done:
+			log.Printf("[privacy] privacy worker stopped")
+			return
+		}
+	}
+}
+
+// enforce performs a single pass. The salt of yesterday is kept for clicks that were still queued at midnight.
+func (w *PrivacyWorker) enforce(now time.Time) {
+	y, m, d := now.UTC().Date()
+	saltsBefore := time.Date(y, m, d-1, 0, 0, 0, 0, time.UTC)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	salts, err := w.repo.DeleteIPSaltsBefore(ctx, saltsBefore)
+	cancel()
+	if err != nil {
+		log.Printf("[privacy] failed to delete ip salts: %v", err)
+	}
+
+	var expired, forgotten int64
+	if w.policy.Retention > 0 {
+		cutoff := now.UTC().Add(-w.policy.Retention)
+		expired = w.expireClicks(cutoff)
+		forgotten = w.forgetVisitors(cutoff)
+	}
+
+	if salts > 0 || expired > 0 || forgotten > 0 {
+		log.Printf("[privacy] deleted ip salts=%d expired personal data of clicks=%d delete=%t forgotten visitors=%d",
+			salts, expired, w.policy.Delete, forgotten)
+	}
+}
+
+// expireClicks anonymizes or deletes clicks before cutoff batch by batch.
+func (w *PrivacyWorker) expireClicks(cutoff time.Time) int64 {
+	var total int64
+	for !w.stopping() {
+		n, err := w.expireBatch(cutoff)
+		if err != nil {
+			log.Printf("[privacy] failed to expire personal data: %v", err)
+			return total
+		}
+		total += n
+
+		if n < int64(w.policy.BatchSize) {
+			return total
+		}
+	}
+	return total
+}
+
+// forgetVisitors deletes visitors last seen before cutoff batch by batch.
+func (w *PrivacyWorker) forgetVisitors(cutoff time.Time) int64 {
+	var total int64
+	for !w.stopping() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		n, err := w.repo.DeleteVisitorsNotSeenSince(ctx, cutoff, w.policy.BatchSize)
+		cancel()
+		if err != nil {
+			log.Printf("[privacy] failed to forget visitors: %v", err)
+			return total
+		}
+		total += n
+
+		if n < int64(w.policy.BatchSize) {
+			return total
+		}
+	}
+	return total
+}
+
+func (w *PrivacyWorker) expireBatch(cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if w.policy.Delete {
+		return w.repo.DeleteClicksBefore(ctx, cutoff, w.policy.BatchSize)
+	}
+	return w.repo.AnonymizeClicksBefore(ctx, cutoff, w.policy.BatchSize)
+}
+
+// stopping reports whether Stop was called, so long passes can exit between batches.
+func (w *PrivacyWorker) stopping() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type mockPrivacyRepo struct {
+	salts       map[time.Time][]byte
+	saltLookups int
+
+	saltsBefore time.Time
+	pending     int64
+	anonymized  int64
+	deleted     int64
+	cutoff      time.Time
+
+	forgottenBefore time.Time
+}
+
+func (m *mockPrivacyRepo) GetOrCreateIPSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error) {
+	m.saltLookups++
+	if m.salts == nil {
+		m.salts = make(map[time.Time][]byte)
+	}
+	if salt, ok := m.salts[day]; ok {
+		return salt, nil
+	}
+	m.salts[day] = candidate
+	return candidate, nil
+}
+
+func (m *mockPrivacyRepo) DeleteIPSaltsBefore(ctx context.Context, day time.Time) (int64, error) {
+	m.saltsBefore = day
+	return 0, nil
+}
+
+func (m *mockPrivacyRepo) AnonymizeClicksBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	n := min(m.pending, int64(limit))
+	m.pending -= n
+	m.anonymized += n
+	m.cutoff = before
+	return n, nil
+}
+
+func (m *mockPrivacyRepo) DeleteVisitorsNotSeenSince(ctx context.Context, before time.Time, limit int) (int64, error) {
+	m.forgottenBefore = before
+	return 0, nil
+}
+
+func (m *mockPrivacyRepo) DeleteClicksBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	n := min(m.pending, int64(limit))
+	m.pending -= n
+	m.deleted += n
+	m.cutoff = before
+	return n, nil
+}
+
+func TestTruncateIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.77":             "203.0.113.0",
+		"::ffff:203.0.113.77":      "203.0.113.0",
+		"2001:db8:abcd:12:1::7":    "2001:db8:abcd::",
+		"2001:db8:abcd:ffff::ffff": "2001:db8:abcd::",
+		"not an ip":                "",
+	}
+	for ip, want := range tests {
+		if got := truncateIP(ip); got != want {
+			t.Errorf("truncateIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestIPPseudonymizer_HashesWithDailySalt(t *testing.T) {
+	repo := &mockPrivacyRepo{}
+	p := NewIPPseudonymizer(IPModeTruncate, repo)
+	day := time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)
+
+	first := Click{IPAddress: "203.0.113.77", CreatedAt: day}
+	second := Click{IPAddress: "203.0.113.77", CreatedAt: day.Add(10 * time.Hour)}
+	other := Click{IPAddress: "203.0.113.78", CreatedAt: day}
+	nextDay := Click{IPAddress: "203.0.113.77", CreatedAt: day.Add(24 * time.Hour)}
+	for _, c := range []*Click{&first, &second, &other, &nextDay} {
+		if err := p.pseudonymize(context.Background(), c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if first.IPAddress != "203.0.113.0" {
+		t.Fatalf("IPAddress = %q, want the /24 network", first.IPAddress)
+	}
+	if first.IPHash == "" || first.IPHash != second.IPHash {
+		t.Fatalf("hashes of the same IP on the same day differ: %q, %q", first.IPHash, second.IPHash)
+	}
+	if other.IPHash == first.IPHash {
+		t.Fatal("IPs of the same network must keep distinct hashes")
+	}
+	if nextDay.IPHash == first.IPHash {
+		t.Fatal("hashes of another day must use another salt")
+	}
+	if repo.saltLookups != 2 {
+		t.Fatalf("salt lookups = %d, want one per day", repo.saltLookups)
+	}
+}
+
+func TestIPPseudonymizer_Modes(t *testing.T) {
+	hashed := Click{IPAddress: "2001:db8::1", CreatedAt: time.Now()}
+	if err := NewIPPseudonymizer(IPModeHash, &mockPrivacyRepo{}).pseudonymize(context.Background(), &hashed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hashed.IPAddress != "" || len(hashed.IPHash) != 32 {
+		t.Fatalf("hash mode stored ip=%q hash=%q", hashed.IPAddress, hashed.IPHash)
+	}
+
+	var raw *IPPseudonymizer
+	click := Click{IPAddress: "2001:db8::1"}
+	if err := raw.pseudonymize(context.Background(), &click); err != nil || click.IPAddress != "2001:db8::1" || click.IPHash != "" {
+		t.Fatalf("nil pseudonymizer changed the click: %+v, %v", click, err)
+	}
+}
+
+func TestPrivacyWorker_ExpiresPersonalDataInBatches(t *testing.T) {
+	repo := &mockPrivacyRepo{pending: 25}
+	worker := NewPrivacyWorker(repo, time.Hour, PersonalDataPolicy{Retention: 30 * 24 * time.Hour, BatchSize: 10})
+	now := time.Date(2026, 3, 10, 0, 30, 0, 0, time.UTC)
+
+	worker.enforce(now)
+
+	if !repo.saltsBefore.Equal(time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("salts deleted before %s, want yesterday", repo.saltsBefore)
+	}
+	if repo.anonymized != 25 || repo.deleted != 0 {
+		t.Fatalf("anonymized=%d deleted=%d, want 25 anonymized", repo.anonymized, repo.deleted)
+	}
+	if !repo.cutoff.Equal(now.AddDate(0, 0, -30)) || !repo.forgottenBefore.Equal(repo.cutoff) {
+		t.Fatalf("cutoff = %s, visitors forgotten before %s, want 30 days ago", repo.cutoff, repo.forgottenBefore)
+	}
+}
+
+func TestPrivacyWorker_DeletesOrKeepsClicks(t *testing.T) {
+	repo := &mockPrivacyRepo{pending: 5}
+	NewPrivacyWorker(repo, time.Hour, PersonalDataPolicy{Retention: time.Hour, Delete: true, BatchSize: 10}).enforce(time.Now())
+	if repo.deleted != 5 || repo.anonymized != 0 {
+		t.Fatalf("anonymized=%d deleted=%d, want 5 deleted", repo.anonymized, repo.deleted)
+	}
+
+	repo = &mockPrivacyRepo{pending: 5}
+	NewPrivacyWorker(repo, time.Hour, PersonalDataPolicy{BatchSize: 10}).enforce(time.Now())
+	if repo.pending != 5 || repo.saltsBefore.IsZero() {
+		t.Fatal("without retention only salts expire")
+	}
+}
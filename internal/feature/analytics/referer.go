@@ -0,0 +1,31 @@
+package analytics
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DirectReferrer labels clicks without a referer in the referrer domains breakdown.
+const DirectReferrer = "direct"
+
+// UnknownValue labels clicks without a value of a breakdown dimension: stored before it was
+// collected, or not resolvable (e.g. no GeoIP database configured).
+const UnknownValue = "unknown"
+
+// refererDomain normalizes a Referer header to its host: lowercased, without port and "www." prefix.
+// Empty or unparsable referers give "", which is reported as direct traffic.
+// Keep in sync with the backfill in migrations/000011_add_link_clicks_referer_domain.up.sql.
+func refererDomain(referer string) string {
+	referer = strings.TrimSpace(referer)
+	if referer == "" {
+		return ""
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return strings.TrimPrefix(host, "www.")
+}
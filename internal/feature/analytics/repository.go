@@ -6,8 +6,61 @@ import (
 )
 
 type AnalyticsRepository interface {
-	SaveClick(ctx context.Context, c Click) error
-	GetStats(ctx context.Context, linkID int64, since time.Time) (Stats, error)
+	// SaveClicks stores a batch of clicks. It returns an error wrapping ErrClicksRejected
+	// when one of the clicks is invalid; other errors are transient.
+	SaveClicks(ctx context.Context, clicks []Click) error
+	// SaveRejectedClick dead-letters the encoded click event the database refused to store.
+	SaveRejectedClick(ctx context.Context, payload []byte, reason string) error
+	GetStats(ctx context.Context, query StatsQuery) (Stats, error)
+	GetTotals(ctx context.Context, query TotalsQuery) (Totals, error)
+	GetSeries(ctx context.Context, query SeriesQuery) ([]Bucket, error)
+	GetTopLinks(ctx context.Context, query TopLinksQuery) ([]LinkCount, error)
+	// StreamClicks calls fn for every click of the query, oldest first, without loading them all in memory.
+	StreamClicks(ctx context.Context, query ExportQuery, fn func(ExportedClick) error) error
+}
+
+// RollupRepository maintains the hourly and daily click rollups that AnalyticsRepository reads
+// instead of raw clicks for whole hours before the rollup watermark.
+type RollupRepository interface {
+	// GetRollupWatermark returns the end of the rolled up hours.
+	GetRollupWatermark(ctx context.Context) (time.Time, error)
+	// RollUpHour rolls up the hour starting at the watermark, and its day once the day is complete,
+	// then advances the watermark. It returns false when the watermark isn't at hour anymore,
+	// i.e. another replica rolled it up.
+	RollUpHour(ctx context.Context, hour time.Time) (bool, error)
+	// GetStaleRollupHours returns rolled up hours that received clicks afterwards, oldest first.
+	GetStaleRollupHours(ctx context.Context, limit int) ([]StaleRollupHour, error)
+	// RefreshRollupHour rolls up a stale hour of a link, and its day, again. partitions are the click
+	// partitions as returned by GetClickPartitions, loaded once for a batch of stale hours.
+	RefreshRollupHour(ctx context.Context, stale StaleRollupHour, partitions []time.Time) error
+	// GetClickPartitions returns the first day of the month of every click partition.
+	GetClickPartitions(ctx context.Context) ([]time.Time, error)
+}
+
+// ClickPartitionRepository manages the monthly (UTC) partitions of the clicks table.
+type ClickPartitionRepository interface {
+	// GetClickPartitions returns the first day of the month of every partition.
+	GetClickPartitions(ctx context.Context) ([]time.Time, error)
+	// CreateClickPartition creates the partition of a month, taking over its clicks from the default partition.
+	CreateClickPartition(ctx context.Context, month time.Time) error
+	// RemoveClickPartition drops the partition of a month, or only detaches it to keep its table.
+	RemoveClickPartition(ctx context.Context, month time.Time, detach bool) error
+	// DeleteUnpartitionedClicks deletes clicks before a time from the default partition.
+	DeleteUnpartitionedClicks(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PrivacyRepository stores the daily IP salts and expires the personal data of clicks.
+type PrivacyRepository interface {
+	// GetOrCreateIPSalt returns the salt of a UTC day, storing candidate if the day has none yet.
+	GetOrCreateIPSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error)
+	// DeleteIPSaltsBefore deletes the salts of days before day.
+	DeleteIPSaltsBefore(ctx context.Context, day time.Time) (int64, error)
+	// AnonymizeClicksBefore clears the IP, user agent, referer, visitor ID and click ID of up to limit clicks before a time.
+	AnonymizeClicksBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+	// DeleteClicksBefore deletes up to limit clicks before a time.
+	DeleteClicksBefore(ctx context.Context, before time.Time, limit int) (int64, error)
+	// DeleteVisitorsNotSeenSince forgets up to limit visitors whose last click is before a time.
+	DeleteVisitorsNotSeenSince(ctx context.Context, before time.Time, limit int) (int64, error)
 }
 
 type LinkRepository interface {
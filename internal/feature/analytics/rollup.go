@@ -0,0 +1,159 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// maxRollupHoursPerPass bounds a pass, so the backfill of a long click history is spread over passes.
+	maxRollupHoursPerPass = 7 * 24
+	// staleRollupBatchSize is the number of stale hours refreshed per pass.
+	staleRollupBatchSize = 500
+)
+
+// RollupWorker periodically rolls up closed hours of clicks into hourly and daily aggregates,
+// so stats read per-link counts and unique visitor sketches instead of scanning raw clicks.
+type RollupWorker struct {
+	repo     RollupRepository
+	interval time.Duration
+	// delay keeps an hour open for clicks still in flight (batched or spooled) after it ends.
+	delay time.Duration
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRollupWorker creates a new rollup worker.
+func NewRollupWorker(repo RollupRepository, interval time.Duration, delay time.Duration) *RollupWorker {
+	return &RollupWorker{
+		repo:     repo,
+		interval: interval,
+		delay:    delay,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (w *RollupWorker) Start() {
+	go w.run()
+}
+
+// Stop gracefully stops the worker and blocks until the rollup loop exits.
+func (w *RollupWorker) Stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+func (w *RollupWorker) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	log.Printf("[rollup] click rollup worker started interval=%s delay=%s", w.interval, w.delay)
+
+	for {
+		select {
+		case <-ticker.C:
+			w.rollUp(time.Now())
+		case <-w.done:
+			log.Printf("[rollup] click rollup worker stopped")
+			return
+		}
+	}
+}
+
+// rollUp performs a single pass: closed hours first, then hours that went stale.
+func (w *RollupWorker) rollUp(now time.Time) {
+	hours := w.rollUpClosedHours(now.Add(-w.delay))
+	refreshed := w.refreshStaleHours()
+
+	if hours > 0 || refreshed > 0 {
+		log.Printf("[rollup] rolled up hours=%d refreshed stale hours=%d", hours, refreshed)
+	}
+}
+
+// rollUpClosedHours rolls up the hours after the watermark that ended before until.
+func (w *RollupWorker) rollUpClosedHours(until time.Time) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	watermark, err := w.repo.GetRollupWatermark(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("[rollup] failed to get watermark: %v", err)
+		return 0
+	}
+
+	rolled := 0
+	for hour := watermark; !hour.Add(time.Hour).After(until) && rolled < maxRollupHoursPerPass && !w.stopping(); hour = hour.Add(time.Hour) {
+		ok, err := w.rollUpHour(hour)
+		if err != nil {
+			log.Printf("[rollup] failed to roll up hour %s: %v", hour.UTC().Format(time.RFC3339), err)
+			return rolled
+		}
+		if !ok {
+			return rolled
+		}
+		rolled++
+	}
+	return rolled
+}
+
+func (w *RollupWorker) rollUpHour(hour time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return w.repo.RollUpHour(ctx, hour)
+}
+
+// refreshStaleHours rolls up again a batch of hours that received late clicks.
+func (w *RollupWorker) refreshStaleHours() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	stale, err := w.repo.GetStaleRollupHours(ctx, staleRollupBatchSize)
+	if err != nil || len(stale) == 0 {
+		cancel()
+		if err != nil {
+			log.Printf("[rollup] failed to get stale hours: %v", err)
+		}
+		return 0
+	}
+	partitions, err := w.repo.GetClickPartitions(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("[rollup] failed to get click partitions: %v", err)
+		return 0
+	}
+
+	refreshed := 0
+	for _, s := range stale {
+		if w.stopping() {
+			break
+		}
+		if err := w.refreshStaleHour(s, partitions); err != nil {
+			log.Printf("[rollup] failed to refresh hour %s of link %d: %v", s.Hour.UTC().Format(time.RFC3339), s.LinkID, err)
+			break
+		}
+		refreshed++
+	}
+	return refreshed
+}
+
+// refreshStaleHour refreshes a single stale hour, with a timeout of its own so one slow hour
+// doesn't use up the time of the rest of the batch.
+func (w *RollupWorker) refreshStaleHour(stale StaleRollupHour, partitions []time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return w.repo.RefreshRollupHour(ctx, stale, partitions)
+}
+
+// stopping reports whether Stop was called, so long passes can exit between hours.
+func (w *RollupWorker) stopping() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
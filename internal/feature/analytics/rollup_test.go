@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockRollupRepo struct {
+	watermark time.Time
+	stale     []StaleRollupHour
+
+	partitions []time.Time
+
+	rolled         []time.Time
+	refreshed      []StaleRollupHour
+	partitionLoads int
+	failAt         time.Time
+}
+
+func (m *mockRollupRepo) GetRollupWatermark(ctx context.Context) (time.Time, error) {
+	return m.watermark, nil
+}
+
+func (m *mockRollupRepo) RollUpHour(ctx context.Context, hour time.Time) (bool, error) {
+	if hour.Equal(m.failAt) {
+		return false, errors.New("database is down")
+	}
+	if !hour.Equal(m.watermark) {
+		return false, nil
+	}
+	m.rolled = append(m.rolled, hour)
+	m.watermark = hour.Add(time.Hour)
+	return true, nil
+}
+
+func (m *mockRollupRepo) GetStaleRollupHours(ctx context.Context, limit int) ([]StaleRollupHour, error) {
+	return m.stale[:min(limit, len(m.stale))], nil
+}
+
+func (m *mockRollupRepo) RefreshRollupHour(ctx context.Context, stale StaleRollupHour, partitions []time.Time) error {
+	if len(partitions) != len(m.partitions) {
+		return errors.New("unexpected partitions")
+	}
+	m.refreshed = append(m.refreshed, stale)
+	return nil
+}
+
+func (m *mockRollupRepo) GetClickPartitions(ctx context.Context) ([]time.Time, error) {
+	m.partitionLoads++
+	return m.partitions, nil
+}
+
+func TestRollupWorker_RollsUpClosedHoursAndStaleHours(t *testing.T) {
+	watermark := time.Date(2026, 1, 10, 21, 0, 0, 0, time.UTC)
+	stale := StaleRollupHour{LinkID: 7, Hour: watermark.Add(-5 * time.Hour)}
+	repo := &mockRollupRepo{watermark: watermark, stale: []StaleRollupHour{stale}}
+	worker := NewRollupWorker(repo, time.Minute, 5*time.Minute)
+
+	// 00:04 is within the delay after midnight, so the 23:00 hour stays open.
+	worker.rollUp(time.Date(2026, 1, 11, 0, 4, 0, 0, time.UTC))
+
+	want := []time.Time{watermark, watermark.Add(time.Hour)}
+	if len(repo.rolled) != len(want) || !repo.rolled[0].Equal(want[0]) || !repo.rolled[1].Equal(want[1]) {
+		t.Fatalf("rolled up hours = %v, want %v", repo.rolled, want)
+	}
+	if len(repo.refreshed) != 1 || repo.refreshed[0] != stale {
+		t.Fatalf("refreshed = %v, want %v", repo.refreshed, stale)
+	}
+
+	worker.rollUp(time.Date(2026, 1, 11, 0, 5, 0, 0, time.UTC))
+	if len(repo.rolled) != 3 || !repo.watermark.Equal(time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("rolled up hours = %v, watermark %s", repo.rolled, repo.watermark)
+	}
+}
+
+func TestRollupWorker_BoundsBackfillAndStopsOnError(t *testing.T) {
+	watermark := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockRollupRepo{watermark: watermark}
+	worker := NewRollupWorker(repo, time.Minute, 0)
+
+	worker.rollUp(watermark.AddDate(1, 0, 0))
+	if len(repo.rolled) != maxRollupHoursPerPass {
+		t.Fatalf("rolled up hours = %d, want %d per pass", len(repo.rolled), maxRollupHoursPerPass)
+	}
+
+	repo.failAt = repo.watermark.Add(time.Hour)
+	worker.rollUp(watermark.AddDate(1, 0, 0))
+	if len(repo.rolled) != maxRollupHoursPerPass+1 {
+		t.Fatalf("rolled up hours = %d, want the pass to stop at the failing hour", len(repo.rolled))
+	}
+}
+
+func TestRollupWorker_LoadsPartitionsOncePerPass(t *testing.T) {
+	watermark := time.Date(2026, 1, 10, 21, 0, 0, 0, time.UTC)
+	repo := &mockRollupRepo{
+		watermark:  watermark,
+		partitions: []time.Time{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		stale: []StaleRollupHour{
+			{LinkID: 1, Hour: watermark.Add(-3 * time.Hour)},
+			{LinkID: 2, Hour: watermark.Add(-2 * time.Hour)},
+			{LinkID: 3, Hour: watermark.Add(-time.Hour)},
+		},
+	}
+	worker := NewRollupWorker(repo, time.Minute, 0)
+
+	worker.rollUp(watermark)
+
+	if len(repo.refreshed) != 3 || repo.partitionLoads != 1 {
+		t.Fatalf("refreshed = %d with partition loads = %d, want 3 with 1", len(repo.refreshed), repo.partitionLoads)
+	}
+}
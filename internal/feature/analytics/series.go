@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the bucket size of a clicks time series.
+type Granularity string
+
+const (
+	GranularityHour  Granularity = "hour"
+	GranularityDay   Granularity = "day"
+	GranularityWeek  Granularity = "week" // ISO weeks, starting on Monday
+	GranularityMonth Granularity = "month"
+)
+
+const (
+	// maxStatsRange bounds the time range of a stats query.
+	maxStatsRange = 366 * 24 * time.Hour
+	// maxSeriesBuckets bounds the size of a series, e.g. hourly buckets cover at most ~83 days.
+	maxSeriesBuckets = 2000
+)
+
+func parseGranularity(param string) (Granularity, error) {
+	switch g := Granularity(param); g {
+	case "":
+		return GranularityDay, nil
+	case GranularityHour, GranularityDay, GranularityWeek, GranularityMonth:
+		return g, nil
+	default:
+		return "", fmt.Errorf("invalid granularity %q", param)
+	}
+}
+
+// truncate returns the start of the bucket containing t, in t's location.
+func (g Granularity) truncate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch g {
+	case GranularityHour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+	case GranularityWeek:
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-sinceMonday, 0, 0, 0, 0, t.Location())
+	case GranularityMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// next returns the start of the bucket after the one starting at start.
+// Calendar arithmetic keeps day, week and month buckets aligned across DST changes.
+func (g Granularity) next(start time.Time) time.Time {
+	y, m, d := start.Date()
+	switch g {
+	case GranularityHour:
+		return start.Add(time.Hour)
+	case GranularityWeek:
+		return time.Date(y, m, d+7, 0, 0, 0, 0, start.Location())
+	case GranularityMonth:
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// key identifies a bucket by its wall-clock start, which is how Postgres reports buckets
+// (date_trunc of the local time). Hours repeated when clocks go back share a key.
+func (g Granularity) key(start time.Time) string {
+	if g == GranularityHour {
+		return start.Format("2006-01-02T15")
+	}
+	return start.Format("2006-01-02")
+}
+
+// resolveRange turns the requested range into [from, to) in the viewer's location.
+// The last N days are calendar days: today and the N-1 days before.
+func resolveRange(opts TimeRange, now time.Time) (time.Time, time.Time, error) {
+	now = now.In(opts.Location)
+
+	from, to := opts.From, opts.To
+	if from.IsZero() {
+		to = now
+		from = GranularityDay.truncate(now).AddDate(0, 0, -(opts.Days - 1))
+	}
+	if to.IsZero() {
+		to = now
+	}
+	from, to = from.In(opts.Location), to.In(opts.Location)
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: from must be before to", ErrInvalidStatsRange)
+	}
+	if to.Sub(from) > maxStatsRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: range exceeds 366 days", ErrInvalidStatsRange)
+	}
+
+	buckets := 0
+	for start := opts.Granularity.truncate(from); start.Before(to); start = opts.Granularity.next(start) {
+		if buckets++; buckets > maxSeriesBuckets {
+			return time.Time{}, time.Time{}, fmt.Errorf("%w: more than %d %s buckets", ErrInvalidStatsRange, maxSeriesBuckets, opts.Granularity)
+		}
+	}
+	return from, to, nil
+}
+
+// fillSeries returns every bucket of [from, to), taking counts from the sparse buckets
+// returned by the repository and zero for the rest.
+func fillSeries(sparse []Bucket, from, to time.Time, g Granularity) []Bucket {
+	counts := make(map[string]int64, len(sparse))
+	for _, b := range sparse {
+		counts[g.key(b.Start)] += b.Count
+	}
+
+	series := make([]Bucket, 0, len(sparse))
+	prevKey := ""
+	for start := g.truncate(from); start.Before(to); start = g.next(start) {
+		k := g.key(start)
+		if k == prevKey {
+			continue
+		}
+		prevKey = k
+		series = append(series, Bucket{Start: start, Count: counts[k]})
+	}
+	return series
+}
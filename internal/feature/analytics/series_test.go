@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFillSeries_FillsGapsInViewerZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2026, 3, 28, 0, 0, 0, 0, berlin)
+	to := time.Date(2026, 3, 31, 0, 0, 0, 0, berlin)
+	sparse := []Bucket{{Start: time.Date(2026, 3, 29, 0, 0, 0, 0, berlin), Count: 4}}
+
+	series := fillSeries(sparse, from, to, GranularityDay)
+
+	// 29 March is 23 hours long in Berlin; days still start at local midnight.
+	want := []struct {
+		date  string
+		count int64
+	}{{"2026-03-28", 0}, {"2026-03-29", 4}, {"2026-03-30", 0}}
+	if len(series) != len(want) {
+		t.Fatalf("expected %d buckets, got %+v", len(want), series)
+	}
+	for i, w := range want {
+		if got := series[i].Start.Format("2006-01-02T15:04"); got != w.date+"T00:00" || series[i].Count != w.count {
+			t.Fatalf("bucket %d: got %s=%d, want %s=%d", i, got, series[i].Count, w.date, w.count)
+		}
+	}
+}
+
+func TestFillSeries_HourlyAcrossFallBack(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clocks go back from 03:00 to 02:00 on 25 October 2026; Postgres reports both 02:xx hours as one bucket.
+	from := time.Date(2026, 10, 25, 1, 0, 0, 0, berlin)
+	to := time.Date(2026, 10, 25, 4, 0, 0, 0, berlin)
+	sparse := []Bucket{{Start: time.Date(2026, 10, 25, 2, 0, 0, 0, berlin), Count: 7}}
+
+	series := fillSeries(sparse, from, to, GranularityHour)
+
+	if len(series) != 3 {
+		t.Fatalf("expected hours 01, 02 and 03, got %+v", series)
+	}
+	if series[1].Start.Hour() != 2 || series[1].Count != 7 {
+		t.Fatalf("unexpected 02:00 bucket: %+v", series[1])
+	}
+}
+
+func TestGranularity_Truncate(t *testing.T) {
+	at := time.Date(2026, 10, 15, 13, 45, 0, 0, time.UTC) // Thursday
+
+	tests := []struct {
+		g    Granularity
+		want time.Time
+	}{
+		{GranularityHour, time.Date(2026, 10, 15, 13, 0, 0, 0, time.UTC)},
+		{GranularityDay, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+		{GranularityWeek, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)},
+		{GranularityMonth, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := tt.g.truncate(at); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.g, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRange(t *testing.T) {
+	now := time.Date(2026, 10, 15, 13, 45, 0, 0, time.UTC)
+
+	from, to, err := resolveRange(TimeRange{Days: 7, Granularity: GranularityDay, Location: time.UTC}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !from.Equal(time.Date(2026, 10, 9, 0, 0, 0, 0, time.UTC)) || !to.Equal(now) {
+		t.Fatalf("unexpected range %s..%s", from, to)
+	}
+
+	invalid := []TimeRange{
+		{From: now, To: now.Add(-time.Hour), Granularity: GranularityDay, Location: time.UTC},
+		{From: now.AddDate(-2, 0, 0), To: now, Granularity: GranularityMonth, Location: time.UTC},
+		{From: now.AddDate(0, -6, 0), To: now, Granularity: GranularityHour, Location: time.UTC},
+	}
+	for _, opts := range invalid {
+		if _, _, err := resolveRange(opts, now); !errors.Is(err, ErrInvalidStatsRange) {
+			t.Errorf("%s..%s by %s: expected ErrInvalidStatsRange, got %v", opts.From, opts.To, opts.Granularity, err)
+		}
+	}
+}
@@ -2,40 +2,132 @@ package analytics
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/viacheslaev/url-shortener/internal/feature/link"
+	"github.com/viacheslaev/url-shortener/internal/geoip"
+	"github.com/viacheslaev/url-shortener/internal/useragent"
 )
 
 type AnalyticsService struct {
 	analyticsRepo  AnalyticsRepository
 	linksRepo      LinkRepository
 	clickEventChan chan link.ClickEvent
+	spool          *ClickSpool
+	geo            GeoLocator
+	visitors       *VisitorIdentifier
+	liveClicks     *clickBroker
+	notifier       ClickNotifier
+
+	enqueued, spooled, spoolFailures, dropped, failed, rejected atomic.Int64
+}
+
+// ClickQueueStats are counters of the click event queue.
+type ClickQueueStats struct {
+	Queued            int   `json:"queued"`
+	Capacity          int   `json:"capacity"`
+	Enqueued          int64 `json:"enqueued"`
+	Spooled           int64 `json:"spooled"`
+	SpoolFailures     int64 `json:"spool_failures"`
+	SpoolPendingBytes int64 `json:"spool_pending_bytes"`
+	Dropped           int64 `json:"dropped"`
+	Failed            int64 `json:"failed"`   // clicks lost because storing their batch kept failing
+	Rejected          int64 `json:"rejected"` // clicks refused by the database and dead-lettered
+}
+
+// GeoLocator resolves click IPs to locations (see geoip.Locator).
+type GeoLocator interface {
+	Lookup(ip string) geoip.Location
+}
+
+// ClickNotifier is told about stored clicks, e.g. to deliver them as webhooks.
+type ClickNotifier interface {
+	ClicksStored(ctx context.Context, clicks []Click)
 }
 
-func NewAnalyticsService(analyticRepo AnalyticsRepository, linkRepo LinkRepository) *AnalyticsService {
+// NewAnalyticsService creates the service. spool is optional: with nil spool click events
+// are buffered in memory only and are lost on a crash. geo is optional too: with nil geo
+// clicks are stored without location. With nil visitors, visitors are identified by their IP,
+// which is stored as it is. notifier is optional.
+func NewAnalyticsService(analyticRepo AnalyticsRepository, linkRepo LinkRepository, spool *ClickSpool, geo GeoLocator, visitors *VisitorIdentifier, notifier ClickNotifier) *AnalyticsService {
 	return &AnalyticsService{
 		analyticsRepo:  analyticRepo,
 		linksRepo:      linkRepo,
 		clickEventChan: make(chan link.ClickEvent, 10_000),
+		spool:          spool,
+		geo:            geo,
+		visitors:       visitors,
+		liveClicks:     newClickBroker(),
+		notifier:       notifier,
 	}
 }
 
 // TrackClick publishes click event to background analytics worker.
-// The call is non-blocking and will drop the event if the internal buffer is full,
-// so redirect path is never slowed down by analytics processing.
+// With a spool the event is appended to disk. Otherwise, or when the spool is full or failing,
+// it goes to the in-memory buffer. The call never blocks: when the buffer is full too, the event
+// is dropped and counted, so redirect path is never slowed down by analytics processing.
 func (service *AnalyticsService) TrackClick(ev link.ClickEvent) {
+	if ev.EventID == "" {
+		ev.EventID = newClickEventID()
+	}
+	if ev.OccurredAt.IsZero() {
+		ev.OccurredAt = time.Now().UTC()
+	}
+
+	if service.spool != nil {
+		if err := service.spool.Append(ev); err == nil {
+			service.spooled.Add(1)
+			return
+		}
+		service.spoolFailures.Add(1)
+	}
+
 	select {
 	case service.clickEventChan <- ev:
+		service.enqueued.Add(1)
 	default:
-		// drop if buffer is full
+		service.dropped.Add(1)
 	}
 }
 
-func (service *AnalyticsService) GetLinkAnalytics(ctx context.Context, accPublicId string, shortCode string, days int) (Stats, error) {
+// newClickEventID returns a random (version 4) UUID, or "" if the random source fails:
+// the click is then stored without one.
+func newClickEventID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// QueueStats returns a snapshot of the click queue counters.
+func (service *AnalyticsService) QueueStats() ClickQueueStats {
+	stats := ClickQueueStats{
+		Queued:        len(service.clickEventChan),
+		Capacity:      cap(service.clickEventChan),
+		Enqueued:      service.enqueued.Load(),
+		Spooled:       service.spooled.Load(),
+		SpoolFailures: service.spoolFailures.Load(),
+		Dropped:       service.dropped.Load(),
+		Failed:        service.failed.Load(),
+		Rejected:      service.rejected.Load(),
+	}
+	if service.spool != nil {
+		stats.SpoolPendingBytes = service.spool.Pending()
+	}
+	return stats
+}
+
+func (service *AnalyticsService) GetLinkAnalytics(ctx context.Context, accPublicId string, shortCode string, opts StatsOptions) (Stats, error) {
 	linkID, err := service.linksRepo.GetLinkByCodeAndAccountPublicId(ctx, shortCode, accPublicId)
 	if err != nil {
 		if errors.Is(err, link.ErrNotFound) {
@@ -45,24 +137,292 @@ func (service *AnalyticsService) GetLinkAnalytics(ctx context.Context, accPublic
 		return Stats{}, fmt.Errorf("get analytics failed: %w", err)
 	}
 
-	since := time.Now().UTC().AddDate(0, 0, -days)
+	from, to, err := resolveRange(opts.TimeRange, time.Now())
+	if err != nil {
+		return Stats{}, err
+	}
+
+	scope := ClickScope{LinkID: linkID}
+	stats, err := service.getStats(ctx, scope, from, to, opts)
+	if err != nil {
+		return Stats{}, err
+	}
 
-	return service.analyticsRepo.GetStats(ctx, linkID, since)
+	if opts.ComparePrevious {
+		comparison, err := service.compareWithPrevious(ctx, scope, stats, opts, true)
+		if err != nil {
+			return Stats{}, err
+		}
+		stats.Comparison = &comparison
+	}
+	return stats, nil
 }
 
-func (service *AnalyticsService) handleClickEvent(ev link.ClickEvent) {
-	log.Printf("[analytics] click link_id=%d ip=%s", ev.LinkID, ev.IP)
+// GetAccountOverview aggregates clicks of all links of the account, ranks its links
+// and compares the totals with the previous period of equal length.
+func (service *AnalyticsService) GetAccountOverview(ctx context.Context, accPublicId string, opts OverviewOptions) (Overview, error) {
+	from, to, err := resolveRange(opts.TimeRange, time.Now())
+	if err != nil {
+		return Overview{}, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	scope := ClickScope{AccountPublicID: accPublicId}
+	stats, err := service.getStats(ctx, scope, from, to, opts.StatsOptions)
+	if err != nil {
+		return Overview{}, err
+	}
+
+	topLinks := make([]LinkCount, 0)
+	if opts.LinksLimit > 0 {
+		topLinks, err = service.analyticsRepo.GetTopLinks(ctx, TopLinksQuery{
+			AccountPublicID: accPublicId,
+			From:            from,
+			To:              to,
+			IncludeBots:     opts.IncludeBots,
+			Limit:           opts.LinksLimit,
+		})
+		if err != nil {
+			return Overview{}, fmt.Errorf("get top links failed: %w", err)
+		}
+	}
+
+	// Trends are always included; the previous series only on request, as for link stats.
+	comparison, err := service.compareWithPrevious(ctx, scope, stats, opts.StatsOptions, opts.ComparePrevious)
+	if err != nil {
+		return Overview{}, err
+	}
+	if opts.ComparePrevious {
+		stats.Comparison = &comparison
+	}
+
+	return Overview{Stats: stats, TopLinks: topLinks, Trend: comparison.Trend}, nil
+}
+
+// subscribeLinkClicks subscribes to the clicks of one of the account's links as they are stored.
+// The subscription must be ended with unsubscribeClicks.
+func (service *AnalyticsService) subscribeLinkClicks(ctx context.Context, accPublicId string, shortCode string) (*clickSubscription, error) {
+	linkID, err := service.linksRepo.GetLinkByCodeAndAccountPublicId(ctx, shortCode, accPublicId)
+	if err != nil {
+		if errors.Is(err, link.ErrNotFound) {
+			return nil, ErrAnalyticsNotFound
+		}
+
+		return nil, fmt.Errorf("subscribe to clicks failed: %w", err)
+	}
+
+	sub := service.liveClicks.subscribe(linkID)
+	if sub == nil {
+		return nil, ErrClickStreamClosed
+	}
+	return sub, nil
+}
+
+func (service *AnalyticsService) unsubscribeClicks(sub *clickSubscription) {
+	service.liveClicks.unsubscribe(sub)
+}
+
+// CloseClickStreams ends all live click streams, so that they don't keep the server from shutting down.
+func (service *AnalyticsService) CloseClickStreams() {
+	service.liveClicks.close()
+}
+
+// ExportLinkClicks writes the raw clicks of one of the account's links to w; see ExportAccountClicks.
+func (service *AnalyticsService) ExportLinkClicks(ctx context.Context, accPublicId string, shortCode string, opts ExportOptions, w io.Writer) error {
+	linkID, err := service.linksRepo.GetLinkByCodeAndAccountPublicId(ctx, shortCode, accPublicId)
+	if err != nil {
+		if errors.Is(err, link.ErrNotFound) {
+			return ErrAnalyticsNotFound
+		}
+
+		return fmt.Errorf("export clicks failed: %w", err)
+	}
+
+	return service.exportClicks(ctx, ClickScope{LinkID: linkID}, opts, w)
+}
+
+// ExportAccountClicks writes the raw clicks of all links of the account in [opts.From, opts.To),
+// at most maxExportRange, to w in opts.Format, streaming rows from the repository as they are read.
+// Nothing is written to w before the request is validated.
+func (service *AnalyticsService) ExportAccountClicks(ctx context.Context, accPublicId string, opts ExportOptions, w io.Writer) error {
+	return service.exportClicks(ctx, ClickScope{AccountPublicID: accPublicId}, opts, w)
+}
+
+func (service *AnalyticsService) exportClicks(ctx context.Context, scope ClickScope, opts ExportOptions, w io.Writer) error {
+	to := opts.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !opts.From.Before(to) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidStatsRange)
+	}
+	if to.Sub(opts.From) > maxExportRange {
+		return fmt.Errorf("%w: export range exceeds 93 days", ErrInvalidStatsRange)
+	}
+
+	var hasher *ipHasher
+	if !opts.RawIPs {
+		var err error
+		if hasher, err = newIPHasher(); err != nil {
+			return fmt.Errorf("create ip hasher: %w", err)
+		}
+	}
+
+	cw, err := newClickWriter(opts.Format, w)
+	if err != nil {
+		return err
+	}
+
+	query := ExportQuery{Scope: scope, From: opts.From, To: to, IncludeBots: opts.IncludeBots}
+	err = service.analyticsRepo.StreamClicks(ctx, query, func(c ExportedClick) error {
+		if hasher != nil {
+			c.IPAddress = hasher.hash(c.IPAddress)
+		}
+		return cw.write(c)
+	})
+	if err != nil {
+		return fmt.Errorf("export clicks failed: %w", err)
+	}
+	return cw.flush()
+}
+
+// compareWithPrevious computes the totals, and optionally the series, of the period of equal
+// length right before the current stats, and the change between both.
+func (service *AnalyticsService) compareWithPrevious(ctx context.Context, scope ClickScope, current Stats, opts StatsOptions, withSeries bool) (Comparison, error) {
+	prevFrom, prevTo := previousPeriod(current.From, current.To)
+
+	previous, err := service.analyticsRepo.GetTotals(ctx, TotalsQuery{
+		Scope:       scope,
+		From:        prevFrom,
+		To:          prevTo,
+		IncludeBots: opts.IncludeBots,
+	})
+	if err != nil {
+		return Comparison{}, fmt.Errorf("get previous period totals failed: %w", err)
+	}
+
+	comparison := Comparison{Trend: Trend{
+		PreviousFrom: prevFrom,
+		PreviousTo:   prevTo,
+		TotalClicks:  newChange(current.TotalClicks, previous.TotalClicks),
+		UniqueClicks: newChange(current.UniqueClicks, previous.UniqueClicks),
+	}}
+	if !withSeries {
+		return comparison, nil
+	}
+
+	sparse, err := service.analyticsRepo.GetSeries(ctx, SeriesQuery{
+		Scope:       scope,
+		From:        prevFrom,
+		To:          prevTo,
+		Granularity: opts.Granularity,
+		Location:    opts.Location,
+		IncludeBots: opts.IncludeBots,
+	})
+	if err != nil {
+		return Comparison{}, fmt.Errorf("get previous period series failed: %w", err)
+	}
+	previousSeries := fillSeries(sparse, prevFrom, prevTo, opts.Granularity)
+	comparison.Series = shiftSeries(previousSeries, current.Series, current.To.Sub(current.From))
+	return comparison, nil
+}
+
+// getStats computes the stats of a scope in the resolved range [from, to) and fills the series gaps.
+func (service *AnalyticsService) getStats(ctx context.Context, scope ClickScope, from, to time.Time, opts StatsOptions) (Stats, error) {
+	stats, err := service.analyticsRepo.GetStats(ctx, StatsQuery{
+		Scope:                scope,
+		From:                 from,
+		To:                   to,
+		Granularity:          opts.Granularity,
+		Location:             opts.Location,
+		IncludeBots:          opts.IncludeBots,
+		ReferrerDomainsLimit: opts.ReferrerDomainsLimit,
+		ReferrersLimit:       opts.ReferrersLimit,
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats.From, stats.To = from, to
+	stats.Series = fillSeries(stats.Series, from, to, opts.Granularity)
+	stats.Conversions.Rate = conversionRate(stats.Conversions.ConvertedClicks, stats.TotalClicks)
+	return stats, nil
+}
+
+// conversionRate is the percentage of clicks that converted, rounded to two decimals, nil without clicks.
+// Conversions are counted when recorded while clicks when they happened, so the rate of short periods
+// may slightly exceed 100.
+func conversionRate(converted, clicks int64) *float64 {
+	if clicks == 0 {
+		return nil
+	}
+	rate := math.Round(float64(converted)/float64(clicks)*10000) / 100
+	return &rate
+}
+
+// saveClicks stores a batch of click events.
+func (service *AnalyticsService) saveClicks(events []link.ClickEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := service.analyticsRepo.SaveClick(ctx, Click{
-		LinkID:    ev.LinkID,
-		IPAddress: ev.IP,
-		UserAgent: ev.UserAgent,
-		Referer:   ev.Referer,
-		CreatedAt: time.Now().UTC(),
-	}); err != nil {
-		log.Printf("[analytics] failed to save click link_id=%d err=%v", ev.LinkID, err)
+	clicks := make([]Click, 0, len(events))
+	for _, ev := range events {
+		// Events are stamped when tracked; only events spooled before that was done have no time.
+		createdAt := ev.OccurredAt
+		if createdAt.IsZero() {
+			createdAt = time.Now().UTC()
+		}
+		agent := useragent.Parse(ev.UserAgent)
+		var location geoip.Location
+		if service.geo != nil {
+			location = service.geo.Lookup(ev.IP)
+		}
+		click := Click{
+			LinkID:        ev.LinkID,
+			IPAddress:     ev.IP,
+			UserAgent:     ev.UserAgent,
+			Referer:       ev.Referer,
+			RefererDomain: refererDomain(ev.Referer),
+			Browser:       agent.Browser,
+			OS:            agent.OS,
+			Device:        agent.Device,
+			Country:       location.Country,
+			Region:        location.Region,
+			City:          location.City,
+			TrafficType:   ev.TrafficType,
+			ClickID:       ev.ClickID,
+			EventID:       ev.EventID,
+			CreatedAt:     createdAt,
+		}
+		if err := service.visitors.identify(ctx, ev, &click); err != nil {
+			return err
+		}
+		clicks = append(clicks, click)
+	}
+
+	if err := service.analyticsRepo.SaveClicks(ctx, clicks); err != nil {
+		return err
+	}
+	log.Printf("[analytics] stored clicks=%d", len(clicks))
+	service.liveClicks.publish(clicks)
+	if service.notifier != nil {
+		service.notifier.ClicksStored(ctx, clicks)
+	}
+	return nil
+}
+
+// rejectClick dead-letters a click event the database refused to store.
+func (service *AnalyticsService) rejectClick(ev link.ClickEvent, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	payload, err := encodeClickEvent(ev)
+	if err != nil {
+		return err
+	}
+	if err := service.analyticsRepo.SaveRejectedClick(ctx, payload, cause.Error()); err != nil {
+		return err
 	}
+	service.rejected.Add(1)
+	log.Printf("[analytics] dead-lettered rejected click link_id=%d: %v", ev.LinkID, cause)
+	return nil
 }
@@ -0,0 +1,495 @@
+package analytics
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+const (
+	segmentExt         = ".seg"
+	checkpointFileName = "checkpoint"
+
+	// recordHeaderSize is the length (uint32) and CRC32 (uint32) prefix of every record.
+	recordHeaderSize = 8
+	// maxRecordSize guards against reading garbage as a huge length.
+	maxRecordSize = 1 << 20
+)
+
+var errSpoolFull = errors.New("click spool is full")
+
+// ClickSpoolConfig configures ClickSpool.
+type ClickSpoolConfig struct {
+	Dir          string
+	SegmentSize  int64         // a new segment file is started once the active one reaches this size
+	MaxSize      int64         // events are dropped once unconsumed segments reach this size
+	SyncInterval time.Duration // how often written data and the checkpoint are fsynced
+}
+
+// spoolPosition is a consumer position: segment sequence number and byte offset in it.
+type spoolPosition struct {
+	seq    uint64
+	offset int64
+}
+
+// spooledClick is the on-disk form of link.ClickEvent.
+type spooledClick struct {
+	LinkID      int64            `json:"link_id"`
+	IP          string           `json:"ip"`
+	UserAgent   string           `json:"user_agent"`
+	Referer     string           `json:"referer"`
+	TrafficType link.TrafficType `json:"traffic_type"`
+	OccurredAt  time.Time        `json:"occurred_at"`
+	VisitorID   string           `json:"visitor_id,omitempty"`
+	ClickID     string           `json:"click_id,omitempty"`
+	EventID     string           `json:"event_id,omitempty"`
+}
+
+// ClickSpool is a segmented append-only write-ahead log of click events.
+// TrackClick appends to the active segment, ClickEventWorker reads from the checkpoint
+// and moves it forward once events are stored. Fully consumed segments are deleted.
+//
+// Every record is written with a single write call, so events survive a process crash;
+// events written after the last fsync may be lost on power failure.
+//
+// Record layout: uint32 payload length, uint32 CRC32 of the payload, JSON payload.
+type ClickSpool struct {
+	cfg ClickSpoolConfig
+
+	mu         sync.Mutex
+	sizes      map[uint64]int64 // size of every segment on disk
+	active     *os.File
+	activeSeq  uint64
+	totalSize  int64
+	dirty      bool
+	checkpoint *os.File
+	closed     bool
+
+	// notify wakes up the consumer after an append.
+	notify chan struct{}
+
+	// Consumer state, used by a single goroutine.
+	readFile *os.File
+	readPos  spoolPosition
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// OpenClickSpool opens the spool in cfg.Dir, creating it if needed. Writes always go to a new segment;
+// events left over from a previous run are read first, which replays them after a restart.
+func OpenClickSpool(cfg ClickSpoolConfig) (*ClickSpool, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &ClickSpool{
+		cfg:     cfg,
+		sizes:   make(map[uint64]int64),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	seqs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := os.OpenFile(filepath.Join(cfg.Dir, checkpointFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.checkpoint = checkpoint
+
+	pos, ok, err := s.readCheckpoint()
+	if err != nil {
+		_ = checkpoint.Close()
+		return nil, err
+	}
+	if !ok && len(seqs) > 0 {
+		pos = spoolPosition{seq: seqs[0]}
+	}
+
+	for _, seq := range seqs {
+		if ok && seq < pos.seq {
+			// Consumed before the last run stopped, but not deleted yet.
+			_ = os.Remove(s.segmentPath(seq))
+			continue
+		}
+		info, err := os.Stat(s.segmentPath(seq))
+		if err != nil {
+			_ = checkpoint.Close()
+			return nil, err
+		}
+		s.sizes[seq] = info.Size()
+		s.totalSize += info.Size()
+	}
+
+	next := pos.seq + 1
+	if len(seqs) > 0 {
+		next = max(next, seqs[len(seqs)-1]+1)
+	}
+	if _, exists := s.sizes[pos.seq]; !exists && (len(seqs) == 0 || pos.seq > seqs[len(seqs)-1]) {
+		pos = spoolPosition{seq: next}
+	}
+	s.readPos = pos
+
+	if err := s.openSegment(next); err != nil {
+		_ = checkpoint.Close()
+		return nil, err
+	}
+
+	if pending := s.Pending(); pending > 0 {
+		log.Printf("[spool] replaying click spool dir=%s pending_bytes=%d", cfg.Dir, pending)
+	}
+
+	go s.syncLoop()
+
+	return s, nil
+}
+
+// encodeClickEvent encodes the event as it is spooled and dead-lettered.
+func encodeClickEvent(ev link.ClickEvent) ([]byte, error) {
+	return json.Marshal(spooledClick{
+		LinkID:      ev.LinkID,
+		IP:          ev.IP,
+		UserAgent:   ev.UserAgent,
+		Referer:     ev.Referer,
+		TrafficType: ev.TrafficType,
+		OccurredAt:  ev.OccurredAt,
+		VisitorID:   ev.VisitorID,
+		ClickID:     ev.ClickID,
+		EventID:     ev.EventID,
+	})
+}
+
+// Append writes the event to the active segment.
+func (s *ClickSpool) Append(ev link.ClickEvent) error {
+	payload, err := encodeClickEvent(ev)
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	if s.totalSize+int64(len(record)) > s.cfg.MaxSize {
+		return errSpoolFull
+	}
+	if s.sizes[s.activeSeq] > 0 && s.sizes[s.activeSeq]+int64(len(record)) > s.cfg.SegmentSize {
+		if err := s.rollLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.active.Write(record)
+	s.sizes[s.activeSeq] += int64(n)
+	s.totalSize += int64(n)
+	s.dirty = true
+	if err != nil {
+		// A torn record is skipped by the reader; start clean in a new segment.
+		_ = s.rollLocked()
+		return err
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the number of spooled bytes not yet consumed.
+func (s *ClickSpool) Pending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending int64
+	for seq, size := range s.sizes {
+		if seq >= s.readPos.seq {
+			pending += size
+		}
+	}
+	return pending - s.readPos.offset
+}
+
+// next reads the event at the consumer position. ok is false when everything written so far has been read.
+// The returned position must be passed to commit once the event is stored.
+func (s *ClickSpool) next() (ev link.ClickEvent, pos spoolPosition, ok bool, err error) {
+	for {
+		s.mu.Lock()
+		pos = s.readPos
+		limit, exists := s.sizes[pos.seq]
+		sealed := pos.seq < s.activeSeq
+		s.mu.Unlock()
+
+		if !exists {
+			if !sealed {
+				return link.ClickEvent{}, pos, false, nil
+			}
+			s.advanceTo(pos.seq + 1)
+			continue
+		}
+
+		if pos.offset+recordHeaderSize > limit {
+			if !sealed {
+				return link.ClickEvent{}, pos, false, nil
+			}
+			if pos.offset < limit {
+				log.Printf("[spool] skipping torn record segment=%d offset=%d", pos.seq, pos.offset)
+			}
+			s.advanceTo(pos.seq + 1)
+			continue
+		}
+
+		ev, size, err := s.readRecord(pos, limit)
+		if err != nil {
+			log.Printf("[spool] skipping rest of segment=%d offset=%d: %v", pos.seq, pos.offset, err)
+			if !sealed {
+				s.mu.Lock()
+				rollErr := s.rollLocked()
+				s.mu.Unlock()
+				if rollErr != nil {
+					return link.ClickEvent{}, pos, false, rollErr
+				}
+			}
+			s.advanceTo(pos.seq + 1)
+			continue
+		}
+
+		next := spoolPosition{seq: pos.seq, offset: pos.offset + size}
+		s.mu.Lock()
+		s.readPos = next
+		s.mu.Unlock()
+		return ev, next, true, nil
+	}
+}
+
+// commit stores pos as the checkpoint and deletes segments before it.
+func (s *ClickSpool) commit(pos spoolPosition) error {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[0:8], pos.seq)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(pos.offset))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.checkpoint.WriteAt(buf[:], 0); err != nil {
+		return err
+	}
+	s.dirty = true
+
+	for seq, size := range s.sizes {
+		if seq < pos.seq {
+			if err := os.Remove(s.segmentPath(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[spool] failed to delete consumed segment=%d: %v", seq, err)
+				continue
+			}
+			delete(s.sizes, seq)
+			s.totalSize -= size
+		}
+	}
+	return nil
+}
+
+// Close syncs and closes the spool files. Unconsumed events stay on disk for the next run.
+func (s *ClickSpool) Close() error {
+	close(s.done)
+	<-s.stopped
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.syncLocked()
+	if s.readFile != nil {
+		_ = s.readFile.Close()
+	}
+	return errors.Join(s.active.Close(), s.checkpoint.Close())
+}
+
+func (s *ClickSpool) syncLoop() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.syncLocked()
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// syncLocked must be called with mu held.
+func (s *ClickSpool) syncLocked() {
+	if !s.dirty {
+		return
+	}
+	if err := s.active.Sync(); err != nil {
+		log.Printf("[spool] failed to sync segment=%d: %v", s.activeSeq, err)
+	}
+	if err := s.checkpoint.Sync(); err != nil {
+		log.Printf("[spool] failed to sync checkpoint: %v", err)
+	}
+	s.dirty = false
+}
+
+// rollLocked seals the active segment and starts the next one. Must be called with mu held.
+func (s *ClickSpool) rollLocked() error {
+	if err := s.active.Sync(); err != nil {
+		log.Printf("[spool] failed to sync segment=%d: %v", s.activeSeq, err)
+	}
+	if err := s.active.Close(); err != nil {
+		log.Printf("[spool] failed to close segment=%d: %v", s.activeSeq, err)
+	}
+	return s.openSegment(s.activeSeq + 1)
+}
+
+func (s *ClickSpool) openSegment(seq uint64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.active = f
+	s.activeSeq = seq
+	s.sizes[seq] = info.Size()
+	s.totalSize += info.Size()
+	return nil
+}
+
+// advanceTo moves the consumer to the start of segment seq.
+func (s *ClickSpool) advanceTo(seq uint64) {
+	if s.readFile != nil {
+		_ = s.readFile.Close()
+		s.readFile = nil
+	}
+	s.mu.Lock()
+	s.readPos = spoolPosition{seq: seq}
+	s.mu.Unlock()
+}
+
+// readRecord reads and verifies one record. limit is the number of bytes known to be fully written.
+func (s *ClickSpool) readRecord(pos spoolPosition, limit int64) (link.ClickEvent, int64, error) {
+	if s.readFile == nil || s.readFile.Name() != s.segmentPath(pos.seq) {
+		if s.readFile != nil {
+			_ = s.readFile.Close()
+		}
+		f, err := os.Open(s.segmentPath(pos.seq))
+		if err != nil {
+			return link.ClickEvent{}, 0, err
+		}
+		s.readFile = f
+	}
+
+	var header [recordHeaderSize]byte
+	if _, err := s.readFile.ReadAt(header[:], pos.offset); err != nil {
+		return link.ClickEvent{}, 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > maxRecordSize {
+		return link.ClickEvent{}, 0, fmt.Errorf("invalid record length %d", length)
+	}
+	size := recordHeaderSize + length
+	if pos.offset+size > limit {
+		return link.ClickEvent{}, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := make([]byte, length)
+	if _, err := s.readFile.ReadAt(payload, pos.offset+recordHeaderSize); err != nil {
+		return link.ClickEvent{}, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return link.ClickEvent{}, 0, errors.New("checksum mismatch")
+	}
+
+	var rec spooledClick
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return link.ClickEvent{}, 0, err
+	}
+	return link.ClickEvent{
+		LinkID:      rec.LinkID,
+		IP:          rec.IP,
+		UserAgent:   rec.UserAgent,
+		Referer:     rec.Referer,
+		TrafficType: rec.TrafficType,
+		OccurredAt:  rec.OccurredAt,
+		VisitorID:   rec.VisitorID,
+		ClickID:     rec.ClickID,
+		EventID:     rec.EventID,
+	}, size, nil
+}
+
+// readCheckpoint returns the stored consumer position; ok is false for a new spool.
+func (s *ClickSpool) readCheckpoint() (spoolPosition, bool, error) {
+	var buf [16]byte
+	n, err := s.checkpoint.ReadAt(buf[:], 0)
+	if errors.Is(err, io.EOF) && n < len(buf) {
+		return spoolPosition{}, false, nil
+	}
+	if err != nil {
+		return spoolPosition{}, false, err
+	}
+	return spoolPosition{
+		seq:    binary.BigEndian.Uint64(buf[0:8]),
+		offset: int64(binary.BigEndian.Uint64(buf[8:16])),
+	}, true, nil
+}
+
+func (s *ClickSpool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+func (s *ClickSpool) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
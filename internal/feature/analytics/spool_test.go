@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+func openTestSpool(t *testing.T, dir string, segmentSize int64) *ClickSpool {
+	t.Helper()
+	spool, err := OpenClickSpool(ClickSpoolConfig{
+		Dir:          dir,
+		SegmentSize:  segmentSize,
+		MaxSize:      1 << 20,
+		SyncInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("open spool: %v", err)
+	}
+	return spool
+}
+
+// readAll consumes everything spooled so far, committing after every event when commit is set.
+func readAll(t *testing.T, spool *ClickSpool, commit bool) []int64 {
+	t.Helper()
+	var ids []int64
+	for {
+		ev, pos, ok, err := spool.next()
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		if !ok {
+			return ids
+		}
+		ids = append(ids, ev.LinkID)
+		if commit {
+			if err := spool.commit(pos); err != nil {
+				t.Fatalf("commit: %v", err)
+			}
+		}
+	}
+}
+
+func TestClickSpool_ReplaysUncommittedEventsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	spool := openTestSpool(t, dir, 1<<20)
+
+	occurredAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for id := int64(1); id <= 3; id++ {
+		if err := spool.Append(link.ClickEvent{LinkID: id, IP: "1.2.3.4", OccurredAt: occurredAt}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	ev, pos, ok, err := spool.next()
+	if err != nil || !ok {
+		t.Fatalf("expected event, ok=%t err=%v", ok, err)
+	}
+	if ev.LinkID != 1 || ev.IP != "1.2.3.4" || !ev.OccurredAt.Equal(occurredAt) {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	if err := spool.commit(pos); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	// Read but not committed: must be replayed.
+	if _, _, ok, _ := spool.next(); !ok {
+		t.Fatal("expected second event")
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened := openTestSpool(t, dir, 1<<20)
+	defer reopened.Close()
+
+	got := readAll(t, reopened, true)
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("expected events 2,3 to be replayed, got %v", got)
+	}
+	if pending := reopened.Pending(); pending != 0 {
+		t.Fatalf("expected nothing pending, got %d bytes", pending)
+	}
+}
+
+func TestClickSpool_RollsAndDeletesConsumedSegments(t *testing.T) {
+	dir := t.TempDir()
+	spool := openTestSpool(t, dir, 64) // one record per segment
+	defer spool.Close()
+
+	for id := int64(1); id <= 5; id++ {
+		if err := spool.Append(link.ClickEvent{LinkID: id}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(segments) < 5 {
+		t.Fatalf("expected a segment per record, got %d", len(segments))
+	}
+
+	got := readAll(t, spool, true)
+	if len(got) != 5 {
+		t.Fatalf("expected 5 events, got %v", got)
+	}
+
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(segments) != 1 {
+		t.Fatalf("expected only the active segment to remain, got %v", segments)
+	}
+}
+
+func TestClickSpool_SkipsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	spool := openTestSpool(t, dir, 1<<20)
+	_ = spool.Append(link.ClickEvent{LinkID: 1})
+	_ = spool.Close()
+
+	// Simulate a crash in the middle of a write.
+	segment := spool.segmentPath(spool.activeSeq)
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 40, 1, 2})
+	_ = f.Close()
+
+	reopened := openTestSpool(t, dir, 1<<20)
+	defer reopened.Close()
+	_ = reopened.Append(link.ClickEvent{LinkID: 2})
+
+	got := readAll(t, reopened, true)
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected events 1,2 around the torn record, got %v", got)
+	}
+}
+
+func TestClickSpool_RejectsAppendWhenFull(t *testing.T) {
+	spool, err := OpenClickSpool(ClickSpoolConfig{Dir: t.TempDir(), SegmentSize: 64, MaxSize: 64, SyncInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("open spool: %v", err)
+	}
+	defer spool.Close()
+
+	var appendErr error
+	for i := 0; i < 10 && appendErr == nil; i++ {
+		appendErr = spool.Append(link.ClickEvent{LinkID: int64(i)})
+	}
+
+	if !errors.Is(appendErr, errSpoolFull) {
+		t.Fatalf("expected errSpoolFull, got %v", appendErr)
+	}
+}
@@ -0,0 +1,94 @@
+package analytics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// liveClickBufferSize bounds the clicks queued for one stream subscriber. When a slow client lets
+// its buffer fill up, further clicks are dropped for it (and counted) instead of blocking the publisher.
+const liveClickBufferSize = 256
+
+// clickBroker fans out stored clicks to the live streams of their links. It only sees the clicks
+// stored by this instance.
+type clickBroker struct {
+	mu     sync.RWMutex
+	subs   map[int64]map[*clickSubscription]struct{}
+	closed bool
+}
+
+// clickSubscription receives the clicks of one link. Clicks is closed when the broker closes.
+type clickSubscription struct {
+	linkID  int64
+	clicks  chan Click
+	dropped atomic.Int64
+}
+
+func newClickBroker() *clickBroker {
+	return &clickBroker{subs: make(map[int64]map[*clickSubscription]struct{})}
+}
+
+// subscribe registers a subscriber of the link's clicks. It returns nil once the broker is closed.
+func (b *clickBroker) subscribe(linkID int64) *clickSubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	sub := &clickSubscription{linkID: linkID, clicks: make(chan Click, liveClickBufferSize)}
+	if b.subs[linkID] == nil {
+		b.subs[linkID] = make(map[*clickSubscription]struct{})
+	}
+	b.subs[linkID][sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes the subscriber; it is a no-op once the broker closed it.
+func (b *clickBroker) unsubscribe(sub *clickSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if subs, ok := b.subs[sub.linkID]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(b.subs, sub.linkID)
+		}
+	}
+}
+
+// publish hands the clicks to the subscribers of their links without ever blocking.
+func (b *clickBroker) publish(clicks []Click) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.subs) == 0 {
+		return
+	}
+	for _, c := range clicks {
+		for sub := range b.subs[c.LinkID] {
+			select {
+			case sub.clicks <- c:
+			default:
+				sub.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// close ends all subscriptions, e.g. on shutdown, so streams don't hold the server open.
+func (b *clickBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			close(sub.clicks)
+		}
+	}
+	b.subs = make(map[int64]map[*clickSubscription]struct{})
+}
@@ -0,0 +1,136 @@
+package analytics
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+func TestClickBroker_DropsClicksOfSlowSubscribers(t *testing.T) {
+	broker := newClickBroker()
+	slow := broker.subscribe(1)
+	other := broker.subscribe(2)
+
+	clicks := make([]Click, liveClickBufferSize+5)
+	for i := range clicks {
+		clicks[i] = Click{LinkID: 1}
+	}
+	broker.publish(clicks) // must not block on the full buffer
+
+	if len(slow.clicks) != liveClickBufferSize || slow.dropped.Load() != 5 {
+		t.Fatalf("queued=%d dropped=%d, want a full buffer and 5 dropped", len(slow.clicks), slow.dropped.Load())
+	}
+	if len(other.clicks) != 0 {
+		t.Fatalf("subscriber of another link got %d clicks", len(other.clicks))
+	}
+
+	broker.unsubscribe(other)
+	broker.publish([]Click{{LinkID: 2}})
+	if len(other.clicks) != 0 {
+		t.Fatal("unsubscribed subscriber must not receive clicks")
+	}
+
+	broker.close()
+	for range slow.clicks { // ends once close closed the channel
+	}
+	if broker.subscribe(1) != nil {
+		t.Fatal("closed broker must refuse subscribers")
+	}
+}
+
+func TestAnalyticsHandler_StreamLinkClicks(t *testing.T) {
+	analyticsRepo := &mockAnalyticsRepo{saveClicksFunc: func(ctx context.Context, clicks []Click) error { return nil }}
+	linksRepo := &mockLinksRepo{getLinkIdFunc: func(ctx context.Context, code string, acc string) (int64, error) {
+		if code != "abc" {
+			return 0, link.ErrNotFound
+		}
+		return 7, nil
+	}}
+	service := NewAnalyticsService(analyticsRepo, linksRepo, nil, nil, nil, nil)
+	handler := NewAnalyticsHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/links/{code}/clicks/stream", handler.StreamLinkClicks)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(auth.WithAccountPublicID(r.Context(), "acc")))
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/links/missing/clicks/stream")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 for another account's link", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/links/abc/clicks/stream", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("first line = %q, want the connected comment", lines.Text())
+	}
+
+	err = service.saveClicks([]link.ClickEvent{
+		{LinkID: 7, IP: "203.0.113.7", UserAgent: "Slackbot-LinkExpanding 1.0", TrafficType: link.TrafficBot},
+		{LinkID: 8, TrafficType: link.TrafficHuman},
+		{LinkID: 7, IP: "203.0.113.7", UserAgent: iPhoneSafari, Referer: "https://news.example.com/a", TrafficType: link.TrafficHuman},
+	})
+	if err != nil {
+		t.Fatalf("saveClicks: %v", err)
+	}
+
+	var event, data string
+	for data == "" && lines.Scan() {
+		line := lines.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	var click liveClickResponse
+	if err := json.Unmarshal([]byte(data), &click); err != nil {
+		t.Fatalf("decode %q: %v", data, err)
+	}
+	if event != "click" || click.ShortCode != "abc" || click.TrafficType != link.TrafficHuman || click.ReferrerDomain != "news.example.com" {
+		t.Fatalf("event %q = %+v, want the human click of the link", event, click)
+	}
+	if strings.Contains(data, "203.0.113.7") {
+		t.Fatalf("event data %s leaks the IP", data)
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		service.liveClicks.mu.RLock()
+		subscribers := len(service.liveClicks.subs)
+		service.liveClicks.mu.RUnlock()
+		if subscribers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream wasn't unsubscribed after the client left")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
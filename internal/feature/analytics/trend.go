@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"math"
+	"time"
+)
+
+// previousPeriod is the range of equal length that ends where [from, to) starts.
+func previousPeriod(from, to time.Time) (time.Time, time.Time) {
+	return from.Add(-to.Sub(from)), from
+}
+
+// shiftSeries lines the previous series up with the current one by position. Both usually have
+// the same number of buckets; where the previous one is shorter (e.g. a shorter month) the
+// missing buckets count zero.
+func shiftSeries(previous, current []Bucket, periodLength time.Duration) []ShiftedBucket {
+	shifted := make([]ShiftedBucket, 0, len(current))
+	for i, b := range current {
+		bucket := ShiftedBucket{Start: b.Start, PreviousStart: b.Start.Add(-periodLength)}
+		if i < len(previous) {
+			bucket.PreviousStart = previous[i].Start
+			bucket.Count = previous[i].Count
+		}
+		shifted = append(shifted, bucket)
+	}
+	return shifted
+}
+
+// newChange compares a metric with its value in the previous period.
+// The percentage is rounded to one decimal and left out when the previous value is 0.
+func newChange(current, previous int64) Change {
+	change := Change{Current: current, Previous: previous, Delta: current - previous}
+	if previous != 0 {
+		percent := math.Round(float64(change.Delta)/float64(previous)*1000) / 10
+		change.Percent = &percent
+	}
+	return change
+}
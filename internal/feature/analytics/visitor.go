@@ -0,0 +1,66 @@
+package analytics
+
+import (
+	"context"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+// VisitorStrategy selects how the clicks of one visitor are recognized for unique, first-time
+// and returning visitor counts.
+type VisitorStrategy string
+
+const (
+	// VisitorByCookie uses the first-party cookie set on redirect. Clients without it, e.g. bots and
+	// browsers blocking cookies, fall back to VisitorByIPAndUserAgent.
+	VisitorByCookie VisitorStrategy = "cookie"
+	// VisitorByIPAndUserAgent hashes the IP with the User-Agent, which tells apart users behind a shared NAT.
+	VisitorByIPAndUserAgent VisitorStrategy = "ip_ua"
+	// VisitorByIP uses the IP alone, or its hash when IPs are pseudonymized.
+	VisitorByIP VisitorStrategy = "ip"
+)
+
+// VisitorIdentifier assigns visitor IDs to clicks and pseudonymizes their IPs. IDs derived from the IP
+// are hashed with the daily salt when IPs are pseudonymized, so those visitors are recognized within
+// a UTC day only; cookies recognize them for as long as the cookie lives.
+type VisitorIdentifier struct {
+	strategy      VisitorStrategy
+	pseudonymizer *IPPseudonymizer
+}
+
+// NewVisitorIdentifier creates an identifier. pseudonymizer is optional: with nil pseudonymizer
+// IPs are stored as they are.
+func NewVisitorIdentifier(strategy VisitorStrategy, pseudonymizer *IPPseudonymizer) *VisitorIdentifier {
+	return &VisitorIdentifier{strategy: strategy, pseudonymizer: pseudonymizer}
+}
+
+// identify sets the visitor ID of the click stored for ev, then pseudonymizes its IP.
+// A nil identifier identifies visitors by IP.
+func (v *VisitorIdentifier) identify(ctx context.Context, ev link.ClickEvent, c *Click) error {
+	strategy, pseudonymizer := VisitorByIP, (*IPPseudonymizer)(nil)
+	if v != nil {
+		strategy, pseudonymizer = v.strategy, v.pseudonymizer
+	}
+
+	switch {
+	case strategy == VisitorByCookie && ev.VisitorID != "":
+		c.VisitorID = ev.VisitorID
+	case strategy != VisitorByIP && ev.IP != "":
+		id, err := pseudonymizer.hash(ctx, ev.IP+"\x00"+ev.UserAgent, c.CreatedAt)
+		if err != nil {
+			return err
+		}
+		c.VisitorID = id
+	}
+
+	if err := pseudonymizer.pseudonymize(ctx, c); err != nil {
+		return err
+	}
+	if c.VisitorID == "" {
+		c.VisitorID = c.IPHash
+	}
+	if c.VisitorID == "" {
+		c.VisitorID = c.IPAddress
+	}
+	return nil
+}
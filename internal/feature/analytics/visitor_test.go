@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+func identify(t *testing.T, v *VisitorIdentifier, ev link.ClickEvent) Click {
+	t.Helper()
+	c := Click{IPAddress: ev.IP, UserAgent: ev.UserAgent, CreatedAt: time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC)}
+	if err := v.identify(context.Background(), ev, &c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestVisitorIdentifier_Strategies(t *testing.T) {
+	phone := link.ClickEvent{IP: "203.0.113.7", UserAgent: iPhoneSafari, VisitorID: "cookie-1"}
+	laptop := link.ClickEvent{IP: "203.0.113.7", UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/124.0"}
+
+	byCookie := NewVisitorIdentifier(VisitorByCookie, nil)
+	if c := identify(t, byCookie, phone); c.VisitorID != "cookie-1" {
+		t.Fatalf("cookie strategy: VisitorID = %q, want the cookie", c.VisitorID)
+	}
+	// Without a cookie the IP and User-Agent hash is used.
+	byIPAndUA := NewVisitorIdentifier(VisitorByIPAndUserAgent, nil)
+	if got, want := identify(t, byCookie, laptop).VisitorID, identify(t, byIPAndUA, laptop).VisitorID; got != want || got == "" {
+		t.Fatalf("cookie fallback: VisitorID = %q, want %q", got, want)
+	}
+
+	// Devices behind one NAT are told apart by their User-Agent, but not by the IP alone.
+	if identify(t, byIPAndUA, phone).VisitorID == identify(t, byIPAndUA, laptop).VisitorID {
+		t.Fatal("ip_ua strategy: different User-Agents share a visitor")
+	}
+	if c := identify(t, nil, phone); c.VisitorID != "203.0.113.7" {
+		t.Fatalf("ip strategy: VisitorID = %q, want the IP", c.VisitorID)
+	}
+}
+
+func TestVisitorIdentifier_PseudonymizedIPs(t *testing.T) {
+	ev := link.ClickEvent{IP: "203.0.113.7", UserAgent: iPhoneSafari}
+
+	byIP := identify(t, NewVisitorIdentifier(VisitorByIP, NewIPPseudonymizer(IPModeHash, &mockPrivacyRepo{})), ev)
+	if byIP.IPAddress != "" || byIP.VisitorID == "" || byIP.VisitorID != byIP.IPHash {
+		t.Fatalf("ip strategy in hash mode: %+v, want the IP hash as visitor", byIP)
+	}
+
+	salted := identify(t, NewVisitorIdentifier(VisitorByIPAndUserAgent, NewIPPseudonymizer(IPModeTruncate, &mockPrivacyRepo{})), ev)
+	unsalted := identify(t, NewVisitorIdentifier(VisitorByIPAndUserAgent, nil), ev)
+	if salted.IPAddress != "203.0.113.0" || salted.VisitorID == unsalted.VisitorID {
+		t.Fatalf("ip_ua strategy in truncate mode: %+v, want a salted visitor ID", salted)
+	}
+}
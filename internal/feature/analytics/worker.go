@@ -1,45 +1,78 @@
 package analytics
 
-import "log"
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+const (
+	// spoolPollInterval wakes the spool reader even if an append notification was missed.
+	spoolPollInterval = time.Second
+	// maxSaveBackoff caps the delay between attempts to store a spooled batch.
+	maxSaveBackoff = 30 * time.Second
+	// memorySaveAttempts bounds retries of batches from the in-memory buffer, which has no durable copy to wait on.
+	memorySaveAttempts = 3
+)
+
+// ClickWorkerConfig configures ClickEventWorker.
+type ClickWorkerConfig struct {
+	Consumers     int           // parallel consumers storing batches
+	BatchSize     int           // a batch is stored once it has this many clicks
+	FlushInterval time.Duration // ...or once its oldest click has waited this long
+}
 
 type ClickEventWorker struct {
 	service *AnalyticsService
+	cfg     ClickWorkerConfig
 	done    chan struct{}
 	stopped chan struct{}
 }
 
-func NewClickEventWorker(service *AnalyticsService) *ClickEventWorker {
+func NewClickEventWorker(service *AnalyticsService, cfg ClickWorkerConfig) *ClickEventWorker {
 	return &ClickEventWorker{
 		service: service,
+		cfg:     cfg,
 		done:    make(chan struct{}),
 		stopped: make(chan struct{}),
 	}
 }
 
 // Start runs background analytics worker.
-// Consumes click events asynchronously: writes them to storage.
-// Performs graceful drain of the remaining queue on shutdown.
+// Consumers accumulate click events and store them in batches.
+// Performs graceful drain of the remaining in-memory queue on shutdown.
 func (worker *ClickEventWorker) Start() {
-	log.Println("[ClickEventWorker] worker started")
-	go worker.run()
-}
-
-func (worker *ClickEventWorker) run() {
-	defer close(worker.stopped)
+	log.Printf("[ClickEventWorker] worker started consumers=%d batch=%d flush=%s spool=%t",
+		worker.cfg.Consumers, worker.cfg.BatchSize, worker.cfg.FlushInterval, worker.service.spool != nil)
 
-	for {
-		select {
-		case ev := <-worker.service.clickEventChan:
-			worker.service.handleClickEvent(ev)
-		case <-worker.done:
-			worker.drain()
-			return
-		}
+	var wg sync.WaitGroup
+	for range worker.cfg.Consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.consumeMemory()
+		}()
 	}
+	if worker.service.spool != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker.consumeSpool()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(worker.stopped)
+	}()
 }
 
 // Stop gracefully shuts down.
 // Drains all remaining queued events, and blocks until the worker has fully completed.
+// Spooled events not stored yet stay on disk for the next start.
 func (worker *ClickEventWorker) Stop() {
 	log.Println("[ClickEventWorker] worker shutdown initiated")
 	close(worker.done)
@@ -47,15 +80,270 @@ func (worker *ClickEventWorker) Stop() {
 	log.Println("[ClickEventWorker] worker stopped")
 }
 
+// consumeMemory batches events from the in-memory buffer.
+func (worker *ClickEventWorker) consumeMemory() {
+	ticker := time.NewTicker(worker.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]link.ClickEvent, 0, worker.cfg.BatchSize)
+	for {
+		select {
+		case ev := <-worker.service.clickEventChan:
+			batch = append(batch, ev)
+			if len(batch) >= worker.cfg.BatchSize {
+				batch = worker.flushMemory(batch)
+			}
+		case <-ticker.C:
+			batch = worker.flushMemory(batch)
+		case <-worker.done:
+			worker.drain(batch)
+			return
+		}
+	}
+}
+
 // Drain remaining events on shutdown
-func (worker *ClickEventWorker) drain() {
+func (worker *ClickEventWorker) drain(batch []link.ClickEvent) {
 	for {
 		select {
 		case ev := <-worker.service.clickEventChan:
-			worker.service.handleClickEvent(ev)
+			batch = append(batch, ev)
+			if len(batch) >= worker.cfg.BatchSize {
+				batch = worker.flushMemory(batch)
+			}
 		default:
+			worker.flushMemory(batch)
 			log.Println("[ClickEventWorker] Completed all clickEvents")
 			return
 		}
 	}
 }
+
+// flushMemory stores the batch with a few retries of transient errors and returns it emptied for reuse.
+func (worker *ClickEventWorker) flushMemory(batch []link.ClickEvent) []link.ClickEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	events := batch
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		done, err := worker.storeBatch(events)
+		events = events[done:]
+		if err == nil {
+			break
+		}
+		if attempt == memorySaveAttempts {
+			worker.service.failed.Add(int64(len(events)))
+			log.Printf("[ClickEventWorker] failed to save clicks=%d after %d attempts: %v", len(events), attempt, err)
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return batch[:0]
+}
+
+// storeBatch stores the events and returns how many leading events are done with, stored or dead-lettered.
+// A batch rejected by the database is split in halves until the rejected click is isolated and
+// dead-lettered, so one invalid click doesn't keep the rest of its batch from being stored.
+// The returned error is transient: the remaining events should be retried.
+func (worker *ClickEventWorker) storeBatch(events []link.ClickEvent) (int, error) {
+	err := worker.service.saveClicks(events)
+	if err == nil {
+		return len(events), nil
+	}
+	if !errors.Is(err, ErrClicksRejected) {
+		return 0, err
+	}
+	if len(events) == 1 {
+		if err := worker.service.rejectClick(events[0], err); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	mid := len(events) / 2
+	done, err := worker.storeBatch(events[:mid])
+	if err != nil {
+		return done, err
+	}
+	rest, err := worker.storeBatch(events[mid:])
+	return mid + rest, err
+}
+
+// spoolBatch is a batch read from the spool. end is the spool position right after its last event.
+type spoolBatch struct {
+	seq    uint64
+	events []link.ClickEvent
+	end    spoolPosition
+}
+
+type spoolResult struct {
+	seq    uint64
+	end    spoolPosition
+	stored bool
+}
+
+// consumeSpool reads batches from the spool and stores them with parallel consumers.
+// Batches may complete out of order; the checkpoint only moves past a batch once it
+// and every batch before it are stored.
+func (worker *ClickEventWorker) consumeSpool() {
+	spool := worker.service.spool
+
+	jobs := make(chan spoolBatch, worker.cfg.Consumers)
+	results := make(chan spoolResult, worker.cfg.Consumers)
+
+	var wg sync.WaitGroup
+	for range worker.cfg.Consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- spoolResult{seq: job.seq, end: job.end, stored: worker.saveWithRetry(job.events)}
+			}
+		}()
+	}
+
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		worker.commitInOrder(results)
+	}()
+
+	worker.readSpool(jobs)
+
+	close(jobs)
+	wg.Wait()
+	close(results)
+	<-committed
+
+	if pending := spool.Pending(); pending > 0 {
+		log.Printf("[ClickEventWorker] %d spooled bytes left for the next start", pending)
+	}
+}
+
+// readSpool cuts spooled events into batches until the worker is stopped.
+// A partial batch left on stop isn't stored: it is replayed on the next start.
+func (worker *ClickEventWorker) readSpool(jobs chan<- spoolBatch) {
+	spool := worker.service.spool
+
+	var (
+		seq          uint64
+		batch        []link.ClickEvent
+		end          spoolPosition
+		batchStarted time.Time
+	)
+	dispatch := func() bool {
+		select {
+		case jobs <- spoolBatch{seq: seq, events: batch, end: end}:
+			seq++
+			batch = nil
+			return true
+		case <-worker.done:
+			return false
+		}
+	}
+
+	for !worker.stopping() {
+		ev, pos, ok, err := spool.next()
+		if err != nil {
+			log.Printf("[ClickEventWorker] failed to read click spool: %v", err)
+		}
+
+		if ok {
+			if len(batch) == 0 {
+				batchStarted = time.Now()
+			}
+			batch = append(batch, ev)
+			end = pos
+			if len(batch) >= worker.cfg.BatchSize && !dispatch() {
+				return
+			}
+			continue
+		}
+
+		// Caught up with the writers: flush the batch once it is old enough, otherwise wait for more.
+		wait := spoolPollInterval
+		if len(batch) > 0 {
+			wait = worker.cfg.FlushInterval - time.Since(batchStarted)
+			if wait <= 0 {
+				if !dispatch() {
+					return
+				}
+				continue
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-spool.notify:
+		case <-timer.C:
+		case <-worker.done:
+		}
+		timer.Stop()
+	}
+}
+
+// commitInOrder moves the spool checkpoint as consecutive batches get stored.
+// After a batch fails (the worker was stopped while retrying) nothing is committed anymore,
+// so it and everything after it are replayed on the next start.
+func (worker *ClickEventWorker) commitInOrder(results <-chan spoolResult) {
+	var (
+		next    uint64
+		pending = make(map[uint64]spoolResult)
+		broken  bool
+	)
+
+	for res := range results {
+		pending[res.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if !res.stored {
+				broken = true
+			}
+			if broken {
+				continue
+			}
+			if err := worker.service.spool.commit(res.end); err != nil {
+				log.Printf("[ClickEventWorker] failed to commit click spool checkpoint: %v", err)
+			}
+		}
+	}
+}
+
+// saveWithRetry stores the batch, retrying transient errors with exponential backoff. Returns false if the worker
+// was stopped first; the batch then stays in the spool and is replayed on the next start.
+func (worker *ClickEventWorker) saveWithRetry(events []link.ClickEvent) bool {
+	backoff := 100 * time.Millisecond
+	for {
+		done, err := worker.storeBatch(events)
+		events = events[done:]
+		if err == nil {
+			return true
+		}
+		log.Printf("[ClickEventWorker] failed to save spooled clicks=%d, retrying in %s: %v", len(events), backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-worker.done:
+			return false
+		}
+		backoff = min(backoff*2, maxSaveBackoff)
+	}
+}
+
+func (worker *ClickEventWorker) stopping() bool {
+	select {
+	case <-worker.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,237 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+func TestClickEventWorker_RetriesSpooledClicksUntilStored(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20)
+	defer spool.Close()
+
+	var attempts atomic.Int32
+	stored := make(chan Click, 1)
+	repo := &mockAnalyticsRepo{saveClicksFunc: func(ctx context.Context, clicks []Click) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("database is down")
+		}
+		for _, c := range clicks {
+			stored <- c
+		}
+		return nil
+	}}
+	svc := NewAnalyticsService(repo, &mockLinksRepo{}, spool, nil, nil, nil)
+	worker := NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 2, BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	worker.Start()
+	defer worker.Stop()
+
+	svc.TrackClick(link.ClickEvent{LinkID: 42})
+
+	select {
+	case c := <-stored:
+		if c.LinkID != 42 {
+			t.Fatalf("unexpected click: %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("spooled click was not stored")
+	}
+
+	if stats := svc.QueueStats(); stats.Spooled != 1 || stats.Dropped != 0 {
+		t.Fatalf("unexpected queue stats: %+v", stats)
+	}
+	waitFor(t, func() bool { return spool.Pending() == 0 })
+}
+
+func TestClickEventWorker_CommitsSpoolInOrder(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20)
+	defer spool.Close()
+
+	var total atomic.Int32
+	repo := &mockAnalyticsRepo{saveClicksFunc: func(ctx context.Context, clicks []Click) error {
+		// The first batch is the slowest, so later batches finish before it.
+		if clicks[0].LinkID == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		total.Add(int32(len(clicks)))
+		return nil
+	}}
+	svc := NewAnalyticsService(repo, &mockLinksRepo{}, spool, nil, nil, nil)
+	for id := range int64(30) {
+		svc.TrackClick(link.ClickEvent{LinkID: id})
+	}
+
+	worker := NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 3, BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	worker.Start()
+	defer worker.Stop()
+
+	waitFor(t, func() bool { return total.Load() == 30 && spool.Pending() == 0 })
+}
+
+func TestClickEventWorker_ReplayOfPartlyStoredBatchStoresNoDuplicates(t *testing.T) {
+	dir := t.TempDir()
+
+	// rows is link_clicks keyed by event id: inserts of stored events are skipped as ON CONFLICT DO NOTHING does.
+	var (
+		mu       sync.Mutex
+		rows     = make(map[string]Click)
+		inserted int
+		replayed int
+		attempts atomic.Int32
+	)
+	repo := &mockAnalyticsRepo{saveClicksFunc: func(ctx context.Context, clicks []Click) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// The first attempt stores half of the batch before the connection is lost.
+		if attempts.Add(1) == 1 {
+			clicks = clicks[:len(clicks)/2]
+		}
+		for _, c := range clicks {
+			if c.EventID == "" {
+				t.Errorf("click of link %d stored without an event id", c.LinkID)
+			}
+			if _, ok := rows[c.EventID]; ok {
+				replayed++
+				continue
+			}
+			rows[c.EventID] = c
+			inserted++
+		}
+		if attempts.Load() == 1 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}}
+
+	spool := openTestSpool(t, dir, 1<<20)
+	svc := NewAnalyticsService(repo, &mockLinksRepo{}, spool, nil, nil, nil)
+	for id := range int64(10) {
+		svc.TrackClick(link.ClickEvent{LinkID: id})
+	}
+	worker := NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 1, BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	worker.Start()
+	waitFor(t, func() bool { return attempts.Load() >= 1 })
+	// Stopped while retrying: the checkpoint stays before the batch.
+	worker.Stop()
+	spool.Close()
+
+	spool = openTestSpool(t, dir, 1<<20)
+	defer spool.Close()
+	svc = NewAnalyticsService(repo, &mockLinksRepo{}, spool, nil, nil, nil)
+	worker = NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 1, BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	worker.Start()
+	defer worker.Stop()
+	waitFor(t, func() bool { return spool.Pending() == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rows) != 10 || inserted != 10 {
+		t.Fatalf("expected the 10 clicks stored once, got rows=%d inserted=%d", len(rows), inserted)
+	}
+	if replayed == 0 {
+		t.Fatal("expected the stored half of the batch to be replayed")
+	}
+}
+
+func TestClickEventWorker_FlushesMemoryBatchBySize(t *testing.T) {
+	batches := make(chan int, 10)
+	repo := &mockAnalyticsRepo{saveClicksFunc: func(ctx context.Context, clicks []Click) error {
+		batches <- len(clicks)
+		return nil
+	}}
+	svc := NewAnalyticsService(repo, &mockLinksRepo{}, nil, nil, nil, nil)
+	worker := NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 1, BatchSize: 5, FlushInterval: time.Hour})
+
+	for id := range int64(7) {
+		svc.TrackClick(link.ClickEvent{LinkID: id})
+	}
+	worker.Start()
+
+	if got := <-batches; got != 5 {
+		t.Fatalf("expected a full batch of 5, got %d", got)
+	}
+
+	// The remainder is stored on shutdown.
+	worker.Stop()
+	if got := <-batches; got != 2 {
+		t.Fatalf("expected the remaining 2 clicks on stop, got %d", got)
+	}
+}
+
+// rejectingRepo rejects every batch containing a click of badLinkID, as a data error would.
+func rejectingRepo(badLinkID int64, stored *atomic.Int32, deadLetters chan<- []byte) *mockAnalyticsRepo {
+	return &mockAnalyticsRepo{
+		saveClicksFunc: func(ctx context.Context, clicks []Click) error {
+			for _, c := range clicks {
+				if c.LinkID == badLinkID {
+					return fmt.Errorf("%w: invalid input syntax", ErrClicksRejected)
+				}
+			}
+			stored.Add(int32(len(clicks)))
+			return nil
+		},
+		saveRejectedFunc: func(ctx context.Context, payload []byte, reason string) error {
+			deadLetters <- payload
+			return nil
+		},
+	}
+}
+
+func TestClickEventWorker_DeadLettersRejectedClick(t *testing.T) {
+	var stored atomic.Int32
+	deadLetters := make(chan []byte, 10)
+	svc := NewAnalyticsService(rejectingRepo(3, &stored, deadLetters), &mockLinksRepo{}, nil, nil, nil, nil)
+	worker := NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 1, BatchSize: 8, FlushInterval: time.Hour})
+
+	for id := range int64(8) {
+		svc.TrackClick(link.ClickEvent{LinkID: id})
+	}
+	worker.Start()
+	worker.Stop()
+
+	if stored.Load() != 7 {
+		t.Fatalf("expected the 7 valid clicks to be stored, got %d", stored.Load())
+	}
+	if len(deadLetters) != 1 || !strings.Contains(string(<-deadLetters), `"link_id":3`) {
+		t.Fatal("expected the rejected click to be dead-lettered")
+	}
+	if stats := svc.QueueStats(); stats.Rejected != 1 || stats.Failed != 0 {
+		t.Fatalf("unexpected queue stats: %+v", stats)
+	}
+}
+
+func TestClickEventWorker_RejectedSpooledClickDoesNotBlockSpool(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20)
+	defer spool.Close()
+
+	var stored atomic.Int32
+	deadLetters := make(chan []byte, 10)
+	svc := NewAnalyticsService(rejectingRepo(5, &stored, deadLetters), &mockLinksRepo{}, spool, nil, nil, nil)
+	for id := range int64(10) {
+		svc.TrackClick(link.ClickEvent{LinkID: id})
+	}
+
+	worker := NewClickEventWorker(svc, ClickWorkerConfig{Consumers: 2, BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	worker.Start()
+	defer worker.Stop()
+
+	waitFor(t, func() bool { return stored.Load() == 9 && len(deadLetters) == 1 && spool.Pending() == 0 })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+)
+
+const (
+	// apiKeyPrefix marks API keys, so they are told apart from JWTs and found by secret scanners.
+	apiKeyPrefix = "sk_"
+	// apiKeySize is the number of random bytes of a key, hex-encoded after the prefix.
+	apiKeySize = 32
+	// apiKeyDisplayLength is the length of the key start that is kept to tell keys apart.
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	maxAPIKeyNameLength = 100
+)
+
+// APIKey authenticates server-to-server calls of an account. The key itself is only known when
+// it is created; afterwards it is identified by its hash.
+type APIKey struct {
+	PublicId        string
+	AccountPublicId string
+	Name            string
+	// Prefix is the start of the key, shown in listings.
+	Prefix     string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// APIKeyService manages the API keys of accounts and authenticates requests by them.
+type APIKeyService struct {
+	repo APIKeyRepository
+}
+
+func NewAPIKeyService(repo APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+// createAPIKey issues a new key and returns it with its plain value, which isn't stored.
+func (service *APIKeyService) createAPIKey(ctx context.Context, accountId string, name string) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return APIKey{}, "", ErrInvalidAPIKeyName
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	apiKey, err := service.repo.CreateAPIKey(ctx, APIKey{
+		AccountPublicId: accountId,
+		Name:            name,
+		Prefix:          key[:apiKeyDisplayLength],
+	}, hashAPIKey(key))
+	if err != nil {
+		return APIKey{}, "", fmt.Errorf("create api key failed: %w", err)
+	}
+	return apiKey, key, nil
+}
+
+func (service *APIKeyService) getAPIKeys(ctx context.Context, accountId string) ([]APIKey, error) {
+	keys, err := service.repo.GetAPIKeys(ctx, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("get api keys failed: %w", err)
+	}
+	return keys, nil
+}
+
+// deleteAPIKey revokes a key of the account.
+func (service *APIKeyService) deleteAPIKey(ctx context.Context, id string, accountId string) error {
+	if !httpx.IsUUID(id) {
+		return ErrAPIKeyNotFound
+	}
+	if err := service.repo.DeleteAPIKey(ctx, id, accountId); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return err
+		}
+		return fmt.Errorf("delete api key failed: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the public id of the account owning the key.
+// Unknown and malformed keys fail with ErrUnauthorized.
+func (service *APIKeyService) AuthenticateAPIKey(ctx context.Context, key string) (string, error) {
+	if !validAPIKey(key) {
+		return "", ErrUnauthorized
+	}
+	accountId, err := service.repo.FindAPIKeyAccount(ctx, hashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return "", ErrUnauthorized
+		}
+		return "", fmt.Errorf("authenticate api key failed: %w", err)
+	}
+	return accountId, nil
+}
+
+// generateAPIKey returns a new random key: the prefix and 64 hex characters.
+func generateAPIKey() (string, error) {
+	b := make([]byte, apiKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate api key: %w", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// hashAPIKey is the stored form of a key. Keys are random, so a fast unsalted hash is enough,
+// unlike for passwords.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func validAPIKey(key string) bool {
+	hexPart, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok || len(hexPart) != 2*apiKeySize {
+		return false
+	}
+	_, err := hex.DecodeString(hexPart)
+	return err == nil
+}
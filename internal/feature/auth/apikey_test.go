@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockAPIKeyRepo struct {
+	createAPIKeyFunc      func(ctx context.Context, key APIKey, keyHash string) (APIKey, error)
+	findAPIKeyAccountFunc func(ctx context.Context, keyHash string) (string, error)
+}
+
+func (m *mockAPIKeyRepo) CreateAPIKey(ctx context.Context, key APIKey, keyHash string) (APIKey, error) {
+	if m.createAPIKeyFunc == nil {
+		return APIKey{}, errors.New("CreateAPIKey not configured")
+	}
+	return m.createAPIKeyFunc(ctx, key, keyHash)
+}
+
+func (m *mockAPIKeyRepo) GetAPIKeys(ctx context.Context, accountPublicId string) ([]APIKey, error) {
+	return nil, errors.New("GetAPIKeys not configured")
+}
+
+func (m *mockAPIKeyRepo) DeleteAPIKey(ctx context.Context, publicId string, accountPublicId string) error {
+	return errors.New("DeleteAPIKey not configured")
+}
+
+func (m *mockAPIKeyRepo) FindAPIKeyAccount(ctx context.Context, keyHash string) (string, error) {
+	if m.findAPIKeyAccountFunc == nil {
+		return "", errors.New("FindAPIKeyAccount not configured")
+	}
+	return m.findAPIKeyAccountFunc(ctx, keyHash)
+}
+
+func TestAPIKeyService_CreatedKeyAuthenticatesItsAccount(t *testing.T) {
+	hashes := map[string]string{}
+	repo := &mockAPIKeyRepo{
+		createAPIKeyFunc: func(ctx context.Context, key APIKey, keyHash string) (APIKey, error) {
+			hashes[keyHash] = key.AccountPublicId
+			key.PublicId = "0b8e7f3c-2a1d-4e5f-8c9b-7a6d5e4f3c2b"
+			key.CreatedAt = time.Now()
+			return key, nil
+		},
+		findAPIKeyAccountFunc: func(ctx context.Context, keyHash string) (string, error) {
+			if accountId, ok := hashes[keyHash]; ok {
+				return accountId, nil
+			}
+			return "", ErrAPIKeyNotFound
+		},
+	}
+	svc := NewAPIKeyService(repo)
+
+	key, plainKey, err := svc.createAPIKey(context.Background(), "acc-1", "  crm postbacks ")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !strings.HasPrefix(plainKey, "sk_") || len(plainKey) != 67 || !strings.HasPrefix(plainKey, key.Prefix) {
+		t.Fatalf("unexpected key %q with prefix %q", plainKey, key.Prefix)
+	}
+	if key.Name != "crm postbacks" {
+		t.Fatalf("expected a trimmed name, got %q", key.Name)
+	}
+	if _, stored := hashes[plainKey]; stored {
+		t.Fatal("expected the key to be stored hashed")
+	}
+
+	accountId, err := svc.AuthenticateAPIKey(context.Background(), plainKey)
+	if err != nil || accountId != "acc-1" {
+		t.Fatalf("expected the key to authenticate acc-1, got %q err=%v", accountId, err)
+	}
+
+	other, _ := generateAPIKey()
+	if _, err := svc.AuthenticateAPIKey(context.Background(), other); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized for an unknown key, got %v", err)
+	}
+}
+
+func TestAPIKeyService_AuthenticateAPIKey_RejectsMalformedKeys(t *testing.T) {
+	svc := NewAPIKeyService(&mockAPIKeyRepo{})
+
+	for _, key := range []string{"", "sk_", "sk_abc", "pk_" + strings.Repeat("a", 64), "sk_" + strings.Repeat("z", 64)} {
+		if _, err := svc.AuthenticateAPIKey(context.Background(), key); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("key %q: expected ErrUnauthorized without a lookup, got %v", key, err)
+		}
+	}
+}
+
+func TestAPIKeyService_createAPIKey_RejectsLongName(t *testing.T) {
+	svc := NewAPIKeyService(&mockAPIKeyRepo{})
+
+	if _, _, err := svc.createAPIKey(context.Background(), "acc-1", strings.Repeat("n", 101)); !errors.Is(err, ErrInvalidAPIKeyName) {
+		t.Fatalf("expected ErrInvalidAPIKeyName, got %v", err)
+	}
+}
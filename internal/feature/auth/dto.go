@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -8,3 +10,43 @@ type LoginRequest struct {
 type LoginResponse struct {
 	Token string `json:"token"`
 }
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type apiKeyResponse struct {
+	Id         string  `json:"id"`
+	Name       string  `json:"name"`
+	Prefix     string  `json:"prefix"`
+	Key        string  `json:"key,omitempty"` // only in the response to creation
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"`
+}
+
+func createAPIKeyResponse(key APIKey, plainKey string) apiKeyResponse {
+	resp := apiKeyResponse{
+		Id:        key.PublicId,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Key:       plainKey,
+		CreatedAt: key.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if key.LastUsedAt != nil {
+		lastUsedAt := key.LastUsedAt.UTC().Format(time.RFC3339)
+		resp.LastUsedAt = &lastUsedAt
+	}
+	return resp
+}
+
+type apiKeysResponse struct {
+	APIKeys []apiKeyResponse `json:"api_keys"`
+}
+
+func createAPIKeysResponse(keys []APIKey) apiKeysResponse {
+	resp := apiKeysResponse{APIKeys: make([]apiKeyResponse, 0, len(keys))}
+	for _, k := range keys {
+		resp.APIKeys = append(resp.APIKeys, createAPIKeyResponse(k, ""))
+	}
+	return resp
+}
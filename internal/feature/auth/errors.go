@@ -5,4 +5,6 @@ import "errors"
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUnauthorized       = errors.New("unauthorized")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrInvalidAPIKeyName  = errors.New("name must be at most 100 characters")
 )
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/viacheslaev/url-shortener/internal/server/httpx"
@@ -30,3 +32,82 @@ func (handler *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	httpx.WriteResponse(w, http.StatusOK, LoginResponse{Token: token})
 }
+
+type APIKeyHandler struct {
+	service *APIKeyService
+}
+
+func NewAPIKeyHandler(service *APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// CreateAPIKey issues an API key for the account. The key is only returned in this response.
+// Route: POST /api/v1/account/api-keys
+func (handler *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	key, plainKey, err := handler.service.createAPIKey(r.Context(), accountPublicId, req.Name)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAPIKeyName) {
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("CreateAPIKey failed: %v", err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to create api key")
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusCreated, createAPIKeyResponse(key, plainKey))
+}
+
+// GetAPIKeys lists the API keys of the account without the keys themselves.
+// Route: GET /api/v1/account/api-keys
+func (handler *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	keys, err := handler.service.getAPIKeys(r.Context(), accountPublicId)
+	if err != nil {
+		log.Printf("GetAPIKeys failed: %v", err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to get api keys")
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createAPIKeysResponse(keys))
+}
+
+// DeleteAPIKey revokes an API key of the account.
+// Route: DELETE /api/v1/account/api-keys/{id}
+func (handler *APIKeyHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := handler.service.deleteAPIKey(r.Context(), id, accountPublicId); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("DeleteAPIKey failed: id=%s err=%v", id, err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to delete api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
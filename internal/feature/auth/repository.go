@@ -9,3 +9,14 @@ import (
 type AccountRepository interface {
 	FindActiveAccountByEmail(ctx context.Context, email string) (*account.Account, error)
 }
+
+type APIKeyRepository interface {
+	// CreateAPIKey stores a key by its hash and returns it with its public id and creation time.
+	CreateAPIKey(ctx context.Context, key APIKey, keyHash string) (APIKey, error)
+	GetAPIKeys(ctx context.Context, accountPublicId string) ([]APIKey, error)
+	// DeleteAPIKey fails with ErrAPIKeyNotFound unless the key belongs to the account.
+	DeleteAPIKey(ctx context.Context, publicId string, accountPublicId string) error
+	// FindAPIKeyAccount returns the account of the key with the hash, or ErrAPIKeyNotFound,
+	// and records that the key was used.
+	FindAPIKeyAccount(ctx context.Context, keyHash string) (string, error)
+}
@@ -0,0 +1,47 @@
+package conversion
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type createConversionRequest struct {
+	ClickId string `json:"click_id"`
+	Event   string `json:"event"`
+	// Value is decoded as a number literal, so it's stored without floating point rounding.
+	Value      *json.Number `json:"value"`
+	Currency   string       `json:"currency"`
+	ExternalId string       `json:"external_id"`
+}
+
+type conversionResponse struct {
+	Id         string       `json:"id"`
+	ClickId    string       `json:"click_id"`
+	ShortCode  string       `json:"short_code"`
+	Event      string       `json:"event"`
+	Value      *json.Number `json:"value"`
+	Currency   *string      `json:"currency"`
+	ExternalId *string      `json:"external_id"`
+	ClickedAt  string       `json:"clicked_at"`
+	CreatedAt  string       `json:"created_at"`
+}
+
+func createConversionResponse(conversion Conversion) conversionResponse {
+	resp := conversionResponse{
+		Id:        conversion.PublicId,
+		ClickId:   conversion.ClickId,
+		ShortCode: conversion.ShortCode,
+		Event:     conversion.EventName,
+		ClickedAt: conversion.ClickedAt.UTC().Format(time.RFC3339Nano),
+		CreatedAt: conversion.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if conversion.Value != "" {
+		value := json.Number(conversion.Value)
+		resp.Value = &value
+		resp.Currency = &conversion.Currency
+	}
+	if conversion.ExternalId != "" {
+		resp.ExternalId = &conversion.ExternalId
+	}
+	return resp
+}
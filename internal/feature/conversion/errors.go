@@ -0,0 +1,13 @@
+package conversion
+
+import "errors"
+
+var (
+	ErrClickNotFound     = errors.New("click not found")
+	ErrClickPending      = errors.New("click not stored yet, retry later")
+	ErrInvalidClickId    = errors.New("click_id must be a click ID handed to the destination")
+	ErrInvalidEventName  = errors.New("event must be 1 to 64 characters of a-z, 0-9, _, - and .")
+	ErrInvalidValue      = errors.New("value must be a non-negative number with at most 16 integer and 4 fraction digits")
+	ErrInvalidCurrency   = errors.New("currency must be a 3-letter ISO 4217 code and is required with value only")
+	ErrInvalidExternalId = errors.New("external_id must be at most 128 characters")
+)
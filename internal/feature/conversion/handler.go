@@ -0,0 +1,78 @@
+package conversion
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+)
+
+// clickPendingRetryAfter is the Retry-After of conversions posted before their click was stored.
+const clickPendingRetryAfter = 5 * time.Second
+
+type ConversionHandler struct {
+	service *ConversionService
+}
+
+func NewConversionHandler(service *ConversionService) *ConversionHandler {
+	return &ConversionHandler{service: service}
+}
+
+// CreateConversion records a conversion postback: 201 for a new conversion, 200 with the earlier one
+// when its external_id was recorded before, 503 with Retry-After when its click isn't stored yet.
+// Route: POST /api/v1/conversions
+// Access: account API key.
+func (handler *ConversionHandler) CreateConversion(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req createConversionRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	conversion := Conversion{
+		ClickId:    req.ClickId,
+		EventName:  req.Event,
+		Currency:   req.Currency,
+		ExternalId: req.ExternalId,
+	}
+	if req.Value != nil {
+		conversion.Value = req.Value.String()
+	}
+
+	stored, created, err := handler.service.recordConversion(r.Context(), accountPublicId, conversion)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrClickNotFound):
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrClickPending):
+			w.Header().Set("Retry-After", strconv.Itoa(int(clickPendingRetryAfter.Seconds())))
+			httpx.WriteErr(w, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, ErrInvalidClickId), errors.Is(err, ErrInvalidEventName), errors.Is(err, ErrInvalidValue),
+			errors.Is(err, ErrInvalidCurrency), errors.Is(err, ErrInvalidExternalId):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("CreateConversion failed: click_id=%s err=%v", conversion.ClickId, err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to record conversion")
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	httpx.WriteResponse(w, status, createConversionResponse(stored))
+}
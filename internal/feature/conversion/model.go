@@ -0,0 +1,21 @@
+package conversion
+
+import "time"
+
+// Conversion is an action of a visitor on the destination (e.g. a purchase), attributed to the click
+// that brought them there.
+type Conversion struct {
+	PublicId        string
+	AccountPublicId string
+	ClickId         string
+	// ShortCode is the link of the click, filled in by storage.
+	ShortCode string
+	EventName string
+	// Value is a non-negative decimal with up to 4 fractional digits, empty when the conversion has none.
+	Value    string
+	Currency string
+	// ExternalId is the caller's id of the conversion; conversions are recorded once per external id.
+	ExternalId string
+	ClickedAt  time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,10 @@
+package conversion
+
+import "context"
+
+type ConversionRepository interface {
+	// CreateConversion attributes the conversion to the click of one of the account's links and returns it
+	// as stored, with created true. When a conversion with the same external id exists, that one is
+	// returned with created false. Fails with ErrClickNotFound when the account has no such click.
+	CreateConversion(ctx context.Context, conversion Conversion) (Conversion, bool, error)
+}
@@ -0,0 +1,58 @@
+package conversion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+)
+
+// clickSettleWindow is how long after a click its conversions may arrive before the click is stored:
+// clicks are saved in batches, retried while the database is unavailable and replayed from the spool.
+const clickSettleWindow = 5 * time.Minute
+
+type ConversionService struct {
+	repo ConversionRepository
+	now  func() time.Time
+}
+
+func NewConversionService(repo ConversionRepository) *ConversionService {
+	return &ConversionService{repo: repo, now: time.Now}
+}
+
+// recordConversion validates a conversion postback and attributes it to the account's click.
+// created is false when the external id was recorded before, and the earlier conversion is returned.
+// A recent click that isn't stored yet fails with ErrClickPending, for the caller to retry.
+func (service *ConversionService) recordConversion(ctx context.Context, accountId string, conversion Conversion) (Conversion, bool, error) {
+	conversion.ClickId = strings.ToLower(strings.TrimSpace(conversion.ClickId))
+	if !httpx.IsUUID(conversion.ClickId) {
+		return Conversion{}, false, ErrInvalidClickId
+	}
+
+	var err error
+	if conversion.EventName, err = normalizeEventName(conversion.EventName); err != nil {
+		return Conversion{}, false, err
+	}
+	if conversion.Value, conversion.Currency, err = normalizeValue(conversion.Value, conversion.Currency); err != nil {
+		return Conversion{}, false, err
+	}
+	if conversion.ExternalId, err = normalizeExternalId(conversion.ExternalId); err != nil {
+		return Conversion{}, false, err
+	}
+	conversion.AccountPublicId = accountId
+
+	stored, created, err := service.repo.CreateConversion(ctx, conversion)
+	if err != nil {
+		if errors.Is(err, ErrClickNotFound) {
+			if clickedAt, ok := clickTime(conversion.ClickId); ok && service.now().Sub(clickedAt) < clickSettleWindow {
+				return Conversion{}, false, ErrClickPending
+			}
+			return Conversion{}, false, err
+		}
+		return Conversion{}, false, fmt.Errorf("record conversion failed: %w", err)
+	}
+	return stored, created, nil
+}
@@ -0,0 +1,116 @@
+package conversion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testClickId = "0b8e7f3c-2a1d-4e5f-8c9b-7a6d5e4f3c2b"
+
+type mockConversionRepo struct {
+	createConversionFunc func(ctx context.Context, conversion Conversion) (Conversion, bool, error)
+}
+
+func (m *mockConversionRepo) CreateConversion(ctx context.Context, conversion Conversion) (Conversion, bool, error) {
+	if m.createConversionFunc == nil {
+		return Conversion{}, false, errors.New("CreateConversion not configured")
+	}
+	return m.createConversionFunc(ctx, conversion)
+}
+
+func TestConversionService_recordConversion_NormalizesAndStores(t *testing.T) {
+	repo := &mockConversionRepo{createConversionFunc: func(ctx context.Context, c Conversion) (Conversion, bool, error) {
+		if c.AccountPublicId != "acc-1" || c.ClickId != testClickId || c.EventName != "purchase" ||
+			c.Value != "49.90" || c.Currency != "EUR" || c.ExternalId != "order-1042" {
+			t.Fatalf("unexpected conversion: %+v", c)
+		}
+		c.ShortCode = "kP3sA2"
+		return c, true, nil
+	}}
+	svc := NewConversionService(repo)
+
+	stored, created, err := svc.recordConversion(context.Background(), "acc-1", Conversion{
+		ClickId:    " 0B8E7F3C-2A1D-4E5F-8C9B-7A6D5E4F3C2B ",
+		EventName:  "Purchase",
+		Value:      "49.90",
+		Currency:   "eur",
+		ExternalId: " order-1042 ",
+	})
+	if err != nil || !created || stored.ShortCode != "kP3sA2" {
+		t.Fatalf("unexpected result: %+v created=%v err=%v", stored, created, err)
+	}
+}
+
+func TestConversionService_recordConversion_Validates(t *testing.T) {
+	svc := NewConversionService(&mockConversionRepo{})
+
+	tests := []struct {
+		name       string
+		conversion Conversion
+		want       error
+	}{
+		{"malformed click id", Conversion{ClickId: "abc", EventName: "purchase"}, ErrInvalidClickId},
+		{"missing event", Conversion{ClickId: testClickId}, ErrInvalidEventName},
+		{"event with spaces", Conversion{ClickId: testClickId, EventName: "sign up"}, ErrInvalidEventName},
+		{"negative value", Conversion{ClickId: testClickId, EventName: "purchase", Value: "-1", Currency: "EUR"}, ErrInvalidValue},
+		{"exponent value", Conversion{ClickId: testClickId, EventName: "purchase", Value: "1e3", Currency: "EUR"}, ErrInvalidValue},
+		{"too precise value", Conversion{ClickId: testClickId, EventName: "purchase", Value: "0.12345", Currency: "EUR"}, ErrInvalidValue},
+		{"value without currency", Conversion{ClickId: testClickId, EventName: "purchase", Value: "10"}, ErrInvalidCurrency},
+		{"currency without value", Conversion{ClickId: testClickId, EventName: "purchase", Currency: "EUR"}, ErrInvalidCurrency},
+		{"malformed currency", Conversion{ClickId: testClickId, EventName: "purchase", Value: "10", Currency: "EURO"}, ErrInvalidCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := svc.recordConversion(context.Background(), "acc-1", tt.conversion); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestConversionService_recordConversion_ClickNotFound(t *testing.T) {
+	repo := &mockConversionRepo{createConversionFunc: func(ctx context.Context, c Conversion) (Conversion, bool, error) {
+		return Conversion{}, false, ErrClickNotFound
+	}}
+	svc := NewConversionService(repo)
+
+	_, _, err := svc.recordConversion(context.Background(), "acc-1", Conversion{ClickId: testClickId, EventName: "signup"})
+	if !errors.Is(err, ErrClickNotFound) {
+		t.Fatalf("expected ErrClickNotFound, got %v", err)
+	}
+}
+
+func TestConversionService_recordConversion_BeforeClickIsStored(t *testing.T) {
+	// A version 7 click ID of a click at 2026-10-19T12:00:00Z.
+	const clickId = "01a15408-6a00-7c4d-9a1b-2c3d4e5f6a7b"
+	clickedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	stored := false
+	repo := &mockConversionRepo{createConversionFunc: func(ctx context.Context, c Conversion) (Conversion, bool, error) {
+		if !stored {
+			return Conversion{}, false, ErrClickNotFound
+		}
+		c.ClickedAt = clickedAt
+		return c, true, nil
+	}}
+	svc := NewConversionService(repo)
+	svc.now = func() time.Time { return clickedAt.Add(2 * time.Second) }
+
+	postback := Conversion{ClickId: clickId, EventName: "purchase"}
+	if _, _, err := svc.recordConversion(context.Background(), "acc-1", postback); !errors.Is(err, ErrClickPending) {
+		t.Fatalf("expected ErrClickPending while the click is being flushed, got %v", err)
+	}
+
+	stored = true
+	if got, created, err := svc.recordConversion(context.Background(), "acc-1", postback); err != nil || !created || !got.ClickedAt.Equal(clickedAt) {
+		t.Fatalf("expected the retried postback to be attributed, got %+v created=%v err=%v", got, created, err)
+	}
+
+	stored = false
+	svc.now = func() time.Time { return clickedAt.Add(clickSettleWindow) }
+	if _, _, err := svc.recordConversion(context.Background(), "acc-1", postback); !errors.Is(err, ErrClickNotFound) {
+		t.Fatalf("expected ErrClickNotFound once the click should have been stored, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package conversion
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxExternalIdLength = 128
+
+var (
+	eventNamePattern = regexp.MustCompile(`^[a-z0-9_.-]{1,64}$`)
+	// valuePattern matches the values storage holds exactly: NUMERIC(20, 4).
+	valuePattern    = regexp.MustCompile(`^[0-9]{1,16}(\.[0-9]{1,4})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// clickTime returns the time of a time-ordered (version 7) click ID. Click IDs handed out before
+// they were time-ordered have none.
+func clickTime(clickId string) (time.Time, bool) {
+	if len(clickId) != 36 || clickId[14] != '7' {
+		return time.Time{}, false
+	}
+	b, err := hex.DecodeString(clickId[0:8] + clickId[9:13])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var ms int64
+	for _, v := range b {
+		ms = ms<<8 | int64(v)
+	}
+	return time.UnixMilli(ms), true
+}
+
+func normalizeEventName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !eventNamePattern.MatchString(name) {
+		return "", ErrInvalidEventName
+	}
+	return name, nil
+}
+
+// normalizeValue validates a value and its currency; both are optional but only together.
+func normalizeValue(value string, currency string) (string, string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if value == "" {
+		if currency != "" {
+			return "", "", ErrInvalidCurrency
+		}
+		return "", "", nil
+	}
+	if !valuePattern.MatchString(value) {
+		return "", "", ErrInvalidValue
+	}
+	if !currencyPattern.MatchString(currency) {
+		return "", "", ErrInvalidCurrency
+	}
+	return value, currency, nil
+}
+
+func normalizeExternalId(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if utf8.RuneCountInString(id) > maxExternalIdLength {
+		return "", ErrInvalidExternalId
+	}
+	return id, nil
+}
@@ -0,0 +1,84 @@
+package link
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveRecord is a single NDJSON line of the purge export.
+type archiveRecord struct {
+	Type  string         `json:"type"` // "link" or "click"
+	Link  *ArchivedLink  `json:"link,omitempty"`
+	Click *ArchivedClick `json:"click,omitempty"`
+}
+
+// archiveExporter writes links about to be purged, with their clicks, to gzipped NDJSON files.
+type archiveExporter struct {
+	repo ExpiredLinksRepository
+	dir  string
+}
+
+func newArchiveExporter(repo ExpiredLinksRepository, dir string) *archiveExporter {
+	return &archiveExporter{repo: repo, dir: dir}
+}
+
+// export writes one file per batch. The file appears under its final name only when fully written,
+// so a crash never leaves a truncated export next to already deleted rows.
+func (e *archiveExporter) export(ctx context.Context, links []ArchivedLink, now time.Time) (string, error) {
+	if err := os.MkdirAll(e.dir, 0o750); err != nil {
+		return "", fmt.Errorf("create export dir: %w", err)
+	}
+
+	name := fmt.Sprintf("links-%s-%d.ndjson.gz", now.UTC().Format("20060102T150405Z"), links[0].Id)
+	path := filepath.Join(e.dir, name)
+
+	tmp, err := os.CreateTemp(e.dir, name+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+
+	if err := e.write(ctx, tmp, links); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("sync export file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("close export file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("rename export file: %w", err)
+	}
+
+	return path, nil
+}
+
+func (e *archiveExporter) write(ctx context.Context, f *os.File, links []ArchivedLink) error {
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+
+	ids := make([]int64, 0, len(links))
+	for i := range links {
+		ids = append(ids, links[i].Id)
+		if err := enc.Encode(archiveRecord{Type: "link", Link: &links[i]}); err != nil {
+			return fmt.Errorf("write link record: %w", err)
+		}
+	}
+
+	err := e.repo.StreamLinkClicks(ctx, ids, func(c ArchivedClick) error {
+		return enc.Encode(archiveRecord{Type: "click", Click: &c})
+	})
+	if err != nil {
+		return fmt.Errorf("write click records: %w", err)
+	}
+
+	return gz.Close()
+}
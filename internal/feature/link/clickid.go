@@ -0,0 +1,58 @@
+package link
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// clickIDCookieMaxAge bounds how long after the click a conversion can still read the click ID cookie.
+const clickIDCookieMaxAge = 30 * 24 * time.Hour
+
+// newClickID returns a time-ordered (version 7) UUID, or "" if the random source fails. Its time tells
+// a conversion posted before the click was stored from one of an unknown click.
+func newClickID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return ""
+	}
+	ms := uint64(time.Now().UnixMilli())
+	for i := range 6 {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// withClickID appends the click ID to the query of the destination. The existing query is kept
+// as it is rather than re-encoded, since destinations may depend on its exact form.
+func withClickID(longURL string, param string, clickID string) string {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return longURL
+	}
+	pair := url.QueryEscape(param) + "=" + clickID
+	if u.RawQuery == "" {
+		u.RawQuery = pair
+	} else {
+		u.RawQuery = strings.TrimSuffix(u.RawQuery, "&") + "&" + pair
+	}
+	return u.String()
+}
+
+// setClickIDCookie hands the click ID to destinations that share the cookie domain with the short links.
+func setClickIDCookie(w http.ResponseWriter, name string, clickID string, domain string, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    clickID,
+		Path:     "/",
+		Domain:   domain,
+		MaxAge:   int(clickIDCookieMaxAge / time.Second),
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -3,21 +3,166 @@ package link
 import "time"
 
 type createShortLinkRequest struct {
-	LongURL string `json:"long_url"`
+	LongURL      string `json:"long_url"`
+	ExpiryAction string `json:"expiry_action"`
+	FallbackURL  string `json:"fallback_url"`
 }
 
 type shortLinkResponse struct {
-	ShortCode string `json:"short_code"`
-	ShortURL  string `json:"short_url"`
-	LongURL   string `json:"long_url"`
-	ExpiresAt string `json:"expires_at"`
+	ShortCode    string `json:"short_code"`
+	ShortURL     string `json:"short_url"`
+	LongURL      string `json:"long_url"`
+	ExpiresAt    string `json:"expires_at"`
+	ExpiryAction string `json:"expiry_action,omitempty"`
+	FallbackURL  string `json:"fallback_url,omitempty"`
 }
 
 func createShortLinkResponse(baseURL string, link ShortLink) shortLinkResponse {
-	return shortLinkResponse{
+	resp := shortLinkResponse{
 		ShortCode: link.Code,
 		ShortURL:  baseURL + "/" + link.Code,
 		LongURL:   link.LongURL,
 		ExpiresAt: link.ExpiresAt.UTC().Format(time.RFC3339),
 	}
+	if link.ExpiryBehavior != nil {
+		resp.ExpiryAction = string(link.ExpiryBehavior.Action)
+		resp.FallbackURL = link.ExpiryBehavior.FallbackURL
+	}
+	return resp
+}
+
+// updateLinkRequest uses pointers to tell omitted fields from empty ones.
+// Empty expiry_action resets the link to the account/global expiry behavior.
+type updateLinkRequest struct {
+	LongURL      *string `json:"long_url"`
+	ExpiryAction *string `json:"expiry_action"`
+	FallbackURL  *string `json:"fallback_url"`
+}
+
+func createLinkStateResponse(baseURL string, code string, state LinkState) shortLinkResponse {
+	resp := shortLinkResponse{
+		ShortCode:    code,
+		ShortURL:     baseURL + "/" + code,
+		LongURL:      state.LongURL,
+		ExpiryAction: state.ExpiryAction,
+		FallbackURL:  state.FallbackURL,
+	}
+	if state.ExpiresAt != nil {
+		resp.ExpiresAt = state.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
+
+type linkEventResponse struct {
+	Event     string     `json:"event"`
+	ActorID   *string    `json:"actor_id"`
+	OldValue  *LinkState `json:"old_value"`
+	NewValue  *LinkState `json:"new_value"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type linkHistoryResponse struct {
+	ShortCode string              `json:"short_code"`
+	Events    []linkEventResponse `json:"events"`
+}
+
+func createLinkHistoryResponse(code string, events []LinkEvent) linkHistoryResponse {
+	resp := linkHistoryResponse{ShortCode: code, Events: make([]linkEventResponse, 0, len(events))}
+	for _, e := range events {
+		resp.Events = append(resp.Events, linkEventResponse{
+			Event:     string(e.Type),
+			ActorID:   e.ActorPublicId,
+			OldValue:  e.OldValue,
+			NewValue:  e.NewValue,
+			CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return resp
+}
+
+type expiryBehaviorRequest struct {
+	ExpiryAction string `json:"expiry_action"`
+	FallbackURL  string `json:"fallback_url"`
+}
+
+type expiryBehaviorResponse struct {
+	ExpiryAction *string `json:"expiry_action"`
+	FallbackURL  string  `json:"fallback_url,omitempty"`
+}
+
+func createExpiryBehaviorResponse(behavior *ExpiryBehavior) expiryBehaviorResponse {
+	if behavior == nil {
+		return expiryBehaviorResponse{}
+	}
+	action := string(behavior.Action)
+	return expiryBehaviorResponse{ExpiryAction: &action, FallbackURL: behavior.FallbackURL}
+}
+
+type brokenLinkResponse struct {
+	ShortCode           string  `json:"short_code"`
+	LongURL             string  `json:"long_url"`
+	StatusCode          *int    `json:"status_code"`
+	FailureReason       string  `json:"failure_reason"`
+	LatencyMs           int64   `json:"latency_ms"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	LastCheckedAt       string  `json:"last_checked_at"`
+	LastSuccessAt       *string `json:"last_success_at"`
+}
+
+type brokenLinksResponse struct {
+	Links []brokenLinkResponse `json:"links"`
+}
+
+func createBrokenLinksResponse(links []BrokenLink) brokenLinksResponse {
+	resp := brokenLinksResponse{Links: make([]brokenLinkResponse, 0, len(links))}
+	for _, l := range links {
+		item := brokenLinkResponse{
+			ShortCode:           l.Code,
+			LongURL:             l.LongURL,
+			StatusCode:          l.StatusCode,
+			FailureReason:       l.FailureReason,
+			LatencyMs:           l.Latency.Milliseconds(),
+			ConsecutiveFailures: l.ConsecutiveFailures,
+			LastCheckedAt:       l.LastCheckedAt.UTC().Format(time.RFC3339),
+		}
+		if l.LastSuccessAt != nil {
+			lastSuccess := l.LastSuccessAt.UTC().Format(time.RFC3339)
+			item.LastSuccessAt = &lastSuccess
+		}
+		resp.Links = append(resp.Links, item)
+	}
+	return resp
+}
+
+// resolveResponse describes what a visitor of the short URL would get.
+// The destination of an expired link is not disclosed; a configured fallback is.
+type resolveResponse struct {
+	ShortCode    string `json:"short_code"`
+	ShortURL     string `json:"short_url"`
+	Status       string `json:"status"` // active | expired
+	LongURL      string `json:"long_url,omitempty"`
+	ExpiresAt    string `json:"expires_at,omitempty"`
+	ExpiryAction string `json:"expiry_action,omitempty"`
+	FallbackURL  string `json:"fallback_url,omitempty"`
+}
+
+func createResolveResponse(baseURL string, code string, link LongLink, expiredBehavior *ExpiryBehavior) resolveResponse {
+	resp := resolveResponse{
+		ShortCode: code,
+		ShortURL:  baseURL + "/" + code,
+		Status:    "active",
+		LongURL:   link.LongURL,
+	}
+	if link.ExpiresAt != nil {
+		resp.ExpiresAt = link.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if expiredBehavior != nil {
+		resp.Status = "expired"
+		resp.LongURL = ""
+		resp.ExpiryAction = string(expiredBehavior.Action)
+		if expiredBehavior.Action == ExpiryActionRedirect {
+			resp.FallbackURL = expiredBehavior.FallbackURL
+		}
+	}
+	return resp
 }
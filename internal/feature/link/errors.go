@@ -7,4 +7,7 @@ var (
 	ErrLinkExpired               = errors.New("link expired")
 	ErrShortcodeAlreadyExists    = errors.New("short code already exists")
 	ErrFailedToGenerateShortCode = errors.New("failed to generate short code")
+	ErrInvalidURL                = errors.New("invalid url")
+	ErrNothingToUpdate           = errors.New("nothing to update")
+	ErrInvalidExpiryBehavior     = errors.New("invalid expiry behavior: expiry_action must be json, html or redirect; fallback_url is required for redirect only")
 )
@@ -0,0 +1,117 @@
+package link
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+)
+
+// ExpiryAction defines what a visitor gets when a link is expired or unknown.
+type ExpiryAction string
+
+const (
+	ExpiryActionJSON     ExpiryAction = "json"     // JSON error body
+	ExpiryActionHTML     ExpiryAction = "html"     // branded HTML page
+	ExpiryActionRedirect ExpiryAction = "redirect" // redirect to FallbackURL
+)
+
+// ExpiryBehavior is configured per link, per account or globally (link > account > global).
+type ExpiryBehavior struct {
+	Action      ExpiryAction
+	FallbackURL string
+}
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var unavailablePageTemplate = template.Must(template.ParseFS(templatesFS, "templates/unavailable.html"))
+
+type unavailablePage struct {
+	Status      int
+	Title       string
+	Message     string
+	ServiceName string
+	BaseURL     string
+}
+
+// parseExpiryBehavior validates user input. Empty action means "not configured" and returns nil.
+func parseExpiryBehavior(action string, fallbackURL string) (*ExpiryBehavior, error) {
+	action = strings.ToLower(strings.TrimSpace(action))
+	fallbackURL = strings.TrimSpace(fallbackURL)
+
+	if action == "" {
+		if fallbackURL != "" {
+			return nil, ErrInvalidExpiryBehavior
+		}
+		return nil, nil
+	}
+
+	behavior := &ExpiryBehavior{Action: ExpiryAction(action), FallbackURL: fallbackURL}
+	if !behavior.valid() {
+		return nil, ErrInvalidExpiryBehavior
+	}
+	return behavior, nil
+}
+
+func (b ExpiryBehavior) valid() bool {
+	switch b.Action {
+	case ExpiryActionJSON, ExpiryActionHTML:
+		return b.FallbackURL == ""
+	case ExpiryActionRedirect:
+		return validateURL(b.FallbackURL)
+	default:
+		return false
+	}
+}
+
+// writeUnavailable responds to a visitor of an expired or unknown link according to behavior.
+func (handler *LinkHandler) writeUnavailable(w http.ResponseWriter, r *http.Request, status int, cause error, behavior ExpiryBehavior) {
+	switch behavior.Action {
+	case ExpiryActionRedirect:
+		http.Redirect(w, r, behavior.FallbackURL, http.StatusFound)
+
+	case ExpiryActionHTML:
+		page := unavailablePage{
+			Status:      status,
+			ServiceName: handler.config.ServiceName,
+			BaseURL:     handler.config.BaseURL,
+		}
+		if status == http.StatusGone {
+			page.Title = "This link has expired"
+			page.Message = "The short link you followed is no longer active."
+		} else {
+			page.Title = "Link not found"
+			page.Message = "The short link you followed does not exist. Please check the address and try again."
+		}
+
+		var buf bytes.Buffer
+		if err := unavailablePageTemplate.Execute(&buf, page); err != nil {
+			log.Printf("unavailable page render failed: %v", err)
+			httpx.WriteErr(w, status, cause.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			// Too late to change HTTP response – just log it.
+			log.Printf("unavailable page write failed: %v", err)
+		}
+
+	default:
+		httpx.WriteErr(w, status, cause.Error())
+	}
+}
+
+// expiryBehaviorFor returns the link's own or account behavior, falling back to the global default.
+func (handler *LinkHandler) expiryBehaviorFor(longLink LongLink) ExpiryBehavior {
+	if longLink.ExpiryBehavior != nil {
+		return *longLink.ExpiryBehavior
+	}
+	return handler.expiredBehavior
+}
@@ -0,0 +1,96 @@
+package link
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/viacheslaev/url-shortener/internal/config"
+)
+
+func TestParseExpiryBehavior(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		fallbackURL string
+		want        *ExpiryBehavior
+		wantErr     bool
+	}{
+		{name: "not configured", want: nil},
+		{name: "json", action: "JSON", want: &ExpiryBehavior{Action: ExpiryActionJSON}},
+		{name: "html", action: "html", want: &ExpiryBehavior{Action: ExpiryActionHTML}},
+		{name: "redirect", action: "redirect", fallbackURL: "https://example.com/expired", want: &ExpiryBehavior{Action: ExpiryActionRedirect, FallbackURL: "https://example.com/expired"}},
+		{name: "redirect without fallback", action: "redirect", wantErr: true},
+		{name: "redirect with invalid fallback", action: "redirect", fallbackURL: "ftp://example.com", wantErr: true},
+		{name: "fallback without action", fallbackURL: "https://example.com", wantErr: true},
+		{name: "fallback with json", action: "json", fallbackURL: "https://example.com", wantErr: true},
+		{name: "unknown action", action: "teapot", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpiryBehavior(tt.action, tt.fallbackURL)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidExpiryBehavior) {
+					t.Fatalf("expected ErrInvalidExpiryBehavior, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLinkHandler_writeUnavailable(t *testing.T) {
+	handler := NewLinkHandler(&config.Config{
+		ServiceName:    "url-shortener",
+		BaseURL:        "http://localhost:8080",
+		NotFoundAction: "json",
+	}, nil)
+
+	t.Run("json", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.writeUnavailable(rec, httptest.NewRequest(http.MethodGet, "/abc", nil), http.StatusGone, ErrLinkExpired, ExpiryBehavior{Action: ExpiryActionJSON})
+
+		if rec.Code != http.StatusGone {
+			t.Fatalf("expected 410, got %d", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `"error":"link expired"`) {
+			t.Fatalf("unexpected body: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.writeUnavailable(rec, httptest.NewRequest(http.MethodGet, "/abc", nil), http.StatusNotFound, ErrNotFound, ExpiryBehavior{Action: ExpiryActionHTML})
+
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Fatalf("expected html content type, got %q", ct)
+		}
+		if !strings.Contains(rec.Body.String(), "Link not found") {
+			t.Fatalf("unexpected body: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.writeUnavailable(rec, httptest.NewRequest(http.MethodGet, "/abc", nil), http.StatusGone, ErrLinkExpired, ExpiryBehavior{Action: ExpiryActionRedirect, FallbackURL: "https://example.com/expired"})
+
+		if rec.Code != http.StatusFound {
+			t.Fatalf("expected 302, got %d", rec.Code)
+		}
+		if loc := rec.Header().Get("Location"); loc != "https://example.com/expired" {
+			t.Fatalf("unexpected location: %q", loc)
+		}
+	})
+}
@@ -5,21 +5,29 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/viacheslaev/url-shortener/internal/config"
 	"github.com/viacheslaev/url-shortener/internal/feature/auth"
 	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+	"github.com/viacheslaev/url-shortener/internal/useragent"
 )
 
 type LinkHandler struct {
 	config  *config.Config
 	service *LinkService
+
+	expiredBehavior  ExpiryBehavior // global default for expired links
+	notFoundBehavior ExpiryBehavior // used for unknown codes
 }
 
 func NewLinkHandler(cfg *config.Config, svc *LinkService) *LinkHandler {
 	return &LinkHandler{
-		config:  cfg,
-		service: svc}
+		config:           cfg,
+		service:          svc,
+		expiredBehavior:  ExpiryBehavior{Action: ExpiryAction(cfg.ExpiredLinkAction), FallbackURL: cfg.ExpiredLinkFallbackURL},
+		notFoundBehavior: ExpiryBehavior{Action: ExpiryAction(cfg.NotFoundAction), FallbackURL: cfg.NotFoundFallbackURL},
+	}
 }
 
 func (handler *LinkHandler) CreateShortLink(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +43,13 @@ func (handler *LinkHandler) CreateShortLink(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	link, err := handler.service.createShortLink(r.Context(), req.LongURL, accountPublicId)
+	expiryBehavior, err := parseExpiryBehavior(req.ExpiryAction, req.FallbackURL)
+	if err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	link, err := handler.service.createShortLink(r.Context(), req.LongURL, accountPublicId, expiryBehavior)
 	if err != nil {
 		httpx.WriteErr(w, http.StatusBadRequest, err.Error())
 		return
@@ -45,27 +59,220 @@ func (handler *LinkHandler) CreateShortLink(w http.ResponseWriter, r *http.Reque
 	httpx.WriteResponse(w, http.StatusCreated, resp)
 }
 
+// UpdateLink edits destination and expiry behavior of the account's link.
+// Route: PATCH /api/v1/links/{code}
+func (handler *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req updateLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	update := LinkUpdate{LongURL: req.LongURL}
+	if req.ExpiryAction != nil || req.FallbackURL != nil {
+		var action, fallbackURL string
+		if req.ExpiryAction != nil {
+			action = *req.ExpiryAction
+		}
+		if req.FallbackURL != nil {
+			fallbackURL = *req.FallbackURL
+		}
+
+		behavior, err := parseExpiryBehavior(action, fallbackURL)
+		if err != nil {
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		update.SetExpiryBehavior = true
+		update.ExpiryBehavior = behavior
+	}
+
+	code := r.PathValue("code")
+	state, err := handler.service.updateLink(r.Context(), code, accountPublicId, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrInvalidURL), errors.Is(err, ErrNothingToUpdate):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("UpdateLink failed: code=%s err=%v", code, err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to update link")
+		}
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createLinkStateResponse(handler.config.BaseURL, code, state))
+}
+
+// DisableLink stops redirects for the account's link.
+// Route: POST /api/v1/links/{code}/disable
+func (handler *LinkHandler) DisableLink(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	code := r.PathValue("code")
+	if err := handler.service.disableLink(r.Context(), code, accountPublicId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("DisableLink failed: code=%s err=%v", code, err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to disable link")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteLink deletes the account's link.
+// Route: DELETE /api/v1/links/{code}
+func (handler *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	code := r.PathValue("code")
+	if err := handler.service.deleteLink(r.Context(), code, accountPublicId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("DeleteLink failed: code=%s err=%v", code, err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to delete link")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLinkHistory returns the change history of the account's link, including deleted links.
+// Route: GET /api/v1/links/{code}/history
+func (handler *LinkHandler) GetLinkHistory(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	code := r.PathValue("code")
+	events, err := handler.service.getLinkHistory(r.Context(), code, accountPublicId)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("GetLinkHistory failed: code=%s err=%v", code, err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to get link history")
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createLinkHistoryResponse(code, events))
+}
+
+// UpdateAccountExpiryBehavior sets what visitors of the account's expired links get,
+// unless a link defines its own behavior. Empty expiry_action resets to the service default.
+// Route: PUT /api/v1/account/expiry-behavior
+func (handler *LinkHandler) UpdateAccountExpiryBehavior(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req expiryBehaviorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	behavior, err := parseExpiryBehavior(req.ExpiryAction, req.FallbackURL)
+	if err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := handler.service.setAccountExpiryBehavior(r.Context(), accountPublicId, behavior); err != nil {
+		log.Printf("UpdateAccountExpiryBehavior failed: %v", err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to update expiry behavior")
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createExpiryBehaviorResponse(behavior))
+}
+
+// GetBrokenLinks returns links of the authenticated account whose destinations are failing.
+// Route: GET /api/v1/links/broken
+func (handler *LinkHandler) GetBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	links, err := handler.service.getBrokenLinks(r.Context(), accountPublicId)
+	if err != nil {
+		log.Printf("GetBrokenLinks failed: %v", err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to get broken links")
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createBrokenLinksResponse(links))
+}
+
+// ResolveShortLink redirects to the link destination.
+// Route: GET /{code}, HEAD /{code}
+// HEAD gets the same status and headers without a body and isn't tracked as a click.
 func (handler *LinkHandler) ResolveShortLink(w http.ResponseWriter, r *http.Request) {
 	code := r.PathValue("code")
 
-	longLink, err := handler.service.resolveShortLink(r.Context(), code, ClientContext{
-		IP:        httpx.ClientIP(r),
-		UserAgent: r.UserAgent(),
-		Referer:   r.Referer(),
-	})
+	var (
+		longLink LongLink
+		clickID  string
+		err      error
+	)
+	if r.Method == http.MethodHead {
+		longLink, err = handler.service.lookupShortLink(r.Context(), code)
+	} else {
+		clientContext := ClientContext{
+			IP:        httpx.ClientIP(r),
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+			Prefetch:  useragent.IsPrefetch(r.Header),
+		}
+		if handler.config.VisitorIDStrategy == "cookie" {
+			clientContext.VisitorID = visitorCookie(w, r, handler.secureCookies())
+		}
+		if handler.config.ClickIDMode == "query" || handler.config.ClickIDMode == "cookie" {
+			clickID = newClickID()
+			clientContext.ClickID = clickID
+		}
+		longLink, err = handler.service.resolveShortLink(r.Context(), code, clientContext)
+	}
 
 	if err == nil {
-		http.Redirect(w, r, longLink, http.StatusFound)
+		http.Redirect(w, r, handler.handOverClickID(w, longLink.LongURL, clickID), http.StatusFound)
 		return
 	}
 
 	switch {
 	case errors.Is(err, ErrLinkExpired):
-		httpx.WriteErr(w, http.StatusGone, ErrLinkExpired.Error())
+		handler.writeUnavailable(w, r, http.StatusGone, ErrLinkExpired, handler.expiryBehaviorFor(longLink))
 		return
 
 	case errors.Is(err, ErrNotFound):
-		http.NotFound(w, r)
+		handler.writeUnavailable(w, r, http.StatusNotFound, ErrNotFound, handler.notFoundBehavior)
 		return
 
 	default:
@@ -74,3 +281,54 @@ func (handler *LinkHandler) ResolveShortLink(w http.ResponseWriter, r *http.Requ
 	}
 
 }
+
+// handOverClickID passes the click ID to the destination as configured by CLICK_ID_MODE:
+// in the query of the returned URL or in a cookie.
+func (handler *LinkHandler) handOverClickID(w http.ResponseWriter, longURL string, clickID string) string {
+	if clickID == "" {
+		return longURL
+	}
+	switch handler.config.ClickIDMode {
+	case "query":
+		return withClickID(longURL, handler.config.ClickIDParam, clickID)
+	case "cookie":
+		setClickIDCookie(w, handler.config.ClickIDParam, clickID, handler.config.ClickIDCookieDomain, handler.secureCookies())
+	}
+	return longURL
+}
+
+// secureCookies tells whether cookies are set for HTTPS only, i.e. short links are served over HTTPS.
+func (handler *LinkHandler) secureCookies() bool {
+	return strings.HasPrefix(handler.config.BaseURL, "https://")
+}
+
+// ShortLinkOptions answers preflight and capability requests on the redirect route.
+// Route: OPTIONS /{code}
+func (handler *LinkHandler) ShortLinkOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExpandShortLink returns the destination and status of a link without tracking a click.
+// Route: GET /api/v1/resolve/{code}
+// Access: public. Intended for integrations that expand short links.
+func (handler *LinkHandler) ExpandShortLink(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	longLink, err := handler.service.lookupShortLink(r.Context(), code)
+	switch {
+	case err == nil:
+		httpx.WriteResponse(w, http.StatusOK, createResolveResponse(handler.config.BaseURL, code, longLink, nil))
+
+	case errors.Is(err, ErrLinkExpired):
+		behavior := handler.expiryBehaviorFor(longLink)
+		httpx.WriteResponse(w, http.StatusGone, createResolveResponse(handler.config.BaseURL, code, longLink, &behavior))
+
+	case errors.Is(err, ErrNotFound):
+		httpx.WriteErr(w, http.StatusNotFound, "link not found")
+
+	default:
+		log.Printf("ExpandShortLink failed: code=%s err=%v", code, err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to resolve link")
+	}
+}
@@ -0,0 +1,261 @@
+package link
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/outbound"
+)
+
+// maxHealthCheckBackoff caps how far the next check of a failing destination is pushed out.
+const maxHealthCheckBackoff = 24 * time.Hour
+
+// LinkHealthWorker periodically checks link destinations and records their availability.
+type LinkHealthWorker struct {
+	repo        LinkHealthRepository
+	checker     *destinationChecker
+	interval    time.Duration
+	concurrency int
+	batchSize   int
+	notifier    LinkNotifier
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewLinkHealthWorker creates a new destination health worker.
+// Every interval it checks up to batchSize due links, at most concurrency at a time.
+// Destinations on loopback, private and link-local addresses are reported as broken instead of requested,
+// unless allowPrivateTargets. notifier is optional and told about destinations that became broken.
+func NewLinkHealthWorker(repo LinkHealthRepository, interval time.Duration, timeout time.Duration, concurrency int, batchSize int, allowPrivateTargets bool, notifier LinkNotifier) *LinkHealthWorker {
+	return &LinkHealthWorker{
+		repo:        repo,
+		checker:     newDestinationChecker(timeout, allowPrivateTargets),
+		interval:    interval,
+		concurrency: concurrency,
+		batchSize:   batchSize,
+		notifier:    notifier,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+func (w *LinkHealthWorker) Start() {
+	go w.run()
+}
+
+// Stop gracefully stops the worker and blocks until the in-flight pass exits.
+func (w *LinkHealthWorker) Stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// run is the internal background loop.
+func (w *LinkHealthWorker) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	log.Printf("[health] link health worker started interval=%s concurrency=%d", w.interval, w.concurrency)
+
+	for {
+		select {
+		case <-ticker.C:
+			w.checkDueLinks()
+		case <-w.done:
+			log.Printf("[health] link health worker stopped")
+			return
+		}
+	}
+}
+
+// checkDueLinks performs a single pass over links whose next check is due.
+func (w *LinkHealthWorker) checkDueLinks() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+	defer cancel()
+
+	// Abort in-flight checks on shutdown.
+	go func() {
+		select {
+		case <-w.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	targets, err := w.repo.GetLinksDueForHealthCheck(ctx, w.batchSize)
+	if err != nil {
+		log.Printf("[health] failed to load links due for check: %v", err)
+		return
+	}
+
+	sem := make(chan struct{}, w.concurrency)
+	var wg sync.WaitGroup
+
+	for _, target := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(target HealthCheckTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			w.checkLink(ctx, target)
+		}(target)
+	}
+
+	wg.Wait()
+}
+
+// checkLink checks a single destination and stores the result.
+func (w *LinkHealthWorker) checkLink(ctx context.Context, target HealthCheckTarget) {
+	outcome := w.checker.check(ctx, target.LongURL)
+	if ctx.Err() != nil {
+		// Shutdown or pass timeout: the link stays due and is checked next time.
+		return
+	}
+
+	result := buildHealthCheckResult(target, outcome, time.Now().UTC(), w.interval)
+
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.repo.SaveHealthCheckResult(saveCtx, result); err != nil {
+		log.Printf("[health] failed to save check result link_id=%d err=%v", target.LinkID, err)
+		return
+	}
+
+	if result.IsBroken {
+		log.Printf("[health] broken destination link_id=%d reason=%s", target.LinkID, result.FailureReason)
+		if w.notifier != nil && !target.IsBroken {
+			w.notifier.LinkBroken(saveCtx, target, result)
+		}
+	}
+}
+
+// buildHealthCheckResult turns a check outcome into a stored result.
+// Failing destinations are re-checked with exponential backoff.
+func buildHealthCheckResult(target HealthCheckTarget, outcome checkOutcome, now time.Time, interval time.Duration) HealthCheckResult {
+	result := HealthCheckResult{
+		LinkID:        target.LinkID,
+		StatusCode:    outcome.statusCode,
+		Latency:       outcome.latency,
+		FailureReason: outcome.failureReason,
+		IsBroken:      outcome.broken,
+		CheckedAt:     now,
+	}
+
+	if outcome.failureReason == "" {
+		result.LastSuccessAt = &now
+		result.NextCheckAt = now.Add(interval)
+		return result
+	}
+
+	result.ConsecutiveFailures = target.ConsecutiveFailures + 1
+	result.NextCheckAt = now.Add(healthCheckBackoff(interval, result.ConsecutiveFailures))
+	return result
+}
+
+// healthCheckBackoff doubles the check interval for every consecutive failure up to maxHealthCheckBackoff.
+func healthCheckBackoff(interval time.Duration, failures int) time.Duration {
+	backoff := interval
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= maxHealthCheckBackoff {
+			return maxHealthCheckBackoff
+		}
+	}
+	return backoff
+}
+
+// checkOutcome is the raw result of probing a destination.
+type checkOutcome struct {
+	statusCode    *int
+	latency       time.Duration
+	failureReason string
+	broken        bool
+}
+
+// destinationChecker probes destination URLs over HTTP.
+type destinationChecker struct {
+	client *http.Client
+}
+
+// newDestinationChecker returns a checker whose client doesn't follow redirects and refuses
+// internal addresses unless allowPrivate, so destinations can't be used to probe the internal network.
+func newDestinationChecker(timeout time.Duration, allowPrivate bool) *destinationChecker {
+	return &destinationChecker{
+		client: outbound.NewClient(timeout, allowPrivate),
+	}
+}
+
+// check issues a HEAD request and falls back to GET when the destination rejects HEAD.
+// 4xx/5xx responses, DNS failures and private addresses mark the destination as broken;
+// other transport errors (timeouts, refused connections) are recorded as failures only.
+// Redirects aren't followed: a 3xx response counts as reachable.
+func (c *destinationChecker) check(ctx context.Context, rawURL string) checkOutcome {
+	start := time.Now()
+
+	status, err := c.do(ctx, http.MethodHead, rawURL)
+	if err == nil && status >= http.StatusBadRequest {
+		// Many servers answer HEAD with 403/404/405 while GET works fine.
+		status, err = c.do(ctx, http.MethodGet, rawURL)
+	}
+
+	outcome := checkOutcome{latency: time.Since(start)}
+
+	if err != nil {
+		if errors.Is(err, outbound.ErrPrivateTarget) {
+			outcome.failureReason = outbound.ErrPrivateTarget.Error()
+			outcome.broken = true
+			return outcome
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			outcome.failureReason = fmt.Sprintf("dns lookup failed: %s", dnsErr.Err)
+			outcome.broken = true
+			return outcome
+		}
+		outcome.failureReason = fmt.Sprintf("request failed: %v", err)
+		return outcome
+	}
+
+	outcome.statusCode = &status
+	if status >= http.StatusBadRequest {
+		outcome.failureReason = fmt.Sprintf("destination returned %d", status)
+		outcome.broken = true
+	}
+
+	return outcome
+}
+
+func (c *destinationChecker) do(ctx context.Context, method string, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "url-shortener-health-check/1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Read a little of the body so the connection can be reused, but never the whole page.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	return resp.StatusCode, nil
+}
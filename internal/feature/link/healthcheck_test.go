@@ -0,0 +1,149 @@
+package link
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/outbound"
+)
+
+func TestDestinationChecker_check_OK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Fatalf("expected HEAD request, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	outcome := newDestinationChecker(time.Second, true).check(context.Background(), srv.URL)
+
+	if outcome.broken || outcome.failureReason != "" {
+		t.Fatalf("expected healthy outcome, got %+v", outcome)
+	}
+	if outcome.statusCode == nil || *outcome.statusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v", outcome.statusCode)
+	}
+}
+
+func TestDestinationChecker_check_FallsBackToGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	outcome := newDestinationChecker(time.Second, true).check(context.Background(), srv.URL)
+
+	if outcome.broken {
+		t.Fatalf("expected healthy outcome after GET fallback, got %+v", outcome)
+	}
+}
+
+func TestDestinationChecker_check_BrokenOnServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	outcome := newDestinationChecker(time.Second, true).check(context.Background(), srv.URL)
+
+	if !outcome.broken {
+		t.Fatalf("expected broken outcome, got %+v", outcome)
+	}
+	if outcome.statusCode == nil || *outcome.statusCode != http.StatusBadGateway {
+		t.Fatalf("expected status 502, got %v", outcome.statusCode)
+	}
+}
+
+func TestDestinationChecker_check_RefusesPrivateTarget(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	outcome := newDestinationChecker(time.Second, false).check(context.Background(), srv.URL)
+
+	if !outcome.broken || outcome.failureReason != outbound.ErrPrivateTarget.Error() {
+		t.Fatalf("expected broken outcome for loopback destination, got %+v", outcome)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("expected loopback destination not to be requested, got %d requests", hits.Load())
+	}
+}
+
+func TestBuildHealthCheckResult_BacksOffOnFailure(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	status := http.StatusNotFound
+	target := HealthCheckTarget{LinkID: 1, ConsecutiveFailures: 2}
+
+	res := buildHealthCheckResult(target, checkOutcome{statusCode: &status, failureReason: "destination returned 404", broken: true}, now, time.Hour)
+
+	if res.ConsecutiveFailures != 3 {
+		t.Fatalf("expected 3 consecutive failures, got %d", res.ConsecutiveFailures)
+	}
+	if got := res.NextCheckAt.Sub(now); got != 4*time.Hour {
+		t.Fatalf("expected next check in 4h, got %s", got)
+	}
+	if res.LastSuccessAt != nil {
+		t.Fatal("expected LastSuccessAt to be nil on failure")
+	}
+}
+
+func TestBuildHealthCheckResult_ResetsOnSuccess(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	status := http.StatusOK
+	target := HealthCheckTarget{LinkID: 1, ConsecutiveFailures: 5}
+
+	res := buildHealthCheckResult(target, checkOutcome{statusCode: &status}, now, time.Hour)
+
+	if res.ConsecutiveFailures != 0 || res.IsBroken {
+		t.Fatalf("expected reset result, got %+v", res)
+	}
+	if res.LastSuccessAt == nil || !res.LastSuccessAt.Equal(now) {
+		t.Fatalf("expected LastSuccessAt=%s, got %v", now, res.LastSuccessAt)
+	}
+}
+
+type mockLinkHealthRepo struct {
+	saved []HealthCheckResult
+}
+
+func (m *mockLinkHealthRepo) GetLinksDueForHealthCheck(ctx context.Context, limit int) ([]HealthCheckTarget, error) {
+	return nil, nil
+}
+
+func (m *mockLinkHealthRepo) SaveHealthCheckResult(ctx context.Context, result HealthCheckResult) error {
+	m.saved = append(m.saved, result)
+	return nil
+}
+
+func TestLinkHealthWorker_checkLink_NotifiesNewlyBrokenLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	repo := &mockLinkHealthRepo{}
+	notifier := &mockLinkNotifier{}
+	w := NewLinkHealthWorker(repo, time.Hour, time.Second, 1, 10, true, notifier)
+
+	w.checkLink(context.Background(), HealthCheckTarget{LinkID: 1, Code: "new", LongURL: srv.URL})
+	w.checkLink(context.Background(), HealthCheckTarget{LinkID: 2, Code: "known", LongURL: srv.URL, IsBroken: true})
+
+	if len(repo.saved) != 2 {
+		t.Fatalf("expected 2 saved results, got %d", len(repo.saved))
+	}
+	if len(notifier.broken) != 1 || notifier.broken[0].Code != "new" {
+		t.Fatalf("expected only the newly broken link notified, got %+v", notifier.broken)
+	}
+}
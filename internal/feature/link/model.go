@@ -7,23 +7,147 @@ type ShortLink struct {
 	Code            string
 	LongURL         string
 	ExpiresAt       time.Time
+	ExpiryBehavior  *ExpiryBehavior // nil means account or global default
 }
 
 type LongLink struct {
-	Id        int64
-	LongURL   string
-	ExpiresAt *time.Time
+	Id             int64
+	LongURL        string
+	ExpiresAt      *time.Time
+	ExpiryBehavior *ExpiryBehavior // link behavior, else account behavior, nil means global default
+}
+
+// LinkUpdate holds editable link fields; nil fields are left unchanged.
+type LinkUpdate struct {
+	LongURL *string
+	// SetExpiryBehavior replaces the link expiry behavior with ExpiryBehavior (nil resets it to account/global default).
+	SetExpiryBehavior bool
+	ExpiryBehavior    *ExpiryBehavior
+}
+
+// LinkState is a snapshot of link fields recorded in the change history.
+type LinkState struct {
+	LongURL      string     `json:"long_url"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	ExpiryAction string     `json:"expiry_action,omitempty"`
+	FallbackURL  string     `json:"fallback_url,omitempty"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+}
+
+type LinkEventType string
+
+const (
+	LinkEventCreate  LinkEventType = "create"
+	LinkEventUpdate  LinkEventType = "update"
+	LinkEventDisable LinkEventType = "disable"
+	LinkEventDelete  LinkEventType = "delete"
+)
+
+// LinkEvent is a single entry of the link change history.
+type LinkEvent struct {
+	Type          LinkEventType
+	ActorPublicId *string // nil when the change was made by the system (e.g. retention purge)
+	OldValue      *LinkState
+	NewValue      *LinkState
+	CreatedAt     time.Time
 }
 
 type ClientContext struct {
 	IP        string
 	UserAgent string
 	Referer   string
+	Prefetch  bool   // request announced itself as a browser prefetch/prerender
+	VisitorID string // visitor cookie value, empty unless visitors are identified by cookie
+	ClickID   string // handed to the destination for conversion attribution, empty with CLICK_ID_MODE=off
 }
 
+// TrafficType classifies the client behind a click. Only human clicks count in default stats.
+type TrafficType string
+
+const (
+	TrafficHuman    TrafficType = "human"
+	TrafficBot      TrafficType = "bot"
+	TrafficPrefetch TrafficType = "prefetch"
+)
+
 type ClickEvent struct {
-	LinkID    int64
-	IP        string
-	UserAgent string
-	Referer   string
+	LinkID      int64
+	IP          string
+	UserAgent   string
+	Referer     string
+	TrafficType TrafficType
+	OccurredAt  time.Time
+	// VisitorID is the visitor cookie of the client, empty unless visitors are identified by cookie.
+	VisitorID string
+	// ClickID is the click ID handed to the destination, empty unless click IDs are enabled.
+	ClickID string
+	// EventID identifies the event, so an event replayed from the click spool is stored once.
+	// It is assigned when the click is tracked.
+	EventID string
+}
+
+// HealthCheckTarget is a link whose destination is due for a health check.
+type HealthCheckTarget struct {
+	LinkID              int64
+	Code                string
+	AccountPublicId     string
+	LongURL             string
+	ConsecutiveFailures int
+	IsBroken            bool // result of the previous check
+}
+
+// HealthCheckResult is the outcome of a single destination check.
+type HealthCheckResult struct {
+	LinkID              int64
+	StatusCode          *int // nil when no HTTP response was received (DNS, timeout, ...)
+	Latency             time.Duration
+	FailureReason       string
+	IsBroken            bool
+	ConsecutiveFailures int
+	CheckedAt           time.Time
+	LastSuccessAt       *time.Time // nil when the check failed; storage keeps the previous value
+	NextCheckAt         time.Time
+}
+
+// BrokenLink is a link whose destination was flagged by the health worker.
+type BrokenLink struct {
+	Code                string
+	LongURL             string
+	StatusCode          *int
+	Latency             time.Duration
+	FailureReason       string
+	ConsecutiveFailures int
+	LastCheckedAt       time.Time
+	LastSuccessAt       *time.Time
+}
+
+// ExpiredLink is a link archived by the cleanup worker once it expired.
+type ExpiredLink struct {
+	Id              int64
+	Code            string
+	LongURL         string
+	AccountPublicId string
+	ExpiresAt       time.Time
+	ArchivedAt      time.Time
+}
+
+// ArchivedLink is an expired link kept with its stats until the retention period ends.
+type ArchivedLink struct {
+	Id              int64      `json:"id"`
+	Code            string     `json:"code"`
+	LongURL         string     `json:"long_url"`
+	AccountPublicId string     `json:"account_public_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	ArchivedAt      time.Time  `json:"archived_at"`
+	TotalClicks     int64      `json:"total_clicks"`
+}
+
+// ArchivedClick is a click of a purged link, exported before deletion.
+type ArchivedClick struct {
+	LinkID    int64     `json:"link_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Referer   string    `json:"referer"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,12 @@
+package link
+
+import "context"
+
+// LinkNotifier is told about link lifecycle events, e.g. to deliver them as webhooks.
+// The events have already happened, so failures are the notifier's to handle.
+type LinkNotifier interface {
+	LinkCreated(ctx context.Context, link ShortLink)
+	LinksExpired(ctx context.Context, links []ExpiredLink)
+	// LinkBroken is called when a check flags a destination that was not broken before.
+	LinkBroken(ctx context.Context, target HealthCheckTarget, result HealthCheckResult)
+}
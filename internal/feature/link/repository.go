@@ -1,12 +1,33 @@
 package link
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type LinkRepository interface {
 	CreateShortLink(ctx context.Context, link ShortLink) error
 	GetLongLink(ctx context.Context, code string) (LongLink, error)
+	GetBrokenLinks(ctx context.Context, accountPublicId string) ([]BrokenLink, error)
+	SetAccountExpiryBehavior(ctx context.Context, accountPublicId string, behavior *ExpiryBehavior) error
+	UpdateLink(ctx context.Context, code string, accountPublicId string, update LinkUpdate) (LinkState, error)
+	DisableLink(ctx context.Context, code string, accountPublicId string) error
+	DeleteLink(ctx context.Context, code string, accountPublicId string) error
+	GetLinkHistory(ctx context.Context, code string, accountPublicId string) ([]LinkEvent, error)
 }
 
 type ExpiredLinksRepository interface {
-	DeleteExpiredLinks(ctx context.Context) (int64, error)
+	ArchiveExpiredLinks(ctx context.Context, limit int) ([]ExpiredLink, error)
+	GetLinksToPurge(ctx context.Context, archivedBefore time.Time, limit int) ([]ArchivedLink, error)
+	StreamLinkClicks(ctx context.Context, linkIDs []int64, fn func(ArchivedClick) error) error
+	DeleteLinkClicks(ctx context.Context, linkIDs []int64, limit int) (int64, error)
+	DeleteLinks(ctx context.Context, linkIDs []int64) (int64, error)
+	// GetDeletedLinks and PurgeDeletedLinks finish the purge of links deleted by their accounts.
+	GetDeletedLinks(ctx context.Context, limit int) ([]int64, error)
+	PurgeDeletedLinks(ctx context.Context, linkIDs []int64) (int64, error)
+}
+
+type LinkHealthRepository interface {
+	GetLinksDueForHealthCheck(ctx context.Context, limit int) ([]HealthCheckTarget, error)
+	SaveHealthCheckResult(ctx context.Context, result HealthCheckResult) error
 }
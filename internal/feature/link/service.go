@@ -9,30 +9,35 @@ import (
 	"time"
 
 	"github.com/viacheslaev/url-shortener/internal/config"
+	"github.com/viacheslaev/url-shortener/internal/useragent"
 )
 
 type LinkService struct {
 	clickTracker ClickTracker
 	linkRepo     LinkRepository
 	cfg          *config.Config
+	notifier     LinkNotifier
 }
 
+// NewLinkService creates the service. notifier is optional.
 func NewLinkService(
 	clickTracker ClickTracker,
 	linkRepo LinkRepository,
 	cfg *config.Config,
+	notifier LinkNotifier,
 ) *LinkService {
 	return &LinkService{
 		clickTracker: clickTracker,
 		linkRepo:     linkRepo,
 		cfg:          cfg,
+		notifier:     notifier,
 	}
 }
 
-func (service *LinkService) createShortLink(ctx context.Context, longURL string, accountId string) (ShortLink, error) {
+func (service *LinkService) createShortLink(ctx context.Context, longURL string, accountId string, expiryBehavior *ExpiryBehavior) (ShortLink, error) {
 	longURL = strings.TrimSpace(longURL)
 	if !validateURL(longURL) {
-		return ShortLink{}, errors.New("invalid url")
+		return ShortLink{}, ErrInvalidURL
 	}
 
 	// Generates shortCode with retries in case unique constraint violation
@@ -48,10 +53,14 @@ func (service *LinkService) createShortLink(ctx context.Context, longURL string,
 			Code:            code,
 			LongURL:         longURL,
 			ExpiresAt:       service.calculateExpireTime(),
+			ExpiryBehavior:  expiryBehavior,
 		}
 
 		err = service.linkRepo.CreateShortLink(ctx, shortLink)
 		if err == nil {
+			if service.notifier != nil {
+				service.notifier.LinkCreated(ctx, shortLink)
+			}
 			return shortLink, nil
 		}
 
@@ -67,26 +76,43 @@ func (service *LinkService) createShortLink(ctx context.Context, longURL string,
 	return ShortLink{}, ErrFailedToGenerateShortCode
 }
 
-func (service *LinkService) resolveShortLink(ctx context.Context, code string, clientContext ClientContext) (string, error) {
+// resolveShortLink returns the link for the given code and tracks the click. On ErrLinkExpired the link
+// is returned as well, so the caller can apply its expiry behavior.
+func (service *LinkService) resolveShortLink(ctx context.Context, code string, clientContext ClientContext) (LongLink, error) {
+	longLink, err := service.lookupShortLink(ctx, code)
+	if err != nil && !errors.Is(err, ErrLinkExpired) {
+		return LongLink{}, err
+	}
+
+	// Track users click for analytics
+	service.clickTracker.TrackClick(ClickEvent{
+		LinkID:      longLink.Id,
+		IP:          clientContext.IP,
+		UserAgent:   clientContext.UserAgent,
+		Referer:     clientContext.Referer,
+		TrafficType: classifyTraffic(clientContext),
+		OccurredAt:  time.Now().UTC(),
+		VisitorID:   clientContext.VisitorID,
+		ClickID:     clientContext.ClickID,
+	})
+
+	return longLink, err
+}
+
+// lookupShortLink resolves the code like resolveShortLink but doesn't track a click.
+// Used by HEAD requests from link checkers and by the resolve API.
+func (service *LinkService) lookupShortLink(ctx context.Context, code string) (LongLink, error) {
 	longLink, err := service.linkRepo.GetLongLink(ctx, code)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
-			return "", ErrNotFound
+			return LongLink{}, ErrNotFound
 		}
 
-		log.Printf("ERROR resolveShortLink failed: code=%s err=%v", code, err)
+		log.Printf("ERROR lookupShortLink failed: code=%s err=%v", code, err)
 
-		return "", err
+		return LongLink{}, err
 	}
 
-	// Track users click for analytics
-	service.clickTracker.TrackClick(ClickEvent{
-		LinkID:    longLink.Id,
-		IP:        clientContext.IP,
-		UserAgent: clientContext.UserAgent,
-		Referer:   clientContext.Referer,
-	})
-
 	// If ExpiresAt == nil this is permanent link
 	if longLink.ExpiresAt != nil {
 		expiresAt := longLink.ExpiresAt.UTC()
@@ -99,11 +125,99 @@ func (service *LinkService) resolveShortLink(ctx context.Context, code string, c
 				expiresAt.Format(time.RFC3339),
 				now.Format(time.RFC3339),
 			)
-			return "", ErrLinkExpired
+			return longLink, ErrLinkExpired
+		}
+	}
+
+	return longLink, nil
+}
+
+// classifyTraffic tells human clicks from link unfurlers, crawlers and browser prefetches.
+func classifyTraffic(clientContext ClientContext) TrafficType {
+	switch {
+	case clientContext.Prefetch:
+		return TrafficPrefetch
+	case useragent.IsBot(clientContext.UserAgent):
+		return TrafficBot
+	default:
+		return TrafficHuman
+	}
+}
+
+// updateLink changes link fields owned by the account. Every change is recorded in the link history.
+func (service *LinkService) updateLink(ctx context.Context, code string, accountId string, update LinkUpdate) (LinkState, error) {
+	if update.LongURL != nil {
+		longURL := strings.TrimSpace(*update.LongURL)
+		if !validateURL(longURL) {
+			return LinkState{}, ErrInvalidURL
+		}
+		update.LongURL = &longURL
+	}
+
+	if update.LongURL == nil && !update.SetExpiryBehavior {
+		return LinkState{}, ErrNothingToUpdate
+	}
+
+	state, err := service.linkRepo.UpdateLink(ctx, code, accountId, update)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return LinkState{}, ErrNotFound
 		}
+		return LinkState{}, fmt.Errorf("update link failed: %w", err)
 	}
 
-	return longLink.LongURL, nil
+	return state, nil
+}
+
+// disableLink stops redirects for the link while keeping it with its stats and history.
+func (service *LinkService) disableLink(ctx context.Context, code string, accountId string) error {
+	if err := service.linkRepo.DisableLink(ctx, code, accountId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("disable link failed: %w", err)
+	}
+	return nil
+}
+
+// deleteLink deletes the link with its clicks. The link history is kept.
+func (service *LinkService) deleteLink(ctx context.Context, code string, accountId string) error {
+	if err := service.linkRepo.DeleteLink(ctx, code, accountId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("delete link failed: %w", err)
+	}
+	return nil
+}
+
+// getLinkHistory returns all recorded changes of the account's link, oldest first.
+func (service *LinkService) getLinkHistory(ctx context.Context, code string, accountId string) ([]LinkEvent, error) {
+	events, err := service.linkRepo.GetLinkHistory(ctx, code, accountId)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get link history failed: %w", err)
+	}
+	return events, nil
+}
+
+// getBrokenLinks returns the account's links whose destinations were flagged by the health worker.
+func (service *LinkService) getBrokenLinks(ctx context.Context, accountId string) ([]BrokenLink, error) {
+	links, err := service.linkRepo.GetBrokenLinks(ctx, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("get broken links failed: %w", err)
+	}
+	return links, nil
+}
+
+// setAccountExpiryBehavior sets the account default behavior for expired links. nil resets it to the global default.
+func (service *LinkService) setAccountExpiryBehavior(ctx context.Context, accountId string, behavior *ExpiryBehavior) error {
+	if err := service.linkRepo.SetAccountExpiryBehavior(ctx, accountId, behavior); err != nil {
+		return fmt.Errorf("set account expiry behavior failed: %w", err)
+	}
+	return nil
 }
 
 // calculateExpireTime returns the absolute expiration timestamp in UTC.
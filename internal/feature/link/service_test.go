@@ -2,7 +2,10 @@ package link
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -12,6 +15,10 @@ import (
 type mockLinkRepo struct {
 	createShortLinkFunc func(ctx context.Context, l ShortLink) error
 	getLongLinkFunc     func(ctx context.Context, code string) (LongLink, error)
+	getBrokenLinksFunc  func(ctx context.Context, accountPublicId string) ([]BrokenLink, error)
+	setExpiryFunc       func(ctx context.Context, accountPublicId string, behavior *ExpiryBehavior) error
+	updateLinkFunc      func(ctx context.Context, code string, accountPublicId string, update LinkUpdate) (LinkState, error)
+	getLinkHistoryFunc  func(ctx context.Context, code string, accountPublicId string) ([]LinkEvent, error)
 }
 
 func (m *mockLinkRepo) CreateShortLink(ctx context.Context, l ShortLink) error {
@@ -28,6 +35,42 @@ func (m *mockLinkRepo) GetLongLink(ctx context.Context, code string) (LongLink,
 	return m.getLongLinkFunc(ctx, code)
 }
 
+func (m *mockLinkRepo) GetBrokenLinks(ctx context.Context, accountPublicId string) ([]BrokenLink, error) {
+	if m.getBrokenLinksFunc == nil {
+		return nil, errors.New("GetBrokenLinks not configured")
+	}
+	return m.getBrokenLinksFunc(ctx, accountPublicId)
+}
+
+func (m *mockLinkRepo) SetAccountExpiryBehavior(ctx context.Context, accountPublicId string, behavior *ExpiryBehavior) error {
+	if m.setExpiryFunc == nil {
+		return errors.New("SetAccountExpiryBehavior not configured")
+	}
+	return m.setExpiryFunc(ctx, accountPublicId, behavior)
+}
+
+func (m *mockLinkRepo) UpdateLink(ctx context.Context, code string, accountPublicId string, update LinkUpdate) (LinkState, error) {
+	if m.updateLinkFunc == nil {
+		return LinkState{}, errors.New("UpdateLink not configured")
+	}
+	return m.updateLinkFunc(ctx, code, accountPublicId, update)
+}
+
+func (m *mockLinkRepo) DisableLink(ctx context.Context, code string, accountPublicId string) error {
+	return errors.New("DisableLink not configured")
+}
+
+func (m *mockLinkRepo) DeleteLink(ctx context.Context, code string, accountPublicId string) error {
+	return errors.New("DeleteLink not configured")
+}
+
+func (m *mockLinkRepo) GetLinkHistory(ctx context.Context, code string, accountPublicId string) ([]LinkEvent, error) {
+	if m.getLinkHistoryFunc == nil {
+		return nil, errors.New("GetLinkHistory not configured")
+	}
+	return m.getLinkHistoryFunc(ctx, code, accountPublicId)
+}
+
 type mockClickTracker struct {
 	trackFn func(ev ClickEvent)
 }
@@ -57,9 +100,9 @@ func TestLinkService_createShortLink_OK(t *testing.T) {
 			return nil
 		},
 	}
-	svc := NewLinkService(&mockClickTracker{}, repo, testCfg())
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
 
-	got, err := svc.createShortLink(context.Background(), "https://example.com", "acc-1")
+	got, err := svc.createShortLink(context.Background(), "https://example.com", "acc-1", nil)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -82,9 +125,9 @@ func TestLinkService_createShortLink_RetriesOnDuplicate(t *testing.T) {
 		},
 	}
 
-	svc := NewLinkService(&mockClickTracker{}, repo, testCfg())
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
 
-	if _, err := svc.createShortLink(context.Background(), "https://example.com", "acc-1"); err != nil {
+	if _, err := svc.createShortLink(context.Background(), "https://example.com", "acc-1", nil); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if attempts != 3 {
@@ -98,9 +141,9 @@ func TestLinkService_createShortLink_MaxAttemptsExceeded(t *testing.T) {
 			return ErrShortcodeAlreadyExists
 		},
 	}
-	svc := NewLinkService(&mockClickTracker{}, repo, testCfg())
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
 
-	_, err := svc.createShortLink(context.Background(), "https://example.com", "acc-1")
+	_, err := svc.createShortLink(context.Background(), "https://example.com", "acc-1", nil)
 
 	if !errors.Is(err, ErrFailedToGenerateShortCode) {
 		t.Fatalf("expected ErrFailedToGenerateShortCode, got %v", err)
@@ -113,7 +156,7 @@ func TestLinkService_resolveShortLink_NotFound(t *testing.T) {
 			return LongLink{}, ErrNotFound
 		},
 	}
-	svc := NewLinkService(&mockClickTracker{}, repo, testCfg())
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
 
 	_, err := svc.resolveShortLink(context.Background(), "missing", ClientContext{})
 
@@ -130,11 +173,245 @@ func TestLinkService_resolveShortLink_Expired(t *testing.T) {
 			return LongLink{Id: 1, LongURL: "https://example.com", ExpiresAt: &exp}, nil
 		},
 	}
-	svc := NewLinkService(&mockClickTracker{}, repo, testCfg())
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
 
-	_, err := svc.resolveShortLink(context.Background(), "abc", ClientContext{})
+	got, err := svc.resolveShortLink(context.Background(), "abc", ClientContext{})
 
 	if !errors.Is(err, ErrLinkExpired) {
 		t.Fatalf("expected ErrLinkExpired, got %v", err)
 	}
+	if got.Id != 1 {
+		t.Fatalf("expected expired link to be returned for expiry behavior, got %+v", got)
+	}
+}
+
+func TestLinkService_resolveShortLink_ClassifiesTraffic(t *testing.T) {
+	const browserUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+
+	tests := []struct {
+		name   string
+		client ClientContext
+		want   TrafficType
+	}{
+		{name: "browser", client: ClientContext{UserAgent: browserUA}, want: TrafficHuman},
+		{name: "slack unfurler", client: ClientContext{UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"}, want: TrafficBot},
+		{name: "imessage preview", client: ClientContext{UserAgent: "Mozilla/5.0 (Macintosh) AppleWebKit/601.2.4 (KHTML, like Gecko) Version/9.0.1 Safari/601.2.4 facebookexternalhit/1.1 Facebot Twitterbot/1.0"}, want: TrafficBot},
+		{name: "prefetch", client: ClientContext{UserAgent: browserUA, Prefetch: true}, want: TrafficPrefetch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracked ClickEvent
+			repo := &mockLinkRepo{
+				getLongLinkFunc: func(ctx context.Context, code string) (LongLink, error) {
+					return LongLink{Id: 1, LongURL: "https://example.com"}, nil
+				},
+			}
+			svc := NewLinkService(&mockClickTracker{trackFn: func(ev ClickEvent) { tracked = ev }}, repo, testCfg(), nil)
+
+			if _, err := svc.resolveShortLink(context.Background(), "abc", tt.client); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tracked.TrafficType != tt.want {
+				t.Fatalf("expected traffic type %q, got %q", tt.want, tracked.TrafficType)
+			}
+		})
+	}
+}
+
+func TestLinkHandler_ResolveShortLink_HeadIsNotTracked(t *testing.T) {
+	var tracked int
+	repo := &mockLinkRepo{
+		getLongLinkFunc: func(ctx context.Context, code string) (LongLink, error) {
+			return LongLink{Id: 1, LongURL: "https://example.com"}, nil
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{trackFn: func(ev ClickEvent) { tracked++ }}, repo, testCfg(), nil)
+	handler := NewLinkHandler(&config.Config{NotFoundAction: "json"}, svc)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{code}", handler.ResolveShortLink)
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/abc", nil))
+
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://example.com" {
+			t.Fatalf("%s: expected redirect, got %d location=%q", method, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	if tracked != 1 {
+		t.Fatalf("expected only GET to be tracked, got %d clicks", tracked)
+	}
+}
+
+func TestLinkHandler_ResolveShortLink_VisitorCookie(t *testing.T) {
+	var visitors []string
+	repo := &mockLinkRepo{
+		getLongLinkFunc: func(ctx context.Context, code string) (LongLink, error) {
+			return LongLink{Id: 1, LongURL: "https://example.com"}, nil
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{trackFn: func(ev ClickEvent) { visitors = append(visitors, ev.VisitorID) }}, repo, testCfg(), nil)
+	handler := NewLinkHandler(&config.Config{BaseURL: "https://short", NotFoundAction: "json", VisitorIDStrategy: "cookie"}, svc)
+
+	rec := httptest.NewRecorder()
+	handler.ResolveShortLink(rec, httptest.NewRequest(http.MethodGet, "/abc", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != visitorCookieName || !cookies[0].Secure || !cookies[0].HttpOnly {
+		t.Fatalf("expected a secure visitor cookie, got %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.AddCookie(cookies[0])
+	handler.ResolveShortLink(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.AddCookie(&http.Cookie{Name: visitorCookieName, Value: "forged"})
+	handler.ResolveShortLink(httptest.NewRecorder(), req)
+
+	if len(visitors) != 3 || visitors[0] != cookies[0].Value || visitors[1] != visitors[0] {
+		t.Fatalf("expected the cookie to identify the returning visitor, got %v", visitors)
+	}
+	if !validVisitorID(visitors[2]) || visitors[2] == visitors[0] {
+		t.Fatalf("expected a new visitor ID instead of a malformed cookie, got %q", visitors[2])
+	}
+}
+
+func TestLinkHandler_ResolveShortLink_ClickID(t *testing.T) {
+	var clickIDs []string
+	repo := &mockLinkRepo{
+		getLongLinkFunc: func(ctx context.Context, code string) (LongLink, error) {
+			return LongLink{Id: 1, LongURL: "https://shop.example.com/p?utm_source=a+b#top"}, nil
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{trackFn: func(ev ClickEvent) { clickIDs = append(clickIDs, ev.ClickID) }}, repo, testCfg(), nil)
+
+	cfg := &config.Config{BaseURL: "https://short", NotFoundAction: "json", ClickIDMode: "query", ClickIDParam: "click_id"}
+	rec := httptest.NewRecorder()
+	NewLinkHandler(cfg, svc).ResolveShortLink(rec, httptest.NewRequest(http.MethodGet, "/abc", nil))
+
+	if len(clickIDs) != 1 || len(clickIDs[0]) != 36 || clickIDs[0][14] != '7' {
+		t.Fatalf("expected the click to be tracked with a time-ordered click ID, got %v", clickIDs)
+	}
+	want := "https://shop.example.com/p?utm_source=a+b&click_id=" + clickIDs[0] + "#top"
+	if got := rec.Header().Get("Location"); got != want {
+		t.Fatalf("expected location %q, got %q", want, got)
+	}
+
+	cfg = &config.Config{BaseURL: "https://short", NotFoundAction: "json", ClickIDMode: "cookie", ClickIDParam: "click_id", ClickIDCookieDomain: "example.com"}
+	rec = httptest.NewRecorder()
+	NewLinkHandler(cfg, svc).ResolveShortLink(rec, httptest.NewRequest(http.MethodGet, "/abc", nil))
+
+	if got := rec.Header().Get("Location"); got != "https://shop.example.com/p?utm_source=a+b#top" {
+		t.Fatalf("expected the destination unchanged in cookie mode, got %q", got)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "click_id" || cookies[0].Value != clickIDs[1] || cookies[0].Domain != "example.com" {
+		t.Fatalf("expected a click_id cookie for example.com with the tracked ID, got %v", cookies)
+	}
+	if clickIDs[1] == clickIDs[0] {
+		t.Fatalf("expected a new click ID per click, got %v", clickIDs)
+	}
+}
+
+func TestLinkHandler_ExpandShortLink_Expired(t *testing.T) {
+	exp := time.Now().UTC().Add(-time.Hour)
+	repo := &mockLinkRepo{
+		getLongLinkFunc: func(ctx context.Context, code string) (LongLink, error) {
+			return LongLink{Id: 1, LongURL: "https://example.com", ExpiresAt: &exp}, nil
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{trackFn: func(ev ClickEvent) { t.Fatal("resolve API must not track clicks") }}, repo, testCfg(), nil)
+	handler := NewLinkHandler(&config.Config{BaseURL: "http://short", ExpiredLinkAction: "json", NotFoundAction: "json"}, svc)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/resolve/abc", nil)
+	req.SetPathValue("code", "abc")
+	rec := httptest.NewRecorder()
+	handler.ExpandShortLink(rec, req)
+
+	if rec.Code != http.StatusGone {
+		t.Fatalf("expected 410, got %d", rec.Code)
+	}
+	var resp resolveResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Status != "expired" || resp.LongURL != "" || resp.ShortURL != "http://short/abc" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestLinkService_updateLink_TrimsAndValidatesURL(t *testing.T) {
+	repo := &mockLinkRepo{
+		updateLinkFunc: func(ctx context.Context, code string, acc string, update LinkUpdate) (LinkState, error) {
+			if code != "abc" || acc != "acc-1" {
+				t.Fatalf("unexpected code=%q account=%q", code, acc)
+			}
+			if update.LongURL == nil || *update.LongURL != "https://example.org" {
+				t.Fatalf("expected trimmed url, got %v", update.LongURL)
+			}
+			return LinkState{LongURL: *update.LongURL}, nil
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
+
+	longURL := "  https://example.org "
+	state, err := svc.updateLink(context.Background(), "abc", "acc-1", LinkUpdate{LongURL: &longURL})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.LongURL != "https://example.org" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+
+	invalid := "not a url"
+	if _, err := svc.updateLink(context.Background(), "abc", "acc-1", LinkUpdate{LongURL: &invalid}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL, got %v", err)
+	}
+}
+
+func TestLinkService_updateLink_NothingToUpdate(t *testing.T) {
+	svc := NewLinkService(&mockClickTracker{}, &mockLinkRepo{}, testCfg(), nil)
+
+	_, err := svc.updateLink(context.Background(), "abc", "acc-1", LinkUpdate{})
+
+	if !errors.Is(err, ErrNothingToUpdate) {
+		t.Fatalf("expected ErrNothingToUpdate, got %v", err)
+	}
+}
+
+func TestLinkService_getLinkHistory_NotFound(t *testing.T) {
+	repo := &mockLinkRepo{
+		getLinkHistoryFunc: func(ctx context.Context, code string, acc string) ([]LinkEvent, error) {
+			return nil, ErrNotFound
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
+
+	_, err := svc.getLinkHistory(context.Background(), "abc", "acc-1")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLinkService_getLinkHistory_EmptyForLinkWithoutEvents(t *testing.T) {
+	repo := &mockLinkRepo{
+		getLinkHistoryFunc: func(ctx context.Context, code string, acc string) ([]LinkEvent, error) {
+			return []LinkEvent{}, nil
+		},
+	}
+	svc := NewLinkService(&mockClickTracker{}, repo, testCfg(), nil)
+
+	events, err := svc.getLinkHistory(context.Background(), "abc", "acc-1")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if events == nil || len(events) != 0 {
+		t.Fatalf("expected empty history, got %v", events)
+	}
 }
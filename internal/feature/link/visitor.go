@@ -0,0 +1,52 @@
+package link
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// visitorCookieName is the first-party cookie identifying a browser across clicks (VISITOR_ID_STRATEGY=cookie).
+	visitorCookieName   = "vid"
+	visitorCookieMaxAge = 365 * 24 * time.Hour
+	// visitorIDSize is the number of random bytes of a visitor ID, hex-encoded in the cookie.
+	visitorIDSize = 16
+)
+
+// visitorCookie returns the visitor ID of the request cookie. Without a valid cookie a new ID is issued,
+// and the cookie is (re)set either way, so visitors active within a year keep their ID.
+func visitorCookie(w http.ResponseWriter, r *http.Request, secure bool) string {
+	id := ""
+	if c, err := r.Cookie(visitorCookieName); err == nil && validVisitorID(c.Value) {
+		id = c.Value
+	}
+	if id == "" {
+		b := make([]byte, visitorIDSize)
+		if _, err := rand.Read(b); err != nil {
+			return ""
+		}
+		id = hex.EncodeToString(b)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(visitorCookieMaxAge / time.Second),
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+func validVisitorID(id string) bool {
+	if len(id) != 2*visitorIDSize {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
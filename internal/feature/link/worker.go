@@ -6,23 +6,43 @@ import (
 	"time"
 )
 
-// ExpiredLinksCleanupWorker periodically deletes expired links from storage.
+// LinkRetentionPolicy controls how long expired links are kept and how they are purged.
+type LinkRetentionPolicy struct {
+	// Retention is how long an expired link stays archived (visible with its stats) before it is purged.
+	Retention time.Duration
+	// BatchSize bounds every UPDATE/DELETE statement so a single pass can't lock the tables for long.
+	BatchSize int
+	// ExportDir enables gzipped NDJSON export of purged links and their clicks. Empty disables export.
+	ExportDir string
+}
+
+// ExpiredLinksCleanupWorker periodically archives expired links and purges archived links
+// once their retention period is over. It also finishes the purge of deleted links.
 type ExpiredLinksCleanupWorker struct {
 	repo     ExpiredLinksRepository
 	interval time.Duration
+	policy   LinkRetentionPolicy
+	exporter *archiveExporter
+	notifier LinkNotifier
 
 	done    chan struct{}
 	stopped chan struct{}
 }
 
-// NewExpiredLinksCleanupWorker creates a new cleanup worker.
-func NewExpiredLinksCleanupWorker(repo ExpiredLinksRepository, interval time.Duration) *ExpiredLinksCleanupWorker {
-	return &ExpiredLinksCleanupWorker{
+// NewExpiredLinksCleanupWorker creates a new cleanup worker. notifier is optional.
+func NewExpiredLinksCleanupWorker(repo ExpiredLinksRepository, interval time.Duration, policy LinkRetentionPolicy, notifier LinkNotifier) *ExpiredLinksCleanupWorker {
+	w := &ExpiredLinksCleanupWorker{
 		repo:     repo,
 		interval: interval,
+		policy:   policy,
+		notifier: notifier,
 		done:     make(chan struct{}),
 		stopped:  make(chan struct{}),
 	}
+	if policy.ExportDir != "" {
+		w.exporter = newArchiveExporter(repo, policy.ExportDir)
+	}
+	return w
 }
 
 func (w *ExpiredLinksCleanupWorker) Start() {
@@ -42,7 +62,8 @@ func (w *ExpiredLinksCleanupWorker) run() {
 	ticker := time.NewTicker(w.interval)
 	defer ticker.Stop()
 
-	log.Printf("[cleanup] expired links cleanup worker started interval=%s", w.interval)
+	log.Printf("[cleanup] expired links cleanup worker started interval=%s retention=%s batch=%d export=%t",
+		w.interval, w.policy.Retention, w.policy.BatchSize, w.exporter != nil)
 
 	for {
 		select {
@@ -57,16 +78,205 @@ func (w *ExpiredLinksCleanupWorker) run() {
 
 // cleanupExpiredLinks performs a single cleanup pass.
 func (w *ExpiredLinksCleanupWorker) cleanupExpiredLinks() {
+	archived := w.archiveExpiredLinks()
+	purged := w.purgeArchivedLinks(time.Now().UTC().Add(-w.policy.Retention))
+	deleted := w.purgeDeletedLinks()
+
+	if archived > 0 || purged > 0 || deleted > 0 {
+		log.Printf("[cleanup] archived expired links=%d purged links=%d purged deleted links=%d", archived, purged, deleted)
+	}
+}
+
+// archiveExpiredLinks marks expired links as archived batch by batch.
+func (w *ExpiredLinksCleanupWorker) archiveExpiredLinks() int64 {
+	var total int64
+	for !w.stopping() {
+		archived, err := w.archiveBatch()
+		if err != nil {
+			log.Printf("[cleanup] failed to archive expired links: %v", err)
+			return total
+		}
+		total += archived
+
+		if archived < int64(w.policy.BatchSize) {
+			return total
+		}
+	}
+	return total
+}
+
+func (w *ExpiredLinksCleanupWorker) archiveBatch() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	deleted, err := w.repo.DeleteExpiredLinks(ctx)
+	links, err := w.repo.ArchiveExpiredLinks(ctx, w.policy.BatchSize)
 	if err != nil {
-		log.Printf("[cleanup] failed to delete expired links: %v", err)
-		return
+		return 0, err
+	}
+	if w.notifier != nil && len(links) > 0 {
+		w.notifier.LinksExpired(ctx, links)
+	}
+	return int64(len(links)), nil
+}
+
+// purgeArchivedLinks deletes links archived before cutoff batch by batch, exporting them first when configured.
+func (w *ExpiredLinksCleanupWorker) purgeArchivedLinks(cutoff time.Time) int64 {
+	var total int64
+	for !w.stopping() {
+		purged, err := w.purgeBatch(cutoff)
+		if err != nil {
+			log.Printf("[cleanup] failed to purge archived links: %v", err)
+			return total
+		}
+		total += purged
+
+		if purged == 0 {
+			return total
+		}
+	}
+	return total
+}
+
+const (
+	// purgeChunkClicks bounds the clicks exported and deleted for one chunk of a purge batch, so a few
+	// links with long click histories don't make every pass time out on the same batch.
+	purgeChunkClicks = 100_000
+	// purgeExportClicksPerSecond is the export rate a chunk's export timeout is sized for.
+	purgeExportClicksPerSecond = 5_000
+	// purgeStepTimeout bounds each query of a purge that doesn't depend on the click volume.
+	purgeStepTimeout = 30 * time.Second
+)
+
+// purgeBatch purges up to BatchSize archived links, chunk by chunk (see purgeChunks).
+// Every chunk is exported and deleted on its own, so the chunks purged before a failure stay purged.
+func (w *ExpiredLinksCleanupWorker) purgeBatch(cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), purgeStepTimeout)
+	links, err := w.repo.GetLinksToPurge(ctx, cutoff, w.policy.BatchSize)
+	cancel()
+	if err != nil || len(links) == 0 {
+		return 0, err
+	}
+
+	var total int64
+	for _, chunk := range purgeChunks(links) {
+		if w.stopping() {
+			break
+		}
+		purged, err := w.purgeChunk(chunk)
+		if err != nil {
+			return total, err
+		}
+		total += purged
 	}
+	return total, nil
+}
+
+// purgeChunks splits links into chunks of at most purgeChunkClicks clicks. A link with more clicks
+// is a chunk of its own.
+func purgeChunks(links []ArchivedLink) [][]ArchivedLink {
+	var (
+		chunks [][]ArchivedLink
+		start  int
+		clicks int64
+	)
+	for i, l := range links {
+		if i > start && clicks+l.TotalClicks > purgeChunkClicks {
+			chunks = append(chunks, links[start:i])
+			start, clicks = i, 0
+		}
+		clicks += l.TotalClicks
+	}
+	return append(chunks, links[start:])
+}
+
+// purgeChunk exports the links (when configured), deletes their clicks in bounded batches and then the links.
+// Each step gets its own timeout; the export's is sized by the chunk's clicks.
+func (w *ExpiredLinksCleanupWorker) purgeChunk(links []ArchivedLink) (int64, error) {
+	ids := make([]int64, 0, len(links))
+	var clicks int64
+	for _, l := range links {
+		ids = append(ids, l.Id)
+		clicks += l.TotalClicks
+	}
+
+	if w.exporter != nil {
+		timeout := purgeStepTimeout + time.Duration(clicks/purgeExportClicksPerSecond)*time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		path, err := w.exporter.export(ctx, links, time.Now())
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("[cleanup] exported links=%d clicks=%d to %s", len(links), clicks, path)
+	}
+
+	// The links are exported and purged again on the next start, with the clicks left.
+	if done, err := w.deleteClicks(ids); !done || err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), purgeStepTimeout)
+	defer cancel()
+	return w.repo.DeleteLinks(ctx, ids)
+}
+
+// purgeDeletedLinks purges the links deleted by their accounts whose purge didn't finish, batch by batch.
+func (w *ExpiredLinksCleanupWorker) purgeDeletedLinks() int64 {
+	var total int64
+	for !w.stopping() {
+		ctx, cancel := context.WithTimeout(context.Background(), purgeStepTimeout)
+		ids, err := w.repo.GetDeletedLinks(ctx, w.policy.BatchSize)
+		cancel()
+		if err != nil {
+			log.Printf("[cleanup] failed to load deleted links: %v", err)
+			return total
+		}
+		if len(ids) == 0 {
+			return total
+		}
+
+		if done, err := w.deleteClicks(ids); !done || err != nil {
+			if err != nil {
+				log.Printf("[cleanup] failed to purge clicks of deleted links: %v", err)
+			}
+			return total
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), purgeStepTimeout)
+		purged, err := w.repo.PurgeDeletedLinks(ctx, ids)
+		cancel()
+		if err != nil {
+			log.Printf("[cleanup] failed to purge deleted links: %v", err)
+			return total
+		}
+		total += purged
+	}
+	return total
+}
+
+// deleteClicks deletes the click history of the links in bounded chunks first, so the link DELETE doesn't
+// cascade into a huge one. done is false when the worker was stopped before all clicks were deleted.
+func (w *ExpiredLinksCleanupWorker) deleteClicks(ids []int64) (done bool, err error) {
+	for !w.stopping() {
+		ctx, cancel := context.WithTimeout(context.Background(), purgeStepTimeout)
+		deleted, err := w.repo.DeleteLinkClicks(ctx, ids, w.policy.BatchSize)
+		cancel()
+		if err != nil {
+			return false, err
+		}
+		if deleted < int64(w.policy.BatchSize) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	if deleted > 0 {
-		log.Printf("[cleanup] deleted expired links=%d", deleted)
+// stopping reports whether Stop was called, so long passes can exit between batches.
+func (w *ExpiredLinksCleanupWorker) stopping() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
 	}
 }
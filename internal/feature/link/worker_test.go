@@ -0,0 +1,202 @@
+package link
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type mockLinkNotifier struct {
+	created []ShortLink
+	expired []ExpiredLink
+	broken  []HealthCheckTarget
+}
+
+func (m *mockLinkNotifier) LinkCreated(ctx context.Context, link ShortLink) {
+	m.created = append(m.created, link)
+}
+
+func (m *mockLinkNotifier) LinksExpired(ctx context.Context, links []ExpiredLink) {
+	m.expired = append(m.expired, links...)
+}
+
+func (m *mockLinkNotifier) LinkBroken(ctx context.Context, target HealthCheckTarget, result HealthCheckResult) {
+	m.broken = append(m.broken, target)
+}
+
+type mockExpiredLinksRepo struct {
+	archiveBatches []int64
+	purgeBatches   [][]ArchivedLink
+	clicks         []ArchivedClick
+	deletedLinks   []int64
+	// deletedByAccounts are links deleted by their accounts, clickCounts the clicks left per link.
+	deletedByAccounts []int64
+	clickCounts       map[int64]int64
+	purgedDeleted     []int64
+}
+
+func (m *mockExpiredLinksRepo) ArchiveExpiredLinks(ctx context.Context, limit int) ([]ExpiredLink, error) {
+	if len(m.archiveBatches) == 0 {
+		return nil, nil
+	}
+	links := make([]ExpiredLink, m.archiveBatches[0])
+	for i := range links {
+		links[i] = ExpiredLink{Id: int64(i + 1), Code: "c" + strconv.Itoa(i)}
+	}
+	m.archiveBatches = m.archiveBatches[1:]
+	return links, nil
+}
+
+func (m *mockExpiredLinksRepo) GetLinksToPurge(ctx context.Context, archivedBefore time.Time, limit int) ([]ArchivedLink, error) {
+	if len(m.purgeBatches) == 0 {
+		return nil, nil
+	}
+	batch := m.purgeBatches[0]
+	m.purgeBatches = m.purgeBatches[1:]
+	return batch, nil
+}
+
+func (m *mockExpiredLinksRepo) StreamLinkClicks(ctx context.Context, linkIDs []int64, fn func(ArchivedClick) error) error {
+	for _, c := range m.clicks {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockExpiredLinksRepo) DeleteLinkClicks(ctx context.Context, linkIDs []int64, limit int) (int64, error) {
+	var deleted int64
+	for _, id := range linkIDs {
+		if n := min(m.clickCounts[id], int64(limit)-deleted); n > 0 {
+			m.clickCounts[id] -= n
+			deleted += n
+		}
+	}
+	return deleted, nil
+}
+
+func (m *mockExpiredLinksRepo) GetDeletedLinks(ctx context.Context, limit int) ([]int64, error) {
+	ids := m.deletedByAccounts[:min(limit, len(m.deletedByAccounts))]
+	return ids, nil
+}
+
+func (m *mockExpiredLinksRepo) PurgeDeletedLinks(ctx context.Context, linkIDs []int64) (int64, error) {
+	for _, id := range linkIDs {
+		if m.clickCounts[id] > 0 {
+			return 0, errors.New("link still has clicks")
+		}
+	}
+	m.purgedDeleted = append(m.purgedDeleted, linkIDs...)
+	m.deletedByAccounts = m.deletedByAccounts[len(linkIDs):]
+	return int64(len(linkIDs)), nil
+}
+
+func (m *mockExpiredLinksRepo) DeleteLinks(ctx context.Context, linkIDs []int64) (int64, error) {
+	m.deletedLinks = append(m.deletedLinks, linkIDs...)
+	return int64(len(linkIDs)), nil
+}
+
+func TestExpiredLinksCleanupWorker_ArchivesInBatches(t *testing.T) {
+	repo := &mockExpiredLinksRepo{archiveBatches: []int64{2, 2, 1}}
+	notifier := &mockLinkNotifier{}
+	w := NewExpiredLinksCleanupWorker(repo, time.Hour, LinkRetentionPolicy{BatchSize: 2}, notifier)
+
+	if got := w.archiveExpiredLinks(); got != 5 {
+		t.Fatalf("expected 5 archived links, got %d", got)
+	}
+	if len(repo.archiveBatches) != 0 {
+		t.Fatalf("expected all batches consumed, left %d", len(repo.archiveBatches))
+	}
+	if len(notifier.expired) != 5 {
+		t.Fatalf("expected 5 expired links notified, got %d", len(notifier.expired))
+	}
+}
+
+func TestExpiredLinksCleanupWorker_PurgesAndExports(t *testing.T) {
+	dir := t.TempDir()
+	repo := &mockExpiredLinksRepo{
+		purgeBatches: [][]ArchivedLink{{{Id: 1, Code: "abc"}, {Id: 2, Code: "def"}}},
+		clicks:       []ArchivedClick{{LinkID: 1, IP: "1.2.3.4"}},
+	}
+	w := NewExpiredLinksCleanupWorker(repo, time.Hour, LinkRetentionPolicy{BatchSize: 10, ExportDir: dir}, nil)
+
+	if got := w.purgeArchivedLinks(time.Now()); got != 2 {
+		t.Fatalf("expected 2 purged links, got %d", got)
+	}
+	if len(repo.deletedLinks) != 2 {
+		t.Fatalf("expected 2 deleted links, got %v", repo.deletedLinks)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.ndjson.gz"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one export file, got %v (err=%v)", files, err)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("open export: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+
+	types := make([]string, 0)
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var rec archiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		types = append(types, rec.Type)
+	}
+	if len(types) != 3 || types[0] != "link" || types[1] != "link" || types[2] != "click" {
+		t.Fatalf("unexpected records: %v", types)
+	}
+}
+
+func TestExpiredLinksCleanupWorker_PurgesInChunksByClicks(t *testing.T) {
+	dir := t.TempDir()
+	repo := &mockExpiredLinksRepo{
+		purgeBatches: [][]ArchivedLink{{
+			{Id: 1, TotalClicks: 80_000},
+			{Id: 2, TotalClicks: 15_000},
+			{Id: 3, TotalClicks: 5_000},
+			{Id: 4, TotalClicks: 250_000},
+			{Id: 5, TotalClicks: 1},
+		}},
+	}
+	w := NewExpiredLinksCleanupWorker(repo, time.Hour, LinkRetentionPolicy{BatchSize: 10, ExportDir: dir}, nil)
+
+	if got := w.purgeArchivedLinks(time.Now()); got != 5 {
+		t.Fatalf("expected 5 purged links, got %d", got)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.ndjson.gz"))
+	if err != nil || len(files) != 3 {
+		t.Fatalf("expected an export per chunk (1-3, 4, 5), got %v (err=%v)", files, err)
+	}
+}
+
+func TestExpiredLinksCleanupWorker_FinishesPurgeOfDeletedLinks(t *testing.T) {
+	repo := &mockExpiredLinksRepo{
+		deletedByAccounts: []int64{1, 2, 3},
+		clickCounts:       map[int64]int64{1: 7, 3: 2},
+	}
+	w := NewExpiredLinksCleanupWorker(repo, time.Hour, LinkRetentionPolicy{BatchSize: 2}, nil)
+
+	if got := w.purgeDeletedLinks(); got != 3 {
+		t.Fatalf("expected 3 purged deleted links, got %d", got)
+	}
+	if len(repo.purgedDeleted) != 3 || repo.clickCounts[1] != 0 || repo.clickCounts[3] != 0 {
+		t.Fatalf("expected the links purged after their clicks, purged=%v clicks=%v", repo.purgedDeleted, repo.clickCounts)
+	}
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// ClickSampleRate is optional, 1 delivers every click.
+	ClickSampleRate *float64 `json:"click_sample_rate"`
+}
+
+type webhookResponse struct {
+	Id              string      `json:"id"`
+	URL             string      `json:"url"`
+	Events          []EventType `json:"events"`
+	ClickSampleRate float64     `json:"click_sample_rate"`
+	Secret          string      `json:"secret,omitempty"` // only in the response to creation
+	CreatedAt       string      `json:"created_at"`
+}
+
+func createWebhookResponse(endpoint Endpoint, withSecret bool) webhookResponse {
+	resp := webhookResponse{
+		Id:              endpoint.PublicId,
+		URL:             endpoint.URL,
+		Events:          endpoint.Events,
+		ClickSampleRate: endpoint.ClickSampleRate,
+		CreatedAt:       endpoint.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if withSecret {
+		resp.Secret = endpoint.Secret
+	}
+	return resp
+}
+
+type webhooksResponse struct {
+	Webhooks []webhookResponse `json:"webhooks"`
+}
+
+func createWebhooksResponse(endpoints []Endpoint) webhooksResponse {
+	resp := webhooksResponse{Webhooks: make([]webhookResponse, 0, len(endpoints))}
+	for _, e := range endpoints {
+		resp.Webhooks = append(resp.Webhooks, createWebhookResponse(e, false))
+	}
+	return resp
+}
+
+type deliveryResponse struct {
+	Id             int64           `json:"id"`
+	EventId        string          `json:"event_id"`
+	EventType      EventType       `json:"event_type"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *string         `json:"next_attempt_at"` // only for pending deliveries
+	LastAttemptAt  *string         `json:"last_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    *string         `json:"delivered_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+type deliveriesResponse struct {
+	Deliveries []deliveryResponse `json:"deliveries"`
+	// NextBefore is the before parameter of the next page, nil on the last page.
+	NextBefore *int64 `json:"next_before"`
+}
+
+func createDeliveriesResponse(deliveries []Delivery, limit int) deliveriesResponse {
+	resp := deliveriesResponse{Deliveries: make([]deliveryResponse, 0, len(deliveries))}
+	for _, d := range deliveries {
+		dr := deliveryResponse{
+			Id:             d.Id,
+			EventId:        d.EventId,
+			EventType:      d.EventType,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			LastAttemptAt:  formatTime(d.LastAttemptAt),
+			LastStatusCode: d.LastStatusCode,
+			LastError:      d.LastError,
+			CreatedAt:      d.CreatedAt.UTC().Format(time.RFC3339),
+			DeliveredAt:    formatTime(d.DeliveredAt),
+			Payload:        d.Payload,
+		}
+		if d.Status == DeliveryPending {
+			dr.NextAttemptAt = formatTime(&d.NextAttemptAt)
+		}
+		resp.Deliveries = append(resp.Deliveries, dr)
+	}
+	if len(deliveries) > 0 && len(deliveries) == limit {
+		next := deliveries[len(deliveries)-1].Id
+		resp.NextBefore = &next
+	}
+	return resp
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
@@ -0,0 +1,13 @@
+package webhook
+
+import "errors"
+
+var (
+	ErrNotFound             = errors.New("webhook not found")
+	ErrDeliveryNotFound     = errors.New("delivery not found")
+	ErrInvalidURL           = errors.New("url must be an absolute http or https URL")
+	ErrInvalidEvents        = errors.New("events must list at least one of: link.created, link.expired, link.clicked, link.broken")
+	ErrInvalidSampleRate    = errors.New("click_sample_rate must be > 0 and <= 1")
+	ErrDeliveryPending      = errors.New("delivery is still pending")
+	ErrInvalidDeliveryQuery = errors.New("invalid delivery log parameters")
+)
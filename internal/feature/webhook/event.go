@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+// linkData identifies the link of an event.
+type linkData struct {
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	LongURL   string `json:"long_url,omitempty"`
+}
+
+type linkCreatedData struct {
+	linkData
+	ExpiresAt string `json:"expires_at"`
+}
+
+type linkExpiredData struct {
+	linkData
+	ExpiresAt  string `json:"expires_at"`
+	ArchivedAt string `json:"archived_at"`
+}
+
+type linkBrokenData struct {
+	linkData
+	StatusCode    *int   `json:"status_code"`
+	FailureReason string `json:"failure_reason"`
+	CheckedAt     string `json:"checked_at"`
+}
+
+// linkClickedData carries no personal data: no IP, User-Agent or visitor ID.
+type linkClickedData struct {
+	linkData
+	OccurredAt     string           `json:"occurred_at"`
+	TrafficType    link.TrafficType `json:"traffic_type"`
+	ReferrerDomain string           `json:"referrer_domain"`
+	Country        string           `json:"country"`
+	City           string           `json:"city"`
+	Browser        string           `json:"browser"`
+	OS             string           `json:"os"`
+	Device         string           `json:"device"`
+}
+
+func (service *WebhookService) linkData(code string, longURL string) linkData {
+	return linkData{ShortCode: code, ShortURL: service.baseURL + "/" + code, LongURL: longURL}
+}
+
+func createLinkClickedData(data linkData, c analytics.Click) linkClickedData {
+	return linkClickedData{
+		linkData:       data,
+		OccurredAt:     c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		TrafficType:    link.TrafficHuman,
+		ReferrerDomain: c.RefererDomain,
+		Country:        c.Country,
+		City:           c.City,
+		Browser:        c.Browser,
+		OS:             c.OS,
+		Device:         c.Device,
+	}
+}
+
+// newEvent wraps data into an event with the given id and returns its JSON.
+func newEvent(id string, eventType EventType, data any, now time.Time) (Event, []byte, error) {
+	event := Event{Id: id, Type: eventType, CreatedAt: now.UTC(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Event{}, nil, fmt.Errorf("marshal %s event: %w", eventType, err)
+	}
+	return event, payload, nil
+}
+
+// eventIdNamespace is the UUID namespace of event ids derived from their source.
+var eventIdNamespace = [16]byte{0x4e, 0x1c, 0x8a, 0x52, 0x93, 0x0d, 0x4f, 0x7b, 0xa6, 0x21, 0x5c, 0xe8, 0x0f, 0x3d, 0x97, 0xb4}
+
+// sourceEventId derives a name-based (version 5) UUID from the event type and the key of the row
+// the event is about. The same source always gets the same id, so an event enqueued again
+// (a retried enqueue or clicks replayed from the spool) is not delivered twice.
+func sourceEventId(eventType EventType, source ...string) string {
+	h := sha1.New()
+	h.Write(eventIdNamespace[:])
+	h.Write([]byte(eventType))
+	for _, s := range source {
+		h.Write([]byte{0})
+		h.Write([]byte(s))
+	}
+	b := h.Sum(nil)[:16]
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// clickEventId derives the id of a click's link.clicked event from the stored click: its tracked event's id,
+// or the click itself for clicks tracked without one.
+func clickEventId(c analytics.Click) string {
+	if c.EventID != "" {
+		return sourceEventId(EventLinkClicked, c.EventID)
+	}
+	return sourceEventId(EventLinkClicked, strconv.FormatInt(c.LinkID, 10), c.CreatedAt.UTC().Format(time.RFC3339Nano),
+		c.VisitorID, c.IPHash, c.IPAddress, c.UserAgent, c.Referer, c.ClickID)
+}
+
+// sampleValue returns a number in [0, 1) derived from the event and the endpoint, so a click replayed
+// from the spool is sampled for an endpoint the same way again.
+func sampleValue(eventId string, endpointId int64) float64 {
+	sum := sha256.Sum256([]byte(eventId + "/" + strconv.FormatInt(endpointId, 10)))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+// newSecret returns a random endpoint secret.
+func newSecret() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b[:]), nil
+}
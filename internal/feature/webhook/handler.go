@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+)
+
+type WebhookHandler struct {
+	service *WebhookService
+}
+
+func NewWebhookHandler(svc *WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: svc}
+}
+
+// CreateWebhook registers an endpoint for the account's events. The response holds the signing secret.
+// Route: POST /api/v1/webhooks
+func (handler *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.WriteErr(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	endpoint, err := handler.service.createEndpoint(r.Context(), accountPublicId, req.URL, req.Events, req.ClickSampleRate)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidURL), errors.Is(err, ErrInvalidEvents), errors.Is(err, ErrInvalidSampleRate):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("CreateWebhook failed: %v", err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to create webhook")
+		}
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusCreated, createWebhookResponse(endpoint, true))
+}
+
+// GetWebhooks lists the account's endpoints without their secrets.
+// Route: GET /api/v1/webhooks
+func (handler *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	endpoints, err := handler.service.getEndpoints(r.Context(), accountPublicId)
+	if err != nil {
+		log.Printf("GetWebhooks failed: %v", err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to get webhooks")
+		return
+	}
+
+	httpx.WriteResponse(w, http.StatusOK, createWebhooksResponse(endpoints))
+}
+
+// DeleteWebhook deletes the account's endpoint with its pending deliveries and delivery log.
+// Route: DELETE /api/v1/webhooks/{id}
+func (handler *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := handler.service.deleteEndpoint(r.Context(), id, accountPublicId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("DeleteWebhook failed: id=%s err=%v", id, err)
+		httpx.WriteErr(w, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries returns the delivery log of the account's endpoint, newest first.
+// Route: GET /api/v1/webhooks/{id}/deliveries?status=dead&limit=50&before=1234
+func (handler *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := DeliveryFilter{Status: DeliveryStatus(query.Get("status"))}
+	var err error
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit == 0 {
+			httpx.WriteErr(w, http.StatusBadRequest, "invalid limit parameter")
+			return
+		}
+	}
+	if v := query.Get("before"); v != "" {
+		if filter.Before, err = strconv.ParseInt(v, 10, 64); err != nil {
+			httpx.WriteErr(w, http.StatusBadRequest, "invalid before parameter")
+			return
+		}
+	}
+
+	id := r.PathValue("id")
+	deliveries, err := handler.service.getDeliveries(r.Context(), id, accountPublicId, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrInvalidDeliveryQuery):
+			httpx.WriteErr(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("GetDeliveries failed: id=%s err=%v", id, err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to get webhook deliveries")
+		}
+		return
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = defaultDeliveriesLimit
+	}
+	httpx.WriteResponse(w, http.StatusOK, createDeliveriesResponse(deliveries, limit))
+}
+
+// RetryDelivery queues a delivered or dead-lettered delivery again.
+// Route: POST /api/v1/webhooks/{id}/deliveries/{delivery}/retry
+func (handler *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	accountPublicId, ok := auth.AccountPublicIDFromContext(r.Context())
+	if !ok {
+		httpx.WriteErr(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id := r.PathValue("id")
+	deliveryId, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil {
+		httpx.WriteErr(w, http.StatusNotFound, ErrDeliveryNotFound.Error())
+		return
+	}
+
+	if err := handler.service.retryDelivery(r.Context(), id, accountPublicId, deliveryId); err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrDeliveryNotFound):
+			httpx.WriteErr(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrDeliveryPending):
+			httpx.WriteErr(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("RetryDelivery failed: id=%s delivery=%d err=%v", id, deliveryId, err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "failed to retry webhook delivery")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
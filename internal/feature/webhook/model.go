@@ -0,0 +1,92 @@
+package webhook
+
+import "time"
+
+// EventType names an event an endpoint can subscribe to.
+type EventType string
+
+const (
+	EventLinkCreated EventType = "link.created"
+	EventLinkExpired EventType = "link.expired"
+	EventLinkClicked EventType = "link.clicked" // human clicks only, sampled per endpoint
+	EventLinkBroken  EventType = "link.broken"
+)
+
+// Endpoint is a URL of an account that receives the events it subscribed to.
+type Endpoint struct {
+	Id              int64
+	PublicId        string
+	AccountPublicId string
+	URL             string
+	// Secret signs the deliveries (see sign). It is only shown when the endpoint is created.
+	Secret string
+	Events []EventType
+	// ClickSampleRate is the share of link.clicked events delivered to the endpoint, in (0, 1].
+	ClickSampleRate float64
+	CreatedAt       time.Time
+}
+
+// Event is the JSON body of a webhook request.
+type Event struct {
+	// Id is the same for all deliveries of the event and across retries, so receivers can deduplicate.
+	Id        string    `json:"id"`
+	Type      EventType `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// AccountEvent is an event of an account, queued for its endpoints subscribed to the event type.
+type AccountEvent struct {
+	AccountPublicId string
+	Type            EventType
+	Id              string
+	Payload         []byte
+}
+
+// DeliveryStatus is the state of a delivery in the queue.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead" // every attempt failed, kept as a dead letter
+)
+
+// Delivery is an event queued for, or sent to, one endpoint.
+type Delivery struct {
+	Id             int64
+	EndpointId     int64
+	EventId        string
+	EventType      EventType
+	Payload        []byte // the request body, an Event as JSON
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	LastStatusCode *int // nil when no HTTP response was received
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// DueDelivery is a delivery claimed by the worker, with the endpoint to send it to.
+type DueDelivery struct {
+	Delivery
+	URL    string
+	Secret string
+}
+
+// ClickSubscription is an endpoint subscribed to the clicks of one of the account's links.
+type ClickSubscription struct {
+	EndpointId int64
+	LinkID     int64
+	Code       string
+	SampleRate float64
+}
+
+// DeliveryFilter selects a page of an endpoint's delivery log, newest first.
+type DeliveryFilter struct {
+	Status DeliveryStatus // empty selects all
+	Before int64          // only deliveries with a smaller id; 0 starts with the newest
+	Limit  int
+}
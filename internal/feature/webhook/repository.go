@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"context"
+	"time"
+)
+
+type WebhookRepository interface {
+	CreateEndpoint(ctx context.Context, endpoint Endpoint) (Endpoint, error)
+	GetEndpoints(ctx context.Context, accountPublicId string) ([]Endpoint, error)
+	DeleteEndpoint(ctx context.Context, publicId string, accountPublicId string) error
+	GetDeliveries(ctx context.Context, endpointPublicId string, accountPublicId string, filter DeliveryFilter) ([]Delivery, error)
+	RetryDelivery(ctx context.Context, endpointPublicId string, accountPublicId string, deliveryId int64) error
+
+	// EnqueueEvents queues every event for the endpoints of its account subscribed to its type.
+	EnqueueEvents(ctx context.Context, events []AccountEvent) error
+	GetClickSubscriptions(ctx context.Context, linkIDs []int64) ([]ClickSubscription, error)
+	EnqueueDeliveries(ctx context.Context, deliveries []Delivery) error
+}
+
+type DeliveryRepository interface {
+	// ClaimDueDeliveries returns up to limit due deliveries and postpones them by lease,
+	// so they are retried if this instance dies while sending them.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error)
+	SaveDeliveryAttempt(ctx context.Context, delivery Delivery) error
+	// DeleteFinishedDeliveries deletes a batch of delivered and dead deliveries created before a time.
+	DeleteFinishedDeliveries(ctx context.Context, before time.Time, limit int) (int64, error)
+}
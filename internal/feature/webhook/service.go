@@ -0,0 +1,372 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+	"github.com/viacheslaev/url-shortener/internal/server/httpx"
+)
+
+// WebhookService manages the endpoints of accounts and queues the events they subscribed to.
+// It is the link.LinkNotifier and analytics.ClickNotifier of the app: notifications are handed to
+// a bounded in-memory queue and written to the repository in the background, so neither requests
+// nor click ingestion wait for it.
+type WebhookService struct {
+	repo    WebhookRepository
+	baseURL string
+	// sample returns a number in [0, 1) that decides whether a click event is delivered to a sampled endpoint.
+	sample func(eventId string, endpointId int64) float64
+
+	jobs    chan enqueueJob
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// enqueueJob writes the events of one notification to the repository.
+type enqueueJob struct {
+	what string
+	fn   func(ctx context.Context) error
+}
+
+func NewWebhookService(repo WebhookRepository, baseURL string) *WebhookService {
+	return &WebhookService{
+		repo:    repo,
+		baseURL: baseURL,
+		sample:  sampleValue,
+		jobs:    make(chan enqueueJob, enqueueQueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Start runs the background loop that writes queued notifications.
+func (service *WebhookService) Start() {
+	go service.run()
+}
+
+// Stop stops the background loop after the notifications already queued are written, or enqueueTimeout passed.
+func (service *WebhookService) Stop() {
+	close(service.done)
+	<-service.stopped
+}
+
+// run is the internal background loop.
+func (service *WebhookService) run() {
+	defer close(service.stopped)
+
+	for {
+		select {
+		case job := <-service.jobs:
+			service.runJob(context.Background(), job)
+		case <-service.done:
+			service.drain()
+			return
+		}
+	}
+}
+
+// drain writes the notifications left in the queue on shutdown.
+func (service *WebhookService) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), enqueueTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case job := <-service.jobs:
+			service.runJob(ctx, job)
+		default:
+			return
+		}
+	}
+}
+
+// createEndpoint registers an endpoint with a new secret. A nil sampleRate delivers every click.
+func (service *WebhookService) createEndpoint(ctx context.Context, accountId string, rawURL string, events []string, sampleRate *float64) (Endpoint, error) {
+	if !validateEndpointURL(rawURL) {
+		return Endpoint{}, ErrInvalidURL
+	}
+	eventTypes, err := parseEvents(events)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	rate := 1.0
+	if sampleRate != nil {
+		rate = *sampleRate
+	}
+	if !(rate > 0 && rate <= 1) {
+		return Endpoint{}, ErrInvalidSampleRate
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	endpoint, err := service.repo.CreateEndpoint(ctx, Endpoint{
+		AccountPublicId: accountId,
+		URL:             rawURL,
+		Secret:          secret,
+		Events:          eventTypes,
+		ClickSampleRate: rate,
+	})
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("create webhook failed: %w", err)
+	}
+	return endpoint, nil
+}
+
+func (service *WebhookService) getEndpoints(ctx context.Context, accountId string) ([]Endpoint, error) {
+	endpoints, err := service.repo.GetEndpoints(ctx, accountId)
+	if err != nil {
+		return nil, fmt.Errorf("get webhooks failed: %w", err)
+	}
+	return endpoints, nil
+}
+
+// deleteEndpoint deletes the endpoint with its queued deliveries and delivery log.
+func (service *WebhookService) deleteEndpoint(ctx context.Context, id string, accountId string) error {
+	if !httpx.IsUUID(id) {
+		return ErrNotFound
+	}
+	if err := service.repo.DeleteEndpoint(ctx, id, accountId); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("delete webhook failed: %w", err)
+	}
+	return nil
+}
+
+// getDeliveries returns a page of the endpoint's delivery log, newest first.
+func (service *WebhookService) getDeliveries(ctx context.Context, id string, accountId string, filter DeliveryFilter) ([]Delivery, error) {
+	if !httpx.IsUUID(id) {
+		return nil, ErrNotFound
+	}
+	switch filter.Status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryDead:
+	default:
+		return nil, ErrInvalidDeliveryQuery
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultDeliveriesLimit
+	}
+	if filter.Limit < 0 || filter.Limit > maxDeliveriesLimit || filter.Before < 0 {
+		return nil, ErrInvalidDeliveryQuery
+	}
+
+	deliveries, err := service.repo.GetDeliveries(ctx, id, accountId, filter)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get webhook deliveries failed: %w", err)
+	}
+	return deliveries, nil
+}
+
+// retryDelivery queues a delivered or dead delivery again with a fresh set of attempts.
+func (service *WebhookService) retryDelivery(ctx context.Context, id string, accountId string, deliveryId int64) error {
+	if !httpx.IsUUID(id) {
+		return ErrNotFound
+	}
+	err := service.repo.RetryDelivery(ctx, id, accountId, deliveryId)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrDeliveryNotFound), errors.Is(err, ErrDeliveryPending):
+		return err
+	default:
+		return fmt.Errorf("retry webhook delivery failed: %w", err)
+	}
+}
+
+const (
+	// enqueueQueueSize bounds the notifications waiting to be written; further ones are dropped and logged.
+	enqueueQueueSize = 1000
+	// enqueueAttempts bounds the attempts to queue the events of a change; they are sent after its commit.
+	enqueueAttempts = 3
+	// enqueueRetryBackoff is the delay before the second attempt, doubled for each further one.
+	enqueueRetryBackoff = 100 * time.Millisecond
+	// enqueueTimeout bounds all attempts of a notification together.
+	enqueueTimeout = 10 * time.Second
+)
+
+// sourcedEvent is the data of an event with the key of the row it is about (see sourceEventId).
+type sourcedEvent struct {
+	source []string
+	data   any
+}
+
+// LinkCreated queues a link.created event.
+func (service *WebhookService) LinkCreated(ctx context.Context, l link.ShortLink) {
+	service.publish(EventLinkCreated, l.AccountPublicId, sourcedEvent{
+		source: []string{l.AccountPublicId, l.Code, l.ExpiresAt.UTC().Format(time.RFC3339Nano)},
+		data: linkCreatedData{
+			linkData:  service.linkData(l.Code, l.LongURL),
+			ExpiresAt: l.ExpiresAt.UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+// LinksExpired queues a link.expired event per link.
+func (service *WebhookService) LinksExpired(ctx context.Context, links []link.ExpiredLink) {
+	events := make(map[string][]sourcedEvent)
+	for _, l := range links {
+		events[l.AccountPublicId] = append(events[l.AccountPublicId], sourcedEvent{
+			source: []string{strconv.FormatInt(l.Id, 10)},
+			data: linkExpiredData{
+				linkData:   service.linkData(l.Code, l.LongURL),
+				ExpiresAt:  l.ExpiresAt.UTC().Format(time.RFC3339),
+				ArchivedAt: l.ArchivedAt.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+	for accountId, accountEvents := range events {
+		service.publish(EventLinkExpired, accountId, accountEvents...)
+	}
+}
+
+// LinkBroken queues a link.broken event.
+func (service *WebhookService) LinkBroken(ctx context.Context, target link.HealthCheckTarget, result link.HealthCheckResult) {
+	service.publish(EventLinkBroken, target.AccountPublicId, sourcedEvent{
+		source: []string{strconv.FormatInt(target.LinkID, 10), result.CheckedAt.UTC().Format(time.RFC3339Nano)},
+		data: linkBrokenData{
+			linkData:      service.linkData(target.Code, target.LongURL),
+			StatusCode:    result.StatusCode,
+			FailureReason: result.FailureReason,
+			CheckedAt:     result.CheckedAt.UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+// publish queues the events for the account's endpoints subscribed to eventType.
+// Links without an account have no endpoints.
+func (service *WebhookService) publish(eventType EventType, accountId string, sourced ...sourcedEvent) {
+	if accountId == "" {
+		return
+	}
+
+	now := time.Now()
+	events := make([]AccountEvent, 0, len(sourced))
+	for _, s := range sourced {
+		event, payload, err := newEvent(sourceEventId(eventType, s.source...), eventType, s.data, now)
+		if err != nil {
+			log.Printf("[webhook] failed to create %s event: %v", eventType, err)
+			return
+		}
+		events = append(events, AccountEvent{AccountPublicId: accountId, Type: eventType, Id: event.Id, Payload: payload})
+	}
+
+	service.enqueue(fmt.Sprintf("%s events=%d", eventType, len(events)), func(ctx context.Context) error {
+		return service.repo.EnqueueEvents(ctx, events)
+	})
+}
+
+// ClicksStored queues link.clicked events of the human clicks for the endpoints subscribed to them,
+// keeping the sample rate share of clicks for each endpoint.
+func (service *WebhookService) ClicksStored(ctx context.Context, clicks []analytics.Click) {
+	linkIDs := make([]int64, 0)
+	for _, c := range clicks {
+		if isHuman(c) {
+			linkIDs = append(linkIDs, c.LinkID)
+		}
+	}
+	if len(linkIDs) == 0 {
+		return
+	}
+
+	service.enqueue(fmt.Sprintf("%s clicks=%d", EventLinkClicked, len(linkIDs)), func(ctx context.Context) error {
+		subs, err := service.repo.GetClickSubscriptions(ctx, linkIDs)
+		if err != nil || len(subs) == 0 {
+			return err
+		}
+		deliveries, err := service.clickDeliveries(clicks, subs)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		return service.repo.EnqueueDeliveries(ctx, deliveries)
+	})
+}
+
+// clickDeliveries creates the deliveries of the human clicks to the subscribed endpoints that sample them.
+func (service *WebhookService) clickDeliveries(clicks []analytics.Click, subs []ClickSubscription) ([]Delivery, error) {
+	subsByLink := make(map[int64][]ClickSubscription)
+	for _, s := range subs {
+		subsByLink[s.LinkID] = append(subsByLink[s.LinkID], s)
+	}
+
+	now := time.Now()
+	var deliveries []Delivery
+	for _, c := range clicks {
+		if !isHuman(c) {
+			continue
+		}
+
+		var (
+			eventId = clickEventId(c)
+			payload []byte
+		)
+		for _, s := range subsByLink[c.LinkID] {
+			if s.SampleRate < 1 && service.sample(eventId, s.EndpointId) >= s.SampleRate {
+				continue
+			}
+			if payload == nil {
+				data := createLinkClickedData(service.linkData(s.Code, ""), c)
+				var err error
+				if _, payload, err = newEvent(eventId, EventLinkClicked, data, now); err != nil {
+					return nil, err
+				}
+			}
+			deliveries = append(deliveries, Delivery{EndpointId: s.EndpointId, EventId: eventId, EventType: EventLinkClicked, Payload: payload})
+		}
+	}
+	return deliveries, nil
+}
+
+// enqueue hands fn to the background loop without waiting. It is called after the change was committed;
+// when the queue is full the events are dropped and logged rather than holding up the caller.
+func (service *WebhookService) enqueue(what string, fn func(ctx context.Context) error) {
+	select {
+	case service.jobs <- enqueueJob{what: what, fn: fn}:
+	default:
+		log.Printf("[webhook] queue is full, dropped %s", what)
+	}
+}
+
+// runJob runs the job with a few retries. Enqueueing is idempotent: event ids are derived from
+// their source and an event already queued for an endpoint is skipped.
+func (service *WebhookService) runJob(ctx context.Context, job enqueueJob) {
+	ctx, cancel := context.WithTimeout(ctx, enqueueTimeout)
+	defer cancel()
+
+	backoff := enqueueRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := job.fn(ctx)
+		if err == nil {
+			return
+		}
+		if attempt == enqueueAttempts {
+			log.Printf("[webhook] failed to enqueue %s after %d attempts: %v", job.what, attempt, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			log.Printf("[webhook] failed to enqueue %s: %v", job.what, err)
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// isHuman reports whether the click counts as human traffic; clicks stored before traffic types have none.
+func isHuman(c analytics.Click) bool {
+	return c.TrafficType == "" || c.TrafficType == link.TrafficHuman
+}
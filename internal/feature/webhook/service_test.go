@@ -0,0 +1,370 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
+	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+const testEndpointId = "0b9f7c1e-6f4a-4d2b-9a57-3c1d2e8f4a10"
+
+type mockWebhookRepo struct {
+	createEndpointFunc        func(ctx context.Context, endpoint Endpoint) (Endpoint, error)
+	getEndpointsFunc          func(ctx context.Context, acc string) ([]Endpoint, error)
+	getDeliveriesFunc         func(ctx context.Context, id string, acc string, filter DeliveryFilter) ([]Delivery, error)
+	getClickSubscriptionsFunc func(ctx context.Context, linkIDs []int64) ([]ClickSubscription, error)
+
+	events     []AccountEvent
+	deliveries []Delivery
+	// enqueueFailures is the number of enqueues that fail before they succeed.
+	enqueueFailures int
+	enqueueCalls    int
+}
+
+func (m *mockWebhookRepo) CreateEndpoint(ctx context.Context, endpoint Endpoint) (Endpoint, error) {
+	if m.createEndpointFunc == nil {
+		return Endpoint{}, errors.New("CreateEndpoint not configured")
+	}
+	return m.createEndpointFunc(ctx, endpoint)
+}
+
+func (m *mockWebhookRepo) GetEndpoints(ctx context.Context, acc string) ([]Endpoint, error) {
+	if m.getEndpointsFunc == nil {
+		return nil, errors.New("GetEndpoints not configured")
+	}
+	return m.getEndpointsFunc(ctx, acc)
+}
+
+func (m *mockWebhookRepo) DeleteEndpoint(ctx context.Context, id string, acc string) error {
+	return ErrNotFound
+}
+
+func (m *mockWebhookRepo) GetDeliveries(ctx context.Context, id string, acc string, filter DeliveryFilter) ([]Delivery, error) {
+	if m.getDeliveriesFunc == nil {
+		return nil, errors.New("GetDeliveries not configured")
+	}
+	return m.getDeliveriesFunc(ctx, id, acc, filter)
+}
+
+func (m *mockWebhookRepo) RetryDelivery(ctx context.Context, id string, acc string, deliveryId int64) error {
+	return ErrDeliveryNotFound
+}
+
+func (m *mockWebhookRepo) EnqueueEvents(ctx context.Context, events []AccountEvent) error {
+	m.enqueueCalls++
+	if m.enqueueCalls <= m.enqueueFailures {
+		return errors.New("connection reset")
+	}
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *mockWebhookRepo) GetClickSubscriptions(ctx context.Context, linkIDs []int64) ([]ClickSubscription, error) {
+	if m.getClickSubscriptionsFunc == nil {
+		return nil, errors.New("GetClickSubscriptions not configured")
+	}
+	return m.getClickSubscriptionsFunc(ctx, linkIDs)
+}
+
+func (m *mockWebhookRepo) EnqueueDeliveries(ctx context.Context, deliveries []Delivery) error {
+	m.enqueueCalls++
+	if m.enqueueCalls <= m.enqueueFailures {
+		return errors.New("connection reset")
+	}
+	m.deliveries = append(m.deliveries, deliveries...)
+	return nil
+}
+
+func decodeEvent(t *testing.T, payload []byte) (Event, map[string]any) {
+	t.Helper()
+	var event struct {
+		Event
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("decode payload %s: %v", payload, err)
+	}
+	return event.Event, event.Data
+}
+
+func TestWebhookService_createEndpoint(t *testing.T) {
+	repo := &mockWebhookRepo{createEndpointFunc: func(ctx context.Context, endpoint Endpoint) (Endpoint, error) {
+		endpoint.PublicId = testEndpointId
+		return endpoint, nil
+	}}
+	svc := NewWebhookService(repo, "https://sho.rt")
+
+	half := 0.5
+	zero := 0.0
+	invalid := []struct {
+		url    string
+		events []string
+		rate   *float64
+		want   error
+	}{
+		{"ftp://crm.example.com/hook", []string{"link.created"}, nil, ErrInvalidURL},
+		{"/hook", []string{"link.created"}, nil, ErrInvalidURL},
+		{"https://crm.example.com/hook", nil, nil, ErrInvalidEvents},
+		{"https://crm.example.com/hook", []string{"link.deleted"}, nil, ErrInvalidEvents},
+		{"https://crm.example.com/hook", []string{"link.clicked"}, &zero, ErrInvalidSampleRate},
+	}
+	for _, tc := range invalid {
+		if _, err := svc.createEndpoint(context.Background(), "acc", tc.url, tc.events, tc.rate); !errors.Is(err, tc.want) {
+			t.Errorf("createEndpoint(%q, %v) error = %v, want %v", tc.url, tc.events, err, tc.want)
+		}
+	}
+
+	endpoint, err := svc.createEndpoint(context.Background(), "acc", "https://crm.example.com/hook", []string{"link.clicked", " LINK.CLICKED", "link.broken"}, &half)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(endpoint.Events) != 2 || endpoint.Events[0] != EventLinkClicked || endpoint.Events[1] != EventLinkBroken {
+		t.Fatalf("events = %v, want link.clicked and link.broken once", endpoint.Events)
+	}
+	if endpoint.ClickSampleRate != 0.5 || endpoint.AccountPublicId != "acc" || !strings.HasPrefix(endpoint.Secret, "whsec_") {
+		t.Fatalf("unexpected endpoint %+v", endpoint)
+	}
+
+	endpoint, err = svc.createEndpoint(context.Background(), "acc", "https://crm.example.com/hook", []string{"link.created"}, nil)
+	if err != nil || endpoint.ClickSampleRate != 1 {
+		t.Fatalf("expected every click delivered by default, got %v, %v", endpoint.ClickSampleRate, err)
+	}
+}
+
+func TestWebhookService_LinkEvents(t *testing.T) {
+	repo := &mockWebhookRepo{}
+	svc := NewWebhookService(repo, "https://sho.rt")
+	expiresAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	svc.LinkCreated(context.Background(), link.ShortLink{Code: "anon", LongURL: "https://example.com"})
+	svc.drain()
+	if len(repo.events) != 0 {
+		t.Fatal("links without an account have no webhooks")
+	}
+
+	svc.LinkCreated(context.Background(), link.ShortLink{AccountPublicId: "acc", Code: "abc", LongURL: "https://example.com", ExpiresAt: expiresAt})
+	svc.LinksExpired(context.Background(), []link.ExpiredLink{
+		{Code: "a1", AccountPublicId: "acc"},
+		{Code: "b1", AccountPublicId: "other"},
+		{Code: "a2", AccountPublicId: "acc"},
+	})
+	status := http.StatusNotFound
+	svc.LinkBroken(context.Background(),
+		link.HealthCheckTarget{Code: "abc", AccountPublicId: "acc", LongURL: "https://example.com"},
+		link.HealthCheckResult{StatusCode: &status, FailureReason: "destination returned 404", IsBroken: true})
+	svc.drain()
+
+	if len(repo.events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(repo.events))
+	}
+	created := repo.events[0]
+	event, data := decodeEvent(t, created.Payload)
+	if created.Type != EventLinkCreated || created.AccountPublicId != "acc" || event.Id != created.Id || event.Type != EventLinkCreated {
+		t.Fatalf("unexpected created event %+v", created)
+	}
+	if data["short_url"] != "https://sho.rt/abc" || data["long_url"] != "https://example.com" || data["expires_at"] != "2026-03-01T00:00:00Z" {
+		t.Fatalf("unexpected created event data %v", data)
+	}
+
+	expired := map[string]int{}
+	for _, e := range repo.events[1:4] {
+		if e.Type != EventLinkExpired {
+			t.Fatalf("expected link.expired, got %s", e.Type)
+		}
+		expired[e.AccountPublicId]++
+	}
+	if expired["acc"] != 2 || expired["other"] != 1 {
+		t.Fatalf("expired events per account = %v", expired)
+	}
+
+	_, data = decodeEvent(t, repo.events[4].Payload)
+	if repo.events[4].Type != EventLinkBroken || data["status_code"] != float64(404) || data["failure_reason"] != "destination returned 404" {
+		t.Fatalf("unexpected broken event data %v", data)
+	}
+}
+
+func TestWebhookService_ClicksStored_SamplesHumanClicks(t *testing.T) {
+	var requested []int64
+	repo := &mockWebhookRepo{getClickSubscriptionsFunc: func(ctx context.Context, linkIDs []int64) ([]ClickSubscription, error) {
+		requested = linkIDs
+		return []ClickSubscription{
+			{EndpointId: 1, LinkID: 7, Code: "abc", SampleRate: 1},
+			{EndpointId: 2, LinkID: 7, Code: "abc", SampleRate: 0.5},
+		}, nil
+	}}
+	svc := NewWebhookService(repo, "https://sho.rt")
+	samples := []float64{0.2, 0.8}
+	svc.sample = func(eventId string, endpointId int64) float64 {
+		v := samples[0]
+		samples = samples[1:]
+		return v
+	}
+
+	svc.ClicksStored(context.Background(), []analytics.Click{
+		{LinkID: 7, IPAddress: "203.0.113.7", RefererDomain: "news.example.com", TrafficType: link.TrafficHuman},
+		{LinkID: 7, TrafficType: link.TrafficBot},
+		{LinkID: 7, TrafficType: link.TrafficHuman},
+		{LinkID: 9, TrafficType: link.TrafficHuman},
+	})
+	svc.drain()
+
+	if len(requested) != 3 {
+		t.Fatalf("expected subscriptions of the 3 human clicks, got %v", requested)
+	}
+	perEndpoint := map[int64]int{}
+	for _, d := range repo.deliveries {
+		perEndpoint[d.EndpointId]++
+	}
+	if perEndpoint[1] != 2 || perEndpoint[2] != 1 {
+		t.Fatalf("deliveries per endpoint = %v, want every click for 1 and the sampled one for 2", perEndpoint)
+	}
+
+	first, sampled := repo.deliveries[0], repo.deliveries[1]
+	if sampled.EndpointId != 2 || sampled.EventId != first.EventId {
+		t.Fatal("endpoints must get the same event of a click")
+	}
+	event, data := decodeEvent(t, first.Payload)
+	if event.Type != EventLinkClicked || data["short_code"] != "abc" || data["referrer_domain"] != "news.example.com" {
+		t.Fatalf("unexpected click event %s", first.Payload)
+	}
+	if strings.Contains(string(first.Payload), "203.0.113.7") {
+		t.Fatalf("click event %s leaks the IP", first.Payload)
+	}
+}
+
+func TestWebhookService_ClicksStored_ReplayKeepsEventIds(t *testing.T) {
+	repo := &mockWebhookRepo{getClickSubscriptionsFunc: func(ctx context.Context, linkIDs []int64) ([]ClickSubscription, error) {
+		return []ClickSubscription{
+			{EndpointId: 1, LinkID: 7, Code: "abc", SampleRate: 1},
+			{EndpointId: 2, LinkID: 7, Code: "abc", SampleRate: 0.5},
+		}, nil
+	}}
+	svc := NewWebhookService(repo, "https://sho.rt")
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clicks := make([]analytics.Click, 0, 20)
+	for i := range 20 {
+		clicks = append(clicks, analytics.Click{LinkID: 7, CreatedAt: now.Add(time.Duration(i) * time.Millisecond), TrafficType: link.TrafficHuman})
+	}
+	svc.ClicksStored(context.Background(), clicks)
+	svc.drain()
+	stored := repo.deliveries
+	repo.deliveries = nil
+	svc.ClicksStored(context.Background(), clicks)
+	svc.drain()
+
+	if len(repo.deliveries) != len(stored) {
+		t.Fatalf("replay queued %d deliveries, want %d", len(repo.deliveries), len(stored))
+	}
+	ids := map[string]bool{}
+	for i, d := range repo.deliveries {
+		if d.EndpointId != stored[i].EndpointId || d.EventId != stored[i].EventId {
+			t.Fatalf("replayed delivery %d = %d/%s, want %d/%s", i, d.EndpointId, d.EventId, stored[i].EndpointId, stored[i].EventId)
+		}
+		ids[d.EventId] = true
+	}
+	if len(ids) != len(clicks) {
+		t.Fatalf("expected an event id per click, got %d", len(ids))
+	}
+}
+
+func TestWebhookService_publish_RetriesEnqueue(t *testing.T) {
+	repo := &mockWebhookRepo{enqueueFailures: 2}
+	svc := NewWebhookService(repo, "https://sho.rt")
+	svc.Start()
+
+	svc.LinkCreated(context.Background(), link.ShortLink{Code: "abc", AccountPublicId: "acc"})
+	svc.LinkCreated(context.Background(), link.ShortLink{Code: "abc", AccountPublicId: "acc"})
+	svc.Stop()
+
+	if repo.enqueueCalls != 4 || len(repo.events) != 2 {
+		t.Fatalf("enqueue calls = %d, events = %d; want the third attempt to queue the first event", repo.enqueueCalls, len(repo.events))
+	}
+	if repo.events[1].Id != repo.events[0].Id {
+		t.Fatal("the same link must get the same link.created event id")
+	}
+}
+
+func TestWebhookService_enqueue_DoesNotBlockCaller(t *testing.T) {
+	repo := &mockWebhookRepo{}
+	svc := NewWebhookService(repo, "https://sho.rt")
+
+	for range enqueueQueueSize + 10 {
+		svc.LinkCreated(context.Background(), link.ShortLink{Code: "abc", AccountPublicId: "acc"})
+	}
+	if repo.enqueueCalls != 0 {
+		t.Fatalf("enqueue calls = %d; the caller must not write the events itself", repo.enqueueCalls)
+	}
+	if len(svc.jobs) != enqueueQueueSize {
+		t.Fatalf("queued %d notifications, want the queue to stop at %d", len(svc.jobs), enqueueQueueSize)
+	}
+}
+
+func TestWebhookService_getDeliveries_Validates(t *testing.T) {
+	var got DeliveryFilter
+	repo := &mockWebhookRepo{getDeliveriesFunc: func(ctx context.Context, id string, acc string, filter DeliveryFilter) ([]Delivery, error) {
+		got = filter
+		return nil, nil
+	}}
+	svc := NewWebhookService(repo, "https://sho.rt")
+
+	if _, err := svc.getDeliveries(context.Background(), "not-a-uuid", "acc", DeliveryFilter{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a malformed id, got %v", err)
+	}
+	for _, filter := range []DeliveryFilter{{Status: "failed"}, {Limit: maxDeliveriesLimit + 1}, {Before: -1}} {
+		if _, err := svc.getDeliveries(context.Background(), testEndpointId, "acc", filter); !errors.Is(err, ErrInvalidDeliveryQuery) {
+			t.Fatalf("filter %+v: expected ErrInvalidDeliveryQuery, got %v", filter, err)
+		}
+	}
+	if _, err := svc.getDeliveries(context.Background(), testEndpointId, "acc", DeliveryFilter{Status: DeliveryDead}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Limit != defaultDeliveriesLimit || got.Status != DeliveryDead {
+		t.Fatalf("filter = %+v, want the default limit", got)
+	}
+}
+
+func TestWebhookHandler_SecretIsOnlyShownOnCreate(t *testing.T) {
+	var stored Endpoint
+	repo := &mockWebhookRepo{
+		createEndpointFunc: func(ctx context.Context, endpoint Endpoint) (Endpoint, error) {
+			endpoint.PublicId = testEndpointId
+			stored = endpoint
+			return endpoint, nil
+		},
+		getEndpointsFunc: func(ctx context.Context, acc string) ([]Endpoint, error) {
+			return []Endpoint{stored}, nil
+		},
+	}
+	handler := NewWebhookHandler(NewWebhookService(repo, "https://sho.rt"))
+	ctx := auth.WithAccountPublicID(context.Background(), "acc")
+
+	rec := httptest.NewRecorder()
+	body := `{"url":"https://crm.example.com/hook","events":["link.created","link.clicked"],"click_sample_rate":0.1}`
+	handler.CreateWebhook(rec, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", strings.NewReader(body)).WithContext(ctx))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var created webhookResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.Id != testEndpointId || created.Secret == "" || created.ClickSampleRate != 0.1 {
+		t.Fatalf("unexpected response %+v", created)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.GetWebhooks(rec, httptest.NewRequest(http.MethodGet, "/api/v1/webhooks", nil).WithContext(ctx))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "secret") {
+		t.Fatalf("status = %d, list must not show secrets: %s", rec.Code, rec.Body)
+	}
+}
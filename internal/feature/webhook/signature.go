@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers of a webhook request.
+const (
+	headerEventId   = "X-Webhook-Id"
+	headerEventType = "X-Webhook-Event"
+	headerTimestamp = "X-Webhook-Timestamp"
+	headerSignature = "X-Webhook-Signature"
+)
+
+// sign returns the X-Webhook-Signature value of a request body: "sha256=" and the hex HMAC-SHA256,
+// keyed with the endpoint secret, of the X-Webhook-Timestamp value, a dot and the body.
+// Signing the timestamp lets receivers reject replayed requests.
+func sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
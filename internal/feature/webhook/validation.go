@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 100
+)
+
+var eventTypes = []EventType{EventLinkCreated, EventLinkExpired, EventLinkClicked, EventLinkBroken}
+
+func validateEndpointURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.User != nil {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// parseEvents validates the subscribed event types and removes duplicates.
+func parseEvents(events []string) ([]EventType, error) {
+	parsed := make([]EventType, 0, len(events))
+	for _, e := range events {
+		eventType := EventType(strings.ToLower(strings.TrimSpace(e)))
+		if !slices.Contains(eventTypes, eventType) {
+			return nil, ErrInvalidEvents
+		}
+		if !slices.Contains(parsed, eventType) {
+			parsed = append(parsed, eventType)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, ErrInvalidEvents
+	}
+	return parsed, nil
+}
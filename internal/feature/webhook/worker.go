@@ -0,0 +1,286 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/outbound"
+)
+
+// maxDeliveryBackoff caps how far the next attempt of a failing delivery is pushed out.
+const maxDeliveryBackoff = 6 * time.Hour
+
+// purgeInterval is how often finished deliveries past their retention are deleted.
+const purgeInterval = time.Hour
+
+// DeliveryPolicy controls how webhook deliveries are sent, retried and kept.
+type DeliveryPolicy struct {
+	// BatchSize bounds the deliveries claimed at once, Concurrency the requests in flight.
+	BatchSize   int
+	Concurrency int
+	// Timeout bounds a single request.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts before a delivery is kept as a dead letter.
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry; it doubles with every failed attempt.
+	RetryBackoff time.Duration
+	// Retention is how long delivered and dead deliveries stay in the log. 0 keeps them.
+	Retention time.Duration
+	// AllowPrivateTargets permits endpoints on loopback, private and link-local addresses.
+	AllowPrivateTargets bool
+}
+
+// DeliveryWorker sends due webhook deliveries from the Postgres queue.
+// Workers of several instances share the queue: every delivery is claimed by one of them.
+type DeliveryWorker struct {
+	repo      DeliveryRepository
+	interval  time.Duration
+	policy    DeliveryPolicy
+	client    *http.Client
+	lastPurge time.Time
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewDeliveryWorker creates a new delivery worker that polls the queue every interval.
+func NewDeliveryWorker(repo DeliveryRepository, interval time.Duration, policy DeliveryPolicy) *DeliveryWorker {
+	return &DeliveryWorker{
+		repo:     repo,
+		interval: interval,
+		policy:   policy,
+		client:   outbound.NewClient(policy.Timeout, policy.AllowPrivateTargets),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (w *DeliveryWorker) Start() {
+	go w.run()
+}
+
+// Stop gracefully stops the worker and blocks until the in-flight pass exits.
+func (w *DeliveryWorker) Stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// run is the internal background loop.
+func (w *DeliveryWorker) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	log.Printf("[webhook] delivery worker started interval=%s concurrency=%d max_attempts=%d",
+		w.interval, w.policy.Concurrency, w.policy.MaxAttempts)
+
+	for {
+		select {
+		case <-ticker.C:
+			w.deliverDue()
+			w.purgeFinished(time.Now().UTC())
+		case <-w.done:
+			log.Printf("[webhook] delivery worker stopped")
+			return
+		}
+	}
+}
+
+// deliverDue sends due deliveries batch by batch until the queue has no more due ones.
+func (w *DeliveryWorker) deliverDue() {
+	for !w.stopping() {
+		claimed, err := w.deliverBatch()
+		if err != nil {
+			log.Printf("[webhook] failed to claim due deliveries: %v", err)
+			return
+		}
+		if claimed < w.policy.BatchSize {
+			return
+		}
+	}
+}
+
+func (w *DeliveryWorker) deliverBatch() (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Abort in-flight requests on shutdown; their deliveries are retried once the lease ends.
+	go func() {
+		select {
+		case <-w.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	claimCtx, claimCancel := context.WithTimeout(ctx, 10*time.Second)
+	deliveries, err := w.repo.ClaimDueDeliveries(claimCtx, w.policy.BatchSize, w.lease())
+	claimCancel()
+	if err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, w.policy.Concurrency)
+	var wg sync.WaitGroup
+
+	for _, d := range deliveries {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return len(deliveries), nil
+		}
+
+		wg.Add(1)
+		go func(d DueDelivery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			w.deliver(ctx, d)
+		}(d)
+	}
+
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// lease is how long claimed deliveries stay hidden from other workers: long enough
+// to send the whole batch when every request times out.
+func (w *DeliveryWorker) lease() time.Duration {
+	rounds := (w.policy.BatchSize + w.policy.Concurrency - 1) / w.policy.Concurrency
+	return time.Duration(rounds+1) * w.policy.Timeout
+}
+
+// deliver sends one delivery and stores the outcome of the attempt.
+func (w *DeliveryWorker) deliver(ctx context.Context, d DueDelivery) {
+	outcome := w.send(ctx, d, time.Now())
+	if ctx.Err() != nil {
+		// Shutdown: the delivery is retried once its lease ends.
+		return
+	}
+
+	delivery := applyAttempt(d.Delivery, outcome, time.Now().UTC(), w.policy)
+
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.repo.SaveDeliveryAttempt(saveCtx, delivery); err != nil {
+		log.Printf("[webhook] failed to save delivery attempt delivery_id=%d err=%v", d.Id, err)
+		return
+	}
+
+	if delivery.Status == DeliveryDead {
+		log.Printf("[webhook] delivery dead-lettered delivery_id=%d attempts=%d err=%s", d.Id, delivery.Attempts, delivery.LastError)
+	}
+}
+
+// attemptOutcome is the result of a single delivery request.
+type attemptOutcome struct {
+	statusCode *int
+	err        string // empty on success
+}
+
+// send POSTs the payload, signed with the endpoint secret. Only 2xx responses count as delivered.
+func (w *DeliveryWorker) send(ctx context.Context, d DueDelivery, now time.Time) attemptOutcome {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return attemptOutcome{err: fmt.Sprintf("invalid request: %v", err)}
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-webhooks/1.0")
+	req.Header.Set(headerEventId, d.EventId)
+	req.Header.Set(headerEventType, string(d.EventType))
+	req.Header.Set(headerTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(headerSignature, sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return attemptOutcome{err: fmt.Sprintf("request failed: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	// Read a little of the body so the connection can be reused, but never a whole page.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	outcome := attemptOutcome{statusCode: &resp.StatusCode}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		outcome.err = fmt.Sprintf("endpoint returned %d", resp.StatusCode)
+	}
+	return outcome
+}
+
+// applyAttempt records an attempt in the delivery. Failed deliveries are retried with exponential
+// backoff until MaxAttempts, then kept as dead letters.
+func applyAttempt(d Delivery, outcome attemptOutcome, now time.Time, policy DeliveryPolicy) Delivery {
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.LastStatusCode = outcome.statusCode
+	d.LastError = outcome.err
+
+	switch {
+	case outcome.err == "":
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = &now
+	case d.Attempts >= policy.MaxAttempts:
+		d.Status = DeliveryDead
+	default:
+		d.Status = DeliveryPending
+		d.NextAttemptAt = now.Add(deliveryBackoff(policy.RetryBackoff, d.Attempts))
+	}
+	return d
+}
+
+// deliveryBackoff doubles the retry delay for every failed attempt up to maxDeliveryBackoff.
+func deliveryBackoff(backoff time.Duration, attempts int) time.Duration {
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxDeliveryBackoff {
+			return maxDeliveryBackoff
+		}
+	}
+	return min(backoff, maxDeliveryBackoff)
+}
+
+// purgeFinished deletes delivered and dead deliveries past the retention batch by batch, at most once per purgeInterval.
+func (w *DeliveryWorker) purgeFinished(now time.Time) {
+	if w.policy.Retention <= 0 || now.Sub(w.lastPurge) < purgeInterval {
+		return
+	}
+	w.lastPurge = now
+
+	var total int64
+	for !w.stopping() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		deleted, err := w.repo.DeleteFinishedDeliveries(ctx, now.Add(-w.policy.Retention), w.policy.BatchSize)
+		cancel()
+		if err != nil {
+			log.Printf("[webhook] failed to delete finished deliveries: %v", err)
+			break
+		}
+		total += deleted
+		if deleted < int64(w.policy.BatchSize) {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("[webhook] deleted finished deliveries=%d", total)
+	}
+}
+
+// stopping reports whether Stop was called, so long passes can exit between batches.
+func (w *DeliveryWorker) stopping() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
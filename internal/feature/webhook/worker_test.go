@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/outbound"
+)
+
+type mockDeliveryRepo struct {
+	mu     sync.Mutex
+	due    []DueDelivery
+	lease  time.Duration
+	saved  []Delivery
+	purged []time.Time
+}
+
+func (m *mockDeliveryRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	m.lease = lease
+	n := min(limit, len(m.due))
+	claimed := m.due[:n]
+	m.due = m.due[n:]
+	return claimed, nil
+}
+
+func (m *mockDeliveryRepo) SaveDeliveryAttempt(ctx context.Context, delivery Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saved = append(m.saved, delivery)
+	return nil
+}
+
+func (m *mockDeliveryRepo) DeleteFinishedDeliveries(ctx context.Context, before time.Time, limit int) (int64, error) {
+	m.purged = append(m.purged, before)
+	return 0, nil
+}
+
+func testPolicy() DeliveryPolicy {
+	return DeliveryPolicy{
+		BatchSize:           10,
+		Concurrency:         2,
+		Timeout:             time.Second,
+		MaxAttempts:         3,
+		RetryBackoff:        time.Minute,
+		AllowPrivateTargets: true, // httptest receivers listen on loopback
+	}
+}
+
+func TestDeliveryWorker_SendsSignedDeliveries(t *testing.T) {
+	const secret = "whsec_test"
+	payload := `{"id":"5f0c6a8e-2b7d-41c9-a3e1-f02b6d8c7e94","type":"link.created","data":{}}`
+
+	var received http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = r.Header
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "." + string(body)))
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) || string(body) != payload {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	repo := &mockDeliveryRepo{due: []DueDelivery{{
+		Delivery: Delivery{Id: 1, EventId: "5f0c6a8e-2b7d-41c9-a3e1-f02b6d8c7e94", EventType: EventLinkCreated, Payload: []byte(payload)},
+		URL:      receiver.URL,
+		Secret:   secret,
+	}}}
+	w := NewDeliveryWorker(repo, time.Second, testPolicy())
+
+	w.deliverDue()
+
+	if len(repo.saved) != 1 {
+		t.Fatalf("expected 1 saved attempt, got %d", len(repo.saved))
+	}
+	d := repo.saved[0]
+	if d.Status != DeliveryDelivered || d.Attempts != 1 || d.DeliveredAt == nil || *d.LastStatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected delivery %+v, last error %q", d, d.LastError)
+	}
+	if received.Get("X-Webhook-Event") != "link.created" || received.Get("X-Webhook-Id") != d.EventId {
+		t.Fatalf("unexpected headers %v", received)
+	}
+	if repo.lease != 6*time.Second {
+		t.Fatalf("lease = %s, want enough for 5 rounds of timeouts and one more", repo.lease)
+	}
+}
+
+func TestDeliveryWorker_RetriesFailedDeliveries(t *testing.T) {
+	var requests atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Redirect(w, r, "https://elsewhere.example.com", http.StatusFound)
+	}))
+	defer receiver.Close()
+
+	repo := &mockDeliveryRepo{due: []DueDelivery{
+		{Delivery: Delivery{Id: 1, Attempts: 0}, URL: receiver.URL},
+		{Delivery: Delivery{Id: 2, Attempts: 2}, URL: receiver.URL},
+	}}
+	w := NewDeliveryWorker(repo, time.Second, testPolicy())
+
+	before := time.Now().UTC()
+	w.deliverDue()
+
+	if requests.Load() != 2 || len(repo.saved) != 2 {
+		t.Fatalf("requests=%d saved=%d, want redirects not followed", requests.Load(), len(repo.saved))
+	}
+	for _, d := range repo.saved {
+		switch d.Id {
+		case 1:
+			if d.Status != DeliveryPending || d.Attempts != 1 || d.NextAttemptAt.Before(before.Add(time.Minute)) {
+				t.Fatalf("expected a retry in a minute, got %+v", d)
+			}
+			if d.LastError != "endpoint returned 302" {
+				t.Fatalf("last error = %q", d.LastError)
+			}
+		case 2:
+			if d.Status != DeliveryDead || d.Attempts != 3 {
+				t.Fatalf("expected the last attempt to dead-letter the delivery, got %+v", d)
+			}
+		}
+	}
+}
+
+func TestDeliveryWorker_RefusesPrivateTargets(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request to a loopback endpoint must not be sent")
+	}))
+	defer receiver.Close()
+
+	repo := &mockDeliveryRepo{due: []DueDelivery{{Delivery: Delivery{Id: 1}, URL: receiver.URL}}}
+	policy := testPolicy()
+	policy.AllowPrivateTargets = false
+	w := NewDeliveryWorker(repo, time.Second, policy)
+
+	w.deliverDue()
+
+	if len(repo.saved) != 1 || !strings.Contains(repo.saved[0].LastError, outbound.ErrPrivateTarget.Error()) || repo.saved[0].LastStatusCode != nil {
+		t.Fatalf("expected a failed attempt refused by the dialer, got %+v", repo.saved)
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		20: maxDeliveryBackoff,
+	}
+	for attempts, want := range tests {
+		if got := deliveryBackoff(30*time.Second, attempts); got != want {
+			t.Errorf("deliveryBackoff(30s, %d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestDeliveryWorker_purgeFinished(t *testing.T) {
+	repo := &mockDeliveryRepo{}
+	policy := testPolicy()
+	policy.Retention = 24 * time.Hour
+	w := NewDeliveryWorker(repo, time.Second, policy)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	w.purgeFinished(now)
+	w.purgeFinished(now.Add(time.Minute))
+
+	if len(repo.purged) != 1 || !repo.purged[0].Equal(now.Add(-24*time.Hour)) {
+		t.Fatalf("purged = %v, want one purge of deliveries older than a day", repo.purged)
+	}
+}
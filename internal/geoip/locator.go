@@ -0,0 +1,146 @@
+package geoip
+
+import (
+	"log"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Location is where an IP address is registered, as precise as the database allows.
+// Fields are empty when unknown.
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code, e.g. "DE"
+	Region  string // first-level subdivision (state, province), English name
+	City    string // English name
+}
+
+// Locator serves lookups from a GeoIP database file and reloads it when the file changes,
+// so databases updated in place (e.g. by geoipupdate) are picked up without a restart.
+// A nil Locator, or one whose file couldn't be loaded yet, returns zero Locations.
+type Locator struct {
+	path     string
+	interval time.Duration
+
+	reader  atomic.Pointer[Reader]
+	modTime time.Time
+	size    int64
+	missing bool
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewLocator loads the database at path. A missing or invalid file is logged, not fatal:
+// lookups return zero Locations until a valid file appears.
+func NewLocator(path string, reloadInterval time.Duration) *Locator {
+	l := &Locator{
+		path:     path,
+		interval: reloadInterval,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	l.reloadIfChanged()
+	return l
+}
+
+// Lookup locates an IP address given as text. Unparsable and unknown addresses give a zero Location.
+func (l *Locator) Lookup(ip string) Location {
+	if l == nil || ip == "" {
+		return Location{}
+	}
+	reader := l.reader.Load()
+	if reader == nil {
+		return Location{}
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}
+	}
+
+	location, err := reader.Lookup(addr)
+	if err != nil {
+		log.Printf("[geoip] lookup ip=%s failed: %v", ip, err)
+		return Location{}
+	}
+	return location
+}
+
+// Start polls the file for changes.
+func (l *Locator) Start() {
+	go l.run()
+}
+
+// Stop blocks until the reload loop exits.
+func (l *Locator) Stop() {
+	close(l.done)
+	<-l.stopped
+}
+
+func (l *Locator) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.reloadIfChanged()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// reloadIfChanged swaps in the file when its modification time or size changed since the last load.
+// A file that fails to load keeps the previous database in use.
+func (l *Locator) reloadIfChanged() {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		if !l.missing {
+			log.Printf("[geoip] database %s unavailable: %v", l.path, err)
+			l.missing = true
+		}
+		return
+	}
+	l.missing = false
+	if info.ModTime().Equal(l.modTime) && info.Size() == l.size {
+		return
+	}
+
+	reader, err := OpenReader(l.path)
+	l.modTime, l.size = info.ModTime(), info.Size()
+	if err != nil {
+		// Likely caught mid-write; retried once the file changes again.
+		log.Printf("[geoip] failed to load database %s: %v", l.path, err)
+		return
+	}
+
+	l.reader.Store(reader)
+	log.Printf("[geoip] loaded database %s type=%s", l.path, reader.DatabaseType())
+}
+
+// locationFromRecord reads the fields shared by GeoIP2/GeoLite2 City and DB-IP City records.
+func locationFromRecord(record map[string]any) Location {
+	var location Location
+	if country, ok := record["country"].(map[string]any); ok {
+		location.Country, _ = country["iso_code"].(string)
+	}
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		if region, ok := subdivisions[0].(map[string]any); ok {
+			location.Region = englishName(region)
+		}
+	}
+	if city, ok := record["city"].(map[string]any); ok {
+		location.City = englishName(city)
+	}
+	return location
+}
+
+func englishName(entity map[string]any) string {
+	names, _ := entity["names"].(map[string]any)
+	name, _ := names["en"].(string)
+	return name
+}
@@ -0,0 +1,382 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// Reader looks up IP addresses in a MaxMind DB file (.mmdb), the format of GeoLite2 / GeoIP2 City
+// and DB-IP City Lite databases. The whole file is read into memory and the reader is safe for
+// concurrent use.
+//
+// Format: https://maxmind.github.io/MaxMind-DB/
+type Reader struct {
+	buf       []byte
+	meta      metadata
+	nodeSize  int
+	treeSize  int
+	dataStart int
+	// ipv4Start is the node reached by the 96 zero bits of IPv4-mapped addresses in an IPv6 tree.
+	ipv4Start uint
+}
+
+type metadata struct {
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+}
+
+// dataSectionSeparator is the 16 zero bytes between the search tree and the data section.
+const dataSectionSeparator = 16
+
+// maxDecodeDepth bounds nesting (and pointer chains) so a corrupt file can't recurse forever.
+const maxDecodeDepth = 32
+
+var (
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+	errInvalidDatabase = errors.New("invalid MaxMind DB file")
+)
+
+// OpenReader reads and validates a .mmdb file.
+func OpenReader(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(buf)
+}
+
+func newReader(buf []byte) (*Reader, error) {
+	markerAt := bytes.LastIndex(buf, metadataMarker)
+	if markerAt < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errInvalidDatabase)
+	}
+
+	metaBuf := buf[markerAt+len(metadataMarker):]
+	raw, _, err := decoder{buf: metaBuf}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", errInvalidDatabase, err)
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errInvalidDatabase)
+	}
+
+	meta := metadata{
+		nodeCount:  uintField(fields, "node_count"),
+		recordSize: uintField(fields, "record_size"),
+		ipVersion:  uintField(fields, "ip_version"),
+	}
+	meta.databaseType, _ = fields["database_type"].(string)
+	if major := uintField(fields, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("%w: unsupported format version %d", errInvalidDatabase, major)
+	}
+	if meta.recordSize != 24 && meta.recordSize != 28 && meta.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalidDatabase, meta.recordSize)
+	}
+	if meta.ipVersion != 4 && meta.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", errInvalidDatabase, meta.ipVersion)
+	}
+
+	r := &Reader{
+		buf:      buf[:markerAt],
+		meta:     meta,
+		nodeSize: int(meta.recordSize) / 4,
+	}
+	r.treeSize = int(meta.nodeCount) * r.nodeSize
+	r.dataStart = r.treeSize + dataSectionSeparator
+	if r.dataStart > len(r.buf) {
+		return nil, fmt.Errorf("%w: search tree exceeds the file", errInvalidDatabase)
+	}
+
+	if meta.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// DatabaseType is the database_type from the file metadata, e.g. "GeoLite2-City".
+func (r *Reader) DatabaseType() string {
+	return r.meta.databaseType
+}
+
+// Lookup returns the location of the address. Addresses outside the database give a zero Location.
+func (r *Reader) Lookup(addr netip.Addr) (Location, error) {
+	raw, found, err := r.lookup(addr)
+	if err != nil || !found {
+		return Location{}, err
+	}
+	record, ok := raw.(map[string]any)
+	if !ok {
+		return Location{}, nil
+	}
+	return locationFromRecord(record), nil
+}
+
+func (r *Reader) lookup(addr netip.Addr) (any, bool, error) {
+	addr = addr.Unmap()
+
+	var bits []byte
+	node := uint(0)
+	switch {
+	case addr.Is4():
+		a := addr.As4()
+		bits = a[:]
+		if r.meta.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	case r.meta.ipVersion == 6:
+		a := addr.As16()
+		bits = a[:]
+	default:
+		// IPv6 address in an IPv4-only database.
+		return nil, false, nil
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.meta.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	switch {
+	case node == r.meta.nodeCount:
+		return nil, false, nil
+	case node < r.meta.nodeCount:
+		return nil, false, fmt.Errorf("%w: search tree is deeper than the address", errInvalidDatabase)
+	}
+
+	offset := int(node-r.meta.nodeCount) - dataSectionSeparator
+	value, _, err := decoder{buf: r.buf[r.dataStart:]}.decode(offset, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a search tree node.
+// Callers keep node below nodeCount, which newReader checked to fit in the file.
+func (r *Reader) record(node, bit uint) uint {
+	b := r.buf[int(node)*r.nodeSize:]
+	switch r.meta.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Data section field types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder decodes values of the data section (or of the metadata, which uses the same encoding)
+// into maps, slices, strings and numbers.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset right after it. Pointers are followed,
+// but the returned offset is the one after the pointer itself.
+func (d decoder) decode(offset, depth int) (any, int, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("%w: data nested too deep", errInvalidDatabase)
+	}
+
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for range size {
+			var key, value any
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errInvalidDatabase)
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for range size {
+			var value any
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.buf) {
+		return nil, 0, fmt.Errorf("%w: value exceeds the data section", errInvalidDatabase)
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of size %d", errInvalidDatabase, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of size %d", errInvalidDatabase, size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: unsigned integer of size %d", errInvalidDatabase, size)
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: int32 of size %d", errInvalidDatabase, size)
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	case typeUint128:
+		// Not used by location databases; kept as raw big-endian bytes.
+		return bytes.Clone(b), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unexpected field type %d", errInvalidDatabase, typ)
+	}
+}
+
+// control parses a field's control byte(s) and returns its type, its size (for pointers:
+// the raw size bits) and the offset of its payload.
+func (d decoder) control(offset int) (typ, size, next int, err error) {
+	if offset < 0 || offset >= len(d.buf) {
+		return 0, 0, 0, fmt.Errorf("%w: offset %d outside the data section", errInvalidDatabase, offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ = int(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= len(d.buf) {
+			return 0, 0, 0, fmt.Errorf("%w: truncated field", errInvalidDatabase)
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+		if typ <= typeMap {
+			return 0, 0, 0, fmt.Errorf("%w: invalid extended type %d", errInvalidDatabase, typ)
+		}
+	}
+
+	size = int(ctrl & 0x1F)
+	if typ == typePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > len(d.buf) {
+		return 0, 0, 0, fmt.Errorf("%w: truncated field size", errInvalidDatabase)
+	}
+	n := 0
+	for _, c := range d.buf[offset : offset+extra] {
+		n = n<<8 | int(c)
+	}
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return typ, size, offset + extra, nil
+}
+
+// pointer resolves a pointer field from its size bits (SSVVV of the control byte) and payload.
+func (d decoder) pointer(sizeBits, offset int) (target, next int, err error) {
+	length := sizeBits>>3 + 1
+	if offset+length > len(d.buf) {
+		return 0, 0, fmt.Errorf("%w: truncated pointer", errInvalidDatabase)
+	}
+
+	v := 0
+	if length < 4 {
+		v = sizeBits & 0x7
+	}
+	for _, c := range d.buf[offset : offset+length] {
+		v = v<<8 | int(c)
+	}
+	switch length {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + length, nil
+}
+
+func uintField(fields map[string]any, key string) uint {
+	v, _ := fields[key].(uint64)
+	return uint(v)
+}
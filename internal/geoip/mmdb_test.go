@@ -0,0 +1,325 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testDB builds small .mmdb files: a search tree over the inserted networks and a data section
+// with one record per network.
+type testDB struct {
+	ipVersion  int
+	recordSize int
+	nodes      [][2]testRecord
+	data       bytes.Buffer
+}
+
+type testRecord struct {
+	kind  int // 0 empty, 1 node, 2 data
+	value int
+}
+
+func newTestDB(ipVersion, recordSize int) *testDB {
+	return &testDB{ipVersion: ipVersion, recordSize: recordSize, nodes: make([][2]testRecord, 1)}
+}
+
+// insert maps the network to the data encoded at dataOffset.
+func (db *testDB) insert(t *testing.T, network string, dataOffset int) {
+	t.Helper()
+
+	prefix := netip.MustParsePrefix(network)
+	var bits []byte
+	depth := prefix.Bits()
+	switch {
+	case db.ipVersion == 6 && prefix.Addr().Is4():
+		// IPv4 networks live under ::/96 of IPv6 trees.
+		a := prefix.Addr().As4()
+		bits = append(make([]byte, 12), a[:]...)
+		depth += 96
+	case db.ipVersion == 6:
+		a := prefix.Addr().As16()
+		bits = a[:]
+	default:
+		a := prefix.Addr().As4()
+		bits = a[:]
+	}
+
+	node := 0
+	for i := 0; i < depth; i++ {
+		bit := int(bits[i/8]>>(7-i%8)) & 1
+		if i == depth-1 {
+			db.nodes[node][bit] = testRecord{kind: 2, value: dataOffset}
+			return
+		}
+		next := db.nodes[node][bit]
+		if next.kind != 1 {
+			db.nodes = append(db.nodes, [2]testRecord{})
+			next = testRecord{kind: 1, value: len(db.nodes) - 1}
+			db.nodes[node][bit] = next
+		}
+		node = next.value
+	}
+}
+
+// add encodes a record and returns its data section offset.
+func (db *testDB) add(value any) int {
+	offset := db.data.Len()
+	encodeValue(&db.data, value)
+	return offset
+}
+
+func (db *testDB) bytes() []byte {
+	var out bytes.Buffer
+	nodeCount := len(db.nodes)
+	resolve := func(r testRecord) uint32 {
+		switch r.kind {
+		case 1:
+			return uint32(r.value)
+		case 2:
+			return uint32(nodeCount + dataSectionSeparator + r.value)
+		default:
+			return uint32(nodeCount)
+		}
+	}
+
+	for _, node := range db.nodes {
+		left, right := resolve(node[0]), resolve(node[1])
+		switch db.recordSize {
+		case 24:
+			out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			out.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left),
+				byte(left>>20)&0xF0 | byte(right>>24)&0x0F,
+				byte(right >> 16), byte(right >> 8), byte(right)})
+		default:
+			out.Write(binary.BigEndian.AppendUint32(nil, left))
+			out.Write(binary.BigEndian.AppendUint32(nil, right))
+		}
+	}
+	out.Write(make([]byte, dataSectionSeparator))
+	out.Write(db.data.Bytes())
+
+	out.Write(metadataMarker)
+	encodeValue(&out, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(db.recordSize),
+		"ip_version":                  uint16(db.ipVersion),
+		"database_type":               "Test-City",
+		"languages":                   []any{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+	})
+	return out.Bytes()
+}
+
+// testPointer encodes a pointer to a data section offset.
+type testPointer int
+
+func encodeValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case string:
+		writeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		b := trimLeadingZeros(binary.BigEndian.AppendUint16(nil, v))
+		writeControl(buf, typeUint16, len(b))
+		buf.Write(b)
+	case uint32:
+		b := trimLeadingZeros(binary.BigEndian.AppendUint32(nil, v))
+		writeControl(buf, typeUint32, len(b))
+		buf.Write(b)
+	case uint64:
+		b := trimLeadingZeros(binary.BigEndian.AppendUint64(nil, v))
+		writeControl(buf, typeUint64, len(b))
+		buf.Write(b)
+	case []any:
+		writeControl(buf, typeArray, len(v))
+		for _, item := range v {
+			encodeValue(buf, item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeControl(buf, typeMap, len(v))
+		for _, k := range keys {
+			encodeValue(buf, k)
+			encodeValue(buf, v[k])
+		}
+	case testPointer:
+		// 11-bit pointer form (SS=0): test data sections are small.
+		buf.Write([]byte{byte(typePointer<<5 | (int(v)>>8)&0x7), byte(v)})
+	default:
+		panic("unsupported test value")
+	}
+}
+
+func writeControl(buf *bytes.Buffer, typ, size int) {
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		sizeBytes = []byte{byte(size - 29)}
+		size = 29
+	default:
+		n := size - 285
+		sizeBytes = []byte{byte(n >> 8), byte(n)}
+		size = 30
+	}
+
+	if typ <= typeMap {
+		buf.WriteByte(byte(typ<<5 | size))
+	} else {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(sizeBytes)
+}
+
+func trimLeadingZeros(b []byte) []byte {
+	return bytes.TrimLeft(b, "\x00")
+}
+
+func cityRecord(country, region, city string) map[string]any {
+	return map[string]any{
+		"city":    map[string]any{"names": map[string]any{"en": city, "de": city + "-de"}},
+		"country": map[string]any{"iso_code": country, "geoname_id": uint32(2921044)},
+		"subdivisions": []any{
+			map[string]any{"iso_code": "BE", "names": map[string]any{"en": region}},
+		},
+	}
+}
+
+func TestReader_Lookup(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			db := newTestDB(ipVersion, recordSize)
+			berlin := db.add(cityRecord("DE", "Land Berlin", "Berlin"))
+			db.insert(t, "1.2.3.0/24", berlin)
+			// Records usually share their parts through pointers.
+			names := db.add(map[string]any{"en": "Paris"})
+			paris := db.add(map[string]any{
+				"city":    map[string]any{"names": testPointer(names)},
+				"country": map[string]any{"iso_code": "FR"},
+			})
+			db.insert(t, "5.6.0.0/16", paris)
+			if ipVersion == 6 {
+				db.insert(t, "2001:db8::/32", berlin)
+			}
+
+			r, err := newReader(db.bytes())
+			if err != nil {
+				t.Fatalf("ipv%d/%d: newReader: %v", ipVersion, recordSize, err)
+			}
+
+			tests := []struct {
+				ip   string
+				want Location
+			}{
+				{"1.2.3.4", Location{Country: "DE", Region: "Land Berlin", City: "Berlin"}},
+				{"::ffff:1.2.3.200", Location{Country: "DE", Region: "Land Berlin", City: "Berlin"}},
+				{"5.6.7.8", Location{Country: "FR", City: "Paris"}},
+				{"1.2.4.1", Location{}},
+				{"9.9.9.9", Location{}},
+			}
+			if ipVersion == 6 {
+				tests = append(tests, struct {
+					ip   string
+					want Location
+				}{"2001:db8::1", Location{Country: "DE", Region: "Land Berlin", City: "Berlin"}})
+			} else {
+				tests = append(tests, struct {
+					ip   string
+					want Location
+				}{"2001:db8::1", Location{}})
+			}
+
+			for _, tt := range tests {
+				got, err := r.Lookup(netip.MustParseAddr(tt.ip))
+				if err != nil {
+					t.Fatalf("ipv%d/%d: Lookup(%s): %v", ipVersion, recordSize, tt.ip, err)
+				}
+				if got != tt.want {
+					t.Errorf("ipv%d/%d: Lookup(%s) = %+v, want %+v", ipVersion, recordSize, tt.ip, got, tt.want)
+				}
+			}
+		}
+	}
+}
+
+func TestNewReader_RejectsInvalidFile(t *testing.T) {
+	if _, err := newReader([]byte("not a database")); err == nil {
+		t.Fatal("expected error for a file without metadata")
+	}
+
+	db := newTestDB(6, 24)
+	db.insert(t, "1.2.3.0/24", db.add(cityRecord("DE", "Land Berlin", "Berlin")))
+	full := db.bytes()
+	// Drop most of the search tree, keeping the metadata.
+	markerAt := bytes.LastIndex(full, metadataMarker)
+	truncated := append([]byte{}, full[:10]...)
+	truncated = append(truncated, full[markerAt:]...)
+	if _, err := newReader(truncated); err == nil {
+		t.Fatal("expected error for a truncated search tree")
+	}
+}
+
+func TestLocator_ReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+
+	// Unconfigured and missing databases locate nothing.
+	var unconfigured *Locator
+	if got := unconfigured.Lookup("1.2.3.4"); got != (Location{}) {
+		t.Fatalf("nil locator: got %+v", got)
+	}
+	l := NewLocator(path, time.Hour)
+	if got := l.Lookup("1.2.3.4"); got != (Location{}) {
+		t.Fatalf("missing file: got %+v", got)
+	}
+
+	write := func(country string, modTime time.Time) {
+		db := newTestDB(6, 28)
+		db.insert(t, "1.2.3.0/24", db.add(cityRecord(country, "", "")))
+		if err := os.WriteFile(path, db.bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	write("DE", now)
+	l.reloadIfChanged()
+	if got := l.Lookup("1.2.3.4").Country; got != "DE" {
+		t.Fatalf("after load: country %q, want DE", got)
+	}
+
+	// A broken file keeps the loaded database.
+	if err := os.WriteFile(path, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l.reloadIfChanged()
+	if got := l.Lookup("1.2.3.4").Country; got != "DE" {
+		t.Fatalf("after broken write: country %q, want DE", got)
+	}
+
+	write("FR", now.Add(time.Minute))
+	l.reloadIfChanged()
+	if got := l.Lookup("1.2.3.4").Country; got != "FR" {
+		t.Fatalf("after reload: country %q, want FR", got)
+	}
+
+	if got := l.Lookup("not an ip"); got != (Location{}) {
+		t.Fatalf("unparsable ip: got %+v", got)
+	}
+}
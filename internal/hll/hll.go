@@ -0,0 +1,147 @@
+// Package hll implements HyperLogLog sketches: fixed-size distinct counters that can be merged,
+// so unique visitors of hours can be combined into the unique visitors of any range of hours.
+package hll
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits selecting a register. 2^12 registers give a standard
+	// error of about 1.6% in at most 4 KiB.
+	Precision = 12
+	// MaxRank is the largest register value: the position of the first set bit of the remaining
+	// 64-Precision hash bits, or one past them when all are zero.
+	MaxRank = 64 - Precision + 1
+
+	registers = 1 << Precision
+)
+
+const (
+	formatSparse byte = 1 // (index uint16, rank uint8) of every non-empty register
+	formatDense  byte = 2 // all registers
+)
+
+var errInvalidSketch = errors.New("hll: invalid sketch encoding")
+
+// Sketch estimates the number of distinct values added to it. The zero value is an empty sketch.
+type Sketch struct {
+	registers [registers]uint8
+}
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add adds a value. The hash is the first 64 bits of the value's MD5, big-endian, so registers
+// can equally be computed in SQL (see the postgres click rollups).
+func (s *Sketch) Add(value string) {
+	sum := md5.Sum([]byte(value))
+	h := binary.BigEndian.Uint64(sum[:8])
+
+	rank := bits.LeadingZeros64(h<<Precision) + 1
+	s.Observe(int(h>>(64-Precision)), uint8(min(rank, MaxRank)))
+}
+
+// Observe raises register idx to rank. Out of range registers and ranks are ignored.
+func (s *Sketch) Observe(idx int, rank uint8) {
+	if idx < 0 || idx >= registers || rank > MaxRank {
+		return
+	}
+	s.registers[idx] = max(s.registers[idx], rank)
+}
+
+// Merge adds the values of other to s.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.registers {
+		s.registers[i] = max(s.registers[i], r)
+	}
+}
+
+// Estimate returns the approximate number of distinct values added.
+func (s *Sketch) Estimate() int64 {
+	const m = float64(registers)
+
+	sum, zeros := 0.0, 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Small cardinalities are counted by the share of empty registers, which is exact-ish
+	// where the raw estimate is biased.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch, sparsely while few registers are set.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	set := 0
+	for _, r := range s.registers {
+		if r != 0 {
+			set++
+		}
+	}
+
+	if 3*set >= registers {
+		return append([]byte{formatDense}, s.registers[:]...), nil
+	}
+
+	buf := make([]byte, 1, 1+3*set)
+	buf[0] = formatSparse
+	for i, r := range s.registers {
+		if r != 0 {
+			buf = binary.BigEndian.AppendUint16(buf, uint16(i))
+			buf = append(buf, r)
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary replaces the sketch with an encoded one.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errInvalidSketch
+	}
+
+	var decoded Sketch
+	switch data[0] {
+	case formatDense:
+		if len(data) != 1+registers {
+			return errInvalidSketch
+		}
+		copy(decoded.registers[:], data[1:])
+	case formatSparse:
+		if (len(data)-1)%3 != 0 {
+			return errInvalidSketch
+		}
+		for p := data[1:]; len(p) > 0; p = p[3:] {
+			idx := int(binary.BigEndian.Uint16(p))
+			if idx >= registers {
+				return errInvalidSketch
+			}
+			decoded.registers[idx] = p[2]
+		}
+	default:
+		return errInvalidSketch
+	}
+
+	for _, r := range decoded.registers {
+		if r > MaxRank {
+			return errInvalidSketch
+		}
+	}
+	*s = decoded
+	return nil
+}
@@ -0,0 +1,80 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSketch_Estimate(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1_000, 10_000, 200_000} {
+		s := New()
+		for i := range n {
+			ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+			s.Add(ip)
+			s.Add(ip) // duplicates don't count
+		}
+
+		got := s.Estimate()
+		if tolerance := math.Max(1, 0.05*float64(n)); math.Abs(float64(got-int64(n))) > tolerance {
+			t.Errorf("n=%d: estimate = %d", n, got)
+		}
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b := New(), New()
+	for i := range 6_000 {
+		a.Add(fmt.Sprint("a", i))
+		b.Add(fmt.Sprint("b", i))
+		if i < 3_000 {
+			b.Add(fmt.Sprint("a", i)) // overlap
+		}
+	}
+
+	a.Merge(b)
+	if got := a.Estimate(); math.Abs(float64(got-12_000)) > 0.05*12_000 {
+		t.Fatalf("merged estimate = %d, want about 12000", got)
+	}
+}
+
+func TestSketch_MarshalRoundTrip(t *testing.T) {
+	for n, format := range map[int]byte{0: formatSparse, 50: formatSparse, 50_000: formatDense} {
+		s := New()
+		for i := range n {
+			s.Add(fmt.Sprint(i))
+		}
+
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatalf("n=%d: marshal: %v", n, err)
+		}
+		if data[0] != format {
+			t.Fatalf("n=%d: format = %d, want %d", n, data[0], format)
+		}
+
+		var decoded Sketch
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("n=%d: unmarshal: %v", n, err)
+		}
+		if decoded != *s {
+			t.Fatalf("n=%d: round trip changed the sketch", n)
+		}
+	}
+}
+
+func TestSketch_UnmarshalRejectsInvalidData(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":          nil,
+		"unknown format": {9},
+		"short dense":    {formatDense, 1, 2},
+		"partial pair":   {formatSparse, 0, 1},
+		"index too big":  {formatSparse, 0xff, 0xff, 1},
+		"rank too big":   {formatSparse, 0, 1, MaxRank + 1},
+	} {
+		var s Sketch
+		if err := s.UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
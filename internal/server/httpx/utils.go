@@ -76,3 +76,22 @@ func normalizeIP(ip net.IP) string {
 	// Otherwise keep IPv6 string
 	return ip.String()
 }
+
+// IsUUID reports whether id is a UUID in its canonical text form, as public ids are stored.
+// Path parameters are checked with it before they reach a UUID column.
+func IsUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, c := range id {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'):
+			return false
+		}
+	}
+	return true
+}
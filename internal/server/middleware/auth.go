@@ -13,16 +13,26 @@ import (
 	"github.com/viacheslaev/url-shortener/internal/server/httpx"
 )
 
+// apiKeyHeader carries the API key of server-to-server calls.
+const apiKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator resolves API keys to their accounts (see auth.APIKeyService).
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (string, error)
+}
+
 type AuthMiddleware struct {
 	accountRepo AccountRepository
+	apiKeys     APIKeyAuthenticator
 	jwtSecret   string
 	issuer      string
 	audience    string
 }
 
-func NewAuthMiddleware(accountRepo AccountRepository, cfg *config.Config) *AuthMiddleware {
+func NewAuthMiddleware(accountRepo AccountRepository, apiKeys APIKeyAuthenticator, cfg *config.Config) *AuthMiddleware {
 	return &AuthMiddleware{
 		accountRepo: accountRepo,
+		apiKeys:     apiKeys,
 		jwtSecret:   cfg.JWTSecret,
 		issuer:      cfg.ServiceName,
 		audience:    cfg.ServiceName + "-" + "api",
@@ -54,6 +64,35 @@ func (m *AuthMiddleware) Authorize(next http.Handler) http.Handler {
 	})
 }
 
+// AuthorizeAPIKey authenticates server-to-server calls by the API key of an account.
+func (m *AuthMiddleware) AuthorizeAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+		if key == "" {
+			httpx.WriteErr(w, http.StatusUnauthorized, "missing "+apiKeyHeader+" header")
+			return
+		}
+
+		publicID, err := m.apiKeys.AuthenticateAPIKey(r.Context(), key)
+		if errors.Is(err, auth.ErrUnauthorized) {
+			httpx.WriteErr(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		if err != nil {
+			log.Printf("api key authentication failed: %v", err)
+			httpx.WriteErr(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		if !m.authorizeAccount(w, r.Context(), publicID) {
+			return
+		}
+
+		ctx := auth.WithAccountPublicID(r.Context(), publicID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // authorizeAccount checks if account exists and is active
 func (m *AuthMiddleware) authorizeAccount(w http.ResponseWriter, ctx context.Context, publicID string) bool {
 	accStatus, err := m.accountRepo.FindAccountStatusByPublicID(ctx, publicID)
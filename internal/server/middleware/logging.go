@@ -26,3 +26,15 @@ func (lw *logWriter) WriteHeader(status int) {
 	lw.status = status
 	lw.ResponseWriter.WriteHeader(status)
 }
+
+// Flush passes flushes through, e.g. for streamed responses and Server-Sent Events.
+func (lw *logWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (lw *logWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/viacheslaev/url-shortener/internal/feature/account"
 	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
 	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+	"github.com/viacheslaev/url-shortener/internal/feature/conversion"
 	"github.com/viacheslaev/url-shortener/internal/feature/link"
+	"github.com/viacheslaev/url-shortener/internal/feature/webhook"
 	"github.com/viacheslaev/url-shortener/internal/server/middleware"
 )
 
@@ -15,6 +18,9 @@ func NewRouter(
 	accRegisterHandler *account.RegisterHandler,
 	authHandler *auth.AuthHandler,
 	analyticsHandler *analytics.AnalyticsHandler,
+	webhookHandler *webhook.WebhookHandler,
+	apiKeyHandler *auth.APIKeyHandler,
+	conversionHandler *conversion.ConversionHandler,
 	authMiddleware *middleware.AuthMiddleware,
 ) http.Handler {
 	mux := http.NewServeMux()
@@ -26,12 +32,45 @@ func NewRouter(
 	mux.HandleFunc("POST /api/v1/auth/register", accRegisterHandler.RegisterAccount)
 	mux.HandleFunc("POST /api/v1/auth/login", authHandler.Login)
 
+	// Link expansion without click tracking (public)
+	mux.HandleFunc("GET /api/v1/resolve/{code}", linkHandler.ExpandShortLink)
+
 	// Protected
 	mux.Handle("POST /api/v1/urls", authMiddleware.Authorize(http.HandlerFunc(linkHandler.CreateShortLink)))
+	mux.Handle("PUT /api/v1/account/expiry-behavior", authMiddleware.Authorize(http.HandlerFunc(linkHandler.UpdateAccountExpiryBehavior)))
+	mux.Handle("GET /api/v1/links/broken", authMiddleware.Authorize(http.HandlerFunc(linkHandler.GetBrokenLinks)))
+	mux.Handle("PATCH /api/v1/links/{code}", authMiddleware.Authorize(http.HandlerFunc(linkHandler.UpdateLink)))
+	mux.Handle("DELETE /api/v1/links/{code}", authMiddleware.Authorize(http.HandlerFunc(linkHandler.DeleteLink)))
+	mux.Handle("POST /api/v1/links/{code}/disable", authMiddleware.Authorize(http.HandlerFunc(linkHandler.DisableLink)))
+	mux.Handle("GET /api/v1/links/{code}/history", authMiddleware.Authorize(http.HandlerFunc(linkHandler.GetLinkHistory)))
 	mux.Handle("GET /api/v1/links/{code}/stats", authMiddleware.Authorize(http.HandlerFunc(analyticsHandler.GetStats)))
+	mux.Handle("GET /api/v1/analytics/overview", authMiddleware.Authorize(http.HandlerFunc(analyticsHandler.GetOverview)))
+	mux.Handle("GET /api/v1/links/{code}/clicks/export", authMiddleware.Authorize(http.HandlerFunc(analyticsHandler.ExportLinkClicks)))
+	mux.Handle("GET /api/v1/links/{code}/clicks/stream", authMiddleware.Authorize(http.HandlerFunc(analyticsHandler.StreamLinkClicks)))
+	mux.Handle("GET /api/v1/analytics/clicks/export", authMiddleware.Authorize(http.HandlerFunc(analyticsHandler.ExportAccountClicks)))
+	mux.Handle("POST /api/v1/webhooks", authMiddleware.Authorize(http.HandlerFunc(webhookHandler.CreateWebhook)))
+	mux.Handle("GET /api/v1/webhooks", authMiddleware.Authorize(http.HandlerFunc(webhookHandler.GetWebhooks)))
+	mux.Handle("DELETE /api/v1/webhooks/{id}", authMiddleware.Authorize(http.HandlerFunc(webhookHandler.DeleteWebhook)))
+	mux.Handle("GET /api/v1/webhooks/{id}/deliveries", authMiddleware.Authorize(http.HandlerFunc(webhookHandler.GetDeliveries)))
+	mux.Handle("POST /api/v1/webhooks/{id}/deliveries/{delivery}/retry", authMiddleware.Authorize(http.HandlerFunc(webhookHandler.RetryDelivery)))
+	mux.Handle("POST /api/v1/account/api-keys", authMiddleware.Authorize(http.HandlerFunc(apiKeyHandler.CreateAPIKey)))
+	mux.Handle("GET /api/v1/account/api-keys", authMiddleware.Authorize(http.HandlerFunc(apiKeyHandler.GetAPIKeys)))
+	mux.Handle("DELETE /api/v1/account/api-keys/{id}", authMiddleware.Authorize(http.HandlerFunc(apiKeyHandler.DeleteAPIKey)))
+
+	// Server-to-server postbacks (account API key)
+	mux.Handle("POST /api/v1/conversions", authMiddleware.AuthorizeAPIKey(http.HandlerFunc(conversionHandler.CreateConversion)))
 
-	// Public redirect
+	// Public redirect. GET patterns also match HEAD, which the handler serves without tracking.
 	mux.HandleFunc("GET /{code}", linkHandler.ResolveShortLink)
+	mux.HandleFunc("OPTIONS /{code}", linkHandler.ShortLinkOptions)
+
+	return mux
+}
 
+// NewDebugRouter serves runtime counters (expvar): link cache, failover, click queue, ...
+// It is meant for a separate internal listener and is not exposed on the public router.
+func NewDebugRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /debug/vars", expvar.Handler())
 	return mux
 }
@@ -0,0 +1,338 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+// ErrCircuitOpen is returned when the database is skipped and no stale copy of the link is known.
+var ErrCircuitOpen = errors.New("link storage unavailable: circuit open")
+
+// FailoverConfig configures FailoverLinkRepository.
+type FailoverConfig struct {
+	FailureThreshold int           // consecutive failures that trip the breaker
+	OpenTimeout      time.Duration // how long the breaker stays open before a trial request
+	StaleSize        int           // max number of last known destinations kept in memory
+	SnapshotPath     string        // optional file the last known destinations are persisted to
+	SnapshotInterval time.Duration
+}
+
+// FailoverStats are counters of degraded-mode operation.
+type FailoverStats struct {
+	State          string `json:"state"`
+	DegradedServes int64  `json:"degraded_serves"`
+	DegradedMisses int64  `json:"degraded_misses"`
+	BreakerTrips   int64  `json:"breaker_trips"`
+	StaleSize      int    `json:"stale_size"`
+}
+
+// FailoverLinkRepository keeps redirects working while Postgres is unavailable.
+// A circuit breaker around GetLongLink stops hammering a failing database, and while it is open
+// (or a lookup fails) the last known destination is served from memory or from the on-disk snapshot.
+type FailoverLinkRepository struct {
+	link.LinkRepository
+
+	breaker          *circuitBreaker
+	stale            *staleLinks
+	snapshotPath     string
+	snapshotInterval time.Duration
+
+	degradedServes, degradedMisses, breakerTrips atomic.Int64
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewFailoverLinkRepository wraps repo and loads the snapshot when one is configured.
+func NewFailoverLinkRepository(repo link.LinkRepository, cfg FailoverConfig) *FailoverLinkRepository {
+	r := &FailoverLinkRepository{
+		LinkRepository:   repo,
+		breaker:          newCircuitBreaker(cfg.FailureThreshold, cfg.OpenTimeout),
+		stale:            newStaleLinks(cfg.StaleSize),
+		snapshotPath:     cfg.SnapshotPath,
+		snapshotInterval: cfg.SnapshotInterval,
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+
+	if r.snapshotPath != "" {
+		loaded, err := r.stale.load(r.snapshotPath)
+		if err != nil {
+			log.Printf("[failover] failed to load link snapshot %s: %v", r.snapshotPath, err)
+		} else if loaded > 0 {
+			log.Printf("[failover] loaded link snapshot %s links=%d", r.snapshotPath, loaded)
+		}
+	}
+
+	return r
+}
+
+// GetLongLink reads through the breaker and falls back to the last known destination.
+func (r *FailoverLinkRepository) GetLongLink(ctx context.Context, code string) (link.LongLink, error) {
+	if !r.breaker.allow() {
+		return r.serveStale(code, ErrCircuitOpen)
+	}
+
+	longLink, err := r.LinkRepository.GetLongLink(ctx, code)
+	switch {
+	case err == nil:
+		r.recordSuccess()
+		r.stale.put(code, longLink)
+		return longLink, nil
+
+	case errors.Is(err, link.ErrNotFound):
+		r.recordSuccess()
+		r.stale.remove(code)
+		return link.LongLink{}, err
+
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		// The visitor went away; that says nothing about database health.
+		// A deadline is not treated this way: a hung database shows up as DeadlineExceeded.
+		r.breaker.abort()
+		return link.LongLink{}, err
+
+	default:
+		if r.breaker.failure() {
+			r.breakerTrips.Add(1)
+			log.Printf("[failover] circuit opened after lookup failure: %v", err)
+		}
+		return r.serveStale(code, err)
+	}
+}
+
+func (r *FailoverLinkRepository) UpdateLink(ctx context.Context, code string, accountPublicId string, update link.LinkUpdate) (link.LinkState, error) {
+	state, err := r.LinkRepository.UpdateLink(ctx, code, accountPublicId, update)
+	r.stale.remove(code)
+	return state, err
+}
+
+func (r *FailoverLinkRepository) DisableLink(ctx context.Context, code string, accountPublicId string) error {
+	err := r.LinkRepository.DisableLink(ctx, code, accountPublicId)
+	r.stale.remove(code)
+	return err
+}
+
+func (r *FailoverLinkRepository) DeleteLink(ctx context.Context, code string, accountPublicId string) error {
+	err := r.LinkRepository.DeleteLink(ctx, code, accountPublicId)
+	r.stale.remove(code)
+	return err
+}
+
+// Invalidate evicts the last known destinations of links changed on other instances.
+func (r *FailoverLinkRepository) Invalidate(codes ...string) {
+	for _, code := range codes {
+		r.stale.remove(code)
+	}
+}
+
+// Flush evicts all last known destinations.
+func (r *FailoverLinkRepository) Flush() {
+	r.stale.clear()
+}
+
+// Stats returns a snapshot of the failover counters.
+func (r *FailoverLinkRepository) Stats() FailoverStats {
+	return FailoverStats{
+		State:          r.breaker.currentState().String(),
+		DegradedServes: r.degradedServes.Load(),
+		DegradedMisses: r.degradedMisses.Load(),
+		BreakerTrips:   r.breakerTrips.Load(),
+		StaleSize:      r.stale.len(),
+	}
+}
+
+// Start runs the periodic snapshot writer when a snapshot path is configured.
+func (r *FailoverLinkRepository) Start() {
+	if r.snapshotPath == "" {
+		close(r.stopped)
+		return
+	}
+	go r.run()
+}
+
+// Stop writes a final snapshot and blocks until the snapshot loop exits.
+func (r *FailoverLinkRepository) Stop() {
+	close(r.done)
+	<-r.stopped
+}
+
+func (r *FailoverLinkRepository) run() {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(r.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.writeSnapshot()
+		case <-r.done:
+			r.writeSnapshot()
+			return
+		}
+	}
+}
+
+func (r *FailoverLinkRepository) writeSnapshot() {
+	if err := r.stale.save(r.snapshotPath); err != nil {
+		log.Printf("[failover] failed to write link snapshot %s: %v", r.snapshotPath, err)
+	}
+}
+
+func (r *FailoverLinkRepository) recordSuccess() {
+	if r.breaker.success() {
+		log.Printf("[failover] circuit closed, link storage recovered")
+	}
+}
+
+func (r *FailoverLinkRepository) serveStale(code string, cause error) (link.LongLink, error) {
+	longLink, ok := r.stale.get(code)
+	if !ok {
+		r.degradedMisses.Add(1)
+		return link.LongLink{}, fmt.Errorf("no stale copy of code=%s: %w", code, cause)
+	}
+
+	r.degradedServes.Add(1)
+	log.Printf("[failover] serving stale destination code=%s cause=%v", code, cause)
+	return longLink, nil
+}
+
+// staleLinks is a bounded LRU of last known destinations. Entries don't expire:
+// they are only used when the database can't be asked.
+type staleLinks struct {
+	size int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type staleEntry struct {
+	Code string        `json:"code"`
+	Link link.LongLink `json:"link"`
+}
+
+func newStaleLinks(size int) *staleLinks {
+	return &staleLinks{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (s *staleLinks) get(code string) (link.LongLink, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[code]
+	if !ok {
+		return link.LongLink{}, false
+	}
+	s.ll.MoveToFront(el)
+	return el.Value.(*staleEntry).Link, true
+}
+
+func (s *staleLinks) put(code string, longLink link.LongLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[code]; ok {
+		el.Value.(*staleEntry).Link = longLink
+		s.ll.MoveToFront(el)
+		return
+	}
+
+	s.items[code] = s.ll.PushFront(&staleEntry{Code: code, Link: longLink})
+	for s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*staleEntry).Code)
+	}
+}
+
+func (s *staleLinks) remove(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[code]; ok {
+		s.ll.Remove(el)
+		delete(s.items, code)
+	}
+}
+
+func (s *staleLinks) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ll.Init()
+	clear(s.items)
+}
+
+func (s *staleLinks) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+// save writes entries, most recently used first, to a temp file and renames it over path.
+func (s *staleLinks) save(path string) error {
+	s.mu.Lock()
+	entries := make([]staleEntry, 0, s.ll.Len())
+	for el := s.ll.Front(); el != nil; el = el.Next() {
+		entries = append(entries, *el.Value.(*staleEntry))
+	}
+	s.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// load reads a snapshot written by save. A missing file is not an error.
+func (s *staleLinks) load(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []staleEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+
+	// Insert least recently used first to keep the saved order.
+	for i := len(entries) - 1; i >= 0; i-- {
+		s.put(entries[i].Code, entries[i].Link)
+	}
+	return min(len(entries), s.size), nil
+}
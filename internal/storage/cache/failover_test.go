@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+func testFailover(repo link.LinkRepository, snapshotPath string) *FailoverLinkRepository {
+	return NewFailoverLinkRepository(repo, FailoverConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		StaleSize:        10,
+		SnapshotPath:     snapshotPath,
+		SnapshotInterval: time.Minute,
+	})
+}
+
+func TestFailoverLinkRepository_ServesStaleOnFailure(t *testing.T) {
+	dbDown := false
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		if dbDown {
+			return link.LongLink{}, errors.New("connection refused")
+		}
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	r := testFailover(repo, "")
+
+	if _, err := r.GetLongLink(context.Background(), "abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dbDown = true
+	got, err := r.GetLongLink(context.Background(), "abc")
+	if err != nil || got.LongURL != "https://example.com" {
+		t.Fatalf("expected stale destination, got %+v err=%v", got, err)
+	}
+
+	if _, err := r.GetLongLink(context.Background(), "unknown"); err == nil {
+		t.Fatal("expected error for code without stale copy")
+	}
+
+	if stats := r.Stats(); stats.DegradedServes != 1 || stats.DegradedMisses != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestFailoverLinkRepository_OpensBreakerAfterThreshold(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{}, errors.New("connection refused")
+	}}
+	r := testFailover(repo, "")
+
+	for range 2 {
+		_, _ = r.GetLongLink(context.Background(), "abc")
+	}
+	if state := r.breaker.currentState(); state != breakerOpen {
+		t.Fatalf("expected open breaker, got %s", state)
+	}
+
+	_, err := r.GetLongLink(context.Background(), "abc")
+
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if repo.loads.Load() != 2 {
+		t.Fatalf("expected no database call while open, got %d calls", repo.loads.Load())
+	}
+}
+
+func TestFailoverLinkRepository_HalfOpenTrialClosesBreaker(t *testing.T) {
+	dbDown := true
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		if dbDown {
+			return link.LongLink{}, errors.New("connection refused")
+		}
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	r := testFailover(repo, "")
+	now := time.Now()
+	r.breaker.now = func() time.Time { return now }
+
+	for range 2 {
+		_, _ = r.GetLongLink(context.Background(), "abc")
+	}
+
+	dbDown = false
+	now = now.Add(2 * time.Minute)
+
+	if _, err := r.GetLongLink(context.Background(), "abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state := r.breaker.currentState(); state != breakerClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+}
+
+func TestFailoverLinkRepository_NotFoundIsNotAFailure(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{}, link.ErrNotFound
+	}}
+	r := testFailover(repo, "")
+
+	for range 5 {
+		if _, err := r.GetLongLink(context.Background(), "missing"); !errors.Is(err, link.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if state := r.breaker.currentState(); state != breakerClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+}
+
+func TestFailoverLinkRepository_TimeoutIsAFailure(t *testing.T) {
+	dbHung := false
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		if dbHung {
+			<-ctx.Done()
+			return link.LongLink{}, ctx.Err()
+		}
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	r := testFailover(repo, "")
+
+	if _, err := r.GetLongLink(context.Background(), "abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dbHung = true
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		got, err := r.GetLongLink(ctx, "abc")
+		cancel()
+		if err != nil || got.LongURL != "https://example.com" {
+			t.Fatalf("expected stale destination, got %+v err=%v", got, err)
+		}
+	}
+	if state := r.breaker.currentState(); state != breakerOpen {
+		t.Fatalf("expected open breaker, got %s", state)
+	}
+}
+
+func TestFailoverLinkRepository_CancelIsNotAFailure(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{}, ctx.Err()
+	}}
+	r := testFailover(repo, "")
+
+	for range 5 {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _ = r.GetLongLink(ctx, "abc")
+	}
+	if state := r.breaker.currentState(); state != breakerClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+}
+
+func TestFailoverLinkRepository_InvalidateEvictsStaleCopy(t *testing.T) {
+	dbDown := false
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		if dbDown {
+			return link.LongLink{}, errors.New("connection refused")
+		}
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	r := testFailover(repo, "")
+
+	if _, err := r.GetLongLink(context.Background(), "abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r.Invalidate("abc")
+
+	dbDown = true
+	if _, err := r.GetLongLink(context.Background(), "abc"); err == nil {
+		t.Fatal("expected error for invalidated code")
+	}
+}
+
+func TestFailoverLinkRepository_SnapshotSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.json")
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	r := testFailover(repo, path)
+	r.Start()
+	_, _ = r.GetLongLink(context.Background(), "abc")
+	r.Stop()
+
+	down := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{}, errors.New("connection refused")
+	}}
+	restarted := testFailover(down, path)
+
+	got, err := restarted.GetLongLink(context.Background(), "abc")
+	if err != nil || got.LongURL != "https://example.com" {
+		t.Fatalf("expected destination from snapshot, got %+v err=%v", got, err)
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+// loadTimeout bounds a shared load. Loads are detached from the caller context,
+// so one visitor dropping the connection doesn't fail everybody waiting on the same code.
+const loadTimeout = 5 * time.Second
+
+// LinkCacheConfig configures LinkCache.
+type LinkCacheConfig struct {
+	Size        int           // max number of cached codes
+	TTL         time.Duration // lifetime of a found link
+	NegativeTTL time.Duration // lifetime of a not-found code
+}
+
+// LinkCacheStats are counters exported to size the cache.
+type LinkCacheStats struct {
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	SharedLoads  int64 `json:"shared_loads"`
+	Evictions    int64 `json:"evictions"`
+	Size         int   `json:"size"`
+	Capacity     int   `json:"capacity"`
+}
+
+type cacheEntry struct {
+	code      string
+	link      link.LongLink
+	notFound  bool
+	expiresAt time.Time
+}
+
+// LinkCache is a bounded LRU read-through cache in front of link.LinkRepository.
+// Only GetLongLink is cached; writes go to the wrapped repository and invalidate affected codes.
+type LinkCache struct {
+	link.LinkRepository
+
+	cfg LinkCacheConfig
+	now func() time.Time
+
+	mu    sync.Mutex
+	ll    *list.List // front = most recently used
+	items map[string]*list.Element
+	// generation changes on every invalidation, so a load started before it doesn't store a stale value.
+	generation uint64
+
+	group flightGroup
+
+	hits, negativeHits, misses, sharedLoads, evictions atomic.Int64
+}
+
+// NewLinkCache wraps repo with an LRU cache.
+func NewLinkCache(repo link.LinkRepository, cfg LinkCacheConfig) *LinkCache {
+	return &LinkCache{
+		LinkRepository: repo,
+		cfg:            cfg,
+		now:            time.Now,
+		ll:             list.New(),
+		items:          make(map[string]*list.Element, cfg.Size),
+	}
+}
+
+// GetLongLink returns the cached link or loads it once for all concurrent callers.
+// Not-found codes are cached for NegativeTTL.
+func (c *LinkCache) GetLongLink(ctx context.Context, code string) (link.LongLink, error) {
+	if entry, ok := c.get(code); ok {
+		if entry.notFound {
+			c.negativeHits.Add(1)
+			return link.LongLink{}, link.ErrNotFound
+		}
+		c.hits.Add(1)
+		return entry.link, nil
+	}
+	c.misses.Add(1)
+
+	longLink, err, shared := c.group.do(code, func() (link.LongLink, error) {
+		generation := c.currentGeneration()
+
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		longLink, err := c.LinkRepository.GetLongLink(loadCtx, code)
+		switch {
+		case err == nil:
+			c.put(code, cacheEntry{link: longLink}, generation)
+		case errors.Is(err, link.ErrNotFound):
+			c.put(code, cacheEntry{notFound: true}, generation)
+		}
+		return longLink, err
+	})
+	if shared {
+		c.sharedLoads.Add(1)
+	}
+
+	return longLink, err
+}
+
+func (c *LinkCache) CreateShortLink(ctx context.Context, shortLink link.ShortLink) error {
+	err := c.LinkRepository.CreateShortLink(ctx, shortLink)
+	// The code may have been cached as not found.
+	c.Invalidate(shortLink.Code)
+	return err
+}
+
+func (c *LinkCache) UpdateLink(ctx context.Context, code string, accountPublicId string, update link.LinkUpdate) (link.LinkState, error) {
+	state, err := c.LinkRepository.UpdateLink(ctx, code, accountPublicId, update)
+	c.Invalidate(code)
+	return state, err
+}
+
+func (c *LinkCache) DisableLink(ctx context.Context, code string, accountPublicId string) error {
+	err := c.LinkRepository.DisableLink(ctx, code, accountPublicId)
+	c.Invalidate(code)
+	return err
+}
+
+func (c *LinkCache) DeleteLink(ctx context.Context, code string, accountPublicId string) error {
+	err := c.LinkRepository.DeleteLink(ctx, code, accountPublicId)
+	c.Invalidate(code)
+	return err
+}
+
+// SetAccountExpiryBehavior changes behavior of every account link without a behavior of its own.
+// Cached entries aren't indexed by account, so the whole cache is flushed; the operation is rare.
+func (c *LinkCache) SetAccountExpiryBehavior(ctx context.Context, accountPublicId string, behavior *link.ExpiryBehavior) error {
+	err := c.LinkRepository.SetAccountExpiryBehavior(ctx, accountPublicId, behavior)
+	c.Flush()
+	return err
+}
+
+// Invalidate evicts the given codes.
+func (c *LinkCache) Invalidate(codes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, code := range codes {
+		if el, ok := c.items[code]; ok {
+			c.removeElement(el)
+		}
+	}
+}
+
+// Flush evicts all entries.
+func (c *LinkCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.ll.Init()
+	clear(c.items)
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *LinkCache) Stats() LinkCacheStats {
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+
+	return LinkCacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		SharedLoads:  c.sharedLoads.Load(),
+		Evictions:    c.evictions.Load(),
+		Size:         size,
+		Capacity:     c.cfg.Size,
+	}
+}
+
+func (c *LinkCache) get(code string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[code]
+	if !ok {
+		return cacheEntry{}, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.removeElement(el)
+		return cacheEntry{}, false
+	}
+
+	c.ll.MoveToFront(el)
+	return *entry, true
+}
+
+func (c *LinkCache) put(code string, entry cacheEntry, generation uint64) {
+	now := c.now()
+	entry.code = code
+	entry.expiresAt = c.entryExpiry(entry, now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if el, ok := c.items[code]; ok {
+		el.Value = &entry
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[code] = c.ll.PushFront(&entry)
+
+	for c.ll.Len() > c.cfg.Size {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// entryExpiry caps the entry lifetime at the link expiry, so an expiring link is re-read right when it expires.
+func (c *LinkCache) entryExpiry(entry cacheEntry, now time.Time) time.Time {
+	if entry.notFound {
+		return now.Add(c.cfg.NegativeTTL)
+	}
+
+	expiresAt := now.Add(c.cfg.TTL)
+	if linkExpiry := entry.link.ExpiresAt; linkExpiry != nil && linkExpiry.After(now) && linkExpiry.Before(expiresAt) {
+		return *linkExpiry
+	}
+	return expiresAt
+}
+
+func (c *LinkCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// removeElement must be called with mu held.
+func (c *LinkCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).code)
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+type mockLinkRepo struct {
+	link.LinkRepository
+
+	loads       atomic.Int64
+	getLongLink func(ctx context.Context, code string) (link.LongLink, error)
+}
+
+func (m *mockLinkRepo) GetLongLink(ctx context.Context, code string) (link.LongLink, error) {
+	m.loads.Add(1)
+	return m.getLongLink(ctx, code)
+}
+
+func (m *mockLinkRepo) UpdateLink(ctx context.Context, code string, accountPublicId string, update link.LinkUpdate) (link.LinkState, error) {
+	return link.LinkState{}, nil
+}
+
+func testCache(repo link.LinkRepository, size int) (*LinkCache, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLinkCache(repo, LinkCacheConfig{Size: size, TTL: time.Minute, NegativeTTL: 10 * time.Second})
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestLinkCache_GetLongLink_HitAfterMiss(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	c, _ := testCache(repo, 10)
+
+	for range 3 {
+		got, err := c.GetLongLink(context.Background(), "abc")
+		if err != nil || got.LongURL != "https://example.com" {
+			t.Fatalf("unexpected result: %+v err=%v", got, err)
+		}
+	}
+
+	if repo.loads.Load() != 1 {
+		t.Fatalf("expected 1 load, got %d", repo.loads.Load())
+	}
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLinkCache_GetLongLink_NegativeCaching(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{}, link.ErrNotFound
+	}}
+	c, now := testCache(repo, 10)
+
+	for range 2 {
+		if _, err := c.GetLongLink(context.Background(), "missing"); !errors.Is(err, link.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if repo.loads.Load() != 1 {
+		t.Fatalf("expected 1 load, got %d", repo.loads.Load())
+	}
+
+	*now = now.Add(11 * time.Second)
+	_, _ = c.GetLongLink(context.Background(), "missing")
+
+	if repo.loads.Load() != 2 {
+		t.Fatalf("expected reload after negative TTL, got %d loads", repo.loads.Load())
+	}
+}
+
+func TestLinkCache_GetLongLink_DoesNotCacheErrors(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{}, errors.New("db down")
+	}}
+	c, _ := testCache(repo, 10)
+
+	_, _ = c.GetLongLink(context.Background(), "abc")
+	_, _ = c.GetLongLink(context.Background(), "abc")
+
+	if repo.loads.Load() != 2 {
+		t.Fatalf("expected 2 loads, got %d", repo.loads.Load())
+	}
+}
+
+func TestLinkCache_GetLongLink_EvictsAtLinkExpiry(t *testing.T) {
+	c, now := testCache(nil, 10)
+	linkExpiry := now.Add(5 * time.Second)
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{Id: 1, LongURL: "https://example.com", ExpiresAt: &linkExpiry}, nil
+	}}
+	c.LinkRepository = repo
+
+	_, _ = c.GetLongLink(context.Background(), "abc")
+	*now = now.Add(6 * time.Second)
+	_, _ = c.GetLongLink(context.Background(), "abc")
+
+	if repo.loads.Load() != 2 {
+		t.Fatalf("expected reload after link expiry, got %d loads", repo.loads.Load())
+	}
+}
+
+func TestLinkCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{LongURL: "https://example.com/" + code}, nil
+	}}
+	c, _ := testCache(repo, 2)
+
+	_, _ = c.GetLongLink(context.Background(), "a")
+	_, _ = c.GetLongLink(context.Background(), "b")
+	_, _ = c.GetLongLink(context.Background(), "a") // a is now most recently used
+	_, _ = c.GetLongLink(context.Background(), "c") // evicts b
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to stay cached")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLinkCache_UpdateLink_Invalidates(t *testing.T) {
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	c, _ := testCache(repo, 10)
+
+	_, _ = c.GetLongLink(context.Background(), "abc")
+	if _, err := c.UpdateLink(context.Background(), "abc", "acc-1", link.LinkUpdate{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = c.GetLongLink(context.Background(), "abc")
+
+	if repo.loads.Load() != 2 {
+		t.Fatalf("expected reload after update, got %d loads", repo.loads.Load())
+	}
+}
+
+func TestLinkCache_GetLongLink_CollapsesConcurrentMisses(t *testing.T) {
+	release := make(chan struct{})
+	repo := &mockLinkRepo{getLongLink: func(ctx context.Context, code string) (link.LongLink, error) {
+		<-release
+		return link.LongLink{Id: 1, LongURL: "https://example.com"}, nil
+	}}
+	c, _ := testCache(repo, 10)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetLongLink(context.Background(), "abc"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	// Let the callers pile up on the in-flight load before releasing it.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if repo.loads.Load() != 1 {
+		t.Fatalf("expected 1 load, got %d", repo.loads.Load())
+	}
+}
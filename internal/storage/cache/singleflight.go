@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+// flightCall is an in-flight or completed load.
+type flightCall struct {
+	wg  sync.WaitGroup
+	val link.LongLink
+	err error
+}
+
+// flightGroup collapses concurrent loads of the same key into one call.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do executes fn once per key at a time; concurrent callers wait for and share the result.
+// shared reports whether the result was produced by another caller.
+func (g *flightGroup) do(key string, fn func() (link.LongLink, error)) (val link.LongLink, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.val, c.err, false
+}
@@ -3,11 +3,19 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
 )
 
+// visitorKey identifies the visitor of a click for unique counts: its visitor ID, or for clicks stored
+// without one the IP hash of pseudonymized clicks, else the IP.
+const visitorKey = `COALESCE(visitor_id, ip_hash, host(ip_address))`
+
 type AnalyticsRepository struct {
 	db *sql.DB
 }
@@ -16,55 +24,438 @@ func NewAnalyticsRepository(db *sql.DB) *AnalyticsRepository {
 	return &AnalyticsRepository{db: db}
 }
 
-func (r *AnalyticsRepository) SaveClick(ctx context.Context, c analytics.Click) error {
-	const q = `
-		INSERT INTO link_clicks (link_id, ip_address, user_agent, referer, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`
-	_, err := r.db.ExecContext(ctx, q, c.LinkID, c.IPAddress, c.UserAgent, c.Referer, c.CreatedAt)
+// SaveClicks stores a batch of clicks with COPY into a staging table and moves them into link_clicks.
+// Clicks of links deleted while they were queued are skipped, and so are clicks whose event is stored already:
+// events replayed from the spool after a partly stored batch aren't counted twice.
+// Data errors reject the batch with analytics.ErrClicksRejected.
+func (r *AnalyticsRepository) SaveClicks(ctx context.Context, clicks []analytics.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	err := r.copyClicks(ctx, clicks)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+		// A link was deleted while its clicks were being stored; they are skipped on the second attempt.
+		err = r.copyClicks(ctx, clicks)
+	}
+	if isDataError(err) {
+		return fmt.Errorf("%w: %w", analytics.ErrClicksRejected, err)
+	}
 	return err
 }
 
-func (r *AnalyticsRepository) GetStats(ctx context.Context, linkID int64, since time.Time) (analytics.Stats, error) {
-	const totalCountQuery = `
-		SELECT
-			COUNT(*) AS total,
-			COUNT(DISTINCT ip_address) AS unique
+// SaveRejectedClick dead-letters a click event the database refused to store.
+func (r *AnalyticsRepository) SaveRejectedClick(ctx context.Context, payload []byte, reason string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO link_click_dead_letters (payload, error) VALUES ($1, $2)`, payload, reason)
+	return err
+}
+
+// clickColumns are the link_clicks columns SaveClicks writes.
+const clickColumns = `link_id, ip_address, ip_hash, visitor_id, user_agent, referer, referer_domain,
+	browser, os, device_class, country, region, city, traffic_type, click_id, event_id, created_at`
+
+func (r *AnalyticsRepository) copyClicks(ctx context.Context, clicks []analytics.Click) error {
+	const createStaging = `
+		CREATE TEMP TABLE link_clicks_staging ON COMMIT DROP AS
+		SELECT ` + clickColumns + ` FROM link_clicks WITH NO DATA
+	`
+	const moveStaged = `
+		INSERT INTO link_clicks (` + clickColumns + `)
+		SELECT ` + clickColumns + `
+		FROM link_clicks_staging s
+		WHERE EXISTS (SELECT 1 FROM links l WHERE l.id = s.link_id)
+		ON CONFLICT (event_id, created_at) DO NOTHING
+	`
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, createStaging); err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("link_clicks_staging",
+			"link_id", "ip_address", "ip_hash", "visitor_id", "user_agent", "referer", "referer_domain",
+			"browser", "os", "device_class", "country", "region", "city", "traffic_type", "click_id", "event_id", "created_at"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, c := range clicks {
+			if _, err := stmt.ExecContext(ctx, c.LinkID, nullIfEmpty(c.IPAddress), nullIfEmpty(c.IPHash), nullIfEmpty(c.VisitorID), c.UserAgent, c.Referer, nullIfEmpty(c.RefererDomain),
+				nullIfEmpty(c.Browser), nullIfEmpty(c.OS), nullIfEmpty(c.Device),
+				nullIfEmpty(c.Country), nullIfEmpty(c.Region), nullIfEmpty(c.City), trafficType(c.TrafficType), nullIfEmpty(c.ClickID), nullIfEmpty(c.EventID), c.CreatedAt); err != nil {
+				return err
+			}
+		}
+		// Flushes the buffered rows; malformed values surface here.
+		if _, err = stmt.ExecContext(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, moveStaged); err != nil {
+			return err
+		}
+		// Both are idempotent, so replayed clicks don't change them.
+		if err := recordVisitors(ctx, tx, clicks); err != nil {
+			return err
+		}
+		return markStaleHours(ctx, tx, clicks)
+	})
+}
+
+// GetStats aggregates clicks of a link or an account. Bot and prefetch clicks are skipped unless query.IncludeBots is set.
+// The series is sparse: buckets without clicks are left out. Totals and series read the rollups of whole rolled up
+// hours and days, so unique clicks are estimates once a range covers one; breakdowns always read raw clicks.
+func (r *AnalyticsRepository) GetStats(ctx context.Context, query analytics.StatsQuery) (analytics.Stats, error) {
+	filter, filterArgs := clicksFilter(query.Scope, query.From, query.To, query.IncludeBots)
+	withArgs := func(extra ...any) []any {
+		return append(append([]any{}, filterArgs...), extra...)
+	}
+
+	totals, err := r.totals(ctx, query.Scope, query.From, query.To, query.IncludeBots)
+	if err != nil {
+		return analytics.Stats{}, err
+	}
+
+	series, err := r.series(ctx, query.Scope, query.From, query.To, query.IncludeBots, query.Granularity, query.Location)
+	if err != nil {
+		return analytics.Stats{}, err
+	}
+
+	stats := analytics.Stats{TotalClicks: totals.TotalClicks, UniqueClicks: totals.UniqueClicks, Series: series}
+
+	stats.FirstTimeVisitors, err = r.firstTimeVisitors(ctx, query.Scope, query.From, query.To, query.IncludeBots)
+	if err != nil {
+		return analytics.Stats{}, err
+	}
+	// Unique clicks may be an estimate, while first-time visitors are counted exactly.
+	stats.ReturningVisitors = max(stats.UniqueClicks-stats.FirstTimeVisitors, 0)
+
+	topDomainsQuery := `
+		SELECT COALESCE(referer_domain, $6) AS domain, COUNT(*) AS c
 		FROM link_clicks
-		WHERE link_id = $1
-		  AND created_at >= $2
+	` + filter + `
+		GROUP BY domain
+		ORDER BY c DESC, domain
+		LIMIT $5
 	`
-	var total, unique int64
-	if err := r.db.QueryRowContext(ctx, totalCountQuery, linkID, since).Scan(&total, &unique); err != nil {
+	if stats.TopReferrerDomains, err = r.topValues(ctx, query.ReferrerDomainsLimit, topDomainsQuery,
+		withArgs(query.ReferrerDomainsLimit, analytics.DirectReferrer)...); err != nil {
 		return analytics.Stats{}, err
 	}
 
-	const countByDayQuery = `
-		SELECT DATE(created_at) AS d, COUNT(*)
+	topReferrersQuery := `
+		SELECT referer, COUNT(*) AS c
 		FROM link_clicks
-		WHERE link_id = $1
+	` + filter + `
+		  AND referer <> ''
+		GROUP BY referer
+		ORDER BY c DESC, referer
+		LIMIT $5
+	`
+	if stats.TopReferrers, err = r.topValues(ctx, query.ReferrersLimit, topReferrersQuery,
+		withArgs(query.ReferrersLimit)...); err != nil {
+		return analytics.Stats{}, err
+	}
+
+	// User-Agent families and countries are small sets, so these breakdowns aren't limited.
+	for _, breakdown := range []struct {
+		column string
+		dest   *[]analytics.ValueCount
+	}{
+		{column: "browser", dest: &stats.ByBrowser},
+		{column: "os", dest: &stats.ByOS},
+		{column: "device_class", dest: &stats.ByDevice},
+		{column: "country", dest: &stats.ByCountry},
+	} {
+		q := `
+			SELECT COALESCE(` + breakdown.column + `, $5) AS v, COUNT(*) AS c
+			FROM link_clicks
+		` + filter + `
+			GROUP BY v
+			ORDER BY c DESC, v
+		`
+		if *breakdown.dest, err = r.topValues(ctx, -1, q, withArgs(analytics.UnknownValue)...); err != nil {
+			return analytics.Stats{}, err
+		}
+	}
+
+	if stats.Conversions, err = r.conversions(ctx, query.Scope, query.From, query.To); err != nil {
+		return analytics.Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// conversions counts the conversions of a scope recorded in [from, to) and sums their values per currency.
+// Conversions aren't classified by traffic type, so bots don't change them.
+func (r *AnalyticsRepository) conversions(ctx context.Context, scope analytics.ClickScope, from, to time.Time) (analytics.ConversionStats, error) {
+	scopeCond, scopeArg := scopeFilter(scope)
+	filter := `
+		WHERE ` + scopeCond + `
 		  AND created_at >= $2
-		GROUP BY d
-		ORDER BY d
+		  AND created_at < $3
 	`
-	rows, err := r.db.QueryContext(ctx, countByDayQuery, linkID, since)
+
+	var conversions analytics.ConversionStats
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT click_id)
+		FROM conversions
+	`+filter, scopeArg, from, to).Scan(&conversions.Count, &conversions.ConvertedClicks)
 	if err != nil {
-		return analytics.Stats{}, err
+		return analytics.ConversionStats{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT currency, trim_scale(SUM(value))::text
+		FROM conversions
+	`+filter+`
+		  AND value IS NOT NULL
+		GROUP BY currency
+		ORDER BY currency
+	`, scopeArg, from, to)
+	if err != nil {
+		return analytics.ConversionStats{}, err
 	}
 	defer rows.Close()
 
-	byDay := make([]analytics.DayCount, 0)
+	conversions.Revenue = make([]analytics.Revenue, 0)
 	for rows.Next() {
-		var d time.Time
+		var revenue analytics.Revenue
+		if err := rows.Scan(&revenue.Currency, &revenue.Amount); err != nil {
+			return analytics.ConversionStats{}, err
+		}
+		conversions.Revenue = append(conversions.Revenue, revenue)
+	}
+	return conversions, rows.Err()
+}
+
+// GetTotals counts clicks of a scope, e.g. in the period before the one of GetStats.
+func (r *AnalyticsRepository) GetTotals(ctx context.Context, query analytics.TotalsQuery) (analytics.Totals, error) {
+	return r.totals(ctx, query.Scope, query.From, query.To, query.IncludeBots)
+}
+
+// GetSeries counts clicks of a scope per bucket, e.g. in the period before the one of GetStats. Empty buckets are left out.
+func (r *AnalyticsRepository) GetSeries(ctx context.Context, query analytics.SeriesQuery) ([]analytics.Bucket, error) {
+	return r.series(ctx, query.Scope, query.From, query.To, query.IncludeBots, query.Granularity, query.Location)
+}
+
+// GetTopLinks ranks the account's links by clicks.
+func (r *AnalyticsRepository) GetTopLinks(ctx context.Context, query analytics.TopLinksQuery) ([]analytics.LinkCount, error) {
+	const q = `
+		SELECT l.code, l.long_url, COUNT(*) AS total, COUNT(DISTINCT COALESCE(c.visitor_id, c.ip_hash, host(c.ip_address))) AS unique
+		FROM link_clicks c
+		JOIN links l ON l.id = c.link_id
+		WHERE l.account_public_id = $1
+		  AND c.created_at >= $2
+		  AND c.created_at < $3
+		  AND ($4 OR c.traffic_type = 'human')
+		GROUP BY l.id
+		ORDER BY total DESC, l.code
+		LIMIT $5
+	`
+	rows, err := r.db.QueryContext(ctx, q, query.AccountPublicID, query.From, query.To, query.IncludeBots, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]analytics.LinkCount, 0, query.Limit)
+	for rows.Next() {
+		var l analytics.LinkCount
+		if err := rows.Scan(&l.ShortCode, &l.LongURL, &l.TotalClicks, &l.UniqueClicks); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// exportPageSize is the number of clicks read per export query.
+const exportPageSize = 1000
+
+// StreamClicks reads the clicks page by page with keyset pagination on (created_at, id), so neither the driver
+// nor the service holds more than one page of a large export. Every page is a short query of its own: no
+// transaction or connection is held while fn writes to a slow client.
+func (r *AnalyticsRepository) StreamClicks(ctx context.Context, query analytics.ExportQuery, fn func(analytics.ExportedClick) error) error {
+	filter, args := clicksFilter(query.Scope, query.From, query.To, query.IncludeBots)
+	q := `
+		SELECT c.id, l.code, c.created_at, COALESCE(host(c.ip_address), ''), COALESCE(c.user_agent, ''),
+		       COALESCE(c.referer, ''), COALESCE(c.referer_domain, ''), COALESCE(c.browser, ''),
+		       COALESCE(c.os, ''), COALESCE(c.device_class, ''), COALESCE(c.country, ''),
+		       COALESCE(c.region, ''), COALESCE(c.city, ''), c.traffic_type
+		FROM (
+			SELECT *
+			FROM link_clicks
+			` + filter + `
+			  AND (created_at, id) > ($5, $6)
+			ORDER BY created_at, id
+			LIMIT $7
+		) c
+		JOIN links l ON l.id = c.link_id
+		ORDER BY c.created_at, c.id
+	`
+	afterCreatedAt, afterID := query.From, int64(0)
+	for {
+		page, lastID, err := r.exportPage(ctx, q, append(args, afterCreatedAt, afterID, exportPageSize))
+		if err != nil {
+			return err
+		}
+		for _, c := range page {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+		afterCreatedAt, afterID = page[len(page)-1].CreatedAt, lastID
+	}
+}
+
+// exportPage reads one page of an export and returns it with the id of its last click.
+func (r *AnalyticsRepository) exportPage(ctx context.Context, q string, args []any) ([]analytics.ExportedClick, int64, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		page   = make([]analytics.ExportedClick, 0, exportPageSize)
+		lastID int64
+	)
+	for rows.Next() {
+		var c analytics.ExportedClick
+		err := rows.Scan(&lastID, &c.ShortCode, &c.CreatedAt, &c.IPAddress, &c.UserAgent, &c.Referer, &c.RefererDomain,
+			&c.Browser, &c.OS, &c.Device, &c.Country, &c.Region, &c.City, &c.TrafficType)
+		if err != nil {
+			return nil, 0, err
+		}
+		page = append(page, c)
+	}
+	return page, lastID, rows.Err()
+}
+
+// clicksFilter is the WHERE clause of the stats queries with its $1..$4 arguments:
+// scope, [from, to) and bots. Queries number their own parameters from $5.
+func clicksFilter(scope analytics.ClickScope, from, to time.Time, includeBots bool) (string, []any) {
+	scopeCond, scopeArg := scopeFilter(scope)
+	filter := `
+		WHERE ` + scopeCond + `
+		  AND created_at >= $2
+		  AND created_at < $3
+		  AND ($4 OR traffic_type = 'human')
+	`
+	return filter, []any{scopeArg, from, to, includeBots}
+}
+
+// scopeFilter is the condition selecting the clicks, or rollups, of a scope with its $1 argument.
+func scopeFilter(scope analytics.ClickScope) (string, any) {
+	if scope.AccountPublicID != "" {
+		return "link_id IN (SELECT id FROM links WHERE account_public_id = $1)", scope.AccountPublicID
+	}
+	return "link_id = $1", scope.LinkID
+}
+
+// totals counts clicks and unique visitors of a scope in [from, to), exactly unless the range holds rolled up hours.
+func (r *AnalyticsRepository) totals(ctx context.Context, scope analytics.ClickScope, from, to time.Time, includeBots bool) (analytics.Totals, error) {
+	split, ok, err := r.splitRange(ctx, from, to)
+	if err != nil {
+		return analytics.Totals{}, err
+	}
+	if ok {
+		return r.rolledUpTotals(ctx, scope, split, includeBots)
+	}
+
+	filter, args := clicksFilter(scope, from, to, includeBots)
+	q := `
+		SELECT
+			COUNT(*) AS total,
+			COUNT(DISTINCT ` + visitorKey + `) AS unique
+		FROM link_clicks
+	` + filter
+	var totals analytics.Totals
+	err = r.db.QueryRowContext(ctx, q, args...).Scan(&totals.TotalClicks, &totals.UniqueClicks)
+	return totals, err
+}
+
+// series buckets clicks in the viewer's wall clock, so days start at their midnight.
+func (r *AnalyticsRepository) series(ctx context.Context, scope analytics.ClickScope, from, to time.Time, includeBots bool, g analytics.Granularity, loc *time.Location) ([]analytics.Bucket, error) {
+	split, ok, err := r.splitRange(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if ok && wholeHourOffset(loc, from, to) {
+		return r.rolledUpSeries(ctx, scope, split, includeBots, g, loc)
+	}
+
+	filter, args := clicksFilter(scope, from, to, includeBots)
+	q := `
+		SELECT date_trunc($5, created_at AT TIME ZONE $6) AS bucket, COUNT(*)
+		FROM link_clicks
+	` + filter + `
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+	return r.scanSeries(ctx, loc, q, append(args, string(g), loc.String())...)
+}
+
+// scanSeries runs a (wall-clock bucket, count) series query.
+func (r *AnalyticsRepository) scanSeries(ctx context.Context, loc *time.Location, q string, args ...any) ([]analytics.Bucket, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := make([]analytics.Bucket, 0)
+	for rows.Next() {
+		var wall time.Time
 		var c int64
-		if err := rows.Scan(&d, &c); err != nil {
-			return analytics.Stats{}, err
+		if err := rows.Scan(&wall, &c); err != nil {
+			return nil, err
 		}
-		byDay = append(byDay, analytics.DayCount{Date: d, Count: c})
+		// timestamp without time zone is scanned as UTC; reinterpret the wall clock in the viewer's zone.
+		start := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), 0, 0, 0, loc)
+		series = append(series, analytics.Bucket{Start: start, Count: c})
 	}
-	if err := rows.Err(); err != nil {
-		return analytics.Stats{}, err
+	return series, rows.Err()
+}
+
+// topValues runs a (value, count) breakdown query. A zero limit skips the query, a negative one doesn't limit it.
+func (r *AnalyticsRepository) topValues(ctx context.Context, limit int, q string, args ...any) ([]analytics.ValueCount, error) {
+	values := make([]analytics.ValueCount, 0, max(limit, 0))
+	if limit == 0 {
+		return values, nil
 	}
 
-	return analytics.Stats{TotalClicks: total, UniqueClicks: unique, ByDay: byDay}, nil
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v analytics.ValueCount
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// trafficType stores unclassified clicks as human, matching the column default.
+func trafficType(t link.TrafficType) string {
+	if t == "" {
+		return string(link.TrafficHuman)
+	}
+	return string(t)
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
 }
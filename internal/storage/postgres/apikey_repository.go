@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/auth"
+)
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// CreateAPIKey inserts the key by its hash and returns it with its public id.
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key auth.APIKey, keyHash string) (auth.APIKey, error) {
+	const q = `
+		INSERT INTO api_keys (account_public_id, name, key_prefix, key_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING public_id, created_at
+	`
+	if err := r.db.QueryRowContext(ctx, q, key.AccountPublicId, key.Name, key.Prefix, keyHash).
+		Scan(&key.PublicId, &key.CreatedAt); err != nil {
+		return auth.APIKey{}, err
+	}
+	return key, nil
+}
+
+// GetAPIKeys returns the account's keys, oldest first.
+func (r *APIKeyRepository) GetAPIKeys(ctx context.Context, accountPublicId string) ([]auth.APIKey, error) {
+	const q = `
+		SELECT public_id, name, key_prefix, created_at, last_used_at
+		FROM api_keys
+		WHERE account_public_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, q, accountPublicId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]auth.APIKey, 0)
+	for rows.Next() {
+		k := auth.APIKey{AccountPublicId: accountPublicId}
+		if err := rows.Scan(&k.PublicId, &k.Name, &k.Prefix, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) DeleteAPIKey(ctx context.Context, publicId string, accountPublicId string) error {
+	const q = `DELETE FROM api_keys WHERE public_id = $1 AND account_public_id = $2`
+	res, err := r.db.ExecContext(ctx, q, publicId, accountPublicId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return auth.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// FindAPIKeyAccount looks the key up by its hash. last_used_at is updated at most once a minute,
+// so a busy key doesn't write on every request.
+func (r *APIKeyRepository) FindAPIKeyAccount(ctx context.Context, keyHash string) (string, error) {
+	const q = `
+		WITH key AS (
+			SELECT id, account_public_id, last_used_at
+			FROM api_keys
+			WHERE key_hash = $1
+		), touched AS (
+			UPDATE api_keys
+			SET last_used_at = now()
+			WHERE id = (SELECT id FROM key)
+			  AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+		)
+		SELECT account_public_id FROM key
+	`
+	var accountPublicId string
+	err := r.db.QueryRowContext(ctx, q, keyHash).Scan(&accountPublicId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", auth.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return accountPublicId, nil
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// clickPartitionPrefix names the monthly partitions of link_clicks: link_clicks_pYYYY_MM.
+const clickPartitionPrefix = "link_clicks_p"
+
+func clickPartitionName(month time.Time) string {
+	return clickPartitionPrefix + month.UTC().Format("2006_01")
+}
+
+// GetClickPartitions returns the months of the attached link_clicks partitions. The default partition is skipped.
+func (r *AnalyticsRepository) GetClickPartitions(ctx context.Context) ([]time.Time, error) {
+	const q = `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'link_clicks'::regclass
+		ORDER BY c.relname
+	`
+	rows, err := r.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	months := make([]time.Time, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		suffix, ok := strings.CutPrefix(name, clickPartitionPrefix)
+		if !ok {
+			continue
+		}
+		month, err := time.Parse("2006_01", suffix)
+		if err != nil {
+			continue
+		}
+		months = append(months, month)
+	}
+	return months, rows.Err()
+}
+
+// CreateClickPartition creates the partition of a month. Postgres refuses a partition whose rows already
+// sit in the default partition, so those are moved aside first and re-inserted once it exists.
+func (r *AnalyticsRepository) CreateClickPartition(ctx context.Context, month time.Time) error {
+	from, to := month.UTC(), month.UTC().AddDate(0, 1, 0)
+
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE moved_clicks (LIKE link_clicks) ON COMMIT DROP`); err != nil {
+			return err
+		}
+		const moveAside = `
+			WITH moved AS (
+				DELETE FROM link_clicks_default
+				WHERE created_at >= $1
+				  AND created_at < $2
+				RETURNING *
+			)
+			INSERT INTO moved_clicks
+			SELECT * FROM moved
+		`
+		if _, err := tx.ExecContext(ctx, moveAside, from, to); err != nil {
+			return err
+		}
+
+		create := fmt.Sprintf(`CREATE TABLE %s PARTITION OF link_clicks FOR VALUES FROM (%s) TO (%s)`,
+			pq.QuoteIdentifier(clickPartitionName(month)),
+			pq.QuoteLiteral(from.Format(time.RFC3339)), pq.QuoteLiteral(to.Format(time.RFC3339)))
+		if _, err := tx.ExecContext(ctx, create); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO link_clicks SELECT * FROM moved_clicks`)
+		return err
+	})
+}
+
+// RemoveClickPartition drops or detaches the partition of a month. Pending re-rollups of its hours are
+// discarded with it: the rollups keep the counts the clicks had when they were rolled up.
+func (r *AnalyticsRepository) RemoveClickPartition(ctx context.Context, month time.Time, detach bool) error {
+	name := pq.QuoteIdentifier(clickPartitionName(month))
+	statement := `DROP TABLE ` + name
+	if detach {
+		statement = `ALTER TABLE link_clicks DETACH PARTITION ` + name
+	}
+
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+
+		const unmark = `
+			DELETE FROM click_rollup_stale_hours
+			WHERE bucket_start >= $1
+			  AND bucket_start < $2
+		`
+		_, err := tx.ExecContext(ctx, unmark, month.UTC(), month.UTC().AddDate(0, 1, 0))
+		return err
+	})
+}
+
+// DeleteUnpartitionedClicks deletes clicks that landed in the default partition and are older than before,
+// e.g. late clicks of a month whose partition was already removed.
+func (r *AnalyticsRepository) DeleteUnpartitionedClicks(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM link_clicks_default WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,536 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
+	"github.com/viacheslaev/url-shortener/internal/hll"
+)
+
+// visitorHash is the 64-bit hash of a click's visitorKey that hll.Sketch.Add uses: the first 8 bytes of its MD5.
+const visitorHash = `('x' || substr(md5(` + visitorKey + `), 1, 16))::bit(64)`
+
+// hllRegisters computes the HyperLogLog register of a hash h the way hll.Sketch.Add does: the top
+// hll.Precision bits are the register index, the rank is the position of the first set bit in the rest.
+var hllRegisters = fmt.Sprintf(`
+	substring(h FROM 1 FOR %[1]d)::bit(%[1]d)::int AS idx,
+	COALESCE(NULLIF(position(B'1' IN substring(h FROM %[2]d)), 0), %[3]d) AS rank`,
+	hll.Precision, hll.Precision+1, hll.MaxRank)
+
+type rollupKey struct {
+	linkID      int64
+	trafficType string
+}
+
+type rollup struct {
+	clicks   int64
+	visitors *hll.Sketch
+}
+
+// GetRollupWatermark returns the end of the rolled up hours.
+func (r *AnalyticsRepository) GetRollupWatermark(ctx context.Context) (time.Time, error) {
+	var watermark time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT rolled_up_until FROM click_rollup_state`).Scan(&watermark)
+	return watermark, err
+}
+
+// RollUpHour rolls up the hour starting at the watermark. The aggregation holds the advisory lock of the hour
+// rather than the state row, so SaveClicks marking late clicks (see markStaleHours) isn't blocked by it:
+// the hour is claimed first, and late clicks of the claimed hour are marked stale.
+func (r *AnalyticsRepository) RollUpHour(ctx context.Context, hour time.Time) (bool, error) {
+	claimed, err := r.claimRollupHour(ctx, hour)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	rolled := false
+	err = withTx(ctx, r.db, func(tx *sql.Tx) error {
+		if err := lockRollupHour(ctx, tx, hour); err != nil {
+			return err
+		}
+		// Another replica may have rolled the hour up while this one waited for the lock.
+		watermark, err := rollupWatermark(ctx, tx)
+		if err != nil || !watermark.Equal(hour) {
+			return err
+		}
+
+		end := hour.Add(time.Hour)
+		if err := rollUpHour(ctx, tx, hour, 0); err != nil {
+			return err
+		}
+		if end.UTC().Hour() == 0 {
+			if err := rollUpDay(ctx, tx, end.AddDate(0, 0, -1), 0); err != nil {
+				return err
+			}
+		}
+
+		// The state row is only locked from here to the commit.
+		const advance = `UPDATE click_rollup_state SET rolled_up_until = $2, rolling_up_hour = NULL WHERE rolled_up_until = $1`
+		if _, err := tx.ExecContext(ctx, advance, hour, end); err != nil {
+			return err
+		}
+		rolled = true
+		return nil
+	})
+	return rolled, err
+}
+
+// claimRollupHour records that the hour at the watermark is being rolled up, so clicks of it committed after
+// the rollup read the clicks are marked stale. A SaveClicks transaction that checked the state before holds
+// its shared lock until commit, so the claim waits for its clicks. Returns false when the watermark isn't at hour.
+func (r *AnalyticsRepository) claimRollupHour(ctx context.Context, hour time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE click_rollup_state SET rolling_up_hour = $1 WHERE rolled_up_until = $1`, hour)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetStaleRollupHours returns rolled up hours that received clicks afterwards, oldest first.
+func (r *AnalyticsRepository) GetStaleRollupHours(ctx context.Context, limit int) ([]analytics.StaleRollupHour, error) {
+	const q = `
+		SELECT link_id, bucket_start
+		FROM click_rollup_stale_hours
+		ORDER BY bucket_start, link_id
+		LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stale := make([]analytics.StaleRollupHour, 0)
+	for rows.Next() {
+		var s analytics.StaleRollupHour
+		if err := rows.Scan(&s.LinkID, &s.Hour); err != nil {
+			return nil, err
+		}
+		stale = append(stale, s)
+	}
+	return stale, rows.Err()
+}
+
+// RefreshRollupHour rolls up a stale hour of a link again, and its day when the day is rolled up already.
+// Hours of months before the partitions, i.e. whose partition was removed, are only unmarked: their late clicks
+// sit in the default partition, and rolling up the hour again would replace its rollups with those few clicks.
+func (r *AnalyticsRepository) RefreshRollupHour(ctx context.Context, stale analytics.StaleRollupHour, partitions []time.Time) error {
+	removed := len(partitions) > 0 && stale.Hour.Before(partitions[0])
+
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		// The rollup of the last hour of the day rolls up the day as well, so it must not read
+		// the hourly rollups of the day while they are refreshed.
+		day := utcDay(stale.Hour)
+		if err := lockRollupHour(ctx, tx, stale.Hour); err != nil {
+			return err
+		}
+		if lastHour := day.Add(23 * time.Hour); !lastHour.Equal(stale.Hour) {
+			if err := lockRollupHour(ctx, tx, lastHour); err != nil {
+				return err
+			}
+		}
+		watermark, err := rollupWatermark(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		const unmark = `DELETE FROM click_rollup_stale_hours WHERE link_id = $1 AND bucket_start = $2`
+		if _, err := tx.ExecContext(ctx, unmark, stale.LinkID, stale.Hour); err != nil || removed {
+			return err
+		}
+
+		if err := rollUpHour(ctx, tx, stale.Hour, stale.LinkID); err != nil {
+			return err
+		}
+		if day.AddDate(0, 0, 1).After(watermark) {
+			return nil
+		}
+		return rollUpDay(ctx, tx, day, stale.LinkID)
+	})
+}
+
+// rollupLockClass namespaces the advisory locks of rollup hours (see lockRollupHour).
+const rollupLockClass = 14
+
+// lockRollupHour takes the advisory lock of an hour until the end of tx, so the hour isn't aggregated
+// by the rollup of all links and a refresh of one of its links, or by two replicas, at the same time.
+func lockRollupHour(ctx context.Context, tx *sql.Tx, hour time.Time) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, rollupLockClass, int32(hour.Unix()/3600))
+	return err
+}
+
+func rollupWatermark(ctx context.Context, tx *sql.Tx) (time.Time, error) {
+	var watermark time.Time
+	err := tx.QueryRowContext(ctx, `SELECT rolled_up_until FROM click_rollup_state`).Scan(&watermark)
+	return watermark, err
+}
+
+// rollUpHour replaces the hourly rollups of hour with counts and sketches of the raw clicks,
+// of every link or only of linkID.
+func rollUpHour(ctx context.Context, tx *sql.Tx, hour time.Time, linkID int64) error {
+	const filter = `
+		WHERE created_at >= $1
+		  AND created_at < $2
+		  AND ($3::bigint = 0 OR link_id = $3)
+	`
+	args := []any{hour, hour.Add(time.Hour), linkID}
+	rollups := make(map[rollupKey]*rollup)
+	get := func(key rollupKey) *rollup {
+		if rollups[key] == nil {
+			rollups[key] = &rollup{visitors: hll.New()}
+		}
+		return rollups[key]
+	}
+
+	countsQuery := `
+		SELECT link_id, traffic_type, COUNT(*)
+		FROM link_clicks
+	` + filter + `
+		GROUP BY link_id, traffic_type
+	`
+	rows, err := tx.QueryContext(ctx, countsQuery, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key rollupKey
+		var clicks int64
+		if err := rows.Scan(&key.linkID, &key.trafficType, &clicks); err != nil {
+			rows.Close()
+			return err
+		}
+		get(key).clicks = clicks
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	registersQuery := `
+		SELECT link_id, traffic_type, idx, MAX(rank)
+		FROM (
+			SELECT link_id, traffic_type, ` + hllRegisters + `
+			FROM (
+				SELECT link_id, traffic_type, ` + visitorHash + ` AS h
+				FROM link_clicks
+			` + filter + `
+				  AND ` + visitorKey + ` IS NOT NULL
+			) c
+		) r
+		GROUP BY link_id, traffic_type, idx
+	`
+	rows, err = tx.QueryContext(ctx, registersQuery, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key rollupKey
+		var idx int
+		var rank uint8
+		if err := rows.Scan(&key.linkID, &key.trafficType, &idx, &rank); err != nil {
+			rows.Close()
+			return err
+		}
+		get(key).visitors.Observe(idx, rank)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return replaceRollups(ctx, tx, "link_click_rollups_hourly", hour, linkID, rollups)
+}
+
+// rollUpDay replaces the daily rollups of day by merging its hourly rollups.
+func rollUpDay(ctx context.Context, tx *sql.Tx, day time.Time, linkID int64) error {
+	const q = `
+		SELECT link_id, traffic_type, clicks, visitors
+		FROM link_click_rollups_hourly
+		WHERE bucket_start >= $1
+		  AND bucket_start < $2
+		  AND ($3::bigint = 0 OR link_id = $3)
+	`
+	rows, err := tx.QueryContext(ctx, q, day, day.AddDate(0, 0, 1), linkID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	rollups := make(map[rollupKey]*rollup)
+	var hour hll.Sketch
+	for rows.Next() {
+		var key rollupKey
+		var clicks int64
+		var visitors []byte
+		if err := rows.Scan(&key.linkID, &key.trafficType, &clicks, &visitors); err != nil {
+			return err
+		}
+		if err := hour.UnmarshalBinary(visitors); err != nil {
+			return fmt.Errorf("hourly rollup of link %d: %w", key.linkID, err)
+		}
+
+		if rollups[key] == nil {
+			rollups[key] = &rollup{visitors: hll.New()}
+		}
+		rollups[key].clicks += clicks
+		rollups[key].visitors.Merge(&hour)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return replaceRollups(ctx, tx, "link_click_rollups_daily", day, linkID, rollups)
+}
+
+// replaceRollups replaces the rollups of a bucket, of every link or only of linkID.
+// Rollups of links deleted in the meantime are skipped.
+func replaceRollups(ctx context.Context, tx *sql.Tx, table string, bucketStart time.Time, linkID int64, rollups map[rollupKey]*rollup) error {
+	deleteQuery := `DELETE FROM ` + table + ` WHERE bucket_start = $1 AND ($2::bigint = 0 OR link_id = $2)`
+	if _, err := tx.ExecContext(ctx, deleteQuery, bucketStart, linkID); err != nil {
+		return err
+	}
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	var (
+		linkIDs      = make([]int64, 0, len(rollups))
+		trafficTypes = make([]string, 0, len(rollups))
+		clicks       = make([]int64, 0, len(rollups))
+		visitors     = make([][]byte, 0, len(rollups))
+	)
+	for key, r := range rollups {
+		sketch, err := r.visitors.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		linkIDs = append(linkIDs, key.linkID)
+		trafficTypes = append(trafficTypes, key.trafficType)
+		clicks = append(clicks, r.clicks)
+		visitors = append(visitors, sketch)
+	}
+
+	insertQuery := `
+		INSERT INTO ` + table + ` (link_id, bucket_start, traffic_type, clicks, visitors)
+		SELECT r.link_id, $1, r.traffic_type, r.clicks, r.visitors
+		FROM unnest($2::bigint[], $3::text[], $4::bigint[], $5::bytea[]) AS r(link_id, traffic_type, clicks, visitors)
+		WHERE EXISTS (SELECT 1 FROM links l WHERE l.id = r.link_id)
+	`
+	_, err := tx.ExecContext(ctx, insertQuery, bucketStart,
+		pq.Array(linkIDs), pq.Array(trafficTypes), pq.Array(clicks), pq.Array(visitors))
+	return err
+}
+
+// markStaleHours records the rolled up hours the clicks fall in, and the hour being rolled up, so the worker
+// rolls them up again. Clicks of the current hour can't be rolled up yet and are skipped without a query.
+// The shared lock on the state row keeps a rollup from claiming an hour before these clicks are committed.
+// A stale hour that is already marked is locked by the no-op update: a refresh unmarking it waits for
+// these clicks, so it either reads them or the hour is marked again.
+func markStaleHours(ctx context.Context, tx *sql.Tx, clicks []analytics.Click) error {
+	currentHour := time.Now().Truncate(time.Hour)
+
+	var linkIDs []int64
+	var hours []string
+	for _, c := range clicks {
+		if c.CreatedAt.Before(currentHour) {
+			linkIDs = append(linkIDs, c.LinkID)
+			hours = append(hours, c.CreatedAt.Truncate(time.Hour).Format(time.RFC3339Nano))
+		}
+	}
+	if len(linkIDs) == 0 {
+		return nil
+	}
+
+	const q = `
+		WITH state AS (
+			SELECT rolled_up_until, rolling_up_hour FROM click_rollup_state FOR SHARE
+		)
+		INSERT INTO click_rollup_stale_hours (link_id, bucket_start)
+		SELECT DISTINCT s.link_id, s.bucket_start
+		FROM unnest($1::bigint[], $2::timestamptz[]) AS s(link_id, bucket_start)
+		WHERE (s.bucket_start < (SELECT rolled_up_until FROM state) OR s.bucket_start = (SELECT rolling_up_hour FROM state))
+		  AND EXISTS (SELECT 1 FROM links l WHERE l.id = s.link_id)
+		ON CONFLICT (link_id, bucket_start) DO UPDATE SET bucket_start = EXCLUDED.bucket_start
+	`
+	_, err := tx.ExecContext(ctx, q, pq.Array(linkIDs), pq.Array(hours))
+	return err
+}
+
+// rollupSplit divides a range into raw clicks at its edges and whole UTC hours and days read from rollups:
+// raw [from, hoursFrom), hourly [hoursFrom, daysFrom), daily [daysFrom, daysTo), hourly [daysTo, hoursTo)
+// and raw [hoursTo, to).
+type rollupSplit struct {
+	from, hoursFrom, daysFrom, daysTo, hoursTo, to time.Time
+}
+
+// splitForRollups returns false when [from, to) holds no whole hour before the watermark.
+func splitForRollups(from, to, watermark time.Time) (rollupSplit, bool) {
+	hoursFrom := from.UTC().Truncate(time.Hour)
+	if hoursFrom.Before(from) {
+		hoursFrom = hoursFrom.Add(time.Hour)
+	}
+	hoursTo := to.UTC().Truncate(time.Hour)
+	if watermark.Before(hoursTo) {
+		hoursTo = watermark.UTC()
+	}
+	if !hoursFrom.Before(hoursTo) {
+		return rollupSplit{}, false
+	}
+
+	daysFrom, daysTo := utcDay(hoursFrom), utcDay(hoursTo)
+	if daysFrom.Before(hoursFrom) {
+		daysFrom = daysFrom.AddDate(0, 0, 1)
+	}
+	if !daysFrom.Before(daysTo) {
+		daysFrom, daysTo = hoursTo, hoursTo
+	}
+	return rollupSplit{from: from, hoursFrom: hoursFrom, daysFrom: daysFrom, daysTo: daysTo, hoursTo: hoursTo, to: to}, true
+}
+
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// splitRange splits [from, to) by the current watermark.
+func (r *AnalyticsRepository) splitRange(ctx context.Context, from, to time.Time) (rollupSplit, bool, error) {
+	watermark, err := r.GetRollupWatermark(ctx)
+	if err != nil {
+		return rollupSplit{}, false, err
+	}
+	split, ok := splitForRollups(from, to, watermark)
+	return split, ok, nil
+}
+
+// The rollup-aware queries share $1 scope and $2 bots; rawEdges and hourlyEdges take four bounds.
+const (
+	botsFilter  = `($2 OR traffic_type = 'human')`
+	rawEdges    = `((created_at >= $3 AND created_at < $4) OR (created_at >= $5 AND created_at < $6))`
+	hourlyEdges = `((bucket_start >= $3 AND bucket_start < $4) OR (bucket_start >= $5 AND bucket_start < $6))`
+)
+
+// rolledUpTotals counts the raw clicks at the edges of the split, adds the rollups of its hours and days
+// and estimates unique visitors by merging all their sketches.
+func (r *AnalyticsRepository) rolledUpTotals(ctx context.Context, scope analytics.ClickScope, split rollupSplit, includeBots bool) (analytics.Totals, error) {
+	scopeCond, scopeArg := scopeFilter(scope)
+	rawArgs := []any{scopeArg, includeBots, split.from, split.hoursFrom, split.hoursTo, split.to}
+	rawFilter := `
+		WHERE ` + scopeCond + `
+		  AND ` + botsFilter + `
+		  AND ` + rawEdges + `
+	`
+
+	var totals analytics.Totals
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM link_clicks`+rawFilter, rawArgs...).Scan(&totals.TotalClicks); err != nil {
+		return analytics.Totals{}, err
+	}
+
+	visitors := hll.New()
+	registersQuery := `
+		SELECT idx, MAX(rank)
+		FROM (
+			SELECT ` + hllRegisters + `
+			FROM (
+				SELECT ` + visitorHash + ` AS h
+				FROM link_clicks
+			` + rawFilter + `
+				  AND ` + visitorKey + ` IS NOT NULL
+			) c
+		) r
+		GROUP BY idx
+	`
+	rows, err := r.db.QueryContext(ctx, registersQuery, rawArgs...)
+	if err != nil {
+		return analytics.Totals{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx int
+		var rank uint8
+		if err := rows.Scan(&idx, &rank); err != nil {
+			return analytics.Totals{}, err
+		}
+		visitors.Observe(idx, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return analytics.Totals{}, err
+	}
+
+	rollupsQuery := `
+		SELECT clicks, visitors
+		FROM link_click_rollups_hourly
+		WHERE ` + scopeCond + `
+		  AND ` + botsFilter + `
+		  AND ` + hourlyEdges + `
+		UNION ALL
+		SELECT clicks, visitors
+		FROM link_click_rollups_daily
+		WHERE ` + scopeCond + `
+		  AND ` + botsFilter + `
+		  AND bucket_start >= $4
+		  AND bucket_start < $5
+	`
+	rows, err = r.db.QueryContext(ctx, rollupsQuery, scopeArg, includeBots, split.hoursFrom, split.daysFrom, split.daysTo, split.hoursTo)
+	if err != nil {
+		return analytics.Totals{}, err
+	}
+	defer rows.Close()
+
+	var bucket hll.Sketch
+	for rows.Next() {
+		var clicks int64
+		var sketch []byte
+		if err := rows.Scan(&clicks, &sketch); err != nil {
+			return analytics.Totals{}, err
+		}
+		if err := bucket.UnmarshalBinary(sketch); err != nil {
+			return analytics.Totals{}, err
+		}
+		totals.TotalClicks += clicks
+		visitors.Merge(&bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return analytics.Totals{}, err
+	}
+
+	totals.UniqueClicks = visitors.Estimate()
+	return totals, nil
+}
+
+// rolledUpSeries buckets the raw clicks at the edges of the split together with its hourly rollups.
+// Hourly rollups only fall into the buckets of a location whose offset is a whole number of hours.
+func (r *AnalyticsRepository) rolledUpSeries(ctx context.Context, scope analytics.ClickScope, split rollupSplit, includeBots bool, g analytics.Granularity, loc *time.Location) ([]analytics.Bucket, error) {
+	scopeCond, scopeArg := scopeFilter(scope)
+	q := `
+		SELECT date_trunc($7, ts AT TIME ZONE $8) AS bucket, SUM(clicks)::bigint
+		FROM (
+			SELECT created_at AS ts, 1 AS clicks
+			FROM link_clicks
+			WHERE ` + scopeCond + `
+			  AND ` + botsFilter + `
+			  AND ` + rawEdges + `
+			UNION ALL
+			SELECT bucket_start, clicks
+			FROM link_click_rollups_hourly
+			WHERE ` + scopeCond + `
+			  AND ` + botsFilter + `
+			  AND bucket_start >= $4
+			  AND bucket_start < $5
+		) c
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+	return r.scanSeries(ctx, loc, q, scopeArg, includeBots, split.from, split.hoursFrom, split.hoursTo, split.to, string(g), loc.String())
+}
+
+// wholeHourOffset reports whether loc is a whole number of hours away from UTC at both ends of a range.
+func wholeHourOffset(loc *time.Location, from, to time.Time) bool {
+	_, fromOffset := from.In(loc).Zone()
+	_, toOffset := to.In(loc).Zone()
+	return fromOffset%3600 == 0 && toOffset%3600 == 0
+}
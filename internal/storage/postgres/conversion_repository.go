@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/conversion"
+)
+
+type ConversionRepository struct {
+	db *sql.DB
+}
+
+func NewConversionRepository(db *sql.DB) *ConversionRepository {
+	return &ConversionRepository{db: db}
+}
+
+// CreateConversion attributes the conversion to the click with its click ID among the clicks of the
+// account's links. A conflicting external id inserts nothing, and the stored conversion is read instead.
+func (r *ConversionRepository) CreateConversion(ctx context.Context, c conversion.Conversion) (conversion.Conversion, bool, error) {
+	const q = `
+		WITH click AS (
+			SELECT lc.link_id, lc.click_id, lc.created_at, l.code
+			FROM link_clicks lc
+			JOIN links l ON l.id = lc.link_id
+			WHERE lc.click_id = $2::uuid
+			  AND l.account_public_id = $1
+			LIMIT 1
+		), inserted AS (
+			INSERT INTO conversions (account_public_id, link_id, click_id, clicked_at, event_name, value, currency, external_id)
+			SELECT $1, link_id, click_id, created_at, $3, NULLIF($4, '')::numeric, NULLIF($5, ''), NULLIF($6, '')
+			FROM click
+			ON CONFLICT (account_public_id, external_id) WHERE external_id IS NOT NULL DO NOTHING
+			RETURNING public_id, click_id, clicked_at, event_name, trim_scale(value)::text AS value, currency,
+			          external_id, created_at
+		)
+		SELECT i.public_id, i.click_id, c.code, i.clicked_at, i.event_name, COALESCE(i.value, ''),
+		       COALESCE(i.currency, ''), COALESCE(i.external_id, ''), i.created_at
+		FROM inserted i
+		CROSS JOIN click c
+	`
+	stored, err := scanConversion(r.db.QueryRowContext(ctx, q,
+		c.AccountPublicId, c.ClickId, c.EventName, c.Value, c.Currency, c.ExternalId))
+	if err == nil {
+		return stored, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return conversion.Conversion{}, false, err
+	}
+
+	// Either the click wasn't found, or the external id was recorded before.
+	if c.ExternalId == "" {
+		return conversion.Conversion{}, false, conversion.ErrClickNotFound
+	}
+	const existing = `
+		SELECT cv.public_id, cv.click_id, l.code, cv.clicked_at, cv.event_name, COALESCE(trim_scale(cv.value)::text, ''),
+		       COALESCE(cv.currency, ''), cv.external_id, cv.created_at
+		FROM conversions cv
+		JOIN links l ON l.id = cv.link_id
+		WHERE cv.account_public_id = $1
+		  AND cv.external_id = $2
+	`
+	stored, err = scanConversion(r.db.QueryRowContext(ctx, existing, c.AccountPublicId, c.ExternalId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return conversion.Conversion{}, false, conversion.ErrClickNotFound
+	}
+	if err != nil {
+		return conversion.Conversion{}, false, err
+	}
+	return stored, false, nil
+}
+
+func scanConversion(row *sql.Row) (conversion.Conversion, error) {
+	var c conversion.Conversion
+	err := row.Scan(&c.PublicId, &c.ClickId, &c.ShortCode, &c.ClickedAt, &c.EventName, &c.Value,
+		&c.Currency, &c.ExternalId, &c.CreatedAt)
+	return c, err
+}
@@ -1,3 +1,23 @@
 package postgres
 
-const pgUniqueViolation = "23505"
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// isDataError reports whether err is a data exception (class 22) or an integrity constraint
+// violation (class 23): executing the same statement with the same rows again can't succeed.
+func isDataError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23"
+}
@@ -0,0 +1,306 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/viacheslaev/url-shortener/internal/feature/link"
+)
+
+// linkStateColumns are the links columns recorded in link_events snapshots.
+const linkStateColumns = `long_url, expires_at, expiry_action, expiry_fallback_url, disabled_at`
+
+// linkRow is a link locked for modification together with its current state.
+type linkRow struct {
+	id    int64
+	state link.LinkState
+}
+
+// lockOwnedLink selects the account's link FOR UPDATE or returns link.ErrNotFound.
+func lockOwnedLink(ctx context.Context, tx *sql.Tx, code string, accountPublicId string) (linkRow, error) {
+	query := `
+		SELECT id, ` + linkStateColumns + `
+		FROM links
+		WHERE code = $1 AND account_public_id = $2
+		FOR UPDATE
+	`
+	var (
+		row         linkRow
+		action      sql.NullString
+		fallbackURL sql.NullString
+	)
+	err := tx.QueryRowContext(ctx, query, code, accountPublicId).Scan(
+		&row.id, &row.state.LongURL, &row.state.ExpiresAt, &action, &fallbackURL, &row.state.DisabledAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return linkRow{}, link.ErrNotFound
+	}
+	if err != nil {
+		return linkRow{}, err
+	}
+	row.state.ExpiryAction = action.String
+	row.state.FallbackURL = fallbackURL.String
+	return row, nil
+}
+
+// insertLinkEvent appends a history entry. actor == "" records a system change.
+func insertLinkEvent(
+	ctx context.Context,
+	tx *sql.Tx,
+	linkID int64,
+	code string,
+	owner string,
+	actor string,
+	eventType link.LinkEventType,
+	oldValue *link.LinkState,
+	newValue *link.LinkState,
+) error {
+	const q = `
+		INSERT INTO link_events (link_id, link_code, owner_public_id, actor_public_id, event_type, old_value, new_value)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, '')::uuid, $5, $6, $7)
+	`
+	oldJSON, err := marshalLinkState(oldValue)
+	if err != nil {
+		return err
+	}
+	newJSON, err := marshalLinkState(newValue)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, q, linkID, code, owner, actor, string(eventType), oldJSON, newJSON)
+	return err
+}
+
+// notifyLinkChange publishes a link change to other instances; delivered on commit.
+func notifyLinkChange(ctx context.Context, tx *sql.Tx, code string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, linkChangesChannel, code)
+	return err
+}
+
+func marshalLinkState(state *link.LinkState) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+func unmarshalLinkState(raw []byte) (*link.LinkState, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var state link.LinkState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// UpdateLink applies the update to the account's link and records the change.
+func (r *LinkRepository) UpdateLink(ctx context.Context, code string, accountPublicId string, update link.LinkUpdate) (link.LinkState, error) {
+	var newState link.LinkState
+
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		row, err := lockOwnedLink(ctx, tx, code, accountPublicId)
+		if err != nil {
+			return err
+		}
+
+		newState = row.state
+		if update.LongURL != nil {
+			newState.LongURL = *update.LongURL
+		}
+		if update.SetExpiryBehavior {
+			newState.ExpiryAction, newState.FallbackURL = "", ""
+			if update.ExpiryBehavior != nil {
+				newState.ExpiryAction = string(update.ExpiryBehavior.Action)
+				newState.FallbackURL = update.ExpiryBehavior.FallbackURL
+			}
+		}
+
+		if newState == row.state {
+			return nil
+		}
+
+		const q = `
+			UPDATE links
+			SET long_url = $2, expiry_action = NULLIF($3, ''), expiry_fallback_url = NULLIF($4, '')
+			WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, q, row.id, newState.LongURL, newState.ExpiryAction, newState.FallbackURL); err != nil {
+			return err
+		}
+		if err := notifyLinkChange(ctx, tx, code); err != nil {
+			return err
+		}
+
+		return insertLinkEvent(ctx, tx, row.id, code, accountPublicId, accountPublicId, link.LinkEventUpdate, &row.state, &newState)
+	})
+	if err != nil {
+		return link.LinkState{}, err
+	}
+
+	return newState, nil
+}
+
+// DisableLink stops redirects for the account's link. Disabling an already disabled link is a no-op.
+func (r *LinkRepository) DisableLink(ctx context.Context, code string, accountPublicId string) error {
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		row, err := lockOwnedLink(ctx, tx, code, accountPublicId)
+		if err != nil {
+			return err
+		}
+		if row.state.DisabledAt != nil {
+			return nil
+		}
+
+		newState := row.state
+		disabledAt := time.Now().UTC()
+		newState.DisabledAt = &disabledAt
+
+		if _, err := tx.ExecContext(ctx, `UPDATE links SET disabled_at = $2 WHERE id = $1`, row.id, disabledAt); err != nil {
+			return err
+		}
+		if err := notifyLinkChange(ctx, tx, code); err != nil {
+			return err
+		}
+
+		return insertLinkEvent(ctx, tx, row.id, code, accountPublicId, accountPublicId, link.LinkEventDisable, &row.state, &newState)
+	})
+}
+
+// deleteLinkClicksBatchSize bounds each DELETE of a deleted link's clicks before the link itself is deleted.
+const deleteLinkClicksBatchSize = 5000
+
+// ownedLinkID returns the id of the account's link or link.ErrNotFound.
+func (r *LinkRepository) ownedLinkID(ctx context.Context, code string, accountPublicId string) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM links WHERE code = $1 AND account_public_id = $2`, code, accountPublicId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, link.ErrNotFound
+	}
+	return id, err
+}
+
+// DeleteLink records the deletion of the account's link and detaches the link from its code and account,
+// which frees the code at once. Its clicks are purged in bounded batches after the commit, so the link
+// DELETE doesn't cascade into a huge one; what a failed purge leaves is purged by the cleanup worker.
+func (r *LinkRepository) DeleteLink(ctx context.Context, code string, accountPublicId string) error {
+	const markDeleted = `
+		UPDATE links
+		SET code = 'deleted/' || id, account_public_id = NULL, disabled_at = COALESCE(disabled_at, NOW()), deleted_at = NOW()
+		WHERE id = $1
+	`
+	var id int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		row, err := lockOwnedLink(ctx, tx, code, accountPublicId)
+		if err != nil {
+			return err
+		}
+		id = row.id
+
+		if err := insertLinkEvent(ctx, tx, row.id, code, accountPublicId, accountPublicId, link.LinkEventDelete, &row.state, nil); err != nil {
+			return err
+		}
+		if err := notifyLinkChange(ctx, tx, code); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, markDeleted, row.id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := r.purgeDeletedLink(ctx, id); err != nil {
+		log.Printf("[links] failed to purge deleted link id=%d, left to the cleanup worker: %v", id, err)
+	}
+	return nil
+}
+
+// purgeDeletedLink deletes the clicks of a deleted link in bounded batches and then the link.
+func (r *LinkRepository) purgeDeletedLink(ctx context.Context, id int64) error {
+	for {
+		deleted, err := r.DeleteLinkClicks(ctx, []int64{id}, deleteLinkClicksBatchSize)
+		if err != nil {
+			return err
+		}
+		if deleted < deleteLinkClicksBatchSize {
+			break
+		}
+	}
+	_, err := r.PurgeDeletedLinks(ctx, []int64{id})
+	return err
+}
+
+// historyLinkID resolves the link whose history is requested: the account's current link with the code,
+// or else the last deleted link the account had under it. Returns link.ErrNotFound if there is neither.
+func (r *LinkRepository) historyLinkID(ctx context.Context, code string, accountPublicId string) (int64, error) {
+	id, err := r.ownedLinkID(ctx, code, accountPublicId)
+	if !errors.Is(err, link.ErrNotFound) {
+		return id, err
+	}
+
+	const deleted = `
+		SELECT link_id
+		FROM link_events
+		WHERE link_code = $1 AND owner_public_id = $2 AND event_type = 'delete'
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+	err = r.db.QueryRowContext(ctx, deleted, code, accountPublicId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, link.ErrNotFound
+	}
+	return id, err
+}
+
+// GetLinkHistory returns the events of the account's link, oldest first, or link.ErrNotFound.
+// A deleted link's history stays readable until the account creates a new link with the same code.
+func (r *LinkRepository) GetLinkHistory(ctx context.Context, code string, accountPublicId string) ([]link.LinkEvent, error) {
+	const q = `
+		SELECT event_type, actor_public_id::text, old_value, new_value, created_at
+		FROM link_events
+		WHERE link_id = $1
+		ORDER BY created_at, id
+	`
+	id, err := r.historyLinkID(ctx, code, accountPublicId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]link.LinkEvent, 0)
+	for rows.Next() {
+		var (
+			e                link.LinkEvent
+			eventType        string
+			oldJSON, newJSON []byte
+		)
+		if err := rows.Scan(&eventType, &e.ActorPublicId, &oldJSON, &newJSON, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Type = link.LinkEventType(eventType)
+		if e.OldValue, err = unmarshalLinkState(oldJSON); err != nil {
+			return nil, err
+		}
+		if e.NewValue, err = unmarshalLinkState(newJSON); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// linkChangesChannel is the NOTIFY channel for link writes. The payload is the changed short code,
+// or flushAllPayload when changes can't be expressed as a list of codes.
+const (
+	linkChangesChannel = "link_changes"
+	flushAllPayload    = "*"
+)
+
+const (
+	listenerMinReconnectInterval = time.Second
+	listenerMaxReconnectInterval = time.Minute
+	// listenerPingInterval detects a silently dropped connection when there are no notifications.
+	listenerPingInterval = 90 * time.Second
+)
+
+// LinkInvalidator is a local link cache that can evict entries changed on other instances.
+type LinkInvalidator interface {
+	Invalidate(codes ...string)
+	Flush()
+}
+
+// LinkChangeListener evicts local cache entries for links changed by any instance from every target.
+// It LISTENs on the link_changes channel on a dedicated connection, reconnects with backoff
+// and flushes the whole cache after a reconnect, because notifications sent during the gap are lost.
+type LinkChangeListener struct {
+	listener *pq.Listener
+	targets  []LinkInvalidator
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewLinkChangeListener creates a listener on a dedicated connection to dsn.
+func NewLinkChangeListener(dsn string, targets ...LinkInvalidator) *LinkChangeListener {
+	l := &LinkChangeListener{
+		targets: targets,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	l.listener = pq.NewListener(dsn, listenerMinReconnectInterval, listenerMaxReconnectInterval, l.handleEvent)
+	return l
+}
+
+func (l *LinkChangeListener) Start() {
+	go l.run()
+}
+
+// Stop closes the listener connection and blocks until the loop exits.
+func (l *LinkChangeListener) Stop() {
+	close(l.done)
+	if err := l.listener.Close(); err != nil {
+		log.Printf("[link-listener] close failed: %v", err)
+	}
+	<-l.stopped
+}
+
+func (l *LinkChangeListener) run() {
+	defer close(l.stopped)
+
+	// Listen blocks until the connection is established, so it runs here and not in Start.
+	if err := l.listener.Listen(linkChangesChannel); err != nil {
+		select {
+		case <-l.done:
+		default:
+			log.Printf("[link-listener] listen on %s failed: %v", linkChangesChannel, err)
+		}
+		return
+	}
+	log.Printf("[link-listener] listening on %s", linkChangesChannel)
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case n := <-l.listener.Notify:
+			l.handleNotification(n)
+		case <-ticker.C:
+			if err := l.listener.Ping(); err != nil {
+				log.Printf("[link-listener] ping failed: %v", err)
+			}
+		case <-l.done:
+			log.Printf("[link-listener] stopped")
+			return
+		}
+	}
+}
+
+// handleNotification evicts the notified code. A nil notification is sent by pq after a reconnect.
+func (l *LinkChangeListener) handleNotification(n *pq.Notification) {
+	for _, target := range l.targets {
+		if n == nil || n.Extra == flushAllPayload {
+			target.Flush()
+		} else {
+			target.Invalidate(n.Extra)
+		}
+	}
+}
+
+func (l *LinkChangeListener) handleEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		log.Printf("[link-listener] disconnected: %v", err)
+	case pq.ListenerEventReconnected:
+		log.Printf("[link-listener] reconnected, flushing link caches")
+	case pq.ListenerEventConnectionAttemptFailed:
+		log.Printf("[link-listener] connection attempt failed: %v", err)
+	}
+}
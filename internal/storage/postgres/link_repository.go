@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/viacheslaev/url-shortener/internal/feature/link"
@@ -18,12 +19,35 @@ func NewLinkRepository(db *sql.DB) *LinkRepository {
 	return &LinkRepository{db: db}
 }
 
+// CreateShortLink inserts the link and records its creation in the link history.
 func (r *LinkRepository) CreateShortLink(ctx context.Context, shortLink link.ShortLink) error {
 	const query = `
-		INSERT INTO links (code, long_url, expires_at, account_public_id)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO links (code, long_url, expires_at, account_public_id, expiry_action, expiry_fallback_url)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
 	`
-	_, err := r.db.ExecContext(ctx, query, shortLink.Code, shortLink.LongURL, shortLink.ExpiresAt, shortLink.AccountPublicId)
+	action, fallbackURL := expiryBehaviorArgs(shortLink.ExpiryBehavior)
+
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, query, shortLink.Code, shortLink.LongURL, shortLink.ExpiresAt, shortLink.AccountPublicId, action, fallbackURL).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		// The code may be cached as not found on other instances.
+		if err := notifyLinkChange(ctx, tx, shortLink.Code); err != nil {
+			return err
+		}
+
+		state := link.LinkState{
+			LongURL:      shortLink.LongURL,
+			ExpiresAt:    &shortLink.ExpiresAt,
+			ExpiryAction: action.String,
+			FallbackURL:  fallbackURL.String,
+		}
+		return insertLinkEvent(ctx, tx, id, shortLink.Code, shortLink.AccountPublicId, shortLink.AccountPublicId, link.LinkEventCreate, nil, &state)
+	})
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
@@ -32,27 +56,65 @@ func (r *LinkRepository) CreateShortLink(ctx context.Context, shortLink link.Sho
 		return fmt.Errorf("create shortLink failed: %w", err)
 	}
 
-	return err
+	return nil
 }
 
-// GetLongLink returns original URL for the given short code or ErrNotFound if the link does not exist.
+// GetLongLink returns original URL for the given short code or ErrNotFound if the link does not exist or is disabled.
+// Expiry behavior of the link takes precedence over the account one.
 func (r *LinkRepository) GetLongLink(ctx context.Context, code string) (link.LongLink, error) {
 	const query = `
-		SELECT id, long_url, expires_at
-		FROM links
-		WHERE code = $1
+		SELECT l.id, l.long_url, l.expires_at,
+		       COALESCE(l.expiry_action, a.expiry_action),
+		       CASE WHEN l.expiry_action IS NOT NULL THEN l.expiry_fallback_url ELSE a.expiry_fallback_url END
+		FROM links l
+		LEFT JOIN accounts a ON a.public_id = l.account_public_id
+		WHERE l.code = $1
+		  AND l.disabled_at IS NULL
 		`
-	var longLink link.LongLink
-	err := r.db.QueryRowContext(ctx, query, code).Scan(&longLink.Id, &longLink.LongURL, &longLink.ExpiresAt)
+	var (
+		longLink    link.LongLink
+		action      sql.NullString
+		fallbackURL sql.NullString
+	)
+	err := r.db.QueryRowContext(ctx, query, code).Scan(&longLink.Id, &longLink.LongURL, &longLink.ExpiresAt, &action, &fallbackURL)
 	if errors.Is(err, sql.ErrNoRows) {
 		return link.LongLink{}, link.ErrNotFound
 	}
 	if err != nil {
 		return link.LongLink{}, err
 	}
+	if action.Valid {
+		longLink.ExpiryBehavior = &link.ExpiryBehavior{Action: link.ExpiryAction(action.String), FallbackURL: fallbackURL.String}
+	}
 	return longLink, nil
 }
 
+// SetAccountExpiryBehavior stores the account default behavior for expired links; nil clears it.
+func (r *LinkRepository) SetAccountExpiryBehavior(ctx context.Context, accountPublicId string, behavior *link.ExpiryBehavior) error {
+	const q = `
+		UPDATE accounts
+		SET expiry_action = $2, expiry_fallback_url = $3
+		WHERE public_id = $1
+	`
+	action, fallbackURL := expiryBehaviorArgs(behavior)
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, q, accountPublicId, action, fallbackURL); err != nil {
+			return err
+		}
+		// Affects every account link without its own behavior.
+		return notifyLinkChange(ctx, tx, flushAllPayload)
+	})
+}
+
+// expiryBehaviorArgs converts optional behavior to nullable column values.
+func expiryBehaviorArgs(behavior *link.ExpiryBehavior) (sql.NullString, sql.NullString) {
+	if behavior == nil {
+		return sql.NullString{}, sql.NullString{}
+	}
+	return sql.NullString{String: string(behavior.Action), Valid: true},
+		sql.NullString{String: behavior.FallbackURL, Valid: behavior.FallbackURL != ""}
+}
+
 // GetLinkByCodeAndAccountPublicId returns internal link id only if the link belongs to the given account by account_public_id
 func (r *LinkRepository) GetLinkByCodeAndAccountPublicId(ctx context.Context, code string, accountPublicId string) (int64, error) {
 	const query = `
@@ -71,20 +133,308 @@ func (r *LinkRepository) GetLinkByCodeAndAccountPublicId(ctx context.Context, co
 	return id, nil
 }
 
-// DeleteExpiredLinks delete expired links using UTC timezone
-func (r *LinkRepository) DeleteExpiredLinks(ctx context.Context) (int64, error) {
+// ArchiveExpiredLinks marks up to limit expired links as archived using UTC timezone and returns them.
+func (r *LinkRepository) ArchiveExpiredLinks(ctx context.Context, limit int) ([]link.ExpiredLink, error) {
+	const q = `
+		UPDATE links
+		SET archived_at = NOW()
+		WHERE id IN (
+			SELECT id
+			FROM links
+			WHERE expires_at IS NOT NULL
+			  AND expires_at <= NOW()
+			  AND archived_at IS NULL
+			  AND deleted_at IS NULL
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, code, long_url, COALESCE(account_public_id::text, ''), expires_at, archived_at
+	`
+	rows, err := r.db.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]link.ExpiredLink, 0)
+	for rows.Next() {
+		var l link.ExpiredLink
+		if err := rows.Scan(&l.Id, &l.Code, &l.LongURL, &l.AccountPublicId, &l.ExpiresAt, &l.ArchivedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// GetLinksToPurge returns up to limit links archived before the given time, with their click totals.
+func (r *LinkRepository) GetLinksToPurge(ctx context.Context, archivedBefore time.Time, limit int) ([]link.ArchivedLink, error) {
+	const q = `
+		SELECT l.id, l.code, l.long_url, COALESCE(l.account_public_id::text, ''), l.created_at, l.expires_at, l.archived_at,
+		       (SELECT COUNT(*) FROM link_clicks c WHERE c.link_id = l.id)
+		FROM links l
+		WHERE l.archived_at IS NOT NULL
+		  AND l.archived_at <= $1
+		  AND l.deleted_at IS NULL
+		ORDER BY l.id
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, q, archivedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]link.ArchivedLink, 0)
+	for rows.Next() {
+		var a link.ArchivedLink
+		if err := rows.Scan(&a.Id, &a.Code, &a.LongURL, &a.AccountPublicId, &a.CreatedAt, &a.ExpiresAt, &a.ArchivedAt, &a.TotalClicks); err != nil {
+			return nil, err
+		}
+		links = append(links, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// StreamLinkClicks calls fn for every click of the given links without loading them all in memory.
+func (r *LinkRepository) StreamLinkClicks(ctx context.Context, linkIDs []int64, fn func(link.ArchivedClick) error) error {
 	const q = `
-        DELETE FROM links
-        WHERE expires_at IS NOT NULL
-        AND (expires_at AT TIME ZONE 'UTC')::timestamptz <= (NOW() AT TIME ZONE 'UTC')::timestamptz;
-    `
-	res, err := r.db.ExecContext(ctx, q)
+		SELECT link_id, COALESCE(host(ip_address), ''), COALESCE(user_agent, ''), COALESCE(referer, ''), created_at
+		FROM link_clicks
+		WHERE link_id = ANY($1)
+		ORDER BY link_id, created_at
+	`
+	rows, err := r.db.QueryContext(ctx, q, pq.Array(linkIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c link.ArchivedClick
+		if err := rows.Scan(&c.LinkID, &c.IP, &c.UserAgent, &c.Referer, &c.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteLinkClicks deletes up to limit clicks of the given links.
+func (r *LinkRepository) DeleteLinkClicks(ctx context.Context, linkIDs []int64, limit int) (int64, error) {
+	const q = `
+		DELETE FROM link_clicks
+		WHERE id IN (
+			SELECT id
+			FROM link_clicks
+			WHERE link_id = ANY($1)
+			LIMIT $2
+		)
+	`
+	res, err := r.db.ExecContext(ctx, q, pq.Array(linkIDs), limit)
 	if err != nil {
 		return 0, err
 	}
-	rows, err := res.RowsAffected()
+	return res.RowsAffected()
+}
+
+// DeleteLinks hard-deletes archived links by id and records system deletions in the link history.
+func (r *LinkRepository) DeleteLinks(ctx context.Context, linkIDs []int64) (int64, error) {
+	const recordEvents = `
+		INSERT INTO link_events (link_id, link_code, owner_public_id, event_type, old_value)
+		SELECT id, code, account_public_id, 'delete',
+		       jsonb_strip_nulls(jsonb_build_object(
+		           'long_url', long_url,
+		           'expires_at', expires_at,
+		           'expiry_action', expiry_action,
+		           'fallback_url', expiry_fallback_url,
+		           'disabled_at', disabled_at
+		       ))
+		FROM links
+		WHERE id = ANY($1)
+		  AND archived_at IS NOT NULL
+		  AND deleted_at IS NULL
+	`
+	const notifyDeleted = `
+		SELECT pg_notify($2, code)
+		FROM links
+		WHERE id = ANY($1)
+		  AND archived_at IS NOT NULL
+		  AND deleted_at IS NULL
+	`
+	const deleteLinks = `
+		DELETE FROM links
+		WHERE id = ANY($1)
+		  AND archived_at IS NOT NULL
+		  AND deleted_at IS NULL
+	`
+	var deleted int64
+	err := withTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, recordEvents, pq.Array(linkIDs)); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, notifyDeleted, pq.Array(linkIDs), linkChangesChannel); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, deleteLinks, pq.Array(linkIDs))
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	return deleted, err
+}
+
+// GetDeletedLinks returns the ids of up to limit links deleted by their accounts whose clicks weren't purged yet.
+func (r *LinkRepository) GetDeletedLinks(ctx context.Context, limit int) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM links WHERE deleted_at IS NOT NULL ORDER BY deleted_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// PurgeDeletedLinks hard-deletes links deleted by their accounts. Their deletion is already in the link history.
+func (r *LinkRepository) PurgeDeletedLinks(ctx context.Context, linkIDs []int64) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM links WHERE id = ANY($1) AND deleted_at IS NOT NULL`, pq.Array(linkIDs))
 	if err != nil {
 		return 0, err
 	}
-	return rows, nil
+	return res.RowsAffected()
+}
+
+// GetLinksDueForHealthCheck returns active links that were never checked or whose next check is due.
+func (r *LinkRepository) GetLinksDueForHealthCheck(ctx context.Context, limit int) ([]link.HealthCheckTarget, error) {
+	const q = `
+		SELECT l.id, l.code, COALESCE(l.account_public_id::text, ''), l.long_url,
+		       COALESCE(h.consecutive_failures, 0), COALESCE(h.is_broken, false)
+		FROM links l
+		LEFT JOIN link_health h ON h.link_id = l.id
+		WHERE (l.expires_at IS NULL OR l.expires_at > NOW())
+		  AND l.disabled_at IS NULL
+		  AND (h.next_check_at IS NULL OR h.next_check_at <= NOW())
+		ORDER BY h.next_check_at NULLS FIRST
+		LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := make([]link.HealthCheckTarget, 0)
+	for rows.Next() {
+		var t link.HealthCheckTarget
+		if err := rows.Scan(&t.LinkID, &t.Code, &t.AccountPublicId, &t.LongURL, &t.ConsecutiveFailures, &t.IsBroken); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// SaveHealthCheckResult upserts the latest check result; last_success_at is kept when the check failed.
+func (r *LinkRepository) SaveHealthCheckResult(ctx context.Context, res link.HealthCheckResult) error {
+	const q = `
+		INSERT INTO link_health (
+			link_id, status_code, latency_ms, failure_reason, is_broken,
+			consecutive_failures, last_checked_at, last_success_at, next_check_at
+		)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+		ON CONFLICT (link_id) DO UPDATE SET
+			status_code          = EXCLUDED.status_code,
+			latency_ms           = EXCLUDED.latency_ms,
+			failure_reason       = EXCLUDED.failure_reason,
+			is_broken            = EXCLUDED.is_broken,
+			consecutive_failures = EXCLUDED.consecutive_failures,
+			last_checked_at      = EXCLUDED.last_checked_at,
+			last_success_at      = COALESCE(EXCLUDED.last_success_at, link_health.last_success_at),
+			next_check_at        = EXCLUDED.next_check_at
+	`
+	_, err := r.db.ExecContext(ctx, q,
+		res.LinkID,
+		res.StatusCode,
+		res.Latency.Milliseconds(),
+		res.FailureReason,
+		res.IsBroken,
+		res.ConsecutiveFailures,
+		res.CheckedAt,
+		res.LastSuccessAt,
+		res.NextCheckAt,
+	)
+	if err != nil {
+		// The link may have been deleted while it was being checked.
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgForeignKeyViolation {
+			return nil
+		}
+		return fmt.Errorf("save health check result failed: %w", err)
+	}
+	return nil
+}
+
+// GetBrokenLinks returns the account's links flagged as broken by the last health check.
+func (r *LinkRepository) GetBrokenLinks(ctx context.Context, accountPublicId string) ([]link.BrokenLink, error) {
+	const q = `
+		SELECT l.code, l.long_url, h.status_code, h.latency_ms, COALESCE(h.failure_reason, ''),
+		       h.consecutive_failures, h.last_checked_at, h.last_success_at
+		FROM link_health h
+		JOIN links l ON l.id = h.link_id
+		WHERE l.account_public_id = $1
+		  AND h.is_broken
+		ORDER BY h.last_checked_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, q, accountPublicId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]link.BrokenLink, 0)
+	for rows.Next() {
+		var (
+			b         link.BrokenLink
+			status    sql.NullInt32
+			latencyMs int64
+		)
+		if err := rows.Scan(&b.Code, &b.LongURL, &status, &latencyMs, &b.FailureReason,
+			&b.ConsecutiveFailures, &b.LastCheckedAt, &b.LastSuccessAt); err != nil {
+			return nil, err
+		}
+		if status.Valid {
+			code := int(status.Int32)
+			b.StatusCode = &code
+		}
+		b.Latency = time.Duration(latencyMs) * time.Millisecond
+		links = append(links, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
 }
@@ -64,3 +64,18 @@ func DisconnectDB(db *sql.DB) {
 
 	log.Printf("postgres disconnected")
 }
+
+// withTx runs fn in a transaction, committing on success and rolling back on error.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// GetOrCreateIPSalt stores candidate as the salt of a day unless another replica stored one first,
+// and returns the salt in effect.
+func (r *AnalyticsRepository) GetOrCreateIPSalt(ctx context.Context, day time.Time, candidate []byte) ([]byte, error) {
+	const q = `
+		WITH inserted AS (
+			INSERT INTO ip_hash_salts (day, salt)
+			VALUES ($1, $2)
+			ON CONFLICT (day) DO NOTHING
+			RETURNING salt
+		)
+		SELECT salt FROM inserted
+		UNION ALL
+		SELECT salt FROM ip_hash_salts WHERE day = $1
+		LIMIT 1
+	`
+	var salt []byte
+	err := r.db.QueryRowContext(ctx, q, day.UTC().Format(time.DateOnly), candidate).Scan(&salt)
+	return salt, err
+}
+
+// DeleteIPSaltsBefore deletes the salts of days before day.
+func (r *AnalyticsRepository) DeleteIPSaltsBefore(ctx context.Context, day time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM ip_hash_salts WHERE day < $1`, day.UTC().Format(time.DateOnly))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// AnonymizeClicksBefore clears the personal fields of a batch of clicks, found through the partial
+// index of clicks that still have some.
+func (r *AnalyticsRepository) AnonymizeClicksBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		UPDATE link_clicks
+		SET ip_address = NULL,
+		    user_agent = NULL,
+		    referer    = NULL,
+		    visitor_id = NULL,
+		    click_id   = NULL
+		WHERE (id, created_at) IN (
+			SELECT id, created_at
+			FROM link_clicks
+			WHERE created_at < $1
+			  AND (ip_address IS NOT NULL OR user_agent IS NOT NULL OR referer IS NOT NULL OR visitor_id IS NOT NULL
+			       OR click_id IS NOT NULL)
+			LIMIT $2
+		)
+	`
+	res, err := r.db.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteClicksBefore deletes a batch of clicks before a time. Their rollups are kept.
+func (r *AnalyticsRepository) DeleteClicksBefore(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM link_clicks
+		WHERE (id, created_at) IN (
+			SELECT id, created_at
+			FROM link_clicks
+			WHERE created_at < $1
+			LIMIT $2
+		)
+	`
+	res, err := r.db.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteVisitorsNotSeenSince deletes a batch of visitors whose last click is before a time.
+func (r *AnalyticsRepository) DeleteVisitorsNotSeenSince(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM link_visitors
+		WHERE (link_id, visitor_id, traffic_type) IN (
+			SELECT link_id, visitor_id, traffic_type
+			FROM link_visitors
+			WHERE last_seen_at < $1
+			LIMIT $2
+		)
+	`
+	res, err := r.db.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/viacheslaev/url-shortener/internal/feature/analytics"
+)
+
+// recordVisitors upserts the first and last click of the clicks' visitors. Rows are locked in key order,
+// so concurrent batches of overlapping visitors can't deadlock.
+func recordVisitors(ctx context.Context, tx *sql.Tx, clicks []analytics.Click) error {
+	var (
+		linkIDs      []int64
+		visitorIDs   []string
+		trafficTypes []string
+		createdAt    []string
+	)
+	for _, c := range clicks {
+		if c.VisitorID == "" {
+			continue
+		}
+		linkIDs = append(linkIDs, c.LinkID)
+		visitorIDs = append(visitorIDs, c.VisitorID)
+		trafficTypes = append(trafficTypes, trafficType(c.TrafficType))
+		createdAt = append(createdAt, c.CreatedAt.Format(time.RFC3339Nano))
+	}
+	if len(linkIDs) == 0 {
+		return nil
+	}
+
+	const q = `
+		INSERT INTO link_visitors (link_id, visitor_id, traffic_type, first_seen_at, last_seen_at)
+		SELECT v.link_id, v.visitor_id, v.traffic_type, MIN(v.created_at), MAX(v.created_at)
+		FROM unnest($1::bigint[], $2::text[], $3::text[], $4::timestamptz[])
+		     AS v(link_id, visitor_id, traffic_type, created_at)
+		WHERE EXISTS (SELECT 1 FROM links l WHERE l.id = v.link_id)
+		GROUP BY v.link_id, v.visitor_id, v.traffic_type
+		ORDER BY v.link_id, v.visitor_id, v.traffic_type
+		ON CONFLICT (link_id, visitor_id, traffic_type) DO UPDATE
+		SET first_seen_at = LEAST(link_visitors.first_seen_at, EXCLUDED.first_seen_at),
+		    last_seen_at  = GREATEST(link_visitors.last_seen_at, EXCLUDED.last_seen_at)
+	`
+	_, err := tx.ExecContext(ctx, q, pq.Array(linkIDs), pq.Array(visitorIDs), pq.Array(trafficTypes), pq.Array(createdAt))
+	return err
+}
+
+// firstTimeVisitors counts the visitors of a scope whose first click falls in [from, to). For an account
+// that's the first click on any of its links. Visitors forgotten by the personal data retention count again.
+func (r *AnalyticsRepository) firstTimeVisitors(ctx context.Context, scope analytics.ClickScope, from, to time.Time, includeBots bool) (int64, error) {
+	scopeCond, scopeArg := scopeFilter(scope)
+	q := `
+		SELECT COUNT(*)
+		FROM (
+			SELECT visitor_id
+			FROM link_visitors
+			WHERE ` + scopeCond + `
+			  AND ($4 OR traffic_type = 'human')
+			GROUP BY visitor_id
+			HAVING MIN(first_seen_at) >= $2
+			   AND MIN(first_seen_at) < $3
+		) v
+	`
+	if scope.AccountPublicID == "" {
+		// One link: its index finds the visitors first seen in the range without grouping the others.
+		q = `
+			SELECT COUNT(DISTINCT visitor_id)
+			FROM link_visitors
+			WHERE ` + scopeCond + `
+			  AND first_seen_at >= $2
+			  AND first_seen_at < $3
+			  AND ($4 OR traffic_type = 'human')
+		`
+	}
+
+	var n int64
+	err := r.db.QueryRowContext(ctx, q, scopeArg, from, to, includeBots).Scan(&n)
+	return n, err
+}
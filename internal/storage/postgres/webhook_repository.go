@@ -0,0 +1,373 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/viacheslaev/url-shortener/internal/feature/webhook"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// CreateEndpoint inserts the endpoint and returns it with its public id.
+func (r *WebhookRepository) CreateEndpoint(ctx context.Context, endpoint webhook.Endpoint) (webhook.Endpoint, error) {
+	const q = `
+		INSERT INTO webhook_endpoints (account_public_id, url, secret, events, click_sample_rate)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, public_id, created_at
+	`
+	err := r.db.QueryRowContext(ctx, q,
+		endpoint.AccountPublicId,
+		endpoint.URL,
+		endpoint.Secret,
+		pq.Array(eventTypeStrings(endpoint.Events)),
+		endpoint.ClickSampleRate,
+	).Scan(&endpoint.Id, &endpoint.PublicId, &endpoint.CreatedAt)
+	if err != nil {
+		return webhook.Endpoint{}, err
+	}
+	return endpoint, nil
+}
+
+// GetEndpoints returns the account's endpoints, oldest first, without their secrets.
+func (r *WebhookRepository) GetEndpoints(ctx context.Context, accountPublicId string) ([]webhook.Endpoint, error) {
+	const q = `
+		SELECT id, public_id, url, events, click_sample_rate, created_at
+		FROM webhook_endpoints
+		WHERE account_public_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, q, accountPublicId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := make([]webhook.Endpoint, 0)
+	for rows.Next() {
+		var (
+			e      = webhook.Endpoint{AccountPublicId: accountPublicId}
+			events []string
+		)
+		if err := rows.Scan(&e.Id, &e.PublicId, &e.URL, pq.Array(&events), &e.ClickSampleRate, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, ev := range events {
+			e.Events = append(e.Events, webhook.EventType(ev))
+		}
+		endpoints = append(endpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// DeleteEndpoint deletes the account's endpoint; its deliveries are deleted by cascade.
+func (r *WebhookRepository) DeleteEndpoint(ctx context.Context, publicId string, accountPublicId string) error {
+	const q = `DELETE FROM webhook_endpoints WHERE public_id = $1 AND account_public_id = $2`
+	res, err := r.db.ExecContext(ctx, q, publicId, accountPublicId)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return webhook.ErrNotFound
+	}
+	return nil
+}
+
+// GetDeliveries returns a page of the delivery log of the account's endpoint, newest first.
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, endpointPublicId string, accountPublicId string, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	endpointId, err := r.endpointId(ctx, endpointPublicId, accountPublicId)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+		SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+		       last_attempt_at, last_status_code, COALESCE(last_error, ''), created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		  AND ($2::text = '' OR status = $2::text)
+		  AND ($3::bigint = 0 OR id < $3::bigint)
+		ORDER BY id DESC
+		LIMIT $4
+	`
+	rows, err := r.db.QueryContext(ctx, q, endpointId, string(filter.Status), filter.Before, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]webhook.Delivery, 0)
+	for rows.Next() {
+		var (
+			d          webhook.Delivery
+			statusCode sql.NullInt32
+		)
+		err := rows.Scan(&d.Id, &d.EndpointId, &d.EventId, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastAttemptAt, &statusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int32)
+			d.LastStatusCode = &code
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RetryDelivery makes a finished delivery of the account's endpoint due again with a fresh set of attempts.
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, endpointPublicId string, accountPublicId string, deliveryId int64) error {
+	endpointId, err := r.endpointId(ctx, endpointPublicId, accountPublicId)
+	if err != nil {
+		return err
+	}
+
+	const q = `
+		WITH target AS (
+			SELECT id, status
+			FROM webhook_deliveries
+			WHERE id = $1
+			  AND endpoint_id = $2
+			FOR UPDATE
+		), retried AS (
+			UPDATE webhook_deliveries d
+			SET status          = 'pending',
+			    attempts        = 0,
+			    next_attempt_at = NOW(),
+			    delivered_at    = NULL
+			FROM target t
+			WHERE d.id = t.id
+			  AND t.status <> 'pending'
+		)
+		SELECT status FROM target
+	`
+	var status webhook.DeliveryStatus
+	err = r.db.QueryRowContext(ctx, q, deliveryId, endpointId).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return webhook.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == webhook.DeliveryPending {
+		return webhook.ErrDeliveryPending
+	}
+	return nil
+}
+
+func (r *WebhookRepository) endpointId(ctx context.Context, publicId string, accountPublicId string) (int64, error) {
+	const q = `SELECT id FROM webhook_endpoints WHERE public_id = $1 AND account_public_id = $2`
+	var id int64
+	err := r.db.QueryRowContext(ctx, q, publicId, accountPublicId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, webhook.ErrNotFound
+	}
+	return id, err
+}
+
+// EnqueueEvents inserts a delivery of every event for each endpoint of its account subscribed to its type.
+// Events already queued for an endpoint are skipped.
+func (r *WebhookRepository) EnqueueEvents(ctx context.Context, events []webhook.AccountEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	accountIds := make([]string, 0, len(events))
+	eventTypes := make([]string, 0, len(events))
+	eventIds := make([]string, 0, len(events))
+	payloads := make([]string, 0, len(events))
+	for _, e := range events {
+		accountIds = append(accountIds, e.AccountPublicId)
+		eventTypes = append(eventTypes, string(e.Type))
+		eventIds = append(eventIds, e.Id)
+		payloads = append(payloads, string(e.Payload))
+	}
+
+	const q = `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT e.id, v.event_id::uuid, v.event_type, v.payload::jsonb
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[])
+		     AS v(account_public_id, event_type, event_id, payload)
+		JOIN webhook_endpoints e
+		  ON e.account_public_id = v.account_public_id::uuid
+		 AND v.event_type = ANY (e.events)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, q, pq.Array(accountIds), pq.Array(eventTypes), pq.Array(eventIds), pq.Array(payloads))
+	if err != nil {
+		return fmt.Errorf("enqueue webhook events failed: %w", err)
+	}
+	return nil
+}
+
+// GetClickSubscriptions returns the endpoints subscribed to link.clicked of the accounts owning the links.
+func (r *WebhookRepository) GetClickSubscriptions(ctx context.Context, linkIDs []int64) ([]webhook.ClickSubscription, error) {
+	const q = `
+		SELECT e.id, l.id, l.code, e.click_sample_rate
+		FROM links l
+		JOIN webhook_endpoints e ON e.account_public_id = l.account_public_id
+		WHERE l.id = ANY ($1)
+		  AND $2 = ANY (e.events)
+	`
+	rows, err := r.db.QueryContext(ctx, q, pq.Array(linkIDs), string(webhook.EventLinkClicked))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]webhook.ClickSubscription, 0)
+	for rows.Next() {
+		var s webhook.ClickSubscription
+		if err := rows.Scan(&s.EndpointId, &s.LinkID, &s.Code, &s.SampleRate); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// EnqueueDeliveries inserts the deliveries. Deliveries of endpoints deleted meanwhile and events
+// already queued for the endpoint are skipped.
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, deliveries []webhook.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	endpointIds := make([]int64, 0, len(deliveries))
+	eventIds := make([]string, 0, len(deliveries))
+	eventTypes := make([]string, 0, len(deliveries))
+	payloads := make([]string, 0, len(deliveries))
+	for _, d := range deliveries {
+		endpointIds = append(endpointIds, d.EndpointId)
+		eventIds = append(eventIds, d.EventId)
+		eventTypes = append(eventTypes, string(d.EventType))
+		payloads = append(payloads, string(d.Payload))
+	}
+
+	const q = `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT v.endpoint_id, v.event_id::uuid, v.event_type, v.payload::jsonb
+		FROM unnest($1::bigint[], $2::text[], $3::text[], $4::text[])
+		     AS v(endpoint_id, event_id, event_type, payload)
+		WHERE EXISTS (SELECT 1 FROM webhook_endpoints e WHERE e.id = v.endpoint_id)
+		ON CONFLICT (endpoint_id, event_id) DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, q, pq.Array(endpointIds), pq.Array(eventIds), pq.Array(eventTypes), pq.Array(payloads))
+	if err != nil {
+		return fmt.Errorf("enqueue webhook deliveries failed: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries postpones up to limit due deliveries by lease and returns them with their endpoints.
+// SKIP LOCKED lets the workers of several instances claim different deliveries.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.DueDelivery, error) {
+	const q = `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM webhook_endpoints e
+		WHERE d.id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending'
+			  AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		  AND e.id = d.endpoint_id
+		RETURNING d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+		          d.next_attempt_at, d.created_at, e.url, e.secret
+	`
+	rows, err := r.db.QueryContext(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]webhook.DueDelivery, 0)
+	for rows.Next() {
+		var d webhook.DueDelivery
+		err := rows.Scan(&d.Id, &d.EndpointId, &d.EventId, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// SaveDeliveryAttempt stores the state of a delivery after an attempt.
+func (r *WebhookRepository) SaveDeliveryAttempt(ctx context.Context, d webhook.Delivery) error {
+	const q = `
+		UPDATE webhook_deliveries
+		SET status           = $2,
+		    attempts         = $3,
+		    next_attempt_at  = $4,
+		    last_attempt_at  = $5,
+		    last_status_code = $6,
+		    last_error       = NULLIF($7, ''),
+		    delivered_at     = $8
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, q, d.Id, string(d.Status), d.Attempts, d.NextAttemptAt, d.LastAttemptAt, d.LastStatusCode, d.LastError, d.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("save webhook delivery attempt failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteFinishedDeliveries deletes a batch of delivered and dead deliveries created before a time.
+func (r *WebhookRepository) DeleteFinishedDeliveries(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM webhook_deliveries
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE created_at < $1
+			  AND status <> 'pending'
+			LIMIT $2
+		)
+	`
+	res, err := r.db.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func eventTypeStrings(events []webhook.EventType) []string {
+	s := make([]string, 0, len(events))
+	for _, e := range events {
+		s = append(s, string(e))
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+// Package useragent classifies HTTP clients by their User-Agent and request headers.
+package useragent
+
+import (
+	"net/http"
+	"strings"
+)
+
+// botPatterns are lowercase User-Agent fragments of link unfurlers, crawlers and HTTP tools.
+// Keep the list grouped and add new entries next to similar clients.
+var botPatterns = []string{
+	// Chat and social link previews. iMessage sends "facebookexternalhit ... Twitterbot".
+	"slackbot",
+	"slack-imgproxy",
+	"twitterbot",
+	"facebookexternalhit",
+	"facebot",
+	"linkedinbot",
+	"whatsapp",
+	"telegrambot",
+	"discordbot",
+	"skypeuripreview",
+	"microsoftpreview",
+	"redditbot",
+	"embedly",
+	"iframely",
+	"mastodon",
+	"cardyb",
+	"vkshare",
+	"line-poker",
+
+	// Search engines and crawlers.
+	"googlebot",
+	"google-inspectiontool",
+	"adsbot-google",
+	"mediapartners-google",
+	"bingbot",
+	"bingpreview",
+	"yandex",
+	"baiduspider",
+	"duckduckbot",
+	"applebot",
+	"petalbot",
+	"ahrefsbot",
+	"semrushbot",
+	"mj12bot",
+	"dotbot",
+	"gptbot",
+	"chatgpt-user",
+	"claudebot",
+	"perplexitybot",
+	"ccbot",
+
+	// Monitoring, security scanners and HTTP libraries.
+	"url-shortener-health-check",
+	"uptimerobot",
+	"pingdom",
+	"headlesschrome",
+	"phantomjs",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"python-urllib",
+	"aiohttp",
+	"go-http-client",
+	"okhttp",
+	"java/",
+	"apache-httpclient",
+	"libwww-perl",
+	"node-fetch",
+	"axios/",
+}
+
+// genericBotSuffixes end the product names of unlisted automated clients, e.g. "ExampleBot/1.0".
+// They are matched on product tokens only: a device model like "CUBOT X30" is not a product.
+var genericBotSuffixes = []string{"bot", "crawler", "spider", "preview", "fetcher"}
+
+// genericBotWords mark automated clients as whole words, e.g. "(compatible; Example Crawler; +https://example.com/bot.html)".
+var genericBotWords = map[string]bool{
+	"bot":     true,
+	"robot":   true,
+	"crawler": true,
+	"spider":  true,
+}
+
+// IsBot reports whether the User-Agent belongs to an automated client.
+// An empty User-Agent is treated as a bot: real browsers always send one.
+func IsBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+
+	for _, pattern := range botPatterns {
+		if strings.Contains(ua, pattern) {
+			return true
+		}
+	}
+	return hasGenericBotProduct(ua) || hasGenericBotWord(ua)
+}
+
+// hasGenericBotProduct reports whether a product token ("name/version") has a bot-like name.
+func hasGenericBotProduct(ua string) bool {
+	for _, token := range strings.Fields(ua) {
+		name, _, ok := strings.Cut(token, "/")
+		if !ok {
+			continue
+		}
+		name = strings.TrimLeft(name, "(;,+")
+		for _, suffix := range genericBotSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasGenericBotWord(ua string) bool {
+	words := strings.FieldsFunc(ua, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	for _, word := range words {
+		if genericBotWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrefetch reports whether the request was issued speculatively by the browser
+// (link prefetch or prerender) rather than by the user following the link.
+func IsPrefetch(header http.Header) bool {
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(header.Get(name))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package useragent
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsBot(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", false},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", false},
+		{"Mozilla/5.0 (Android 14; Mobile; rv:127.0) Gecko/127.0 Firefox/127.0", false},
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Twitterbot/1.0", true},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", true},
+		{"TelegramBot (like TwitterBot)", true},
+		{"WhatsApp/2.23.20.0", true},
+		{"LinkedInBot/1.0 (compatible; Mozilla/5.0; Apache-HttpClient +http://www.linkedin.com)", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", true},
+		{"curl/8.4.0", true},
+		{"python-requests/2.31.0", true},
+		{"url-shortener-health-check/1.0", true},
+		{"Mozilla/5.0 (compatible; ExampleCrawler/1.2; +https://example.com/crawler)", true},
+		{"Mozilla/5.0 (compatible; +https://example.com/bot.html)", true},
+		{"Example Spider (https://example.com)", true},
+		{"Mozilla/5.0 (Linux; Android 10; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", false},
+		{"Mozilla/5.0 (Linux; Android 12; CUBOT KINGKONG 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36", false},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0 Preview", false},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		if got := IsBot(tt.userAgent); got != tt.want {
+			t.Errorf("IsBot(%q) = %t, want %t", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestIsPrefetch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{name: "no headers", header: http.Header{}, want: false},
+		{name: "chrome speculation rules", header: http.Header{"Sec-Purpose": {"prefetch;prerender"}}, want: true},
+		{name: "chrome link prefetch", header: http.Header{"Sec-Purpose": {"prefetch"}}, want: true},
+		{name: "legacy purpose", header: http.Header{"Purpose": {"prefetch"}}, want: true},
+		{name: "firefox", header: http.Header{"X-Moz": {"prefetch"}}, want: true},
+		{name: "safari preview", header: http.Header{"X-Purpose": {"preview"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPrefetch(tt.header); got != tt.want {
+				t.Fatalf("IsPrefetch() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package useragent
+
+import "strings"
+
+// Device classes.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Other is the family of browsers and operating systems the parser doesn't recognize.
+const Other = "Other"
+
+// Agent is a parsed User-Agent reduced to the families used in analytics breakdowns.
+type Agent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// browserRule maps User-Agent tokens to a browser family. A rule matches when the UA contains
+// any of its tokens and none of its excludes. Rules are checked in order, so browsers built
+// on Chromium or WebKit come before Chrome and Safari, whose tokens they repeat.
+type browserRule struct {
+	family   string
+	tokens   []string
+	excludes []string
+}
+
+var browserRules = []browserRule{
+	// In-app browsers.
+	{family: "Facebook", tokens: []string{"fban/", "fbav/", "fb_iab/"}},
+	{family: "Instagram", tokens: []string{"instagram "}},
+	{family: "TikTok", tokens: []string{"musical_ly", "bytedancewebview"}},
+	{family: "Line", tokens: []string{" line/"}},
+
+	// Chromium and WebKit based.
+	{family: "Edge", tokens: []string{"edg/", "edga/", "edgios/", "edge/"}},
+	{family: "Opera", tokens: []string{"opr/", "opera", "opios/", "opt/"}},
+	{family: "Samsung Internet", tokens: []string{"samsungbrowser/"}},
+	{family: "Yandex Browser", tokens: []string{"yabrowser/"}},
+	{family: "UC Browser", tokens: []string{"ucbrowser/", "ucweb"}},
+	{family: "Vivaldi", tokens: []string{"vivaldi/"}},
+	{family: "DuckDuckGo", tokens: []string{"ddg/", "duckduckgo/"}},
+	{family: "Amazon Silk", tokens: []string{"silk/"}},
+	{family: "Android WebView", tokens: []string{"; wv)"}},
+
+	{family: "Firefox", tokens: []string{"firefox/", "fxios/"}, excludes: []string{"seamonkey/"}},
+	{family: "Chrome", tokens: []string{"chrome/", "crios/", "chromium/"}},
+	{family: "Safari", tokens: []string{"safari/"}, excludes: []string{"android"}},
+	{family: "Internet Explorer", tokens: []string{"msie ", "trident/"}},
+}
+
+// osRule maps User-Agent tokens to an OS family. Order matters: iOS UAs contain "like Mac OS X",
+// Windows Phone UAs contain "Android", Android UAs contain "Linux".
+type osRule struct {
+	family string
+	tokens []string
+}
+
+var osRules = []osRule{
+	{family: "Windows Phone", tokens: []string{"windows phone", "windows mobile"}},
+	{family: "Windows", tokens: []string{"windows nt", "windows 10", "win64", "win32"}},
+	{family: "iOS", tokens: []string{"iphone", "ipad", "ipod"}},
+	{family: "macOS", tokens: []string{"macintosh", "mac os x"}},
+	{family: "Android", tokens: []string{"android"}},
+	{family: "Chrome OS", tokens: []string{"cros "}},
+	{family: "Linux", tokens: []string{"linux", "x11", "ubuntu", "fedora"}},
+}
+
+var (
+	tabletTokens = []string{"ipad", "tablet", "kindle", "silk/", "playbook", "nexus 7", "nexus 10", "sm-t"}
+	mobileTokens = []string{"mobi", "iphone", "ipod", "windows phone", "blackberry", "opera mini", "opios/"}
+)
+
+// Parse classifies a User-Agent. Bots (see IsBot) get DeviceBot; the browser and OS are still
+// reported when recognizable.
+func Parse(userAgent string) Agent {
+	ua := strings.ToLower(userAgent)
+
+	agent := Agent{
+		Browser: matchBrowser(ua),
+		OS:      matchOS(ua),
+	}
+
+	switch {
+	case IsBot(userAgent):
+		agent.Device = DeviceBot
+	case containsAny(ua, tabletTokens) || (strings.Contains(ua, "android") && !strings.Contains(ua, "mobi")):
+		// Android tablets are Android without the "Mobile" token.
+		agent.Device = DeviceTablet
+	case containsAny(ua, mobileTokens):
+		agent.Device = DeviceMobile
+	default:
+		agent.Device = DeviceDesktop
+	}
+
+	return agent
+}
+
+func matchBrowser(ua string) string {
+	for _, rule := range browserRules {
+		if containsAny(ua, rule.tokens) && !containsAny(ua, rule.excludes) {
+			return rule.family
+		}
+	}
+	return Other
+}
+
+func matchOS(ua string) string {
+	for _, rule := range osRules {
+		if containsAny(ua, rule.tokens) {
+			return rule.family
+		}
+	}
+	return Other
+}
+
+func containsAny(s string, tokens []string) bool {
+	for _, token := range tokens {
+		if strings.Contains(s, token) {
+			return true
+		}
+	}
+	return false
+}
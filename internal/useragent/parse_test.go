@@ -0,0 +1,187 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      Agent
+	}{
+		// Desktop.
+		{
+			name:      "chrome windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want:      Agent{Browser: "Chrome", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "edge windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.2592.87",
+			want:      Agent{Browser: "Edge", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "firefox windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want:      Agent{Browser: "Firefox", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "internet explorer 11",
+			userAgent: "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			want:      Agent{Browser: "Internet Explorer", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "safari macos",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+			want:      Agent{Browser: "Safari", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			name:      "chrome macos",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want:      Agent{Browser: "Chrome", OS: "macOS", Device: DeviceDesktop},
+		},
+		{
+			name:      "opera windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36 OPR/111.0.0.0",
+			want:      Agent{Browser: "Opera", OS: "Windows", Device: DeviceDesktop},
+		},
+		{
+			name:      "vivaldi linux",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Vivaldi/6.8.3381.46",
+			want:      Agent{Browser: "Vivaldi", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			name:      "firefox ubuntu",
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want:      Agent{Browser: "Firefox", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			name:      "chrome os",
+			userAgent: "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want:      Agent{Browser: "Chrome", OS: "Chrome OS", Device: DeviceDesktop},
+		},
+		{
+			name:      "yandex browser",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 YaBrowser/24.4.0.0 Safari/537.36",
+			want:      Agent{Browser: "Yandex Browser", OS: "Windows", Device: DeviceDesktop},
+		},
+
+		// Mobile.
+		{
+			name:      "safari iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want:      Agent{Browser: "Safari", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "chrome iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0.6478.54 Mobile/15E148 Safari/604.1",
+			want:      Agent{Browser: "Chrome", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "firefox iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/127.0 Mobile/15E148 Safari/605.1.15",
+			want:      Agent{Browser: "Firefox", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "edge iphone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 EdgiOS/126.2592.86 Mobile/15E148 Safari/605.1.15",
+			want:      Agent{Browser: "Edge", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "chrome android",
+			userAgent: "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+			want:      Agent{Browser: "Chrome", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "samsung internet",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0.0.0 Mobile Safari/537.36",
+			want:      Agent{Browser: "Samsung Internet", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "firefox android",
+			userAgent: "Mozilla/5.0 (Android 14; Mobile; rv:127.0) Gecko/127.0 Firefox/127.0",
+			want:      Agent{Browser: "Firefox", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "android webview",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; Pixel 7 Build/TQ3A.230805.001; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/126.0.6478.71 Mobile Safari/537.36",
+			want:      Agent{Browser: "Android WebView", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "facebook in-app ios",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/470.0.0.38.108;FBBV/611066958;FBDV/iPhone15,2;FBMD/iPhone;FBSN/iOS;FBSV/17.5;FBSS/3;FBCR/;FBID/phone;FBLC/en_US;FBOP/80]",
+			want:      Agent{Browser: "Facebook", OS: "iOS", Device: DeviceMobile},
+		},
+		{
+			name:      "instagram in-app android",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-A536B Build/TP1A.220624.014; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/126.0.6478.71 Mobile Safari/537.36 Instagram 337.0.0.35.102 Android",
+			want:      Agent{Browser: "Instagram", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			name:      "opera mini",
+			userAgent: "Opera/9.80 (J2ME/MIDP; Opera Mini/9.80 (S60; SymbOS; Opera Mobi/23.348; U; en) Presto/2.5.25 Version/10.54",
+			want:      Agent{Browser: "Opera", OS: Other, Device: DeviceMobile},
+		},
+		{
+			name:      "windows phone",
+			userAgent: "Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063",
+			want:      Agent{Browser: "Edge", OS: "Windows Phone", Device: DeviceMobile},
+		},
+
+		// Tablets.
+		{
+			name:      "safari ipad",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want:      Agent{Browser: "Safari", OS: "iOS", Device: DeviceTablet},
+		},
+		{
+			name:      "chrome android tablet",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X200) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want:      Agent{Browser: "Chrome", OS: "Android", Device: DeviceTablet},
+		},
+		{
+			name:      "kindle fire silk",
+			userAgent: "Mozilla/5.0 (Linux; Android 9; KFMAWI) AppleWebKit/537.36 (KHTML, like Gecko) Silk/126.3.1 like Chrome/126.0.6478.71 Safari/537.36",
+			want:      Agent{Browser: "Amazon Silk", OS: "Android", Device: DeviceTablet},
+		},
+		{
+			name:      "firefox android tablet",
+			userAgent: "Mozilla/5.0 (Android 14; Tablet; rv:127.0) Gecko/127.0 Firefox/127.0",
+			want:      Agent{Browser: "Firefox", OS: "Android", Device: DeviceTablet},
+		},
+
+		// Bots.
+		{
+			name:      "googlebot",
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot},
+		},
+		{
+			name:      "googlebot smartphone",
+			userAgent: "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.6478.126 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want:      Agent{Browser: "Chrome", OS: "Android", Device: DeviceBot},
+		},
+		{
+			name:      "slackbot",
+			userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot},
+		},
+		{
+			name:      "curl",
+			userAgent: "curl/8.4.0",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot},
+		},
+		{
+			name:      "empty",
+			userAgent: "",
+			want:      Agent{Browser: Other, OS: Other, Device: DeviceBot},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.userAgent); got != tt.want {
+				t.Fatalf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
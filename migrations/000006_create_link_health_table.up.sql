@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS link_health (
+    link_id              BIGINT PRIMARY KEY REFERENCES links(id) ON DELETE CASCADE,
+    status_code          INT,
+    latency_ms           BIGINT      NOT NULL DEFAULT 0,
+    failure_reason       TEXT,
+    is_broken            BOOLEAN     NOT NULL DEFAULT false,
+    consecutive_failures INT         NOT NULL DEFAULT 0,
+    last_checked_at      TIMESTAMPTZ NOT NULL,
+    last_success_at      TIMESTAMPTZ,
+    next_check_at        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_health_next_check_at ON link_health (next_check_at);
+CREATE INDEX IF NOT EXISTS idx_link_health_broken ON link_health (link_id) WHERE is_broken;
@@ -0,0 +1,13 @@
+ALTER TABLE accounts
+    DROP CONSTRAINT IF EXISTS accounts_expiry_action_check;
+
+ALTER TABLE accounts
+    DROP COLUMN IF EXISTS expiry_fallback_url,
+    DROP COLUMN IF EXISTS expiry_action;
+
+ALTER TABLE links
+    DROP CONSTRAINT IF EXISTS links_expiry_action_check;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS expiry_fallback_url,
+    DROP COLUMN IF EXISTS expiry_action;
@@ -0,0 +1,15 @@
+ALTER TABLE links
+    ADD COLUMN IF NOT EXISTS expiry_action TEXT,
+    ADD COLUMN IF NOT EXISTS expiry_fallback_url TEXT;
+
+ALTER TABLE links
+    ADD CONSTRAINT links_expiry_action_check
+        CHECK (expiry_action IN ('json', 'html', 'redirect'));
+
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS expiry_action TEXT,
+    ADD COLUMN IF NOT EXISTS expiry_fallback_url TEXT;
+
+ALTER TABLE accounts
+    ADD CONSTRAINT accounts_expiry_action_check
+        CHECK (expiry_action IN ('json', 'html', 'redirect'));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS links_archived_at_idx;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS archived_at;
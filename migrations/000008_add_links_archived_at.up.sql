@@ -0,0 +1,6 @@
+ALTER TABLE links
+    ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS links_archived_at_idx
+    ON links (archived_at)
+    WHERE archived_at IS NOT NULL;
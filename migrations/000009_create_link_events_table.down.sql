@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS link_events;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,21 @@
+ALTER TABLE links
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+-- No foreign key to links: history must outlive deleted links.
+CREATE TABLE IF NOT EXISTS link_events (
+    id              BIGSERIAL PRIMARY KEY,
+    link_id         BIGINT      NOT NULL,
+    link_code       TEXT        NOT NULL,
+    owner_public_id UUID,
+    actor_public_id UUID,
+    event_type      TEXT        NOT NULL,
+    old_value       JSONB,
+    new_value       JSONB,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT link_events_event_type_check
+        CHECK (event_type IN ('create', 'update', 'disable', 'delete'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_events_code_owner
+    ON link_events (link_code, owner_public_id, created_at);
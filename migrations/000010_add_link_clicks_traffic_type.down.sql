@@ -0,0 +1,5 @@
+ALTER TABLE link_clicks
+    DROP CONSTRAINT IF EXISTS link_clicks_traffic_type_check;
+
+ALTER TABLE link_clicks
+    DROP COLUMN IF EXISTS traffic_type;
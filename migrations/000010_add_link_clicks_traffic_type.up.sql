@@ -0,0 +1,7 @@
+-- Clicks recorded before classification was introduced are counted as human.
+ALTER TABLE link_clicks
+    ADD COLUMN IF NOT EXISTS traffic_type TEXT NOT NULL DEFAULT 'human';
+
+ALTER TABLE link_clicks
+    ADD CONSTRAINT link_clicks_traffic_type_check
+        CHECK (traffic_type IN ('human', 'bot', 'prefetch'));
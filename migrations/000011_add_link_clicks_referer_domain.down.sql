@@ -0,0 +1,2 @@
+ALTER TABLE link_clicks
+    DROP COLUMN IF EXISTS referer_domain;
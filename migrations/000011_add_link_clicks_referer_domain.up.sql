@@ -0,0 +1,13 @@
+ALTER TABLE link_clicks
+    ADD COLUMN IF NOT EXISTS referer_domain TEXT;
+
+-- Same normalization as refererDomain in internal/feature/analytics/referer.go:
+-- host of an absolute URL, lowercased, without userinfo, port, trailing dot and "www." prefix.
+UPDATE link_clicks
+SET referer_domain = NULLIF(
+        regexp_replace(
+            rtrim(btrim(lower(substring(btrim(referer) FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/?#]*@)?(\[[^]]*\]|[^:/?#]*)')), '[]'), '.'),
+            '^www\.', ''),
+        '')
+WHERE referer IS NOT NULL
+  AND referer <> '';
@@ -0,0 +1,4 @@
+ALTER TABLE link_clicks
+    DROP COLUMN IF EXISTS browser,
+    DROP COLUMN IF EXISTS os,
+    DROP COLUMN IF EXISTS device_class;
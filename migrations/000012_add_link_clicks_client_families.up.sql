@@ -0,0 +1,5 @@
+-- Filled at ingest from the User-Agent. Clicks stored before have NULLs and are reported as "unknown".
+ALTER TABLE link_clicks
+    ADD COLUMN IF NOT EXISTS browser      TEXT,
+    ADD COLUMN IF NOT EXISTS os           TEXT,
+    ADD COLUMN IF NOT EXISTS device_class TEXT;
@@ -0,0 +1,4 @@
+ALTER TABLE link_clicks
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS region,
+    DROP COLUMN IF EXISTS city;
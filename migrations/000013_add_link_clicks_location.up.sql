@@ -0,0 +1,5 @@
+-- Resolved at ingest from an offline GeoIP database. NULL when none is configured or the IP is unknown.
+ALTER TABLE link_clicks
+    ADD COLUMN IF NOT EXISTS country TEXT,
+    ADD COLUMN IF NOT EXISTS region  TEXT,
+    ADD COLUMN IF NOT EXISTS city    TEXT;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS click_rollup_stale_hours;
+DROP TABLE IF EXISTS click_rollup_state;
+DROP TABLE IF EXISTS link_click_rollups_daily;
+DROP TABLE IF EXISTS link_click_rollups_hourly;
@@ -0,0 +1,42 @@
+-- Click aggregates of whole UTC hours and days, maintained by the rollup worker.
+-- visitors is a HyperLogLog sketch of the clicking IPs (see internal/hll), so unique visitors
+-- of any range of hours or days are estimated by merging sketches.
+CREATE TABLE IF NOT EXISTS link_click_rollups_hourly (
+    link_id      BIGINT      NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    traffic_type TEXT        NOT NULL,
+    clicks       BIGINT      NOT NULL,
+    visitors     BYTEA       NOT NULL,
+    PRIMARY KEY (link_id, bucket_start, traffic_type)
+);
+
+CREATE TABLE IF NOT EXISTS link_click_rollups_daily (
+    link_id      BIGINT      NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    traffic_type TEXT        NOT NULL,
+    clicks       BIGINT      NOT NULL,
+    visitors     BYTEA       NOT NULL,
+    PRIMARY KEY (link_id, bucket_start, traffic_type)
+);
+
+-- Rollups cover every hour before rolled_up_until. It starts at the day of the first stored click,
+-- so the existing history is backfilled by the worker.
+CREATE TABLE IF NOT EXISTS click_rollup_state (
+    id              BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    rolled_up_until TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO click_rollup_state (rolled_up_until)
+SELECT COALESCE(
+           date_trunc('day', MIN(created_at) AT TIME ZONE 'UTC'),
+           date_trunc('hour', now() AT TIME ZONE 'UTC')
+       ) AT TIME ZONE 'UTC'
+FROM link_clicks
+ON CONFLICT DO NOTHING;
+
+-- Rolled up hours that received clicks afterwards, e.g. replayed from the click spool.
+CREATE TABLE IF NOT EXISTS click_rollup_stale_hours (
+    link_id      BIGINT      NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (link_id, bucket_start)
+);
@@ -0,0 +1,38 @@
+ALTER TABLE link_clicks RENAME TO link_clicks_partitioned;
+ALTER INDEX link_clicks_pkey RENAME TO link_clicks_partitioned_pkey;
+ALTER INDEX idx_link_clicks_link_date RENAME TO idx_link_clicks_partitioned_link_date;
+ALTER INDEX idx_link_clicks_link_ip_address RENAME TO idx_link_clicks_partitioned_link_ip_address;
+ALTER TABLE link_clicks_partitioned RENAME CONSTRAINT link_clicks_traffic_type_check TO link_clicks_partitioned_traffic_type_check;
+ALTER SEQUENCE link_clicks_id_seq OWNED BY NONE;
+
+CREATE TABLE link_clicks (
+    id             BIGINT PRIMARY KEY DEFAULT nextval('link_clicks_id_seq'),
+    link_id        BIGINT      NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    ip_address     INET,
+    user_agent     TEXT,
+    referer        TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    traffic_type   TEXT        NOT NULL DEFAULT 'human',
+    referer_domain TEXT,
+    browser        TEXT,
+    os             TEXT,
+    device_class   TEXT,
+    country        TEXT,
+    region         TEXT,
+    city           TEXT,
+
+    CONSTRAINT link_clicks_traffic_type_check
+        CHECK (traffic_type IN ('human', 'bot', 'prefetch'))
+);
+
+ALTER SEQUENCE link_clicks_id_seq OWNED BY link_clicks.id;
+
+INSERT INTO link_clicks
+SELECT id, link_id, ip_address, user_agent, referer, created_at, traffic_type, referer_domain,
+       browser, os, device_class, country, region, city
+FROM link_clicks_partitioned;
+
+CREATE INDEX idx_link_clicks_link_date ON link_clicks (link_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_link_clicks_link_ip_address ON link_clicks (link_id, ip_address);
+
+DROP TABLE link_clicks_partitioned;
@@ -0,0 +1,65 @@
+-- Range-partitions link_clicks by month (UTC), so retention drops whole partitions instead of deleting rows.
+-- Partitions are named link_clicks_pYYYY_MM and created ahead of time by the partition worker; clicks outside
+-- of every partition land in link_clicks_default. Existing clicks are copied, which takes a while on large tables.
+ALTER TABLE link_clicks RENAME TO link_clicks_unpartitioned;
+ALTER INDEX link_clicks_pkey RENAME TO link_clicks_unpartitioned_pkey;
+ALTER INDEX idx_link_clicks_link_date RENAME TO idx_link_clicks_unpartitioned_link_date;
+ALTER INDEX idx_link_clicks_link_ip_address RENAME TO idx_link_clicks_unpartitioned_link_ip_address;
+-- Keep the id sequence when the old table is dropped.
+ALTER SEQUENCE link_clicks_id_seq OWNED BY NONE;
+
+-- The primary key of a partitioned table must include the partition key.
+CREATE TABLE link_clicks (
+    id             BIGINT      NOT NULL DEFAULT nextval('link_clicks_id_seq'),
+    link_id        BIGINT      NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    ip_address     INET,
+    user_agent     TEXT,
+    referer        TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    traffic_type   TEXT        NOT NULL DEFAULT 'human',
+    referer_domain TEXT,
+    browser        TEXT,
+    os             TEXT,
+    device_class   TEXT,
+    country        TEXT,
+    region         TEXT,
+    city           TEXT,
+
+    PRIMARY KEY (id, created_at),
+    CONSTRAINT link_clicks_traffic_type_check
+        CHECK (traffic_type IN ('human', 'bot', 'prefetch'))
+) PARTITION BY RANGE (created_at);
+
+ALTER SEQUENCE link_clicks_id_seq OWNED BY link_clicks.id;
+
+CREATE INDEX idx_link_clicks_link_date ON link_clicks (link_id, created_at);
+CREATE INDEX idx_link_clicks_link_ip_address ON link_clicks (link_id, ip_address);
+
+CREATE TABLE link_clicks_default PARTITION OF link_clicks DEFAULT;
+
+-- Months of the existing clicks up to three months ahead.
+DO $$
+DECLARE
+    month TIMESTAMP;
+BEGIN
+    FOR month IN
+        SELECT generate_series(
+                   date_trunc('month', (SELECT COALESCE(MIN(created_at), now()) FROM link_clicks_unpartitioned) AT TIME ZONE 'UTC'),
+                   date_trunc('month', now() AT TIME ZONE 'UTC') + INTERVAL '3 months',
+                   INTERVAL '1 month')
+    LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF link_clicks FOR VALUES FROM (%L) TO (%L)',
+                       'link_clicks_p' || to_char(month, 'YYYY_MM'),
+                       month AT TIME ZONE 'UTC',
+                       (month + INTERVAL '1 month') AT TIME ZONE 'UTC');
+    END LOOP;
+END
+$$;
+
+INSERT INTO link_clicks (id, link_id, ip_address, user_agent, referer, created_at, traffic_type, referer_domain,
+                         browser, os, device_class, country, region, city)
+SELECT id, link_id, ip_address, user_agent, referer, created_at, traffic_type, referer_domain,
+       browser, os, device_class, country, region, city
+FROM link_clicks_unpartitioned;
+
+DROP TABLE link_clicks_unpartitioned;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_link_clicks_personal_data;
+DROP TABLE IF EXISTS ip_hash_salts;
+ALTER TABLE link_clicks DROP COLUMN IF EXISTS ip_hash;
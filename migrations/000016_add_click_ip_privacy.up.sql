@@ -0,0 +1,14 @@
+-- Pseudonymized visitor key of a click, set when IPs aren't stored as is (CLICK_IP_MODE=truncate or hash):
+-- a keyed hash of the full IP under the salt of its UTC day. Unique clicks count it instead of the IP.
+ALTER TABLE link_clicks ADD COLUMN IF NOT EXISTS ip_hash TEXT;
+
+-- Random salts of the IP hashes, one per UTC day. A salt is deleted once its day is over,
+-- after which the hashes of that day can't be linked to IPs anymore.
+CREATE TABLE IF NOT EXISTS ip_hash_salts (
+    day  DATE  PRIMARY KEY,
+    salt BYTEA NOT NULL
+);
+
+-- Clicks that still hold personal data, for the retention worker to find them without scanning old partitions.
+CREATE INDEX IF NOT EXISTS idx_link_clicks_personal_data ON link_clicks (created_at)
+    WHERE ip_address IS NOT NULL OR user_agent IS NOT NULL OR referer IS NOT NULL;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS link_visitors;
+DROP INDEX IF EXISTS idx_link_clicks_personal_data;
+CREATE INDEX IF NOT EXISTS idx_link_clicks_personal_data ON link_clicks (created_at)
+    WHERE ip_address IS NOT NULL OR user_agent IS NOT NULL OR referer IS NOT NULL;
+ALTER TABLE link_clicks DROP COLUMN IF EXISTS visitor_id;
@@ -0,0 +1,30 @@
+-- Visitor of a click as identified by VISITOR_ID_STRATEGY: the visitor cookie, a hash of IP and User-Agent,
+-- or the IP (hash). Unique visitors count it, falling back to the IP of clicks stored before.
+ALTER TABLE link_clicks ADD COLUMN IF NOT EXISTS visitor_id TEXT;
+
+-- Clicks still holding personal data now include the ones with a visitor ID.
+DROP INDEX IF EXISTS idx_link_clicks_personal_data;
+CREATE INDEX IF NOT EXISTS idx_link_clicks_personal_data ON link_clicks (created_at)
+    WHERE ip_address IS NOT NULL OR user_agent IS NOT NULL OR referer IS NOT NULL OR visitor_id IS NOT NULL;
+
+-- First and last click of every visitor of a link, which tell first-time from returning visitors
+-- without scanning the click history.
+CREATE TABLE IF NOT EXISTS link_visitors (
+    link_id       BIGINT      NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    visitor_id    TEXT        NOT NULL,
+    traffic_type  TEXT        NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (link_id, visitor_id, traffic_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_visitors_link_first_seen ON link_visitors (link_id, first_seen_at);
+CREATE INDEX IF NOT EXISTS idx_link_visitors_last_seen ON link_visitors (last_seen_at);
+
+-- Visitors of the existing clicks, identified by IP.
+INSERT INTO link_visitors (link_id, visitor_id, traffic_type, first_seen_at, last_seen_at)
+SELECT link_id, COALESCE(ip_hash, host(ip_address)), traffic_type, MIN(created_at), MAX(created_at)
+FROM link_clicks
+WHERE COALESCE(ip_hash, host(ip_address)) IS NOT NULL
+GROUP BY 1, 2, 3
+ON CONFLICT DO NOTHING;
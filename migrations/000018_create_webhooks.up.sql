@@ -0,0 +1,43 @@
+-- Webhook endpoints of accounts. secret signs the deliveries; click_sample_rate is the share of
+-- link.clicked events delivered to the endpoint.
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id                BIGSERIAL PRIMARY KEY,
+    public_id         UUID             NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+    account_public_id UUID             NOT NULL REFERENCES accounts (public_id) ON DELETE CASCADE,
+    url               TEXT             NOT NULL,
+    secret            TEXT             NOT NULL,
+    events            TEXT[]           NOT NULL,
+    click_sample_rate DOUBLE PRECISION NOT NULL DEFAULT 1,
+    created_at        TIMESTAMPTZ      NOT NULL DEFAULT now(),
+
+    CONSTRAINT webhook_endpoints_click_sample_rate_check
+        CHECK (click_sample_rate > 0 AND click_sample_rate <= 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_account ON webhook_endpoints (account_public_id);
+
+-- Delivery queue and log: one row per event and endpoint. Pending deliveries are sent once
+-- next_attempt_at is due; after the last failed attempt they are kept as dead letters.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    endpoint_id      BIGINT      NOT NULL REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+    event_id         UUID        NOT NULL,
+    event_type       TEXT        NOT NULL,
+    payload          JSONB       NOT NULL,
+    status           TEXT        NOT NULL DEFAULT 'pending',
+    attempts         INT         NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_attempt_at  TIMESTAMPTZ,
+    last_status_code INT,
+    last_error       TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at     TIMESTAMPTZ,
+
+    CONSTRAINT webhook_deliveries_status_check
+        CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+    ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries (endpoint_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS conversions;
+DROP TABLE IF EXISTS api_keys;
+DROP INDEX IF EXISTS idx_link_clicks_personal_data;
+CREATE INDEX IF NOT EXISTS idx_link_clicks_personal_data ON link_clicks (created_at)
+    WHERE ip_address IS NOT NULL OR user_agent IS NOT NULL OR referer IS NOT NULL OR visitor_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_link_clicks_click_id;
+ALTER TABLE link_clicks DROP COLUMN IF EXISTS click_id;
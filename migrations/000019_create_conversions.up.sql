@@ -0,0 +1,48 @@
+-- Click ID handed to the destination on redirect (CLICK_ID_MODE), which conversions are attributed to.
+ALTER TABLE link_clicks ADD COLUMN IF NOT EXISTS click_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_link_clicks_click_id ON link_clicks (click_id) WHERE click_id IS NOT NULL;
+
+-- The click ID ties a click to what the visitor did on the destination, so it's personal data as well.
+DROP INDEX IF EXISTS idx_link_clicks_personal_data;
+CREATE INDEX IF NOT EXISTS idx_link_clicks_personal_data ON link_clicks (created_at)
+    WHERE ip_address IS NOT NULL OR user_agent IS NOT NULL OR referer IS NOT NULL OR visitor_id IS NOT NULL
+       OR click_id IS NOT NULL;
+
+-- API keys of accounts, for server-to-server calls such as conversion postbacks. Only a SHA-256 hash
+-- of the key is stored; key_prefix tells keys apart in listings.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id                BIGSERIAL PRIMARY KEY,
+    public_id         UUID        NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+    account_public_id UUID        NOT NULL REFERENCES accounts (public_id) ON DELETE CASCADE,
+    name              TEXT        NOT NULL DEFAULT '',
+    key_prefix        TEXT        NOT NULL,
+    key_hash          TEXT        NOT NULL UNIQUE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_account ON api_keys (account_public_id);
+
+-- Conversions attributed to a click of a link. external_id is the caller's id of the conversion
+-- (e.g. an order number) that makes repeated postbacks idempotent.
+CREATE TABLE IF NOT EXISTS conversions (
+    id                BIGSERIAL PRIMARY KEY,
+    public_id         UUID           NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+    account_public_id UUID           NOT NULL REFERENCES accounts (public_id) ON DELETE CASCADE,
+    link_id           BIGINT         NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    click_id          UUID           NOT NULL,
+    clicked_at        TIMESTAMPTZ    NOT NULL,
+    event_name        TEXT           NOT NULL,
+    value             NUMERIC(20, 4),
+    currency          CHAR(3),
+    external_id       TEXT,
+    created_at        TIMESTAMPTZ    NOT NULL DEFAULT now(),
+
+    CONSTRAINT conversions_value_check
+        CHECK ((value IS NULL AND currency IS NULL) OR (value >= 0 AND currency IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversions_external_id
+    ON conversions (account_public_id, external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_conversions_link_created_at ON conversions (link_id, created_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_link_events_link_id;
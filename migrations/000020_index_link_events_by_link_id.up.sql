@@ -0,0 +1,3 @@
+-- History is read by link id; link_code/owner_public_id only resolve deleted links.
+CREATE INDEX IF NOT EXISTS idx_link_events_link_id
+    ON link_events (link_id, created_at, id);
@@ -0,0 +1,8 @@
+-- Click events the database refused to store (invalid data, constraint violations).
+-- payload is the click event as spooled (JSON); BYTEA accepts what TEXT/JSONB might reject.
+CREATE TABLE IF NOT EXISTS link_click_dead_letters (
+    id         BIGSERIAL PRIMARY KEY,
+    payload    BYTEA       NOT NULL,
+    error      TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_link_clicks_created_at;
+ALTER TABLE click_rollup_state DROP COLUMN IF EXISTS rolling_up_hour;
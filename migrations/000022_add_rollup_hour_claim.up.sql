@@ -0,0 +1,7 @@
+-- The hour being rolled up: late clicks of it are marked stale while the rollup reads the clicks
+-- without locking the state row.
+ALTER TABLE click_rollup_state
+    ADD COLUMN IF NOT EXISTS rolling_up_hour TIMESTAMPTZ;
+
+-- Rollups aggregate whole hours of all links.
+CREATE INDEX IF NOT EXISTS idx_link_clicks_created_at ON link_clicks (created_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_endpoint_event;
@@ -0,0 +1,10 @@
+-- Event ids are derived from the rows the events are about, so an event queued again
+-- (a retried enqueue or clicks replayed from the spool) is skipped instead of delivered twice.
+DELETE FROM webhook_deliveries d
+USING webhook_deliveries k
+WHERE d.endpoint_id = k.endpoint_id
+  AND d.event_id = k.event_id
+  AND d.id > k.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_event
+    ON webhook_deliveries (endpoint_id, event_id);
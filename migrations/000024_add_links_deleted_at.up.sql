@@ -0,0 +1,8 @@
+-- A deleted link is detached from its code and account at once and marked here until its clicks are purged,
+-- so a failed purge never leaves a link without its clicks.
+ALTER TABLE links
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS links_deleted_at_idx
+    ON links (deleted_at)
+    WHERE deleted_at IS NOT NULL;
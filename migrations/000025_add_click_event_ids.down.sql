@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_link_clicks_event_id;
+
+ALTER TABLE link_clicks
+    DROP COLUMN IF EXISTS event_id;
@@ -0,0 +1,7 @@
+-- Id of the tracked click event. Clicks replayed from the spool after a partly stored batch have the ids
+-- of the stored ones and are skipped, so they are neither counted nor rolled up twice.
+-- The unique index of a partitioned table must include the partition key; a replayed click keeps its time.
+ALTER TABLE link_clicks
+    ADD COLUMN IF NOT EXISTS event_id UUID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_link_clicks_event_id ON link_clicks (event_id, created_at);